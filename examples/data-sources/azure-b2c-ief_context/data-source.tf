@@ -0,0 +1,9 @@
+data "azure_b2c_ief_context" "current" {}
+
+output "b2c_tenant" {
+  value = data.azure_b2c_ief_context.current.tenant_id
+}
+
+output "graph_base_url" {
+  value = data.azure_b2c_ief_context.current.graph_base_url
+}
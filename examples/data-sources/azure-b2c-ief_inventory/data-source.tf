@@ -0,0 +1,14 @@
+data "azure_b2c_ief_inventory" "tenant" {}
+
+# Adopt every existing key container and policy
+import {
+  for_each = { for item in data.azure_b2c_ief_inventory.tenant.items : item.name => item.id if item.type == "policy_key" }
+  to       = azure_b2c_ief_policy_key.imported[each.key]
+  id       = each.value
+}
+
+import {
+  for_each = { for item in data.azure_b2c_ief_inventory.tenant.items : item.name => item.id if item.type == "policy" }
+  to       = azure_b2c_ief_policy.imported[each.key]
+  id       = each.value
+}
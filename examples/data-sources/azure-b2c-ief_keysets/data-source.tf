@@ -0,0 +1,6 @@
+data "azure_b2c_ief_keysets" "all" {}
+
+# Empty key containers left behind by failed applies, ready to be removed
+output "empty_keysets" {
+  value = [for k in data.azure_b2c_ief_keysets.all.keysets : k.id if k.keys_count == 0]
+}
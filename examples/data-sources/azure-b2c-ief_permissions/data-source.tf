@@ -0,0 +1,5 @@
+data "azure_b2c_ief_permissions" "current" {}
+
+output "missing_graph_permissions" {
+  value = data.azure_b2c_ief_permissions.current.missing_roles
+}
@@ -0,0 +1,5 @@
+data "azure_b2c_ief_ping" "check" {}
+
+output "graph_reachable" {
+  value = data.azure_b2c_ief_ping.check.ok
+}
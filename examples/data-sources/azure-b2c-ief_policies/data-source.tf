@@ -0,0 +1,27 @@
+data "azure_b2c_ief_policies" "sign_up" {
+  filter = "startswith(id, 'B2C_1A_SignUp')"
+}
+
+output "sign_up_policies" {
+  value = data.azure_b2c_ief_policies.sign_up.ids
+}
+
+# Read extra fields Graph returns for each policy
+data "azure_b2c_ief_policies" "modified" {
+  select = "lastModifiedDateTime"
+}
+
+output "policies_modified_at" {
+  value = { for id, fields in data.azure_b2c_ief_policies.modified.policies : id => jsondecode(fields).lastModifiedDateTime }
+}
+
+# Download every policy body as well, e.g. for a backup
+data "azure_b2c_ief_policies" "backup" {
+  include_xml = true
+}
+
+resource "local_file" "policy_backup" {
+  for_each = data.azure_b2c_ief_policies.backup.xml
+  filename = "backup/${each.key}.xml"
+  content  = each.value
+}
@@ -0,0 +1,9 @@
+data "azure_b2c_ief_policy" "signup_signin" {
+  policy_id = "B2C_1A_SignUpOrSignIn"
+}
+
+# Save a portal-authored policy so it can be managed from the file
+resource "local_file" "signup_signin" {
+  filename = "${path.module}/policies/SignUpOrSignIn.xml"
+  content  = data.azure_b2c_ief_policy.signup_signin.xml
+}
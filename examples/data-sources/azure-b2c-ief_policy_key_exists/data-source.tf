@@ -0,0 +1,15 @@
+data "azure_b2c_ief_policy_key_exists" "signing" {
+  name = "B2C_1A_TokenSigningKeyContainer"
+}
+
+# Only create the signing key when the tenant does not have one yet
+resource "azure_b2c_ief_policy_key" "token_signing" {
+  count = data.azure_b2c_ief_policy_key_exists.signing.exists ? 0 : 1
+
+  name  = "B2C_1A_TokenSigningKeyContainer"
+  usage = "sig"
+
+  generate {
+    type = "RSA"
+  }
+}
@@ -0,0 +1,10 @@
+data "azure_b2c_ief_policy_key_public" "token_signing" {
+  name = "B2C_1A_TokenSigningKeyContainer"
+}
+
+# JWKS for a downstream service that validates B2C tokens
+output "token_signing_jwks" {
+  value = jsonencode({
+    keys = [jsondecode(data.azure_b2c_ief_policy_key_public.token_signing.jwk)]
+  })
+}
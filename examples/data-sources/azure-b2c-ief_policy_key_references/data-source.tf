@@ -0,0 +1,8 @@
+data "azure_b2c_ief_policy_key_references" "token_signing" {
+  name = "B2C_1A_TokenSigningKeyContainer"
+}
+
+# Policies that break if the key container is deleted
+output "token_signing_key_users" {
+  value = data.azure_b2c_ief_policy_key_references.token_signing.policy_ids
+}
@@ -3,3 +3,18 @@ provider "azure_b2c_ief" {
   client_id     = "00000000-0000-0000-0000-000000000000"
   client_secret = var.client_secret
 }
+
+# Manage several tenants from one configuration with provider aliases. Each
+# alias has its own credentials and Graph client.
+provider "azure_b2c_ief" {
+  alias         = "staging"
+  tenant_id     = "yourtenant-staging.onmicrosoft.com"
+  client_id     = "11111111-1111-1111-1111-111111111111"
+  client_secret = var.staging_client_secret
+}
+
+resource "azure_b2c_ief_policy" "staging_base" {
+  provider = azure_b2c_ief.staging
+  file     = "policies/TrustFrameworkBase.xml"
+  publish  = true
+}
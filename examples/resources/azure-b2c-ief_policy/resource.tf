@@ -7,3 +7,60 @@ resource "azure_b2c_ief_policy" "signup_signin" {
     ai_connection_string = "InstrumentationKey=00000000-0000-0000-0000-000000000000"
   }
 }
+
+# One resource for every environment, selected per workspace
+resource "azure_b2c_ief_policy" "password_reset" {
+  file        = "policy.xml"
+  publish     = true
+  environment = terraform.workspace
+
+  app_settings_by_environment = {
+    default = {
+      tenant_name          = "yourtenant"
+      ai_connection_string = "InstrumentationKey=00000000-0000-0000-0000-000000000000"
+    }
+    dev = {
+      tenant_name = "yourtenant-dev"
+    }
+  }
+}
+
+# Rotate the signing key by bumping key_id. The policy's triggers reference
+# the key's active_kid, so the same apply uploads the policy again once the
+# new key is active.
+resource "azure_b2c_ief_policy_key" "token_signing" {
+  name  = "B2C_1A_TokenSigningKeyContainer"
+  usage = "sig"
+
+  generate {
+    type   = "RSA"
+    key_id = "signing-2026"
+  }
+}
+
+resource "azure_b2c_ief_policy" "trust_framework_base" {
+  file    = "policy.xml"
+  publish = true
+
+  triggers = {
+    signing_kid = azure_b2c_ief_policy_key.token_signing.active_kid
+  }
+}
+
+# The extension references the base policy's id, so Terraform uploads the
+# base first without depends_on
+resource "azure_b2c_ief_policy" "trust_framework_extensions" {
+  file    = "TrustFrameworkExtensions.xml"
+  publish = true
+
+  triggers = {
+    base_policy = azure_b2c_ief_policy.trust_framework_base.id
+  }
+
+  lifecycle {
+    postcondition {
+      condition     = self.base_policy_id == azure_b2c_ief_policy.trust_framework_base.id
+      error_message = "TrustFrameworkExtensions.xml does not build on the managed base policy."
+    }
+  }
+}
@@ -18,3 +18,43 @@ resource "azure_b2c_ief_policy_key" "facebook_secret" {
     value_version = 1
   }
 }
+
+# Upload a client secret that Azure AD B2C should stop using when it expires
+resource "azure_b2c_ief_policy_key" "idp_secret" {
+  name  = "B2C_1A_IdpClientSecret"
+  usage = "sig"
+
+  upload = {
+    value         = var.idp_client_secret
+    value_version = 1
+    not_before    = "2026-01-01T00:00:00Z"
+    expires       = "2027-01-01T00:00:00Z"
+  }
+}
+
+# Changing usage replaces the key container. Renaming it in the same change
+# with create_before_destroy creates the new container before the old one is
+# deleted, so policies never reference a missing key.
+resource "azure_b2c_ief_policy_key" "encryption" {
+  name  = "B2C_1A_TokenEncryptionKeyContainerV2"
+  usage = "enc"
+
+  generate = {
+    type = "RSA"
+  }
+
+  lifecycle {
+    create_before_destroy = true
+  }
+}
+
+# Reference the key container from a policy. Using the key's id in
+# app_settings also makes Terraform create the key before the policy.
+resource "azure_b2c_ief_policy" "extensions" {
+  file    = "TrustFrameworkExtensions.xml"
+  publish = true
+
+  app_settings = {
+    token_signing_key = azure_b2c_ief_policy_key.token_signing.id
+  }
+}
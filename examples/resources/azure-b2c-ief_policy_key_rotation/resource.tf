@@ -0,0 +1,28 @@
+variable "shared_signing_secret" {
+  type      = string
+  sensitive = true
+}
+
+# Upload the same signing secret to several containers in one apply. Bump
+# value_version to rotate all of them again.
+resource "azure_b2c_ief_policy_key_rotation" "signing" {
+  containers = [
+    "B2C_1A_ApiSigningSecret",
+    "B2C_1A_WebhookSigningSecret",
+  ]
+  usage         = "sig"
+  value_version = 3
+  upload_value  = var.shared_signing_secret
+}
+
+# Or generate a fresh RSA key in each container
+resource "azure_b2c_ief_policy_key_rotation" "token_signing" {
+  containers    = ["B2C_1A_TokenSigningKeyContainer", "B2C_1A_LegacyTokenSigningKeyContainer"]
+  usage         = "sig"
+  value_version = 1
+
+  generate {
+    type           = "RSA"
+    valid_for_days = 365
+  }
+}
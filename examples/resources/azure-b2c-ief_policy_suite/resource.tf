@@ -0,0 +1,31 @@
+# Upload the starter pack in one batch, base policies first
+resource "azure_b2c_ief_policy_suite" "starter_pack" {
+  policies = [
+    {
+      file = "TrustFrameworkBase.xml"
+      app_settings = {
+        tenant_name = "yourtenant"
+      }
+    },
+    {
+      file = "TrustFrameworkExtensions.xml"
+      app_settings = {
+        tenant_name = "yourtenant"
+      }
+    },
+    {
+      file = "SignUpOrSignin.xml"
+      app_settings = {
+        tenant_name = "yourtenant"
+      }
+    },
+  ]
+}
+
+# Or upload every policy in a directory; base policies are ordered first
+resource "azure_b2c_ief_policy_suite" "from_directory" {
+  glob = "policies/*.xml"
+  app_settings = {
+    tenant_name = "yourtenant"
+  }
+}
@@ -2,62 +2,709 @@ package provider
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-log/tflog"
 )
 
+// defaultMaxBodyBytes caps how much of a Graph response body is read into memory
+const defaultMaxBodyBytes int64 = 10 * 1024 * 1024
+
+const (
+	defaultEnvironment  = "public"
+	defaultGraphBaseURL = "https://graph.microsoft.com"
+)
+
+// b2cNotFoundCode is the B2C error code Graph answers with when a keyset or
+// policy does not exist, sometimes with a status other than 404
+const b2cNotFoundCode = "AADB2C90073"
+
+// ErrNotFound is returned by readGraph and readGraphXML when Graph reports
+// that the requested object does not exist
+var ErrNotFound = errors.New("object not found in Graph")
+
+// graphDoer sends a single request to Graph. GraphClient sends requests
+// itself unless doer is set, which tests use to substitute a fake so
+// resource CRUD can run without a tenant.
+type graphDoer interface {
+	doGraph(ctx context.Context, method, url string, body any) (*http.Response, error)
+	doGraphXML(ctx context.Context, method, url string, body *string) (*http.Response, error)
+	doGraphXMLGzip(ctx context.Context, method, url string, body string) (*http.Response, error)
+}
+
 type GraphClient struct {
-	tenantId   string
-	credential *azidentity.ClientSecretCredential
-	client     *http.Client
+	tenantId     string
+	clientId     string
+	credential   azcore.TokenCredential
+	client       *http.Client
+	maxBodyBytes int64
+	environment  string
+	graphBaseURL string
+	extraHeaders map[string]string
+	doer         graphDoer
+	// v1Unsupported is set once Graph v1.0 reports it does not serve the
+	// Trust Framework API, so later reads go straight to beta
+	v1Unsupported atomic.Bool
+	// compressUploads gzips policy uploads. It is cleared once Graph rejects
+	// a gzipped body that it accepts uncompressed.
+	compressUploads atomic.Bool
+	// readOnly refuses every request that could change the tenant
+	readOnly bool
+	// keyPollTimeout bounds how long a generated key is polled for before
+	// it is assumed to be available; zero disables polling
+	keyPollTimeout  time.Duration
+	keyPollInterval time.Duration
+	// xmlContentType is the Content-Type sent with policy XML
+	xmlContentType string
+	// requestTimeout bounds each Graph request and the configure-time
+	// token check
+	requestTimeout time.Duration
+	// publishPollTimeout bounds how long a newly published policy is polled
+	// for until Graph serves it; zero disables polling
+	publishPollTimeout  time.Duration
+	publishPollInterval time.Duration
+	// trustFrameworkSegment replaces the trustFramework path segment in
+	// policy and keyset URLs when set
+	trustFrameworkSegment string
+	// debugEmitCurl logs failed requests as curl commands
+	debugEmitCurl bool
+	// uploadPrefer is the Prefer header sent with policy uploads, if any
+	uploadPrefer string
+	// apiVersion is the Graph API version every request uses when pinned by
+	// graph_api_version; empty keeps beta writes and v1.0-first reads
+	apiVersion string
+	// retryBudget bounds the total time every request of the run together
+	// may wait before retrying; zero is unlimited. retryWaited is the time
+	// spent so far, in nanoseconds.
+	retryBudget time.Duration
+	retryWaited atomic.Int64
+	// postWriteDelay is waited after every successful write, to give Graph
+	// time to become consistent before the next request; zero disables it
+	postWriteDelay time.Duration
+	// setPolicyTenantId rewrites the TenantId of every rendered policy to
+	// tenantId
+	setPolicyTenantId bool
+	// policyIdFiles maps each PolicyId validated for this provider instance,
+	// upper-cased as B2C IDs are case-insensitive, to the policy file that
+	// declared it first
+	policyIdFilesMu sync.Mutex
+	policyIdFiles   map[string]string
+}
+
+// GraphClientOptions holds optional settings for NewGraphClient.
+// Zero values fall back to the provider defaults.
+type GraphClientOptions struct {
+	MaxBodyBytes          int64
+	ExtraHeaders          map[string]string
+	GraphBaseURL          string
+	InsecureSkipTLSVerify bool
+	SkipCredentialCheck   bool
+	CompressUploads       bool
+	ReadOnly              bool
+	TrustFrameworkSegment string
+	// KeyPollTimeout and KeyPollInterval control waiting for a generated key
+	// to be listed; a zero timeout disables it
+	KeyPollTimeout  time.Duration
+	KeyPollInterval time.Duration
+	// XMLContentType replaces application/xml on policy XML requests
+	XMLContentType string
+	// RequestTimeout bounds each Graph request and the token check made
+	// while configuring; zero uses defaultRequestTimeout
+	RequestTimeout time.Duration
+	// PublishPollTimeout and PublishPollInterval control waiting for a
+	// created policy to be retrievable; a zero timeout disables it
+	PublishPollTimeout  time.Duration
+	PublishPollInterval time.Duration
+	// AccessToken is used as-is instead of requesting tokens with the
+	// client secret
+	AccessToken string
+	// DebugEmitCurl logs failed requests as curl commands
+	DebugEmitCurl bool
+	// UploadPrefer is sent as the Prefer header of policy uploads
+	UploadPrefer string
+	// APIVersion pins the Graph API version of every request
+	APIVersion string
+	// DisableHTTP2 restricts Graph requests to HTTP/1.1
+	DisableHTTP2 bool
+	// IdleConnTimeout and MaxIdleConnsPerHost tune keep-alive connection
+	// reuse; zero keeps the net/http defaults
+	IdleConnTimeout     time.Duration
+	MaxIdleConnsPerHost int
+	// RetryBudget bounds the total wait before retries across all
+	// requests; zero is unlimited
+	RetryBudget time.Duration
+	// PostWriteDelay is waited after every successful write request
+	PostWriteDelay time.Duration
+	// SetPolicyTenantId rewrites the TenantId of rendered policies to the
+	// tenant the client is configured for
+	SetPolicyTenantId bool
+}
+
+// staticTokenCredential hands out a pre-fetched token. It cannot refresh it.
+type staticTokenCredential struct {
+	token string
+}
+
+func (s staticTokenCredential) GetToken(_ context.Context, _ policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: s.token}, nil
 }
 
-func NewGraphClient(ctx context.Context, tenantId string, clientId string, clientSecret string) (*GraphClient, error) {
-	client := &http.Client{Timeout: 10 * time.Second}
-	tflog.Debug(ctx, fmt.Sprintf("Current secret: %s", clientSecret))
-	credential, err := azidentity.NewClientSecretCredential(tenantId, clientId, clientSecret, nil)
+// microsoftGraphHosts are the real Graph endpoints across the Azure clouds,
+// mapped to the cloud environment each serves. TLS verification can never be
+// disabled against these.
+var microsoftGraphHosts = map[string]string{
+	"graph.microsoft.com":             defaultEnvironment,
+	"graph.microsoft.us":              "usgovernment",
+	"dod-graph.microsoft.us":          "usgovernmentdod",
+	"microsoftgraph.chinacloudapi.cn": "china",
+}
+
+func isMicrosoftGraphHost(baseURL string) bool {
+	u, err := url.Parse(baseURL)
 	if err != nil {
-		tflog.Error(context.Background(), "Credential failed", map[string]any{
-			"error": err.Error(),
+		return false
+	}
+	_, ok := microsoftGraphHosts[strings.ToLower(u.Hostname())]
+	return ok
+}
+
+// graphEnvironment returns the cloud environment baseURL belongs to. Other
+// hosts, such as a mock Graph, count as public, as tokenScope treats them.
+func graphEnvironment(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return defaultEnvironment
+	}
+	if env, ok := microsoftGraphHosts[strings.ToLower(u.Hostname())]; ok {
+		return env
+	}
+	return defaultEnvironment
+}
+
+func NewGraphClient(ctx context.Context, tenantId string, clientId string, clientSecret string, opts GraphClientOptions) (*GraphClient, error) {
+	graphBaseURL := strings.TrimSuffix(opts.GraphBaseURL, "/")
+	if graphBaseURL == "" {
+		graphBaseURL = defaultGraphBaseURL
+	}
+
+	requestTimeout := opts.RequestTimeout
+	if requestTimeout <= 0 {
+		requestTimeout = defaultRequestTimeout
+	}
+	transport := newTransport(opts)
+	client := &http.Client{Timeout: requestTimeout, Transport: transport}
+	if opts.InsecureSkipTLSVerify {
+		if isMicrosoftGraphHost(graphBaseURL) {
+			return nil, fmt.Errorf("insecure_skip_tls_verify cannot be used against %s; it is only for test harnesses pointing graph_base_url at a mock Graph", graphBaseURL)
+		}
+		tflog.Warn(ctx, "⚠️ TLS CERTIFICATE VERIFICATION IS DISABLED: insecure_skip_tls_verify is set. Never use this outside of test harnesses.", map[string]any{
+			"graph_base_url": graphBaseURL,
 		})
-		return nil, err
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 	}
+	return newGraphClient(ctx, tenantId, clientId, clientSecret, opts, client)
+}
+
+// newGraphClient builds a GraphClient that sends every Graph request through
+// client as-is, for tests and wrappers that need their own transport, e.g.
+// for mTLS or tracing. The transport options in opts are ignored, and
+// client's Timeout bounds each request unless opts.RequestTimeout is set.
+// Token requests still use the identity library's own transport.
+func newGraphClient(ctx context.Context, tenantId string, clientId string, clientSecret string, opts GraphClientOptions, client *http.Client) (*GraphClient, error) {
+	graphBaseURL := strings.TrimSuffix(opts.GraphBaseURL, "/")
+	if graphBaseURL == "" {
+		graphBaseURL = defaultGraphBaseURL
+	}
+
+	requestTimeout := opts.RequestTimeout
+	if requestTimeout <= 0 {
+		requestTimeout = client.Timeout
+	}
+	if requestTimeout <= 0 {
+		requestTimeout = defaultRequestTimeout
+	}
+	var credential azcore.TokenCredential
+	if opts.AccessToken != "" {
+		tflog.Warn(ctx, "Using the configured graph_access_token; it will not be refreshed when it expires")
+		credential = staticTokenCredential{token: opts.AccessToken}
+	} else {
+		secretCredential, err := azidentity.NewClientSecretCredential(tenantId, clientId, clientSecret, nil)
+		if err != nil {
+			tflog.Error(context.Background(), "Credential failed", map[string]any{
+				"error": err.Error(),
+			})
+			return nil, err
+		}
+		credential = secretCredential
+	}
+
+	maxBodyBytes := opts.MaxBodyBytes
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = defaultMaxBodyBytes
+	}
+	xmlContentType := opts.XMLContentType
+	if xmlContentType == "" {
+		xmlContentType = defaultXMLContentType
+	}
+
+	c := &GraphClient{
+		tenantId:              tenantId,
+		clientId:              clientId,
+		credential:            credential,
+		client:                client,
+		maxBodyBytes:          maxBodyBytes,
+		environment:           graphEnvironment(graphBaseURL),
+		graphBaseURL:          graphBaseURL,
+		extraHeaders:          maps.Clone(opts.ExtraHeaders),
+		readOnly:              opts.ReadOnly,
+		requestTimeout:        requestTimeout,
+		xmlContentType:        xmlContentType,
+		keyPollTimeout:        opts.KeyPollTimeout,
+		keyPollInterval:       opts.KeyPollInterval,
+		publishPollTimeout:    opts.PublishPollTimeout,
+		publishPollInterval:   opts.PublishPollInterval,
+		trustFrameworkSegment: strings.Trim(opts.TrustFrameworkSegment, "/"),
+		debugEmitCurl:         opts.DebugEmitCurl,
+		uploadPrefer:          opts.UploadPrefer,
+		apiVersion:            opts.APIVersion,
+		retryBudget:           opts.RetryBudget,
+		postWriteDelay:        opts.PostWriteDelay,
+		setPolicyTenantId:     opts.SetPolicyTenantId,
+	}
+	c.compressUploads.Store(opts.CompressUploads)
+
+	if opts.SkipCredentialCheck {
+		tflog.Debug(ctx, "Skipping credential validation, the token will be requested on first use")
+		return c, nil
+	}
+
 	//Check for errors getting token before reporting success
-	_, err = credential.GetToken(ctx, policy.TokenRequestOptions{
-		Scopes: []string{"https://graph.microsoft.com/.default"},
-	})
-	if err != nil {
-		tflog.Error(context.Background(), "Credential failed on token create!", map[string]any{
+	if err := c.checkCredential(ctx); err != nil {
+		tflog.Error(ctx, "Credential failed on token create!", map[string]any{
 			"error": err.Error(),
 		})
 		return nil, err
 	}
 
 	tflog.Debug(ctx, "Success getting default credential!")
-	return &GraphClient{
-		tenantId:   tenantId,
-		credential: credential,
-		client:     client,
-	}, nil
+	return c, nil
+}
+
+// newTransport builds the transport for Graph requests. HTTP/2 is negotiated
+// over TLS unless opts disables it.
+func newTransport(opts GraphClientOptions) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(!opts.DisableHTTP2)
+	transport.Protocols = protocols
+	if opts.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = opts.IdleConnTimeout
+	}
+	if opts.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	}
+	return transport
+}
+
+// defaultXMLContentType is what Graph's policy $value endpoint expects
+const defaultXMLContentType = "application/xml"
+
+// withPolicyTenant sets the TenantId of a rendered policy to the configured
+// tenant when set_policy_tenant_id is enabled. A nil client, e.g. while
+// planning before the provider is configured, leaves the policy unchanged.
+func (c *GraphClient) withPolicyTenant(policyXml string) string {
+	if c == nil || !c.setPolicyTenantId {
+		return policyXml
+	}
+	return withTenantId(policyXml, c.tenantId)
+}
+
+// prefersRepresentation reports whether policy uploads ask Graph to return
+// the stored policy
+func (c *GraphClient) prefersRepresentation() bool {
+	for _, pref := range strings.Split(c.uploadPrefer, ",") {
+		if strings.EqualFold(strings.TrimSpace(pref), "return=representation") {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultRequestTimeout applies when request_timeout_seconds is not set
+const defaultRequestTimeout = 10 * time.Second
+
+// checkCredential requests a token to prove the credentials work. The token
+// request uses the identity client's own transport, so it is bounded here by
+// the request timeout and stops as soon as ctx is cancelled.
+func (c *GraphClient) checkCredential(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+	_, err := c.getToken(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("token request did not complete within %s; check network access to the identity endpoint or raise request_timeout_seconds: %w", c.requestTimeout, err)
+	}
+	return err
+}
+
+// Graph API versions. Unless graph_api_version pins one, writes such as
+// generateKey and uploadSecret go to beta, where they are documented, and
+// reads try v1.0 first.
+const (
+	graphVersionV1   = "v1.0"
+	graphVersionBeta = "beta"
+)
+
+// writeVersion is the Graph API version requests built by endpoint use
+func (c *GraphClient) writeVersion() string {
+	if c.apiVersion != "" {
+		return c.apiVersion
+	}
+	return graphVersionBeta
+}
+
+// endpoint builds a Graph API URL, on beta unless graph_api_version pins
+// another version, from a path format and its arguments
+func (c *GraphClient) endpoint(format string, args ...any) string {
+	return c.versionedEndpoint(c.writeVersion(), format, args...)
+}
+
+// defaultTrustFrameworkSegment is the path segment every policy and keyset
+// path starts with
+const defaultTrustFrameworkSegment = "trustFramework"
+
+func (c *GraphClient) versionedEndpoint(version string, format string, args ...any) string {
+	return c.graphBaseURL + "/" + version + c.trustFrameworkPath(fmt.Sprintf(format, args...))
+}
+
+// trustFrameworkPath swaps the leading trustFramework segment of a relative
+// Graph path for the configured one, leaving other paths untouched
+func (c *GraphClient) trustFrameworkPath(p string) string {
+	if c.trustFrameworkSegment == "" {
+		return p
+	}
+	if rest, ok := strings.CutPrefix(p, "/"+defaultTrustFrameworkSegment+"/"); ok {
+		return "/" + c.trustFrameworkSegment + "/" + rest
+	}
+	if p == "/"+defaultTrustFrameworkSegment || strings.HasPrefix(p, "/"+defaultTrustFrameworkSegment+"?") {
+		return "/" + c.trustFrameworkSegment + strings.TrimPrefix(p, "/"+defaultTrustFrameworkSegment)
+	}
+	return p
+}
+
+// v1NotServed reports whether a v1.0 response means the request has to be
+// retried on beta. unsupported is true when v1.0 lacks the API altogether
+// rather than just the requested object.
+func (c *GraphClient) v1NotServed(resp *http.Response) (fallback bool, unsupported bool) {
+	if resp.StatusCode == http.StatusNotFound {
+		return true, false
+	}
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusNotImplemented {
+		body := c.readBodyString(resp)
+		if strings.Contains(body, "Resource not found for the segment") || strings.Contains(body, "NotSupported") {
+			return true, true
+		}
+	}
+	return false, false
+}
+
+// readWithFallback sends a read through send on Graph v1.0, falling back to
+// beta when v1.0 does not serve it, or only on the version graph_api_version
+// pins. Not-found answers become ErrNotFound.
+func (c *GraphClient) readWithFallback(
+	ctx context.Context,
+	send func(url string) (*http.Response, error),
+	format string,
+	args ...any,
+) (*http.Response, error) {
+	if c.apiVersion != "" {
+		url := c.versionedEndpoint(c.apiVersion, format, args...)
+		resp, err := send(url)
+		return c.checkNotFound(resp, err, url)
+	}
+	if !c.v1Unsupported.Load() {
+		url := c.versionedEndpoint(graphVersionV1, format, args...)
+		resp, err := send(url)
+		if err != nil {
+			return resp, err
+		}
+		fallback, unsupported := c.v1NotServed(resp)
+		if !fallback {
+			tflog.Debug(ctx, "Graph read served", map[string]any{
+				"version": graphVersionV1,
+				"url":     url,
+			})
+			return c.checkNotFound(resp, nil, url)
+		}
+		if unsupported {
+			c.v1Unsupported.Store(true)
+		}
+	}
+
+	url := c.versionedEndpoint(graphVersionBeta, format, args...)
+	resp, err := send(url)
+	tflog.Debug(ctx, "Graph read served", map[string]any{
+		"version": graphVersionBeta,
+		"url":     url,
+	})
+	return c.checkNotFound(resp, err, url)
+}
+
+// readGraph GETs a JSON resource, preferring Graph v1.0
+func (c *GraphClient) readGraph(ctx context.Context, format string, args ...any) (*http.Response, error) {
+	return c.readWithFallback(ctx, func(url string) (*http.Response, error) {
+		return c.doGraph(ctx, "GET", url, nil)
+	}, format, args...)
+}
+
+// readGraphXML GETs an XML resource, preferring Graph v1.0
+func (c *GraphClient) readGraphXML(ctx context.Context, format string, args ...any) (*http.Response, error) {
+	return c.readWithFallback(ctx, func(url string) (*http.Response, error) {
+		return c.doGraphXML(ctx, "GET", url, nil)
+	}, format, args...)
+}
+
+// setHeaders applies the user supplied extra headers followed by the headers
+// the provider manages, so Authorization and Content-Type can't be overridden
+func (c *GraphClient) setHeaders(req *http.Request, token string, contentType string) {
+	for k, v := range c.extraHeaders {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", contentType)
+}
+
+// requiredPermission names the Graph application permission needed for the
+// endpoint behind urlPath, used to give 403 responses an actionable hint
+func requiredPermission(urlPath string) string {
+	switch {
+	case strings.Contains(urlPath, "/keySets"):
+		return "TrustFrameworkKeySet.ReadWrite.All"
+	case strings.Contains(urlPath, "/policies"):
+		return "Policy.ReadWrite.TrustFramework"
+	}
+	return ""
+}
+
+// errorDetail returns the response body for use in a diagnostic, adding a
+// permissions hint when Graph answered 403 Forbidden
+func (c *GraphClient) errorDetail(resp *http.Response) string {
+	body := c.readBodyString(resp)
+	if resp == nil || resp.StatusCode != http.StatusForbidden || resp.Request == nil {
+		return body
+	}
+	permission := requiredPermission(resp.Request.URL.Path)
+	if permission == "" {
+		return body
+	}
+	return fmt.Sprintf(
+		"%s\n\nGraph denied access to %s. The application %s in tenant %s needs the %s application permission with admin consent granted.",
+		body, resp.Request.URL.Path, c.clientId, c.tenantId, permission,
+	)
+}
+
+// secretFields are the JSON keys whose values are never written to logs, such
+// as the secret in an uploadSecret body
+var secretFields = map[string]bool{
+	"k":        true,
+	"password": true,
+}
+
+// maskSecrets returns the JSON document b for logging, with the value of every
+// secretFields key replaced by ***
+func maskSecrets(b []byte) string {
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return string(b)
+	}
+	masked, err := json.Marshal(maskSecretValues(v))
+	if err != nil {
+		return string(b)
+	}
+	return string(masked)
+}
+
+func maskSecretValues(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			if secretFields[k] {
+				t[k] = "***"
+				continue
+			}
+			t[k] = maskSecretValues(child)
+		}
+	case []any:
+		for i, child := range t {
+			t[i] = maskSecretValues(child)
+		}
+	}
+	return v
+}
+
+// readLimited reads at most limit bytes from r, warning when the body is truncated
+func readLimited(ctx context.Context, r io.Reader, limit int64) []byte {
+	b, _ := io.ReadAll(io.LimitReader(r, limit+1))
+	if int64(len(b)) > limit {
+		tflog.Warn(ctx, "Graph response body exceeded the size limit and was truncated", map[string]any{
+			"limit_bytes": limit,
+		})
+		b = b[:limit]
+	}
+	return b
+}
+
+// checkNotFound converts a Graph not-found answer into ErrNotFound, leaving
+// every other response for the caller to inspect
+func (c *GraphClient) checkNotFound(resp *http.Response, err error, url string) (*http.Response, error) {
+	if err != nil || resp.StatusCode < 300 {
+		return resp, err
+	}
+	if resp.StatusCode == http.StatusNotFound || strings.Contains(c.readBodyString(resp), b2cNotFoundCode) {
+		return resp, fmt.Errorf("%w: %s", ErrNotFound, url)
+	}
+	return resp, nil
+}
+
+// expectStatus returns nil when resp has one of the status codes the
+// operation accepts, and otherwise a GraphError naming the request, the
+// status, and the Graph error code and message when the body carries them
+func (c *GraphClient) expectStatus(resp *http.Response, codes ...int) error {
+	if slices.Contains(codes, resp.StatusCode) {
+		return nil
+	}
+	graphErr := &GraphError{
+		StatusCode: resp.StatusCode,
+		Expected:   codes,
+		Detail:     c.errorDetail(resp),
+	}
+	if resp.Request != nil {
+		graphErr.Request = resp.Request.Method + " " + resp.Request.URL.Path
+	}
+	var body graphErrorBody
+	if err := json.Unmarshal(c.readBodyBytes(resp), &body); err == nil {
+		graphErr.Code, graphErr.Message = body.Error.Code, body.Error.Message
+	}
+	return graphErr
+}
+
+// errReadOnly is returned for a write attempted while read_only is set
+var errReadOnly = errors.New("the provider is configured with read_only = true and does not send requests that change the tenant")
+
+// refuseWrite adds an error and returns true when the provider is read-only.
+// Create, Update and Delete call it before touching Graph.
+func (c *GraphClient) refuseWrite(diags *diag.Diagnostics) bool {
+	if c == nil || !c.readOnly {
+		return false
+	}
+	diags.AddError("Provider is read-only", errReadOnly.Error()+". Unset read_only to apply changes.")
+	return true
+}
+
+// gzipRejected reports whether Graph may have refused a gzipped body rather
+// than its content. A plain retry tells the two apart.
+func gzipRejected(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusBadRequest, http.StatusUnsupportedMediaType, http.StatusNotImplemented:
+		return true
+	}
+	return false
+}
+
+// putXML uploads an XML body, gzipped when compress_uploads is set. If Graph
+// rejects the gzipped body but accepts it uncompressed, compression is turned
+// off for the rest of the run.
+func (c *GraphClient) putXML(ctx context.Context, url string, body string) (*http.Response, error) {
+	if !c.compressUploads.Load() {
+		return c.doGraphXML(ctx, "PUT", url, &body)
+	}
+	resp, err := c.doGraphXMLGzip(ctx, "PUT", url, body)
+	if err != nil || !gzipRejected(resp) {
+		return resp, err
+	}
+	tflog.Debug(ctx, "Gzipped upload rejected, retrying uncompressed", map[string]any{
+		"status": resp.Status,
+	})
+	plain, err := c.doGraphXML(ctx, "PUT", url, &body)
+	if err == nil && plain.StatusCode < 300 {
+		tflog.Warn(ctx, "Graph did not accept a gzipped policy upload; sending uploads uncompressed from now on")
+		c.compressUploads.Store(false)
+	}
+	return plain, err
+}
+
+// clockSkewErrorCode is the Azure AD error for a token request that is not
+// yet valid, which happens when the local clock runs behind
+const clockSkewErrorCode = "AADSTS700024"
+
+var clockSkewRetryDelay = 2 * time.Second
+
+var clockSkewValidFrom = regexp.MustCompile(`valid from ([^,]+)`)
+
+// clockSkewError explains an AADSTS700024 failure that survived a retry,
+// quoting when the token becomes valid if Azure AD reported it
+func clockSkewError(err error) error {
+	hint := "Azure AD rejected the token request as not yet valid. This usually means the system clock is out of sync; check that time synchronisation (NTP) is working on this machine."
+	if m := clockSkewValidFrom.FindStringSubmatch(err.Error()); m != nil {
+		hint += fmt.Sprintf(" The token is valid from (nbf) %s.", strings.TrimSpace(m[1]))
+	}
+	return fmt.Errorf("%s\n\n%w", hint, err)
+}
+
+// tokenScope is the Graph scope tokens are requested for. National clouds
+// only accept tokens for their own Graph host; other base URLs, such as a
+// mock Graph, get tokens for public Graph.
+func (c *GraphClient) tokenScope() string {
+	if isMicrosoftGraphHost(c.graphBaseURL) {
+		if u, err := url.Parse(c.graphBaseURL); err == nil {
+			return u.Scheme + "://" + u.Host + "/.default"
+		}
+	}
+	return defaultGraphBaseURL + "/.default"
 }
 
 func (c *GraphClient) getToken(ctx context.Context) (string, error) {
 	// Get token for Graph
-	token, err := c.credential.GetToken(ctx, policy.TokenRequestOptions{
-		Scopes: []string{"https://graph.microsoft.com/.default"},
-	})
+	opts := policy.TokenRequestOptions{
+		Scopes: []string{c.tokenScope()},
+	}
+	token, err := c.credential.GetToken(ctx, opts)
+	if err != nil && strings.Contains(err.Error(), clockSkewErrorCode) {
+		tflog.Warn(ctx, "Token request failed with a clock skew error, retrying once", map[string]any{
+			"delay": clockSkewRetryDelay.String(),
+		})
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(clockSkewRetryDelay):
+		}
+		token, err = c.credential.GetToken(ctx, opts)
+		if err != nil && strings.Contains(err.Error(), clockSkewErrorCode) {
+			return "", &AuthError{Err: clockSkewError(err)}
+		}
+	}
 	if err != nil {
-		return "", err
+		return "", &AuthError{Err: err}
 	}
-	tflog.Debug(ctx, fmt.Sprintf("Token value: %s", token.Token))
 	return token.Token, nil
 }
 
@@ -66,6 +713,10 @@ func (c *GraphClient) doGraph(
 	method, url string,
 	body any,
 ) (*http.Response, error) {
+	if c.doer != nil {
+		return c.doer.doGraph(ctx, method, url, body)
+	}
+
 	var buf *bytes.Buffer
 	var payload string
 
@@ -78,7 +729,7 @@ func (c *GraphClient) doGraph(
 			return nil, err
 		}
 		buf = bytes.NewBuffer(b)
-		payload = string(b)
+		payload = maskSecrets(b)
 	} else {
 		buf = &bytes.Buffer{}
 		payload = "<empty>"
@@ -104,14 +755,11 @@ func (c *GraphClient) doGraph(
 			"error": err.Error(),
 		})
 		return nil, err
-	} else {
-		tflog.Debug(ctx, fmt.Sprintf("Token value: %s", token))
 	}
 
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Content-Type", "application/json")
+	c.setHeaders(req, token, "application/json")
 
-	resp, err := c.client.Do(req)
+	resp, err := c.send(ctx, req)
 	if err != nil {
 		tflog.Error(ctx, "Graph API request failed", map[string]any{
 			"error": err.Error(),
@@ -119,12 +767,13 @@ func (c *GraphClient) doGraph(
 		return nil, err
 	}
 
-	bodyBytes, _ := io.ReadAll(resp.Body)
+	bodyBytes := readLimited(ctx, resp.Body, c.maxBodyBytes)
+	resp.Body.Close()
 	resp.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 
 	tflog.Debug(ctx, "Graph API response", map[string]any{
 		"status": resp.Status,
-		"body":   string(bodyBytes),
+		"body":   maskSecrets(bodyBytes),
 	})
 
 	return resp, nil
@@ -135,6 +784,10 @@ func (c *GraphClient) doGraphXML(
 	method, url string,
 	body *string,
 ) (*http.Response, error) {
+	if c.doer != nil {
+		return c.doer.doGraphXML(ctx, method, url, body)
+	}
+
 	var buf *bytes.Buffer
 
 	if body != nil {
@@ -142,7 +795,40 @@ func (c *GraphClient) doGraphXML(
 	} else {
 		buf = &bytes.Buffer{}
 	}
+	return c.sendXML(ctx, method, url, buf, "")
+}
 
+// doGraphXMLGzip is doGraphXML with the body sent gzip compressed
+func (c *GraphClient) doGraphXMLGzip(
+	ctx context.Context,
+	method, url string,
+	body string,
+) (*http.Response, error) {
+	if c.doer != nil {
+		return c.doer.doGraphXMLGzip(ctx, method, url, body)
+	}
+
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	if _, err := zw.Write([]byte(body)); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	tflog.Debug(ctx, "Compressed XML request body", map[string]any{
+		"bytes":      len(body),
+		"compressed": buf.Len(),
+	})
+	return c.sendXML(ctx, method, url, buf, "gzip")
+}
+
+func (c *GraphClient) sendXML(
+	ctx context.Context,
+	method, url string,
+	buf *bytes.Buffer,
+	contentEncoding string,
+) (*http.Response, error) {
 	req, err := http.NewRequest(method, url, buf)
 	if err != nil {
 		tflog.Error(ctx, "failed to build Graph HTTP request", map[string]any{
@@ -157,16 +843,23 @@ func (c *GraphClient) doGraphXML(
 			"error": err.Error(),
 		})
 		return nil, err
-	} else {
-		tflog.Debug(ctx, fmt.Sprintf("Token value: %s", token))
 	}
 
-	req.Header.Set("Authorization", "Bearer "+token)
 	//Yes this is literally the exact same method as the one above with this one line changed.
 	//Sue me
-	req.Header.Set("Content-Type", "application/xml")
+	contentType := c.xmlContentType
+	if contentType == "" {
+		contentType = defaultXMLContentType
+	}
+	c.setHeaders(req, token, contentType)
+	if contentEncoding != "" {
+		req.Header.Set("Content-Encoding", contentEncoding)
+	}
+	if method == http.MethodPut && c.uploadPrefer != "" {
+		req.Header.Set("Prefer", c.uploadPrefer)
+	}
 
-	resp, err := c.client.Do(req)
+	resp, err := c.send(ctx, req)
 	if err != nil {
 		tflog.Error(ctx, "Graph API request failed", map[string]any{
 			"error": err.Error(),
@@ -174,12 +867,13 @@ func (c *GraphClient) doGraphXML(
 		return nil, err
 	}
 
-	bodyBytes, _ := io.ReadAll(resp.Body)
+	bodyBytes := readLimited(ctx, resp.Body, c.maxBodyBytes)
+	resp.Body.Close()
 	resp.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 
 	tflog.Debug(ctx, "Graph API response", map[string]any{
 		"status": resp.Status,
-		"body":   string(bodyBytes),
+		"body":   maskSecrets(bodyBytes),
 	})
 
 	return resp, nil
@@ -0,0 +1,134 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// maxBatchRequests is the number of requests Graph accepts in a single $batch call
+const maxBatchRequests = 20
+
+type batchRequest struct {
+	Id        string            `json:"id"`
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	DependsOn []string          `json:"dependsOn,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Body      any               `json:"body,omitempty"`
+}
+
+type batchResponse struct {
+	Id     string          `json:"id"`
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+type batchResult struct {
+	Responses []batchResponse `json:"responses"`
+}
+
+// newPolicyBatch builds a $batch request uploading each policy in order. Every
+// request depends on the previous one, so Graph uploads base policies before
+// the policies that inherit from them and stops at the first failure.
+func newPolicyBatch(policies []string) []batchRequest {
+	requests := make([]batchRequest, 0, len(policies))
+	for i, policyXml := range policies {
+		req := batchRequest{
+			Id:     fmt.Sprintf("%d", i+1),
+			Method: "PUT",
+			URL:    fmt.Sprintf("/trustFramework/policies/%s/$value", getPolicyId(policyXml)),
+			Headers: map[string]string{
+				"Content-Type": "application/xml",
+			},
+			// Non-JSON bodies must be base64 encoded inside a batch
+			Body: base64.StdEncoding.EncodeToString([]byte(policyXml)),
+		}
+		if i > 0 {
+			req.DependsOn = []string{requests[i-1].Id}
+		}
+		requests = append(requests, req)
+	}
+	return requests
+}
+
+// batchFailures returns a description of every request in the batch that did
+// not succeed, keyed in request order
+func batchFailures(requests []batchRequest, result batchResult) []string {
+	byId := make(map[string]batchResponse, len(result.Responses))
+	for _, r := range result.Responses {
+		byId[r.Id] = r
+	}
+
+	var failures []string
+	for _, req := range requests {
+		r, ok := byId[req.Id]
+		if !ok {
+			failures = append(failures, fmt.Sprintf("%s %s: no response returned", req.Method, req.URL))
+			continue
+		}
+		if r.Status < 200 || r.Status > 299 {
+			failures = append(failures, fmt.Sprintf("%s %s: %d %s", req.Method, req.URL, r.Status, string(r.Body)))
+		}
+	}
+	return failures
+}
+
+// batchSucceeded returns the ids of the requests in the batch that succeeded
+func batchSucceeded(result batchResult) map[string]bool {
+	done := make(map[string]bool, len(result.Responses))
+	for _, r := range result.Responses {
+		if r.Status >= 200 && r.Status <= 299 {
+			done[r.Id] = true
+		}
+	}
+	return done
+}
+
+// doGraphBatch submits requests through the Graph $batch endpoint and returns
+// the per-request responses along with an error describing every failed
+// request. Graph does not roll back requests that succeeded before a failure.
+func (c *GraphClient) doGraphBatch(ctx context.Context, requests []batchRequest) (batchResult, error) {
+	var result batchResult
+	if len(requests) > maxBatchRequests {
+		return result, fmt.Errorf("a batch can hold at most %d requests, got %d", maxBatchRequests, len(requests))
+	}
+
+	// Batch URLs are relative to the version root, so they need the same
+	// trustFramework rewrite as endpoint() applies to direct requests
+	routed := make([]batchRequest, len(requests))
+	for i, req := range requests {
+		req.URL = c.trustFrameworkPath(req.URL)
+		routed[i] = req
+	}
+
+	endpoint := c.graphBaseURL + "/" + c.writeVersion() + "/$batch"
+	gr, err := c.doGraph(ctx, "POST", endpoint, map[string]any{
+		"requests": routed,
+	})
+	if err != nil {
+		return result, err
+	}
+	if err := c.expectStatus(gr, http.StatusOK); err != nil {
+		return result, err
+	}
+
+	if err := json.Unmarshal(c.readBodyBytes(gr), &result); err != nil {
+		return result, fmt.Errorf("Error parsing graph batch response: %s", err)
+	}
+
+	failures := batchFailures(requests, result)
+	if len(failures) > 0 {
+		tflog.Error(ctx, "Graph batch request failed", map[string]any{
+			"failures": len(failures),
+		})
+		return result, errors.New(strings.Join(failures, "\n"))
+	}
+	return result, nil
+}
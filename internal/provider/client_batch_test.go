@@ -0,0 +1,114 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewPolicyBatch(t *testing.T) {
+	base := `<TrustFrameworkPolicy PolicyId="B2C_1A_Base"></TrustFrameworkPolicy>`
+	ext := `<TrustFrameworkPolicy PolicyId="B2C_1A_Extensions"></TrustFrameworkPolicy>`
+
+	requests := newPolicyBatch([]string{base, ext})
+	if len(requests) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(requests))
+	}
+
+	if requests[0].URL != "/trustFramework/policies/B2C_1A_Base/$value" {
+		t.Errorf("Unexpected URL for first request: %s", requests[0].URL)
+	}
+	if len(requests[0].DependsOn) != 0 {
+		t.Errorf("Expected first request to have no dependencies, got %v", requests[0].DependsOn)
+	}
+	if len(requests[1].DependsOn) != 1 || requests[1].DependsOn[0] != requests[0].Id {
+		t.Errorf("Expected second request to depend on %s, got %v", requests[0].Id, requests[1].DependsOn)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(requests[1].Body.(string))
+	if err != nil {
+		t.Fatalf("Expected base64 body, got error: %s", err)
+	}
+	if string(decoded) != ext {
+		t.Errorf("Expected body to round trip, got %q", string(decoded))
+	}
+}
+
+func TestBatchFailures(t *testing.T) {
+	requests := newPolicyBatch([]string{
+		`<TrustFrameworkPolicy PolicyId="B2C_1A_Base"></TrustFrameworkPolicy>`,
+		`<TrustFrameworkPolicy PolicyId="B2C_1A_Extensions"></TrustFrameworkPolicy>`,
+		`<TrustFrameworkPolicy PolicyId="B2C_1A_SignUpSignIn"></TrustFrameworkPolicy>`,
+	})
+
+	t.Run("AllSucceeded", func(t *testing.T) {
+		result := batchResult{Responses: []batchResponse{
+			{Id: "1", Status: 200},
+			{Id: "2", Status: 201},
+			{Id: "3", Status: 200},
+		}}
+		if failures := batchFailures(requests, result); len(failures) != 0 {
+			t.Errorf("Expected no failures, got %v", failures)
+		}
+	})
+
+	t.Run("FailureStopsDependents", func(t *testing.T) {
+		// Graph answers 424 Failed Dependency for requests after a failure
+		result := batchResult{Responses: []batchResponse{
+			{Id: "3", Status: 424},
+			{Id: "1", Status: 200},
+			{Id: "2", Status: 400, Body: []byte(`{"error":"invalid policy"}`)},
+		}}
+		failures := batchFailures(requests, result)
+		if len(failures) != 2 {
+			t.Fatalf("Expected 2 failures, got %v", failures)
+		}
+	})
+
+	t.Run("MissingResponse", func(t *testing.T) {
+		result := batchResult{Responses: []batchResponse{
+			{Id: "1", Status: 200},
+			{Id: "2", Status: 200},
+		}}
+		if failures := batchFailures(requests, result); len(failures) != 1 {
+			t.Errorf("Expected 1 failure for the missing response, got %v", failures)
+		}
+	})
+}
+
+func TestDoGraphBatchTrustFrameworkSegment(t *testing.T) {
+	var got []batchRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Requests []batchRequest `json:"requests"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("decoding batch body: %v", err)
+		}
+		got = body.Requests
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"responses":[{"id":"1","status":200}]}`))
+	}))
+	defer srv.Close()
+
+	c := &GraphClient{
+		credential:            &fakeCredential{},
+		client:                srv.Client(),
+		maxBodyBytes:          defaultMaxBodyBytes,
+		graphBaseURL:          srv.URL,
+		trustFrameworkSegment: "contexts/b2c/trustFramework",
+	}
+	requests := newPolicyBatch([]string{`<TrustFrameworkPolicy PolicyId="B2C_1A_Base"></TrustFrameworkPolicy>`})
+	if _, err := c.doGraphBatch(context.Background(), requests); err != nil {
+		t.Fatalf("doGraphBatch() unexpected error: %v", err)
+	}
+	if len(got) != 1 || got[0].URL != "/contexts/b2c/trustFramework/policies/B2C_1A_Base/$value" {
+		t.Errorf("batch URLs = %+v, want the overridden segment", got)
+	}
+	if requests[0].URL != "/trustFramework/policies/B2C_1A_Base/$value" {
+		t.Errorf("caller's requests were modified: %s", requests[0].URL)
+	}
+}
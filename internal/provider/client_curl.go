@@ -0,0 +1,93 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// redacted replaces header values that must not be written to logs
+const redacted = "<redacted>"
+
+// shellQuote quotes s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// curlCommand renders req as an equivalent curl command. The bearer token and
+// the values of extra_headers, which may hold gateway keys, are redacted, as
+// are secretFields in JSON bodies. Gzipped bodies are read from a file, since
+// they cannot be pasted into a shell.
+func (c *GraphClient) curlCommand(req *http.Request) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "curl -X %s %s", req.Method, shellQuote(req.URL.String()))
+
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		value := req.Header.Get(name)
+		switch {
+		case name == "Authorization":
+			value = "Bearer " + redacted
+		case c.isExtraHeader(name):
+			value = redacted
+		}
+		fmt.Fprintf(&b, " \\\n  -H %s", shellQuote(name+": "+value))
+	}
+
+	if req.GetBody == nil {
+		return b.String()
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return b.String()
+	}
+	defer body.Close()
+	raw, _ := io.ReadAll(body)
+	switch {
+	case len(raw) == 0:
+	case req.Header.Get("Content-Encoding") == "gzip":
+		b.WriteString(" \\\n  --data-binary @request-body.gz")
+	case strings.HasPrefix(req.Header.Get("Content-Type"), "application/json"):
+		fmt.Fprintf(&b, " \\\n  --data-binary %s", shellQuote(maskSecrets(raw)))
+	default:
+		fmt.Fprintf(&b, " \\\n  --data-binary %s", shellQuote(string(raw)))
+	}
+	return b.String()
+}
+
+// isExtraHeader reports whether name is one of the configured extra_headers
+func (c *GraphClient) isExtraHeader(name string) bool {
+	for k := range c.extraHeaders {
+		if http.CanonicalHeaderKey(k) == http.CanonicalHeaderKey(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// emitCurl logs a failed request as a curl command when debug_emit_curl is
+// set, so it can be reproduced by hand. A request fails when it gets no
+// response or Graph answers with an error status.
+func (c *GraphClient) emitCurl(ctx context.Context, req *http.Request, resp *http.Response, err error) {
+	if !c.debugEmitCurl || (err == nil && resp.StatusCode < 400) {
+		return
+	}
+	fields := map[string]any{
+		"curl": c.curlCommand(req),
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+	} else {
+		fields["status"] = resp.Status
+	}
+	tflog.Warn(ctx, "Failed Graph request as curl (add the token with -H 'Authorization: Bearer ...')", fields)
+}
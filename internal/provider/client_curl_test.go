@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-log/tflogtest"
+)
+
+func TestCurlCommand(t *testing.T) {
+	c := &GraphClient{extraHeaders: map[string]string{"x-gateway-key": "gateway-secret"}}
+	req, err := http.NewRequest("POST", "https://graph.test/beta/trustFramework/keySets/B2C_1A_Test/uploadSecret", strings.NewReader(`{"use":"sig","k":"top-secret"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.setHeaders(req, "real-token", "application/json")
+
+	got := c.curlCommand(req)
+	for _, want := range []string{
+		"curl -X POST 'https://graph.test/beta/trustFramework/keySets/B2C_1A_Test/uploadSecret'",
+		"-H 'Authorization: Bearer <redacted>'",
+		"-H 'X-Gateway-Key: <redacted>'",
+		"-H 'Content-Type: application/json'",
+		`--data-binary '{"k":"***","use":"sig"}'`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("curlCommand() missing %q:\n%s", want, got)
+		}
+	}
+	for _, secret := range []string{"real-token", "gateway-secret", "top-secret"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("curlCommand() leaked %q:\n%s", secret, got)
+		}
+	}
+}
+
+func TestCurlCommandQuotesXML(t *testing.T) {
+	c := &GraphClient{}
+	req, err := http.NewRequest("PUT", "https://graph.test/beta/trustFramework/policies/B2C_1A_TEST/$value", strings.NewReader(`<Policy Name='it''s'/>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/xml")
+	if got := c.curlCommand(req); !strings.Contains(got, `--data-binary '<Policy Name='\''it'\'''\''s'\''/>'`) {
+		t.Errorf("curlCommand() did not quote the body for the shell:\n%s", got)
+	}
+}
+
+func TestEmitCurl(t *testing.T) {
+	tests := []struct {
+		name     string
+		enabled  bool
+		status   int
+		wantCurl bool
+	}{
+		{name: "disabled", enabled: false, status: http.StatusBadRequest},
+		{name: "success", enabled: true, status: http.StatusOK},
+		{name: "failure", enabled: true, status: http.StatusBadRequest, wantCurl: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			var logs bytes.Buffer
+			ctx := tflogtest.RootLogger(context.Background(), &logs)
+			c := &GraphClient{
+				credential:    &fakeCredential{},
+				client:        srv.Client(),
+				maxBodyBytes:  defaultMaxBodyBytes,
+				graphBaseURL:  srv.URL,
+				debugEmitCurl: tt.enabled,
+			}
+			if _, err := c.doGraph(ctx, "GET", srv.URL+"/beta/trustFramework/policies", nil); err != nil {
+				t.Fatalf("doGraph() unexpected error: %v", err)
+			}
+			if got := strings.Contains(logs.String(), "curl -X GET"); got != tt.wantCurl {
+				t.Errorf("curl logged = %v, want %v:\n%s", got, tt.wantCurl, logs.String())
+			}
+		})
+	}
+}
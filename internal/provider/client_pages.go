@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// maxListPages stops getAllPages from following a nextLink loop forever
+const maxListPages = 100
+
+type listPage struct {
+	Value    []json.RawMessage `json:"value"`
+	NextLink string            `json:"@odata.nextLink"`
+}
+
+// nextPageURL returns nextLink with any query parameter of the first request
+// that Graph dropped from it added back, so $filter and $select apply to
+// every page
+func nextPageURL(first, nextLink string) (string, error) {
+	firstURL, err := url.Parse(first)
+	if err != nil {
+		return "", err
+	}
+	next, err := url.Parse(nextLink)
+	if err != nil {
+		return "", err
+	}
+	query := next.Query()
+	for k, v := range firstURL.Query() {
+		if _, ok := query[k]; !ok {
+			query[k] = v
+		}
+	}
+	next.RawQuery = query.Encode()
+	return next.String(), nil
+}
+
+// getAllPages GETs the Graph collection at listPath and follows
+// @odata.nextLink until every item has been read. nextLink pages stay on the
+// API version that served the first page.
+func (c *GraphClient) getAllPages(ctx context.Context, listPath string) ([]json.RawMessage, error) {
+	var items []json.RawMessage
+	first := ""
+	next := ""
+	for page := 1; page == 1 || next != ""; page++ {
+		if page > maxListPages {
+			return nil, fmt.Errorf("Listing %s did not finish after %d pages", listPath, maxListPages)
+		}
+		var gr *http.Response
+		var err error
+		if page == 1 {
+			gr, err = c.readGraph(ctx, "%s", listPath)
+			if gr != nil && gr.Request != nil {
+				first = gr.Request.URL.String()
+			}
+		} else {
+			tflog.Debug(ctx, "GET collection page", map[string]any{
+				"url":  next,
+				"page": page,
+			})
+			gr, err = c.doGraph(ctx, "GET", next, nil)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := c.expectStatus(gr, http.StatusOK); err != nil {
+			return nil, err
+		}
+		var p listPage
+		if err := json.Unmarshal(c.readBodyBytes(gr), &p); err != nil {
+			return nil, fmt.Errorf("Error parsing Graph collection page: %s", err)
+		}
+		items = append(items, p.Value...)
+
+		next = ""
+		if p.NextLink != "" {
+			next, err = nextPageURL(first, p.NextLink)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,52 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestNextPageURL(t *testing.T) {
+	first := "https://graph.test/beta/trustFramework/policies?%24filter=startswith%28id%2C%27B2C_1A_SignUp%27%29&%24select=id"
+	got, err := nextPageURL(first, "https://graph.test/beta/trustFramework/policies?%24skiptoken=abc&%24select=id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if query.Get("$skiptoken") != "abc" {
+		t.Errorf("nextLink skiptoken lost: %s", got)
+	}
+	if query.Get("$filter") != "startswith(id,'B2C_1A_SignUp')" {
+		t.Errorf("filter not carried over: %s", got)
+	}
+	if len(query["$select"]) != 1 {
+		t.Errorf("select duplicated: %s", got)
+	}
+}
+
+func TestGetAllPages(t *testing.T) {
+	fake := &fakeGraph{responses: map[string]fakeResponse{
+		"GET /trustFramework/policies?%24filter=x": {
+			http.StatusOK,
+			`{"value":[{"id":"B2C_1A_A"}],"@odata.nextLink":"https://graph.test/beta/trustFramework/policies?%24skiptoken=p2"}`,
+		},
+		"GET /trustFramework/policies?%24filter=x&%24skiptoken=p2": {
+			http.StatusOK,
+			`{"value":[{"id":"B2C_1A_B"}]}`,
+		},
+	}}
+	c := newFakeGraphClient(fake)
+
+	items, err := c.getAllPages(context.Background(), "/trustFramework/policies?%24filter=x")
+	if err != nil {
+		t.Fatalf("getAllPages() unexpected error: %s (calls: %v)", err, fake.calls)
+	}
+	if len(items) != 2 {
+		t.Errorf("getAllPages() returned %d items, want 2", len(items))
+	}
+}
@@ -0,0 +1,717 @@
+package provider
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+func TestReadLimited(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		limit    int64
+		expected string
+	}{
+		{
+			name:     "under limit",
+			body:     "short body",
+			limit:    100,
+			expected: "short body",
+		},
+		{
+			name:     "exactly at limit",
+			body:     "12345",
+			limit:    5,
+			expected: "12345",
+		},
+		{
+			name:     "over limit is truncated",
+			body:     "<html>a very large error page</html>",
+			limit:    6,
+			expected: "<html>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := readLimited(context.Background(), strings.NewReader(tt.body), tt.limit)
+			if string(got) != tt.expected {
+				t.Errorf("readLimited() = %q, want %q", string(got), tt.expected)
+			}
+		})
+	}
+}
+
+func TestSetHeaders(t *testing.T) {
+	c := &GraphClient{
+		extraHeaders: map[string]string{
+			"X-Gateway-Key": "gateway-secret",
+			"Authorization": "Bearer spoofed",
+			"Content-Type":  "text/plain",
+		},
+	}
+	req, err := http.NewRequest("GET", "https://graph.microsoft.com/beta/trustFramework/policies", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.setHeaders(req, "real-token", "application/json")
+
+	if got := req.Header.Get("X-Gateway-Key"); got != "gateway-secret" {
+		t.Errorf("Expected extra header to be set, got %q", got)
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer real-token" {
+		t.Errorf("Expected Authorization to be managed by the provider, got %q", got)
+	}
+	if got := req.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Expected Content-Type to be managed by the provider, got %q", got)
+	}
+}
+
+func TestErrorDetailForbidden(t *testing.T) {
+	c := &GraphClient{tenantId: "contoso.onmicrosoft.com", clientId: "app-id"}
+
+	tests := []struct {
+		name       string
+		url        string
+		status     int
+		permission string
+	}{
+		{
+			name:       "keySets forbidden",
+			url:        "https://graph.microsoft.com/beta/trustFramework/keySets/B2C_1A_Test",
+			status:     http.StatusForbidden,
+			permission: "TrustFrameworkKeySet.ReadWrite.All",
+		},
+		{
+			name:       "policies forbidden",
+			url:        "https://graph.microsoft.com/beta/trustFramework/policies/B2C_1A_Test/$value",
+			status:     http.StatusForbidden,
+			permission: "Policy.ReadWrite.TrustFramework",
+		},
+		{
+			name:   "not forbidden",
+			url:    "https://graph.microsoft.com/beta/trustFramework/policies/B2C_1A_Test/$value",
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			resp := &http.Response{
+				StatusCode: tt.status,
+				Body:       io.NopCloser(strings.NewReader("graph error body")),
+				Request:    req,
+			}
+
+			got := c.errorDetail(resp)
+			if !strings.HasPrefix(got, "graph error body") {
+				t.Errorf("Expected detail to start with the response body, got %q", got)
+			}
+			if tt.permission == "" {
+				if got != "graph error body" {
+					t.Errorf("Expected no hint for status %d, got %q", tt.status, got)
+				}
+				return
+			}
+			for _, want := range []string{tt.permission, "app-id", "contoso.onmicrosoft.com"} {
+				if !strings.Contains(got, want) {
+					t.Errorf("Expected detail to contain %q, got %q", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestExpectStatus(t *testing.T) {
+	c := &GraphClient{tenantId: "contoso.onmicrosoft.com", clientId: "app-id"}
+	req, _ := http.NewRequest("DELETE", "https://graph.microsoft.com/beta/trustFramework/policies/B2C_1A_Test", nil)
+	response := func(status int, body string) *http.Response {
+		return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(body)), Request: req}
+	}
+
+	if err := c.expectStatus(response(http.StatusNoContent, ""), http.StatusOK, http.StatusNoContent); err != nil {
+		t.Errorf("expectStatus() unexpected error for an accepted status: %s", err)
+	}
+
+	err := c.expectStatus(response(http.StatusBadRequest, `{"error":{"code":"AADB2C90001","message":"The policy is in use."}}`), http.StatusNoContent)
+	if err == nil {
+		t.Fatal("expectStatus() expected an error for an unexpected status")
+	}
+	for _, want := range []string{
+		"DELETE /beta/trustFramework/policies/B2C_1A_Test",
+		"400 Bad Request, expected 204",
+		"Graph error AADB2C90001: The policy is in use.",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expectStatus() error = %q, want it to contain %q", err, want)
+		}
+	}
+
+	err = c.expectStatus(response(http.StatusForbidden, "denied"), http.StatusNoContent)
+	if err == nil || !strings.Contains(err.Error(), "Policy.ReadWrite.TrustFramework") {
+		t.Errorf("expectStatus() error = %v, want the permission hint for a 403", err)
+	}
+}
+
+func TestIsMicrosoftGraphHost(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected bool
+	}{
+		{url: "https://graph.microsoft.com", expected: true},
+		{url: "https://GRAPH.microsoft.com/", expected: true},
+		{url: "https://graph.microsoft.us", expected: true},
+		{url: "https://microsoftgraph.chinacloudapi.cn", expected: true},
+		{url: "https://localhost:8443", expected: false},
+		{url: "https://graph.microsoft.com.mock.local", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := isMicrosoftGraphHost(tt.url); got != tt.expected {
+				t.Errorf("isMicrosoftGraphHost(%q) = %t, want %t", tt.url, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCheckNotFound(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		notFound bool
+	}{
+		{"ok", http.StatusOK, `{"id":"B2C_1A_Test"}`, false},
+		{"404", http.StatusNotFound, `{}`, true},
+		{"b2c not found code", http.StatusBadRequest, `{"error":{"message":"AADB2C90073: Keyset with id 'B2C_1A_Test' does not exist."}}`, true},
+		{"other error", http.StatusForbidden, `{"error":{"code":"Authorization_RequestDenied"}}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Body: io.NopCloser(strings.NewReader(tt.body))}
+			_, err := (&GraphClient{}).checkNotFound(resp, nil, "https://graph.microsoft.com/beta/trustFramework/keySets/B2C_1A_Test")
+			if got := errors.Is(err, ErrNotFound); got != tt.notFound {
+				t.Errorf("errors.Is(err, ErrNotFound) = %v, want %v (err: %v)", got, tt.notFound, err)
+			}
+			if !tt.notFound && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+type fakeCredential struct {
+	errs  []error
+	calls int
+}
+
+func (f *fakeCredential) GetToken(_ context.Context, _ policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	f.calls++
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		if err != nil {
+			return azcore.AccessToken{}, err
+		}
+	}
+	return azcore.AccessToken{Token: "token"}, nil
+}
+
+func TestGetTokenClockSkew(t *testing.T) {
+	defer func(d time.Duration) { clockSkewRetryDelay = d }(clockSkewRetryDelay)
+	clockSkewRetryDelay = 0
+	skew := errors.New("AADSTS700024: Client assertion is not within its valid time range. Current time: 2026-01-01T00:00:00.0000000Z, assertion valid from 2026-01-01T00:05:00.0000000Z, expiry time of assertion 2026-01-01T01:05:00.0000000Z.")
+
+	t.Run("retry succeeds", func(t *testing.T) {
+		cred := &fakeCredential{errs: []error{skew}}
+		c := &GraphClient{credential: cred}
+		if _, err := c.getToken(context.Background()); err != nil {
+			t.Fatalf("getToken() unexpected error: %s", err)
+		}
+		if cred.calls != 2 {
+			t.Errorf("GetToken called %d times, want 2", cred.calls)
+		}
+	})
+
+	t.Run("persistent skew adds hint", func(t *testing.T) {
+		cred := &fakeCredential{errs: []error{skew, skew}}
+		c := &GraphClient{credential: cred}
+		_, err := c.getToken(context.Background())
+		if err == nil {
+			t.Fatal("getToken() expected an error")
+		}
+		if !strings.Contains(err.Error(), "NTP") || !strings.Contains(err.Error(), "(nbf) 2026-01-01T00:05:00.0000000Z") {
+			t.Errorf("missing clock sync hint: %s", err)
+		}
+		if !errors.Is(err, skew) {
+			t.Errorf("original error not wrapped")
+		}
+	})
+
+	t.Run("other errors are not retried", func(t *testing.T) {
+		cred := &fakeCredential{errs: []error{errors.New("AADSTS7000215: Invalid client secret provided.")}}
+		c := &GraphClient{credential: cred}
+		if _, err := c.getToken(context.Background()); err == nil {
+			t.Fatal("getToken() expected an error")
+		}
+		if cred.calls != 1 {
+			t.Errorf("GetToken called %d times, want 1", cred.calls)
+		}
+	})
+}
+
+func TestReadWithFallback(t *testing.T) {
+	const keyset = `{"id":"B2C_1A_Test","keys":[]}`
+	segmentNotFound := fakeResponse{http.StatusBadRequest, `{"error":{"code":"BadRequest","message":"Resource not found for the segment 'trustFramework'."}}`}
+
+	tests := []struct {
+		name         string
+		responses    map[string]fakeResponse
+		wantNotFound bool
+		wantCalls    []string
+		wantCached   bool
+	}{
+		{
+			name: "served by v1.0",
+			responses: map[string]fakeResponse{
+				"GET /v1.0/trustFramework/keySets/B2C_1A_Test": {http.StatusOK, keyset},
+			},
+			wantCalls: []string{"GET /v1.0/trustFramework/keySets/B2C_1A_Test"},
+		},
+		{
+			name: "404 on v1.0 falls back to beta",
+			responses: map[string]fakeResponse{
+				"GET /trustFramework/keySets/B2C_1A_Test": {http.StatusOK, keyset},
+			},
+			wantCalls: []string{"GET /v1.0/trustFramework/keySets/B2C_1A_Test", "GET /trustFramework/keySets/B2C_1A_Test"},
+		},
+		{
+			name: "unsupported on v1.0 is remembered",
+			responses: map[string]fakeResponse{
+				"GET /v1.0/trustFramework/keySets/B2C_1A_Test": segmentNotFound,
+				"GET /trustFramework/keySets/B2C_1A_Test":      {http.StatusOK, keyset},
+			},
+			wantCalls:  []string{"GET /v1.0/trustFramework/keySets/B2C_1A_Test", "GET /trustFramework/keySets/B2C_1A_Test"},
+			wantCached: true,
+		},
+		{
+			name:         "missing on both versions",
+			responses:    map[string]fakeResponse{},
+			wantNotFound: true,
+			wantCalls:    []string{"GET /v1.0/trustFramework/keySets/B2C_1A_Test", "GET /trustFramework/keySets/B2C_1A_Test"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGraph{responses: tt.responses}
+			c := newFakeGraphClient(fake)
+			_, err := c.readGraph(context.Background(), "/trustFramework/keySets/%s", "B2C_1A_Test")
+			if got := errors.Is(err, ErrNotFound); got != tt.wantNotFound {
+				t.Fatalf("errors.Is(err, ErrNotFound) = %v, want %v (err: %v)", got, tt.wantNotFound, err)
+			}
+			if strings.Join(fake.calls, "|") != strings.Join(tt.wantCalls, "|") {
+				t.Errorf("calls = %v, want %v", fake.calls, tt.wantCalls)
+			}
+			if c.v1Unsupported.Load() != tt.wantCached {
+				t.Errorf("v1Unsupported = %v, want %v", c.v1Unsupported.Load(), tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestNewGraphClientSkipCredentialCheck(t *testing.T) {
+	// An unroutable authority host would make an eager token request fail
+	t.Setenv("AZURE_AUTHORITY_HOST", "https://127.0.0.1:1/")
+	c, err := NewGraphClient(
+		context.Background(),
+		"00000000-0000-0000-0000-000000000000",
+		"11111111-1111-1111-1111-111111111111",
+		"not-a-real-secret",
+		GraphClientOptions{SkipCredentialCheck: true},
+	)
+	if err != nil {
+		t.Fatalf("NewGraphClient() unexpected error: %s", err)
+	}
+	if c.graphBaseURL != defaultGraphBaseURL {
+		t.Errorf("graphBaseURL = %s, want %s", c.graphBaseURL, defaultGraphBaseURL)
+	}
+}
+
+func TestPutXML(t *testing.T) {
+	const url = fakeGraphBaseURL + "/beta/trustFramework/policies/B2C_1A_TEST/$value"
+	tests := []struct {
+		name         string
+		compress     bool
+		responses    map[string]fakeResponse
+		wantCalls    []string
+		wantStatus   int
+		wantCompress bool
+	}{
+		{
+			name:       "uncompressed",
+			responses:  map[string]fakeResponse{"PUT /trustFramework/policies/B2C_1A_TEST/$value": {http.StatusOK, ``}},
+			wantCalls:  []string{"PUT /trustFramework/policies/B2C_1A_TEST/$value"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:         "gzip accepted",
+			compress:     true,
+			responses:    map[string]fakeResponse{"PUT /trustFramework/policies/B2C_1A_TEST/$value gzip": {http.StatusOK, ``}},
+			wantCalls:    []string{"PUT /trustFramework/policies/B2C_1A_TEST/$value gzip"},
+			wantStatus:   http.StatusOK,
+			wantCompress: true,
+		},
+		{
+			name:     "gzip rejected",
+			compress: true,
+			responses: map[string]fakeResponse{
+				"PUT /trustFramework/policies/B2C_1A_TEST/$value gzip": {http.StatusUnsupportedMediaType, ``},
+				"PUT /trustFramework/policies/B2C_1A_TEST/$value":      {http.StatusOK, ``},
+			},
+			wantCalls: []string{
+				"PUT /trustFramework/policies/B2C_1A_TEST/$value gzip",
+				"PUT /trustFramework/policies/B2C_1A_TEST/$value",
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:     "invalid policy keeps compression",
+			compress: true,
+			responses: map[string]fakeResponse{
+				"PUT /trustFramework/policies/B2C_1A_TEST/$value gzip": {http.StatusBadRequest, `{"error":{"code":"AADB2C"}}`},
+				"PUT /trustFramework/policies/B2C_1A_TEST/$value":      {http.StatusBadRequest, `{"error":{"code":"AADB2C"}}`},
+			},
+			wantCalls: []string{
+				"PUT /trustFramework/policies/B2C_1A_TEST/$value gzip",
+				"PUT /trustFramework/policies/B2C_1A_TEST/$value",
+			},
+			wantStatus:   http.StatusBadRequest,
+			wantCompress: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGraph{responses: tt.responses}
+			c := newFakeGraphClient(fake)
+			c.compressUploads.Store(tt.compress)
+
+			resp, err := c.putXML(context.Background(), url, "<TrustFrameworkPolicy/>")
+			if err != nil {
+				t.Fatalf("putXML() unexpected error: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if strings.Join(fake.calls, ",") != strings.Join(tt.wantCalls, ",") {
+				t.Errorf("calls = %v, want %v", fake.calls, tt.wantCalls)
+			}
+			if got := c.compressUploads.Load(); got != tt.wantCompress {
+				t.Errorf("compressUploads = %v, want %v", got, tt.wantCompress)
+			}
+		})
+	}
+}
+
+func TestDoGraphXMLGzip(t *testing.T) {
+	const policy = "<TrustFrameworkPolicy/>"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Content-Encoding"); got != "gzip" {
+			t.Errorf("Content-Encoding = %q, want gzip", got)
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Fatalf("body is not gzipped: %v", err)
+		}
+		body, _ := io.ReadAll(zr)
+		if string(body) != policy {
+			t.Errorf("decompressed body = %q, want %q", body, policy)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	c := &GraphClient{
+		credential:   &fakeCredential{},
+		client:       srv.Client(),
+		maxBodyBytes: defaultMaxBodyBytes,
+		graphBaseURL: srv.URL,
+	}
+	resp, err := c.doGraphXMLGzip(context.Background(), "PUT", srv.URL+"/beta/trustFramework/policies/B2C_1A_TEST/$value", policy)
+	if err != nil {
+		t.Fatalf("doGraphXMLGzip() unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	c := &GraphClient{
+		credential:   &fakeCredential{},
+		client:       srv.Client(),
+		maxBodyBytes: defaultMaxBodyBytes,
+		graphBaseURL: srv.URL,
+		readOnly:     true,
+	}
+	if _, err := c.doGraph(context.Background(), "GET", srv.URL+"/beta/trustFramework/keySets", nil); err != nil {
+		t.Errorf("GET unexpected error: %v", err)
+	}
+	policy := "<TrustFrameworkPolicy/>"
+	if _, err := c.doGraphXML(context.Background(), "PUT", srv.URL+"/beta/trustFramework/policies/B2C_1A_TEST/$value", &policy); !errors.Is(err, errReadOnly) {
+		t.Errorf("PUT error = %v, want errReadOnly", err)
+	}
+	if calls != 1 {
+		t.Errorf("server saw %d requests, want only the GET", calls)
+	}
+}
+
+func TestEndpointTrustFrameworkSegment(t *testing.T) {
+	tests := []struct {
+		name    string
+		segment string
+		path    string
+		want    string
+	}{
+		{name: "default", path: "/trustFramework/policies", want: "https://graph.test/beta/trustFramework/policies"},
+		{name: "override", segment: "contexts/b2c/trustFramework", path: "/trustFramework/keySets/B2C_1A_X", want: "https://graph.test/beta/contexts/b2c/trustFramework/keySets/B2C_1A_X"},
+		{name: "other paths untouched", segment: "contexts/b2c/trustFramework", path: "/organization", want: "https://graph.test/beta/organization"},
+		{name: "query on segment root", segment: "proxy/tf", path: "/trustFramework?$select=id", want: "https://graph.test/beta/proxy/tf?$select=id"},
+		{name: "similar prefix untouched", segment: "proxy/tf", path: "/trustFrameworkExtra/policies", want: "https://graph.test/beta/trustFrameworkExtra/policies"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &GraphClient{graphBaseURL: fakeGraphBaseURL, trustFrameworkSegment: tt.segment}
+			if got := c.endpoint("%s", tt.path); got != tt.want {
+				t.Errorf("endpoint() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewGraphClientAccessToken(t *testing.T) {
+	c, err := NewGraphClient(context.Background(), "tenant", "", "", GraphClientOptions{AccessToken: "pre-fetched"})
+	if err != nil {
+		t.Fatalf("NewGraphClient() unexpected error: %v", err)
+	}
+	token, err := c.getToken(context.Background())
+	if err != nil {
+		t.Fatalf("getToken() unexpected error: %v", err)
+	}
+	if token != "pre-fetched" {
+		t.Errorf("getToken() = %q, want the configured token", token)
+	}
+}
+
+func TestNewGraphClientInjectedHTTPClient(t *testing.T) {
+	var auth string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.Write([]byte(`{"value":[]}`))
+	}))
+	defer srv.Close()
+
+	// The test server's certificate is only trusted by its own client
+	c, err := newGraphClient(context.Background(), "tenant", "", "", GraphClientOptions{
+		AccessToken:  "pre-fetched",
+		GraphBaseURL: srv.URL,
+	}, srv.Client())
+	if err != nil {
+		t.Fatalf("newGraphClient() unexpected error: %v", err)
+	}
+	resp, err := c.readGraph(context.Background(), "/trustFramework/policies")
+	if err != nil {
+		t.Fatalf("readGraph() through the injected client failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || auth != "Bearer pre-fetched" {
+		t.Errorf("status = %d, Authorization = %q", resp.StatusCode, auth)
+	}
+	if c.requestTimeout != defaultRequestTimeout {
+		t.Errorf("requestTimeout = %s, want %s for a client without a timeout", c.requestTimeout, defaultRequestTimeout)
+	}
+}
+
+// blockingCredential never issues a token, returning only when ctx ends
+type blockingCredential struct{}
+
+func (blockingCredential) GetToken(ctx context.Context, _ policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	<-ctx.Done()
+	return azcore.AccessToken{}, ctx.Err()
+}
+
+func TestCheckCredential(t *testing.T) {
+	t.Run("times out", func(t *testing.T) {
+		c := &GraphClient{credential: blockingCredential{}, requestTimeout: 20 * time.Millisecond}
+		err := c.checkCredential(context.Background())
+		if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "request_timeout_seconds") {
+			t.Errorf("checkCredential() = %v, want a timeout naming request_timeout_seconds", err)
+		}
+	})
+
+	t.Run("caller cancels", func(t *testing.T) {
+		c := &GraphClient{credential: blockingCredential{}, requestTimeout: time.Minute}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		start := time.Now()
+		if err := c.checkCredential(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("checkCredential() = %v, want context.Canceled", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("checkCredential() took %s after cancellation", elapsed)
+		}
+	})
+
+	t.Run("token issued", func(t *testing.T) {
+		c := &GraphClient{credential: &fakeCredential{}, requestTimeout: time.Second}
+		if err := c.checkCredential(context.Background()); err != nil {
+			t.Errorf("checkCredential() unexpected error: %v", err)
+		}
+	})
+}
+
+func TestDoGraphXMLContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		want        string
+	}{
+		{name: "default", want: "application/xml"},
+		{name: "override", contentType: "text/xml; charset=utf-8", want: "text/xml; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Get("Content-Type")
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer srv.Close()
+
+			c := &GraphClient{
+				credential:     &fakeCredential{},
+				client:         srv.Client(),
+				maxBodyBytes:   defaultMaxBodyBytes,
+				graphBaseURL:   srv.URL,
+				xmlContentType: tt.contentType,
+			}
+			policy := `<TrustFrameworkPolicy PolicyId="B2C_1A_TEST"/>`
+			if _, err := c.doGraphXML(context.Background(), "PUT", c.endpoint("/trustFramework/policies/B2C_1A_TEST/$value"), &policy); err != nil {
+				t.Fatalf("doGraphXML() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Content-Type = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadPreferHeader(t *testing.T) {
+	got := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got[r.Method] = r.Header.Get("Prefer")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	c := &GraphClient{
+		credential:   &fakeCredential{},
+		client:       srv.Client(),
+		maxBodyBytes: defaultMaxBodyBytes,
+		graphBaseURL: srv.URL,
+		uploadPrefer: "return=representation",
+	}
+	url := c.endpoint("/trustFramework/policies/B2C_1A_TEST/$value")
+	policy := `<TrustFrameworkPolicy PolicyId="B2C_1A_TEST"/>`
+	if _, err := c.doGraphXML(context.Background(), "PUT", url, &policy); err != nil {
+		t.Fatalf("doGraphXML() unexpected error: %v", err)
+	}
+	if _, err := c.doGraphXML(context.Background(), "GET", url, nil); err != nil {
+		t.Fatalf("doGraphXML() unexpected error: %v", err)
+	}
+	if got["PUT"] != "return=representation" {
+		t.Errorf("upload Prefer = %q, want return=representation", got["PUT"])
+	}
+	if got["GET"] != "" {
+		t.Errorf("read Prefer = %q, want none", got["GET"])
+	}
+}
+
+func TestPinnedAPIVersion(t *testing.T) {
+	fake := &fakeGraph{responses: map[string]fakeResponse{
+		"GET /v1.0/trustFramework/keySets/B2C_1A_Test": {http.StatusNotFound, `{}`},
+	}}
+	c := newFakeGraphClient(fake)
+	c.apiVersion = graphVersionV1
+
+	if _, err := c.readGraph(context.Background(), "/trustFramework/keySets/%s", "B2C_1A_Test"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("readGraph() = %v, want ErrNotFound without a beta fallback", err)
+	}
+	if got := c.endpoint("/trustFramework/keySets/%s/generateKey", "B2C_1A_Test"); got != fakeGraphBaseURL+"/v1.0/trustFramework/keySets/B2C_1A_Test/generateKey" {
+		t.Errorf("endpoint() = %s, want a v1.0 URL", got)
+	}
+	if strings.Join(fake.calls, "|") != "GET /v1.0/trustFramework/keySets/B2C_1A_Test" {
+		t.Errorf("calls = %v, want only the v1.0 read", fake.calls)
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Proto)
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	rootCAs := srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	tests := []struct {
+		name      string
+		opts      GraphClientOptions
+		wantProto string
+	}{
+		{name: "default", wantProto: "HTTP/2.0"},
+		{name: "disable_http2", opts: GraphClientOptions{DisableHTTP2: true}, wantProto: "HTTP/1.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := newTransport(tt.opts)
+			transport.TLSClientConfig = &tls.Config{RootCAs: rootCAs}
+			resp, err := (&http.Client{Transport: transport}).Get(srv.URL)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != tt.wantProto {
+				t.Errorf("protocol = %s, want %s", body, tt.wantProto)
+			}
+		})
+	}
+
+	transport := newTransport(GraphClientOptions{IdleConnTimeout: 5 * time.Second, MaxIdleConnsPerHost: 8})
+	if transport.IdleConnTimeout != 5*time.Second || transport.MaxIdleConnsPerHost != 8 {
+		t.Errorf("keep-alive settings not applied: idle %s, per host %d", transport.IdleConnTimeout, transport.MaxIdleConnsPerHost)
+	}
+}
@@ -0,0 +1,143 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// maxThrottleRetries is how many times a request answered with 429 is sent
+// again before the 429 is returned to the caller
+const maxThrottleRetries = 3
+
+// throttleRetryDelay is the wait before retrying a 429 without Retry-After;
+// it doubles with each attempt
+var throttleRetryDelay = 2 * time.Second
+
+// errRetryBudgetExhausted is returned instead of retrying a 429 once the
+// waits would exceed retry_budget_seconds
+var errRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// spendRetryBudget reserves delay from the client's retry budget and reports
+// whether it fit. A zero budget is unlimited.
+func (c *GraphClient) spendRetryBudget(delay time.Duration) bool {
+	if c.retryBudget <= 0 {
+		return true
+	}
+	if time.Duration(c.retryWaited.Add(int64(delay))) > c.retryBudget {
+		c.retryWaited.Add(-int64(delay))
+		return false
+	}
+	return true
+}
+
+// throttleStats counts the 429 retries made on behalf of one operation
+type throttleStats struct {
+	retries atomic.Int64
+	backoff atomic.Int64 // nanoseconds
+}
+
+type throttleStatsKey struct{}
+
+// withThrottleStats returns a context that records 429 retries into the
+// returned stats
+func withThrottleStats(ctx context.Context) (context.Context, *throttleStats) {
+	stats := &throttleStats{}
+	return context.WithValue(ctx, throttleStatsKey{}, stats), stats
+}
+
+// warn adds a warning summarizing the retries, if there were any
+func (s *throttleStats) warn(diags *diag.Diagnostics) {
+	retries := s.retries.Load()
+	if retries == 0 {
+		return
+	}
+	diags.AddWarning(
+		"Microsoft Graph throttled requests",
+		fmt.Sprintf(
+			"Graph answered 429 Too Many Requests %d time(s) during this operation and the provider waited %s in total before retrying. If this keeps happening, lower terraform -parallelism.",
+			retries, time.Duration(s.backoff.Load()).Round(time.Millisecond),
+		),
+	)
+}
+
+// retryAfter returns how long Graph asked the client to wait, falling back to
+// an exponential delay when the response has no usable Retry-After
+func retryAfter(resp *http.Response, attempt int) time.Duration {
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second
+	}
+	return throttleRetryDelay << attempt
+}
+
+// waitAfterWrite sleeps for post_write_delay_ms after a successful write, as
+// Graph can briefly serve stale data after a create or upload
+func (c *GraphClient) waitAfterWrite(ctx context.Context, req *http.Request, resp *http.Response) {
+	if c.postWriteDelay <= 0 || req.Method == http.MethodGet || resp.StatusCode >= 300 {
+		return
+	}
+	tflog.Debug(ctx, "Waiting after write for Graph to become consistent", map[string]any{
+		"url":   req.URL.String(),
+		"delay": c.postWriteDelay.String(),
+	})
+	select {
+	case <-ctx.Done():
+	case <-time.After(c.postWriteDelay):
+	}
+}
+
+// send performs req, retrying while Graph answers 429 and recording the
+// retries in the operation's throttleStats. It gives up once the retries of
+// all requests together have waited for the whole retry budget.
+func (c *GraphClient) send(ctx context.Context, req *http.Request) (*http.Response, error) {
+	if c.readOnly && req.Method != http.MethodGet {
+		return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL, errReadOnly)
+	}
+	for attempt := 0; ; attempt++ {
+		resp, err := c.client.Do(req)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests || attempt == maxThrottleRetries {
+			c.emitCurl(ctx, req, resp, err)
+			if err == nil {
+				c.waitAfterWrite(ctx, req, resp)
+			}
+			return resp, err
+		}
+		delay := retryAfter(resp, attempt)
+		resp.Body.Close()
+		if !c.spendRetryBudget(delay) {
+			c.emitCurl(ctx, req, resp, nil)
+			return nil, fmt.Errorf(
+				"%s %s: Graph is still throttling and waiting another %s would exceed retry_budget_seconds (%s) for this run; raise retry_budget_seconds or lower terraform -parallelism: %w",
+				req.Method, req.URL, delay, c.retryBudget, errRetryBudgetExhausted,
+			)
+		}
+		tflog.Warn(ctx, "Graph throttled the request, retrying", map[string]any{
+			"url":     req.URL.String(),
+			"attempt": attempt + 1,
+			"delay":   delay.String(),
+		})
+		if stats, ok := ctx.Value(throttleStatsKey{}).(*throttleStats); ok {
+			stats.retries.Add(1)
+			stats.backoff.Add(int64(delay))
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
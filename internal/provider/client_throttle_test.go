@@ -0,0 +1,155 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+)
+
+func TestRetryAfter(t *testing.T) {
+	withHeader := &http.Response{Header: http.Header{"Retry-After": []string{"5"}}}
+	if got := retryAfter(withHeader, 2); got != 5*time.Second {
+		t.Errorf("retryAfter() with header = %s, want 5s", got)
+	}
+	withoutHeader := &http.Response{Header: http.Header{}}
+	if got := retryAfter(withoutHeader, 2); got != 4*throttleRetryDelay {
+		t.Errorf("retryAfter() without header = %s, want %s", got, 4*throttleRetryDelay)
+	}
+}
+
+func TestSendRetriesThrottledRequests(t *testing.T) {
+	tests := []struct {
+		name        string
+		throttled   int
+		wantStatus  int
+		wantRetries int64
+	}{
+		{name: "not throttled", throttled: 0, wantStatus: http.StatusOK, wantRetries: 0},
+		{name: "throttled then ok", throttled: 2, wantStatus: http.StatusOK, wantRetries: 2},
+		{name: "throttled throughout", throttled: 10, wantStatus: http.StatusTooManyRequests, wantRetries: maxThrottleRetries},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if body, _ := io.ReadAll(r.Body); string(body) != `{"use":"sig"}` {
+					t.Errorf("attempt %d sent body %q", calls, body)
+				}
+				if calls <= tt.throttled {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer srv.Close()
+
+			c := &GraphClient{
+				credential:   &fakeCredential{},
+				client:       srv.Client(),
+				maxBodyBytes: defaultMaxBodyBytes,
+				graphBaseURL: srv.URL,
+			}
+			ctx, stats := withThrottleStats(context.Background())
+			resp, err := c.doGraph(ctx, "POST", srv.URL+"/beta/trustFramework/keySets", map[string]string{"use": "sig"})
+			if err != nil {
+				t.Fatalf("doGraph() unexpected error: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := stats.retries.Load(); got != tt.wantRetries {
+				t.Errorf("retries = %d, want %d", got, tt.wantRetries)
+			}
+
+			var diags diag.Diagnostics
+			stats.warn(&diags)
+			if got, want := diags.WarningsCount(), min(int(tt.wantRetries), 1); got != want {
+				t.Errorf("got %d warnings, want %d: %v", got, want, diags)
+			}
+		})
+	}
+}
+
+func TestSendRetryBudget(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	c := &GraphClient{
+		credential:   &fakeCredential{},
+		client:       srv.Client(),
+		maxBodyBytes: defaultMaxBodyBytes,
+		graphBaseURL: srv.URL,
+		retryBudget:  1500 * time.Millisecond,
+	}
+	_, err := c.doGraph(context.Background(), "GET", srv.URL+"/beta/trustFramework/keySets", nil)
+	if !errors.Is(err, errRetryBudgetExhausted) {
+		t.Fatalf("doGraph() error = %v, want the retry budget to be exhausted", err)
+	}
+	if calls != 2 {
+		t.Errorf("Graph was called %d times, want 2 (one retry fits the budget)", calls)
+	}
+
+	// The budget is shared by the whole run, so the next request fails
+	// without retrying
+	calls = 0
+	if _, err := c.doGraph(context.Background(), "GET", srv.URL+"/beta/trustFramework/keySets", nil); !errors.Is(err, errRetryBudgetExhausted) {
+		t.Fatalf("second doGraph() error = %v, want the retry budget to be exhausted", err)
+	}
+	if calls != 1 {
+		t.Errorf("second request called Graph %d times, want 1", calls)
+	}
+}
+
+func TestSendPostWriteDelay(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/beta/trustFramework/keySets/B2C_1A_Missing/uploadSecret" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	c := &GraphClient{
+		credential:     &fakeCredential{},
+		client:         srv.Client(),
+		maxBodyBytes:   defaultMaxBodyBytes,
+		graphBaseURL:   srv.URL,
+		postWriteDelay: 200 * time.Millisecond,
+	}
+	tests := []struct {
+		name      string
+		method    string
+		url       string
+		wantDelay bool
+	}{
+		{name: "successful write", method: "POST", url: "/beta/trustFramework/keySets", wantDelay: true},
+		{name: "failed write", method: "POST", url: "/beta/trustFramework/keySets/B2C_1A_Missing/uploadSecret"},
+		{name: "read", method: "GET", url: "/beta/trustFramework/keySets"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			if _, err := c.doGraph(context.Background(), tt.method, srv.URL+tt.url, nil); err != nil {
+				t.Fatal(err)
+			}
+			if delayed := time.Since(start) >= c.postWriteDelay; delayed != tt.wantDelay {
+				t.Errorf("delayed = %v, want %v", delayed, tt.wantDelay)
+			}
+		})
+	}
+}
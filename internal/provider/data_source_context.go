@@ -0,0 +1,92 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+type ContextDataSource struct {
+	client *GraphClient
+}
+
+type ContextDataSourceModel struct {
+	TenantId     types.String `tfsdk:"tenant_id"`
+	Environment  types.String `tfsdk:"environment"`
+	GraphBaseURL types.String `tfsdk:"graph_base_url"`
+}
+
+func NewContextDataSource() datasource.DataSource {
+	return &ContextDataSource{}
+}
+
+func (d *ContextDataSource) Metadata(
+	_ context.Context,
+	req datasource.MetadataRequest,
+	resp *datasource.MetadataResponse,
+) {
+	resp.TypeName = req.ProviderTypeName + "_context"
+}
+
+func (d *ContextDataSource) Schema(
+	_ context.Context,
+	_ datasource.SchemaRequest,
+	resp *datasource.SchemaResponse,
+) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Exposes the tenant and cloud the provider resolved at configure time. Useful for building authorize URLs and for checking which tenant a configuration talks to.",
+		Attributes: map[string]schema.Attribute{
+			"tenant_id": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "The tenant ID the provider authenticates against.",
+			},
+			"environment": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "The Azure cloud environment in use, derived from the provider's `graph_base_url`: `public`, `usgovernment`, `usgovernmentdod` or `china`. Other hosts, such as a mock Graph, report `public`.",
+			},
+			"graph_base_url": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "The Microsoft Graph base URL requests are sent to.",
+			},
+		},
+	}
+}
+
+func (d *ContextDataSource) Configure(
+	_ context.Context,
+	req datasource.ConfigureRequest,
+	resp *datasource.ConfigureResponse,
+) {
+	if req.ProviderData == nil {
+		return
+	}
+	d.client = req.ProviderData.(*GraphClient)
+}
+
+func (d *ContextDataSource) Read(
+	ctx context.Context,
+	req datasource.ReadRequest,
+	resp *datasource.ReadResponse,
+) {
+	if d.client == nil {
+		resp.Diagnostics.AddError(
+			"Provider not configured",
+			"The provider must be configured before reading the context data source.",
+		)
+		return
+	}
+
+	data := ContextDataSourceModel{
+		TenantId:     types.StringValue(d.client.tenantId),
+		Environment:  types.StringValue(d.client.environment),
+		GraphBaseURL: types.StringValue(d.client.graphBaseURL),
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	tflog.Debug(ctx, "Context READ complete", map[string]any{
+		"tenant_id": d.client.tenantId,
+	})
+}
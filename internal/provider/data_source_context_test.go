@@ -0,0 +1,80 @@
+package provider
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+func TestAccContextDataSource_Basic(t *testing.T) {
+	dataSourceName := "data.azure_b2c_ief_context.test"
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(t),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccContextDataSourceConfig(),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(dataSourceName, "tenant_id", os.Getenv("AZURE_TENANT_ID")),
+					resource.TestCheckResourceAttr(dataSourceName, "environment", "public"),
+					resource.TestCheckResourceAttr(dataSourceName, "graph_base_url", "https://graph.microsoft.com"),
+				),
+			},
+		},
+	})
+}
+
+func TestContextDataSourceEnvironment(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		want    string
+	}{
+		{baseURL: "", want: "public"},
+		{baseURL: govGraphBaseURL, want: "usgovernment"},
+		{baseURL: "https://dod-graph.microsoft.us/", want: "usgovernmentdod"},
+		{baseURL: "https://microsoftgraph.chinacloudapi.cn", want: "china"},
+		{baseURL: fakeGraphBaseURL, want: "public"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want+" "+tt.baseURL, func(t *testing.T) {
+			ctx := context.Background()
+			client, err := NewGraphClient(ctx, "contoso.onmicrosoft.com", "", "", GraphClientOptions{
+				GraphBaseURL:        tt.baseURL,
+				AccessToken:         "token",
+				SkipCredentialCheck: true,
+			})
+			if err != nil {
+				t.Fatalf("NewGraphClient() unexpected error: %s", err)
+			}
+			d := &ContextDataSource{client: client}
+
+			schemaResp := &datasource.SchemaResponse{}
+			d.Schema(ctx, datasource.SchemaRequest{}, schemaResp)
+			objType := schemaResp.Schema.Type().TerraformType(ctx)
+			resp := &datasource.ReadResponse{State: tfsdk.State{Schema: schemaResp.Schema, Raw: tftypes.NewValue(objType, nil)}}
+			d.Read(ctx, datasource.ReadRequest{}, resp)
+			if resp.Diagnostics.HasError() {
+				t.Fatalf("Read() unexpected error: %v", resp.Diagnostics)
+			}
+
+			var data ContextDataSourceModel
+			resp.State.Get(ctx, &data)
+			if data.Environment.ValueString() != tt.want {
+				t.Errorf("environment = %s, want %s", data.Environment, tt.want)
+			}
+		})
+	}
+}
+
+func testAccContextDataSourceConfig() string {
+	return `
+data "azure_b2c_ief_context" "test" {}
+`
+}
@@ -0,0 +1,125 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+)
+
+const govGraphBaseURL = "https://graph.microsoft.us"
+
+// urlRecorder is a graphDoer that records every URL it is asked to call and
+// answers with an empty 200
+type urlRecorder struct {
+	urls []string
+}
+
+func (u *urlRecorder) record(method, url string) (*http.Response, error) {
+	u.urls = append(u.urls, url)
+	req, _ := http.NewRequest(method, url, nil)
+	return &http.Response{
+		Status:     http.StatusText(http.StatusOK),
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(`{"value":[]}`)),
+		Request:    req,
+	}, nil
+}
+
+func (u *urlRecorder) doGraph(_ context.Context, method, url string, _ any) (*http.Response, error) {
+	return u.record(method, url)
+}
+
+func (u *urlRecorder) doGraphXML(_ context.Context, method, url string, _ *string) (*http.Response, error) {
+	return u.record(method, url)
+}
+
+func (u *urlRecorder) doGraphXMLGzip(_ context.Context, method, url string, _ string) (*http.Response, error) {
+	return u.record(method, url)
+}
+
+// TestDataSourcesUseGraphBaseURL reads every data source against a US
+// Government Graph and checks none of them calls public Graph
+func TestDataSourcesUseGraphBaseURL(t *testing.T) {
+	ctx := context.Background()
+	for _, newDataSource := range New().DataSources(ctx) {
+		d := newDataSource()
+		metaResp := &datasource.MetadataResponse{}
+		d.Metadata(ctx, datasource.MetadataRequest{ProviderTypeName: "azure_b2c_ief"}, metaResp)
+
+		t.Run(metaResp.TypeName, func(t *testing.T) {
+			recorder := &urlRecorder{}
+			client := newFakeGraphClient(nil)
+			client.graphBaseURL = govGraphBaseURL
+			client.doer = recorder
+			client.credential = &scopeCredential{}
+			configureResp := &datasource.ConfigureResponse{}
+			d.(datasource.DataSourceWithConfigure).Configure(ctx, datasource.ConfigureRequest{ProviderData: client}, configureResp)
+
+			schemaResp := &datasource.SchemaResponse{}
+			d.Schema(ctx, datasource.SchemaRequest{}, schemaResp)
+			objType := schemaResp.Schema.Type().TerraformType(ctx).(tftypes.Object)
+			values := map[string]tftypes.Value{}
+			for name, attrType := range objType.AttributeTypes {
+				values[name] = tftypes.NewValue(attrType, nil)
+				if attr := schemaResp.Schema.Attributes[name]; attr != nil && attr.IsRequired() {
+					values[name] = tftypes.NewValue(tftypes.String, "B2C_1A_Test")
+				}
+			}
+			config := tfsdk.Config{Schema: schemaResp.Schema, Raw: tftypes.NewValue(objType, values)}
+			resp := &datasource.ReadResponse{State: tfsdk.State{Schema: schemaResp.Schema, Raw: config.Raw}}
+			d.Read(ctx, datasource.ReadRequest{Config: config}, resp)
+
+			// context and permissions only report what the provider
+			// already holds
+			if len(recorder.urls) == 0 && metaResp.TypeName != "azure_b2c_ief_context" && metaResp.TypeName != "azure_b2c_ief_permissions" {
+				t.Fatalf("Read() made no Graph requests: %v", resp.Diagnostics)
+			}
+			for _, url := range recorder.urls {
+				if !strings.HasPrefix(url, govGraphBaseURL+"/") {
+					t.Errorf("requested %s, want a %s URL", url, govGraphBaseURL)
+				}
+			}
+		})
+	}
+}
+
+// scopeCredential records the scopes tokens are requested for
+type scopeCredential struct {
+	scopes []string
+}
+
+func (s *scopeCredential) GetToken(_ context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	s.scopes = opts.Scopes
+	return azcore.AccessToken{Token: "token"}, nil
+}
+
+func TestTokenScope(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		want    string
+	}{
+		{baseURL: defaultGraphBaseURL, want: "https://graph.microsoft.com/.default"},
+		{baseURL: govGraphBaseURL, want: "https://graph.microsoft.us/.default"},
+		{baseURL: "https://localhost:8443", want: "https://graph.microsoft.com/.default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.baseURL, func(t *testing.T) {
+			cred := &scopeCredential{}
+			c := &GraphClient{credential: cred, graphBaseURL: tt.baseURL}
+			if _, err := c.getToken(context.Background()); err != nil {
+				t.Fatalf("getToken() unexpected error: %v", err)
+			}
+			if len(cred.scopes) != 1 || cred.scopes[0] != tt.want {
+				t.Errorf("scopes = %v, want [%s]", cred.scopes, tt.want)
+			}
+		})
+	}
+}
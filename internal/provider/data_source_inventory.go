@@ -0,0 +1,143 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const (
+	inventoryTypePolicyKey = "policy_key"
+	inventoryTypePolicy    = "policy"
+)
+
+type InventoryDataSource struct {
+	client *GraphClient
+}
+
+type InventoryDataSourceModel struct {
+	Items []InventoryItem `tfsdk:"items"`
+}
+
+type InventoryItem struct {
+	Id   types.String `tfsdk:"id"`
+	Name types.String `tfsdk:"name"`
+	Type types.String `tfsdk:"type"`
+}
+
+func NewInventoryDataSource() datasource.DataSource {
+	return &InventoryDataSource{}
+}
+
+func (d *InventoryDataSource) Metadata(
+	_ context.Context,
+	req datasource.MetadataRequest,
+	resp *datasource.MetadataResponse,
+) {
+	resp.TypeName = req.ProviderTypeName + "_inventory"
+}
+
+func (d *InventoryDataSource) Schema(
+	_ context.Context,
+	_ datasource.SchemaRequest,
+	resp *datasource.SchemaResponse,
+) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Lists every policy key container and Trust Framework policy in the tenant, for adopting an existing tenant with `import` blocks and `for_each`.",
+		Attributes: map[string]schema.Attribute{
+			"items": schema.ListNestedAttribute{
+				Computed:            true,
+				MarkdownDescription: "Keysets first, then policies.",
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"id": schema.StringAttribute{
+							Computed:            true,
+							MarkdownDescription: "The import ID, i.e. the keyset or policy ID.",
+						},
+						"name": schema.StringAttribute{
+							Computed:            true,
+							MarkdownDescription: "A Terraform-safe resource name derived from the ID, e.g. `b2c_1a_trustframeworkbase`. Unique within a `type`.",
+						},
+						"type": schema.StringAttribute{
+							Computed:            true,
+							MarkdownDescription: "`policy_key` for keysets or `policy` for policies, naming the resource to import into.",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (d *InventoryDataSource) Configure(
+	_ context.Context,
+	req datasource.ConfigureRequest,
+	resp *datasource.ConfigureResponse,
+) {
+	if req.ProviderData == nil {
+		return
+	}
+	d.client = req.ProviderData.(*GraphClient)
+}
+
+var inventoryNameUnsafe = regexp.MustCompile(`[^a-z0-9_]`)
+
+// inventoryName turns a keyset or policy ID into a resource name. IDs are
+// case-insensitive in B2C, so lowercasing keeps names unique.
+func inventoryName(id string) string {
+	return inventoryNameUnsafe.ReplaceAllString(strings.ToLower(id), "_")
+}
+
+func (d *InventoryDataSource) Read(
+	ctx context.Context,
+	req datasource.ReadRequest,
+	resp *datasource.ReadResponse,
+) {
+	if d.client == nil {
+		resp.Diagnostics.AddError(
+			"Provider not configured",
+			"The provider must be configured before reading the inventory data source.",
+		)
+		return
+	}
+
+	data := InventoryDataSourceModel{Items: []InventoryItem{}}
+	for _, list := range []struct {
+		path     string
+		itemType string
+	}{
+		{"/trustFramework/keySets", inventoryTypePolicyKey},
+		{"/trustFramework/policies", inventoryTypePolicy},
+	} {
+		items, err := d.client.getAllPages(ctx, list.path)
+		if err != nil {
+			addErrorDiagnostic(&resp.Diagnostics, "Error listing "+list.itemType+" inventory", err)
+			return
+		}
+		for _, item := range items {
+			var entry struct {
+				Id string `json:"id"`
+			}
+			if err := json.Unmarshal(item, &entry); err != nil {
+				resp.Diagnostics.AddError("Error parsing "+list.itemType+" inventory", string(item))
+				return
+			}
+			data.Items = append(data.Items, InventoryItem{
+				Id:   types.StringValue(entry.Id),
+				Name: types.StringValue(inventoryName(entry.Id)),
+				Type: types.StringValue(list.itemType),
+			})
+		}
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	tflog.Debug(ctx, "Inventory READ complete", map[string]any{
+		"count": len(data.Items),
+	})
+}
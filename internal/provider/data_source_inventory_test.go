@@ -0,0 +1,70 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+func TestInventoryDataSourceRead(t *testing.T) {
+	fake := &fakeGraph{responses: map[string]fakeResponse{
+		"GET /trustFramework/keySets": {
+			http.StatusOK,
+			`{"value":[{"id":"B2C_1A_TokenSigningKeyContainer","keys":[{"kid":"a"}]}]}`,
+		},
+		"GET /trustFramework/policies": {
+			http.StatusOK,
+			`{"value":[{"id":"B2C_1A_TrustFrameworkBase"},{"id":"B2C_1A_signup-signin"}]}`,
+		},
+	}}
+	d := &InventoryDataSource{client: newFakeGraphClient(fake)}
+
+	schemaResp := &datasource.SchemaResponse{}
+	d.Schema(context.Background(), datasource.SchemaRequest{}, schemaResp)
+	objType := schemaResp.Schema.Type().TerraformType(context.Background()).(tftypes.Object)
+	resp := &datasource.ReadResponse{State: tfsdk.State{
+		Schema: schemaResp.Schema,
+		Raw:    tftypes.NewValue(objType, nil),
+	}}
+	d.Read(context.Background(), datasource.ReadRequest{}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Read() unexpected error: %v", resp.Diagnostics)
+	}
+
+	var data InventoryDataSourceModel
+	resp.State.Get(context.Background(), &data)
+	want := []struct{ id, name, itemType string }{
+		{"B2C_1A_TokenSigningKeyContainer", "b2c_1a_tokensigningkeycontainer", "policy_key"},
+		{"B2C_1A_TrustFrameworkBase", "b2c_1a_trustframeworkbase", "policy"},
+		{"B2C_1A_signup-signin", "b2c_1a_signup_signin", "policy"},
+	}
+	if len(data.Items) != len(want) {
+		t.Fatalf("got %d items, want %d: %v", len(data.Items), len(want), data.Items)
+	}
+	for i, w := range want {
+		got := data.Items[i]
+		if got.Id.ValueString() != w.id || got.Name.ValueString() != w.name || got.Type.ValueString() != w.itemType {
+			t.Errorf("item %d = %v, want %v", i, got, w)
+		}
+	}
+}
+
+func TestAccInventoryDataSource_Basic(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(t),
+		Steps: []resource.TestStep{
+			{
+				Config: `data "azure_b2c_ief_inventory" "test" {}`,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrSet("data.azure_b2c_ief_inventory.test", "items.#"),
+				),
+			},
+		},
+	})
+}
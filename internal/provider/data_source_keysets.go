@@ -0,0 +1,112 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+type KeysetsDataSource struct {
+	client *GraphClient
+}
+
+type KeysetsDataSourceModel struct {
+	Keysets []KeysetSummary `tfsdk:"keysets"`
+}
+
+type KeysetSummary struct {
+	Id        types.String `tfsdk:"id"`
+	KeysCount types.Int64  `tfsdk:"keys_count"`
+}
+
+func NewKeysetsDataSource() datasource.DataSource {
+	return &KeysetsDataSource{}
+}
+
+func (d *KeysetsDataSource) Metadata(
+	_ context.Context,
+	req datasource.MetadataRequest,
+	resp *datasource.MetadataResponse,
+) {
+	resp.TypeName = req.ProviderTypeName + "_keysets"
+}
+
+func (d *KeysetsDataSource) Schema(
+	_ context.Context,
+	_ datasource.SchemaRequest,
+	resp *datasource.SchemaResponse,
+) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Lists the policy key containers (keysets) in the tenant with how many keys each holds. Failed applies can leave empty containers behind; filter on `keys_count == 0` to find them for cleanup.",
+		Attributes: map[string]schema.Attribute{
+			"keysets": schema.ListNestedAttribute{
+				Computed:            true,
+				MarkdownDescription: "The keysets in the tenant.",
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"id": schema.StringAttribute{
+							Computed:            true,
+							MarkdownDescription: "The keyset ID, e.g. `B2C_1A_TokenSigningKeyContainer`.",
+						},
+						"keys_count": schema.Int64Attribute{
+							Computed:            true,
+							MarkdownDescription: "Number of keys in the keyset. `0` means the container is empty.",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (d *KeysetsDataSource) Configure(
+	_ context.Context,
+	req datasource.ConfigureRequest,
+	resp *datasource.ConfigureResponse,
+) {
+	if req.ProviderData == nil {
+		return
+	}
+	d.client = req.ProviderData.(*GraphClient)
+}
+
+func (d *KeysetsDataSource) Read(
+	ctx context.Context,
+	req datasource.ReadRequest,
+	resp *datasource.ReadResponse,
+) {
+	if d.client == nil {
+		resp.Diagnostics.AddError(
+			"Provider not configured",
+			"The provider must be configured before reading the keysets data source.",
+		)
+		return
+	}
+
+	items, err := d.client.getAllPages(ctx, "/trustFramework/keySets")
+	if err != nil {
+		addErrorDiagnostic(&resp.Diagnostics, "Error listing keysets", err)
+		return
+	}
+
+	data := KeysetsDataSourceModel{Keysets: make([]KeysetSummary, 0, len(items))}
+	for _, item := range items {
+		keyset, err := decodeKeyset(ctx, item)
+		if err != nil {
+			resp.Diagnostics.AddError("Error parsing keyset", string(item))
+			return
+		}
+		data.Keysets = append(data.Keysets, KeysetSummary{
+			Id:        types.StringValue(keyset.Id),
+			KeysCount: types.Int64Value(int64(len(keyset.Keys))),
+		})
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	tflog.Debug(ctx, "Keysets READ complete", map[string]any{
+		"count": len(data.Keysets),
+	})
+}
@@ -0,0 +1,58 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+func TestKeysetsDataSourceRead(t *testing.T) {
+	fake := &fakeGraph{responses: map[string]fakeResponse{
+		"GET /trustFramework/keySets": {
+			http.StatusOK,
+			`{"value":[{"id":"B2C_1A_Signing","keys":[{"kid":"a"},{"kid":"b"}]},{"id":"B2C_1A_Leftover","keys":[]}]}`,
+		},
+	}}
+	d := &KeysetsDataSource{client: newFakeGraphClient(fake)}
+
+	schemaResp := &datasource.SchemaResponse{}
+	d.Schema(context.Background(), datasource.SchemaRequest{}, schemaResp)
+	objType := schemaResp.Schema.Type().TerraformType(context.Background()).(tftypes.Object)
+	resp := &datasource.ReadResponse{State: tfsdk.State{
+		Schema: schemaResp.Schema,
+		Raw:    tftypes.NewValue(objType, nil),
+	}}
+	d.Read(context.Background(), datasource.ReadRequest{}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Read() unexpected error: %v", resp.Diagnostics)
+	}
+
+	var data KeysetsDataSourceModel
+	resp.State.Get(context.Background(), &data)
+	if len(data.Keysets) != 2 {
+		t.Fatalf("got %d keysets, want 2", len(data.Keysets))
+	}
+	if data.Keysets[0].KeysCount.ValueInt64() != 2 || data.Keysets[1].KeysCount.ValueInt64() != 0 {
+		t.Errorf("unexpected keys_count values: %v", data.Keysets)
+	}
+}
+
+func TestAccKeysetsDataSource_Basic(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(t),
+		Steps: []resource.TestStep{
+			{
+				Config: `data "azure_b2c_ief_keysets" "test" {}`,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrSet("data.azure_b2c_ief_keysets.test", "keysets.#"),
+				),
+			},
+		},
+	})
+}
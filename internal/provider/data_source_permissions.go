@@ -0,0 +1,165 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// requiredRoles are the Graph application permissions the provider needs to
+// manage policies and policy keys
+var requiredRoles = []string{
+	"Policy.ReadWrite.TrustFramework",
+	"TrustFrameworkKeySet.ReadWrite.All",
+}
+
+type PermissionsDataSource struct {
+	client *GraphClient
+}
+
+type PermissionsDataSourceModel struct {
+	Roles        types.List   `tfsdk:"roles"`
+	MissingRoles types.List   `tfsdk:"missing_roles"`
+	AppId        types.String `tfsdk:"app_id"`
+	TenantId     types.String `tfsdk:"tenant_id"`
+}
+
+// tokenClaims are the access token claims the data source reports
+type tokenClaims struct {
+	Roles []string `json:"roles"`
+	AppId string   `json:"appid"`
+	Tid   string   `json:"tid"`
+}
+
+// decodeTokenClaims reads the claims of a JWT access token. The signature is
+// not verified; Graph does that, this is only for reporting.
+func decodeTokenClaims(token string) (tokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return tokenClaims{}, errors.New("The access token is not a JWT, so its roles cannot be read")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return tokenClaims{}, fmt.Errorf("Unable to decode the access token payload: %s", err)
+	}
+	var claims tokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return tokenClaims{}, fmt.Errorf("Unable to parse the access token claims: %s", err)
+	}
+	return claims, nil
+}
+
+func NewPermissionsDataSource() datasource.DataSource {
+	return &PermissionsDataSource{}
+}
+
+func (d *PermissionsDataSource) Metadata(
+	_ context.Context,
+	req datasource.MetadataRequest,
+	resp *datasource.MetadataResponse,
+) {
+	resp.TypeName = req.ProviderTypeName + "_permissions"
+}
+
+func (d *PermissionsDataSource) Schema(
+	_ context.Context,
+	_ datasource.SchemaRequest,
+	resp *datasource.SchemaResponse,
+) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Lists the Graph application permissions (app roles) granted to the provider's service principal, as carried in the `roles` claim of its access token. Use it to debug `403 Forbidden` errors without opening the Azure portal. The token is decoded locally; no Graph request is made.",
+		Attributes: map[string]schema.Attribute{
+			"roles": schema.ListAttribute{
+				Computed:            true,
+				ElementType:         types.StringType,
+				MarkdownDescription: "The app roles in the access token, sorted, e.g. `Policy.ReadWrite.TrustFramework`. Empty when the service principal was granted none.",
+			},
+			"missing_roles": schema.ListAttribute{
+				Computed:            true,
+				ElementType:         types.StringType,
+				MarkdownDescription: "Permissions the provider needs to manage policies and policy keys, `Policy.ReadWrite.TrustFramework` and `TrustFrameworkKeySet.ReadWrite.All`, that are not in `roles`.",
+			},
+			"app_id": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "Application (client) ID the token was issued to, from its `appid` claim.",
+			},
+			"tenant_id": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "Tenant ID the token was issued by, from its `tid` claim.",
+			},
+		},
+	}
+}
+
+func (d *PermissionsDataSource) Configure(
+	_ context.Context,
+	req datasource.ConfigureRequest,
+	resp *datasource.ConfigureResponse,
+) {
+	if req.ProviderData == nil {
+		return
+	}
+	d.client = req.ProviderData.(*GraphClient)
+}
+
+func (d *PermissionsDataSource) Read(
+	ctx context.Context,
+	req datasource.ReadRequest,
+	resp *datasource.ReadResponse,
+) {
+	if d.client == nil {
+		resp.Diagnostics.AddError(
+			"Provider not configured",
+			"The provider must be configured before reading the permissions data source.",
+		)
+		return
+	}
+
+	token, err := d.client.getToken(ctx)
+	if err != nil {
+		addErrorDiagnostic(&resp.Diagnostics, "Unable to get an access token", err)
+		return
+	}
+	claims, err := decodeTokenClaims(token)
+	if err != nil {
+		addErrorDiagnostic(&resp.Diagnostics, "Unable to read the access token", err)
+		return
+	}
+
+	roles := append([]string{}, claims.Roles...)
+	slices.Sort(roles)
+	missing := []string{}
+	for _, role := range requiredRoles {
+		if !slices.Contains(roles, role) {
+			missing = append(missing, role)
+		}
+	}
+
+	data := PermissionsDataSourceModel{
+		AppId:    types.StringValue(claims.AppId),
+		TenantId: types.StringValue(claims.Tid),
+	}
+	list, diags := types.ListValueFrom(ctx, types.StringType, roles)
+	resp.Diagnostics.Append(diags...)
+	data.Roles = list
+	list, diags = types.ListValueFrom(ctx, types.StringType, missing)
+	resp.Diagnostics.Append(diags...)
+	data.MissingRoles = list
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	tflog.Debug(ctx, "Permissions READ complete", map[string]any{
+		"roles": roles,
+	})
+}
@@ -0,0 +1,64 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"slices"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+)
+
+func TestDecodeTokenClaims(t *testing.T) {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"appid":"app","tid":"tenant","roles":["TrustFrameworkKeySet.ReadWrite.All"]}`))
+	claims, err := decodeTokenClaims("header." + payload + ".signature")
+	if err != nil {
+		t.Fatalf("decodeTokenClaims() unexpected error: %v", err)
+	}
+	if claims.AppId != "app" || claims.Tid != "tenant" || !slices.Equal(claims.Roles, []string{"TrustFrameworkKeySet.ReadWrite.All"}) {
+		t.Errorf("decodeTokenClaims() = %+v", claims)
+	}
+
+	if _, err := decodeTokenClaims("opaque-token"); err == nil {
+		t.Errorf("decodeTokenClaims() accepted a token that is not a JWT")
+	}
+}
+
+func TestPermissionsDataSourceRead(t *testing.T) {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"appid":"app","tid":"tenant","roles":["User.Read.All","Policy.ReadWrite.TrustFramework"]}`))
+	client := newFakeGraphClient(&fakeGraph{})
+	client.credential = staticTokenCredential{token: "header." + payload + ".signature"}
+	d := &PermissionsDataSource{client: client}
+
+	schemaResp := &datasource.SchemaResponse{}
+	d.Schema(context.Background(), datasource.SchemaRequest{}, schemaResp)
+	objType := schemaResp.Schema.Type().TerraformType(context.Background()).(tftypes.Object)
+	values := map[string]tftypes.Value{}
+	for name, attrType := range objType.AttributeTypes {
+		values[name] = tftypes.NewValue(attrType, nil)
+	}
+	config := tfsdk.Config{Schema: schemaResp.Schema, Raw: tftypes.NewValue(objType, values)}
+
+	resp := &datasource.ReadResponse{State: tfsdk.State{Schema: schemaResp.Schema, Raw: config.Raw}}
+	d.Read(context.Background(), datasource.ReadRequest{Config: config}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Read() unexpected error: %v", resp.Diagnostics)
+	}
+
+	var data PermissionsDataSourceModel
+	resp.State.Get(context.Background(), &data)
+	var roles, missing []string
+	data.Roles.ElementsAs(context.Background(), &roles, false)
+	data.MissingRoles.ElementsAs(context.Background(), &missing, false)
+	if !slices.Equal(roles, []string{"Policy.ReadWrite.TrustFramework", "User.Read.All"}) {
+		t.Errorf("roles = %v, want them sorted", roles)
+	}
+	if !slices.Equal(missing, []string{"TrustFrameworkKeySet.ReadWrite.All"}) {
+		t.Errorf("missing_roles = %v, want TrustFrameworkKeySet.ReadWrite.All", missing)
+	}
+	if data.AppId.ValueString() != "app" || data.TenantId.ValueString() != "tenant" {
+		t.Errorf("app_id = %s, tenant_id = %s", data.AppId, data.TenantId)
+	}
+}
@@ -0,0 +1,97 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+type PingDataSource struct {
+	client *GraphClient
+}
+
+type PingDataSourceModel struct {
+	Ok       types.Bool   `tfsdk:"ok"`
+	TenantId types.String `tfsdk:"tenant_id"`
+}
+
+func NewPingDataSource() datasource.DataSource {
+	return &PingDataSource{}
+}
+
+func (d *PingDataSource) Metadata(
+	_ context.Context,
+	req datasource.MetadataRequest,
+	resp *datasource.MetadataResponse,
+) {
+	resp.TypeName = req.ProviderTypeName + "_ping"
+}
+
+func (d *PingDataSource) Schema(
+	_ context.Context,
+	_ datasource.SchemaRequest,
+	resp *datasource.SchemaResponse,
+) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Performs a minimal authenticated call against the Trust Framework API to confirm the provider credentials and permissions work. Reading fails with the Graph error when they do not.",
+		Attributes: map[string]schema.Attribute{
+			"ok": schema.BoolAttribute{
+				Computed:            true,
+				MarkdownDescription: "`true` when Graph accepted the request.",
+			},
+			"tenant_id": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "The tenant ID the provider authenticated against.",
+			},
+		},
+	}
+}
+
+func (d *PingDataSource) Configure(
+	_ context.Context,
+	req datasource.ConfigureRequest,
+	resp *datasource.ConfigureResponse,
+) {
+	if req.ProviderData == nil {
+		return
+	}
+	d.client = req.ProviderData.(*GraphClient)
+}
+
+func (d *PingDataSource) Read(
+	ctx context.Context,
+	req datasource.ReadRequest,
+	resp *datasource.ReadResponse,
+) {
+	if d.client == nil {
+		resp.Diagnostics.AddError(
+			"Provider not configured",
+			"The provider must be configured before reading the ping data source.",
+		)
+		return
+	}
+
+	gr, err := d.client.readGraph(ctx, "/trustFramework/policies?$top=1")
+	if err != nil {
+		addErrorDiagnostic(&resp.Diagnostics, "Graph ping failed", err)
+		return
+	}
+	if err := d.client.expectStatus(gr, http.StatusOK); err != nil {
+		addErrorDiagnostic(&resp.Diagnostics, "Graph ping failed", err)
+		return
+	}
+
+	data := PingDataSourceModel{
+		Ok:       types.BoolValue(true),
+		TenantId: types.StringValue(d.client.tenantId),
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	tflog.Debug(ctx, "Ping READ complete", map[string]any{
+		"tenant_id": d.client.tenantId,
+	})
+}
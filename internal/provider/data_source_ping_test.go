@@ -0,0 +1,32 @@
+package provider
+
+import (
+	"os"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+func TestAccPingDataSource_Basic(t *testing.T) {
+	dataSourceName := "data.azure_b2c_ief_ping.test"
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(t),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccPingDataSourceConfig(),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(dataSourceName, "ok", "true"),
+					resource.TestCheckResourceAttr(dataSourceName, "tenant_id", os.Getenv("AZURE_TENANT_ID")),
+				),
+			},
+		},
+	})
+}
+
+func testAccPingDataSourceConfig() string {
+	return `
+data "azure_b2c_ief_ping" "test" {}
+`
+}
@@ -0,0 +1,184 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+type PoliciesDataSource struct {
+	client *GraphClient
+}
+
+type PoliciesDataSourceModel struct {
+	Filter     types.String `tfsdk:"filter"`
+	Select     types.String `tfsdk:"select"`
+	IncludeXML types.Bool   `tfsdk:"include_xml"`
+	Ids        types.List   `tfsdk:"ids"`
+	Policies   types.Map    `tfsdk:"policies"`
+	XML        types.Map    `tfsdk:"xml"`
+}
+
+func NewPoliciesDataSource() datasource.DataSource {
+	return &PoliciesDataSource{}
+}
+
+func (d *PoliciesDataSource) Metadata(
+	_ context.Context,
+	req datasource.MetadataRequest,
+	resp *datasource.MetadataResponse,
+) {
+	resp.TypeName = req.ProviderTypeName + "_policies"
+}
+
+func (d *PoliciesDataSource) Schema(
+	_ context.Context,
+	_ datasource.SchemaRequest,
+	resp *datasource.SchemaResponse,
+) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Lists the Trust Framework policies in the tenant, following every page of results. Useful for audits. Only policy metadata is listed, so the list stays fast in large tenants; set `include_xml` to also download every policy body, or use the `azure_b2c_ief_policy` data source to download a single one.",
+		Attributes: map[string]schema.Attribute{
+			"filter": schema.StringAttribute{
+				Optional:            true,
+				MarkdownDescription: "OData `$filter` expression, e.g. `startswith(id, 'B2C_1A_SignUp')`.",
+			},
+			"select": schema.StringAttribute{
+				Optional:            true,
+				MarkdownDescription: "OData `$select` expression listing the fields Graph should return. Defaults to `id`; `id` is always added, as it is needed to list the policies. The selected fields are returned in `policies`.",
+			},
+			"include_xml": schema.BoolAttribute{
+				Optional:            true,
+				MarkdownDescription: "Also download the XML of every listed policy into `xml`. This costs one Graph request per policy. Defaults to `false`.",
+			},
+			"ids": schema.ListAttribute{
+				Computed:            true,
+				ElementType:         types.StringType,
+				MarkdownDescription: "IDs of the policies that matched.",
+			},
+			"policies": schema.MapAttribute{
+				Computed:            true,
+				ElementType:         types.StringType,
+				MarkdownDescription: "The fields Graph returned for each policy, keyed by policy ID, as a JSON object to read with `jsondecode`. Holds the fields listed in `select`, so only `id` by default.",
+			},
+			"xml": schema.MapAttribute{
+				Computed:            true,
+				ElementType:         types.StringType,
+				MarkdownDescription: "The policy XML as served by Graph, keyed by policy ID. Null unless `include_xml` is `true`.",
+			},
+		},
+	}
+}
+
+func (d *PoliciesDataSource) Configure(
+	_ context.Context,
+	req datasource.ConfigureRequest,
+	resp *datasource.ConfigureResponse,
+) {
+	if req.ProviderData == nil {
+		return
+	}
+	d.client = req.ProviderData.(*GraphClient)
+}
+
+// policiesListPath builds the list path with the optional OData query
+// options. It always selects id, so Graph only returns policy metadata.
+func policiesListPath(data PoliciesDataSourceModel) string {
+	query := url.Values{}
+	if !isNullOrEmpty(data.Filter) {
+		query.Set("$filter", data.Filter.ValueString())
+	}
+	fields := []string{"id"}
+	if !isNullOrEmpty(data.Select) {
+		fields = strings.Split(data.Select.ValueString(), ",")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		if !slices.Contains(fields, "id") {
+			fields = append([]string{"id"}, fields...)
+		}
+	}
+	query.Set("$select", strings.Join(fields, ","))
+	return "/trustFramework/policies?" + query.Encode()
+}
+
+func (d *PoliciesDataSource) Read(
+	ctx context.Context,
+	req datasource.ReadRequest,
+	resp *datasource.ReadResponse,
+) {
+	if d.client == nil {
+		resp.Diagnostics.AddError(
+			"Provider not configured",
+			"The provider must be configured before reading the policies data source.",
+		)
+		return
+	}
+
+	var data PoliciesDataSourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	items, err := d.client.getAllPages(ctx, policiesListPath(data))
+	if err != nil {
+		addErrorDiagnostic(&resp.Diagnostics, "Error listing policies", err)
+		return
+	}
+	ids := make([]string, 0, len(items))
+	fields := make(map[string]string, len(items))
+	for _, item := range items {
+		var policy struct {
+			Id string `json:"id"`
+		}
+		if err := json.Unmarshal(item, &policy); err != nil {
+			resp.Diagnostics.AddError("Error parsing policy", string(item))
+			return
+		}
+		ids = append(ids, policy.Id)
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, item); err != nil {
+			resp.Diagnostics.AddError("Error parsing policy", string(item))
+			return
+		}
+		fields[policy.Id] = compact.String()
+	}
+
+	list, diags := types.ListValueFrom(ctx, types.StringType, ids)
+	resp.Diagnostics.Append(diags...)
+	data.Ids = list
+	policies, diags := types.MapValueFrom(ctx, types.StringType, fields)
+	resp.Diagnostics.Append(diags...)
+	data.Policies = policies
+
+	data.XML = types.MapNull(types.StringType)
+	if data.IncludeXML.ValueBool() {
+		bodies := make(map[string]string, len(ids))
+		for _, id := range ids {
+			policyXml, err := d.client.getRemotePolicy(ctx, id)
+			if err != nil {
+				resp.Diagnostics.AddError("Error downloading policy", fmt.Sprintf("%s: %s", id, err))
+				return
+			}
+			bodies[id] = policyXml
+		}
+		xmlMap, diags := types.MapValueFrom(ctx, types.StringType, bodies)
+		resp.Diagnostics.Append(diags...)
+		data.XML = xmlMap
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	tflog.Debug(ctx, "Policies READ complete", map[string]any{
+		"count": len(ids),
+	})
+}
@@ -0,0 +1,140 @@
+package provider
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+func TestPoliciesListPath(t *testing.T) {
+	tests := []struct {
+		name string
+		data PoliciesDataSourceModel
+		want string
+	}{
+		{name: "defaults to id", want: "/trustFramework/policies?%24select=id"},
+		{name: "adds id", data: PoliciesDataSourceModel{Select: types.StringValue("lastModifiedDateTime")}, want: "/trustFramework/policies?%24select=id%2ClastModifiedDateTime"},
+		{name: "keeps id", data: PoliciesDataSourceModel{Select: types.StringValue("lastModifiedDateTime, id")}, want: "/trustFramework/policies?%24select=lastModifiedDateTime%2Cid"},
+		{name: "filter", data: PoliciesDataSourceModel{Filter: types.StringValue("startswith(id, 'B2C_1A_')")}, want: "/trustFramework/policies?%24filter=startswith%28id%2C+%27B2C_1A_%27%29&%24select=id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policiesListPath(tt.data); got != tt.want {
+				t.Errorf("policiesListPath() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPoliciesDataSourceSelect(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeGraph{responses: map[string]fakeResponse{
+		"GET /trustFramework/policies?%24select=id%2ClastModifiedDateTime": {http.StatusOK, `{"value":[
+			{"id": "B2C_1A_Base", "lastModifiedDateTime": "2026-01-02T03:04:05Z"},
+			{"id": "B2C_1A_SignUp", "lastModifiedDateTime": "2026-02-03T04:05:06Z"}
+		]}`},
+	}}
+	d := &PoliciesDataSource{client: newFakeGraphClient(fake)}
+
+	schemaResp := &datasource.SchemaResponse{}
+	d.Schema(ctx, datasource.SchemaRequest{}, schemaResp)
+	objType := schemaResp.Schema.Type().TerraformType(ctx).(tftypes.Object)
+	values := map[string]tftypes.Value{}
+	for name, attrType := range objType.AttributeTypes {
+		values[name] = tftypes.NewValue(attrType, nil)
+	}
+	values["select"] = tftypes.NewValue(tftypes.String, "lastModifiedDateTime")
+	config := tfsdk.Config{Schema: schemaResp.Schema, Raw: tftypes.NewValue(objType, values)}
+	resp := &datasource.ReadResponse{State: tfsdk.State{Schema: schemaResp.Schema, Raw: config.Raw}}
+	d.Read(ctx, datasource.ReadRequest{Config: config}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Read() unexpected error: %v", resp.Diagnostics)
+	}
+
+	var data PoliciesDataSourceModel
+	resp.State.Get(ctx, &data)
+	policies := map[string]string{}
+	data.Policies.ElementsAs(ctx, &policies, false)
+	want := map[string]string{
+		"B2C_1A_Base":   `{"id":"B2C_1A_Base","lastModifiedDateTime":"2026-01-02T03:04:05Z"}`,
+		"B2C_1A_SignUp": `{"id":"B2C_1A_SignUp","lastModifiedDateTime":"2026-02-03T04:05:06Z"}`,
+	}
+	if !maps.Equal(policies, want) {
+		t.Errorf("policies = %v, want %v", policies, want)
+	}
+}
+
+func TestPoliciesDataSourceIncludeXML(t *testing.T) {
+	ctx := context.Background()
+	for _, includeXML := range []bool{false, true} {
+		fake := &fakeGraph{responses: map[string]fakeResponse{
+			"GET /trustFramework/policies?%24select=id":       {http.StatusOK, `{"value":[{"id":"B2C_1A_Base"}]}`},
+			"GET /trustFramework/policies/B2C_1A_Base/$value": {http.StatusOK, testPolicyXml("B2C_1A_Base", "")},
+		}}
+		d := &PoliciesDataSource{client: newFakeGraphClient(fake)}
+
+		schemaResp := &datasource.SchemaResponse{}
+		d.Schema(ctx, datasource.SchemaRequest{}, schemaResp)
+		objType := schemaResp.Schema.Type().TerraformType(ctx).(tftypes.Object)
+		values := map[string]tftypes.Value{}
+		for name, attrType := range objType.AttributeTypes {
+			values[name] = tftypes.NewValue(attrType, nil)
+		}
+		values["include_xml"] = tftypes.NewValue(tftypes.Bool, includeXML)
+		config := tfsdk.Config{Schema: schemaResp.Schema, Raw: tftypes.NewValue(objType, values)}
+		resp := &datasource.ReadResponse{State: tfsdk.State{Schema: schemaResp.Schema, Raw: config.Raw}}
+		d.Read(ctx, datasource.ReadRequest{Config: config}, resp)
+		if resp.Diagnostics.HasError() {
+			t.Fatalf("Read() unexpected error: %v", resp.Diagnostics)
+		}
+
+		var data PoliciesDataSourceModel
+		resp.State.Get(ctx, &data)
+		downloaded := slices.Contains(fake.calls, "GET /trustFramework/policies/B2C_1A_Base/$value")
+		if downloaded != includeXML {
+			t.Errorf("include_xml = %v downloaded the policy body: %v", includeXML, fake.calls)
+		}
+		if includeXML {
+			xml := data.XML.Elements()["B2C_1A_Base"]
+			if xml == nil || xml.(types.String).ValueString() != testPolicyXml("B2C_1A_Base", "") {
+				t.Errorf("xml = %s, want the downloaded policy", data.XML)
+			}
+		} else if !data.XML.IsNull() {
+			t.Errorf("xml = %s, want null without include_xml", data.XML)
+		}
+	}
+}
+
+func TestAccPoliciesDataSource_Filter(t *testing.T) {
+	dataSourceName := "data.azure_b2c_ief_policies.test"
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(t),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccPoliciesDataSourceConfig(),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrSet(dataSourceName, "ids.#"),
+				),
+			},
+		},
+	})
+}
+
+func testAccPoliciesDataSourceConfig() string {
+	return `
+data "azure_b2c_ief_policies" "test" {
+  filter = "startswith(id, 'B2C_1A_')"
+  select = "id"
+}
+`
+}
@@ -0,0 +1,102 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+type PolicyDataSource struct {
+	client *GraphClient
+}
+
+type PolicyDataSourceModel struct {
+	PolicyId types.String `tfsdk:"policy_id"`
+	XML      types.String `tfsdk:"xml"`
+}
+
+func NewPolicyDataSource() datasource.DataSource {
+	return &PolicyDataSource{}
+}
+
+func (d *PolicyDataSource) Metadata(
+	_ context.Context,
+	req datasource.MetadataRequest,
+	resp *datasource.MetadataResponse,
+) {
+	resp.TypeName = req.ProviderTypeName + "_policy"
+}
+
+func (d *PolicyDataSource) Schema(
+	_ context.Context,
+	_ datasource.SchemaRequest,
+	resp *datasource.SchemaResponse,
+) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Downloads the XML of a Trust Framework policy published in the tenant, e.g. to save a portal-authored policy to disk with `local_file` before managing it with `azure_b2c_ief_policy`.",
+		Attributes: map[string]schema.Attribute{
+			"policy_id": schema.StringAttribute{
+				Required:            true,
+				MarkdownDescription: "The policy ID, e.g. `B2C_1A_TrustFrameworkBase`.",
+			},
+			"xml": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "The policy XML as served by Graph.",
+			},
+		},
+	}
+}
+
+func (d *PolicyDataSource) Configure(
+	_ context.Context,
+	req datasource.ConfigureRequest,
+	resp *datasource.ConfigureResponse,
+) {
+	if req.ProviderData == nil {
+		return
+	}
+	d.client = req.ProviderData.(*GraphClient)
+}
+
+func (d *PolicyDataSource) Read(
+	ctx context.Context,
+	req datasource.ReadRequest,
+	resp *datasource.ReadResponse,
+) {
+	if d.client == nil {
+		resp.Diagnostics.AddError(
+			"Provider not configured",
+			"The provider must be configured before reading the policy data source.",
+		)
+		return
+	}
+
+	var data PolicyDataSourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	policyId := data.PolicyId.ValueString()
+	policyXml, err := d.client.getRemotePolicy(ctx, policyId)
+	if errors.Is(err, ErrNotFound) {
+		resp.Diagnostics.AddError("Policy not found", fmt.Sprintf("Policy %s is not published in the tenant.", policyId))
+		return
+	}
+	if err != nil {
+		resp.Diagnostics.AddError("Error downloading policy", fmt.Sprintf("%s: %s", policyId, err))
+		return
+	}
+	data.XML = types.StringValue(policyXml)
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	tflog.Debug(ctx, "Policy data source READ complete", map[string]any{
+		"policy_id": policyId,
+		"bytes":     len(policyXml),
+	})
+}
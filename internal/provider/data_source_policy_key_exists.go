@@ -0,0 +1,119 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+type PolicyKeyExistsDataSource struct {
+	client *GraphClient
+}
+
+type PolicyKeyExistsDataSourceModel struct {
+	Name   types.String `tfsdk:"name"`
+	Exists types.Bool   `tfsdk:"exists"`
+	Id     types.String `tfsdk:"id"`
+}
+
+func NewPolicyKeyExistsDataSource() datasource.DataSource {
+	return &PolicyKeyExistsDataSource{}
+}
+
+func (d *PolicyKeyExistsDataSource) Metadata(
+	_ context.Context,
+	req datasource.MetadataRequest,
+	resp *datasource.MetadataResponse,
+) {
+	resp.TypeName = req.ProviderTypeName + "_policy_key_exists"
+}
+
+func (d *PolicyKeyExistsDataSource) Schema(
+	_ context.Context,
+	_ datasource.SchemaRequest,
+	resp *datasource.SchemaResponse,
+) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Checks whether a policy key container exists, e.g. to create a key with `count` only when the tenant does not have it yet. Unlike the other key data sources, reading a missing container is not an error.",
+		Attributes: map[string]schema.Attribute{
+			"name": schema.StringAttribute{
+				Required:            true,
+				MarkdownDescription: "The key container name, e.g. `B2C_1A_TokenSigningKeyContainer`.",
+			},
+			"exists": schema.BoolAttribute{
+				Computed:            true,
+				MarkdownDescription: "Whether Graph has a key container with this name.",
+			},
+			"id": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "ID of the key container as Graph reports it. Null when it does not exist.",
+			},
+		},
+	}
+}
+
+func (d *PolicyKeyExistsDataSource) Configure(
+	_ context.Context,
+	req datasource.ConfigureRequest,
+	resp *datasource.ConfigureResponse,
+) {
+	if req.ProviderData == nil {
+		return
+	}
+	d.client = req.ProviderData.(*GraphClient)
+}
+
+func (d *PolicyKeyExistsDataSource) Read(
+	ctx context.Context,
+	req datasource.ReadRequest,
+	resp *datasource.ReadResponse,
+) {
+	if d.client == nil {
+		resp.Diagnostics.AddError(
+			"Provider not configured",
+			"The provider must be configured before reading the policy key exists data source.",
+		)
+		return
+	}
+
+	var data PolicyKeyExistsDataSourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	name := data.Name.ValueString()
+	data.Exists = types.BoolValue(false)
+	data.Id = types.StringNull()
+	gr, err := d.client.readGraph(ctx, "/trustFramework/keySets/%s", name)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		// A missing container is the answer, not a failure
+	case err != nil:
+		addErrorDiagnostic(&resp.Diagnostics, "Error reading keyset", err)
+		return
+	default:
+		if err := d.client.expectStatus(gr, http.StatusOK); err != nil {
+			addErrorDiagnostic(&resp.Diagnostics, "Error reading keyset", err)
+			return
+		}
+		keyset, err := decodeKeyset(ctx, d.client.readBodyBytes(gr))
+		if err != nil {
+			addErrorDiagnostic(&resp.Diagnostics, "Error parsing keyset", err)
+			return
+		}
+		data.Exists = types.BoolValue(true)
+		data.Id = types.StringValue(keyset.Id)
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	tflog.Debug(ctx, "Policy key exists READ complete", map[string]any{
+		"name":   name,
+		"exists": data.Exists.ValueBool(),
+	})
+}
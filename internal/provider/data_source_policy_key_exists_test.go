@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+)
+
+func TestPolicyKeyExistsDataSourceRead(t *testing.T) {
+	tests := []struct {
+		name       string
+		response   fakeResponse
+		wantExists bool
+		wantId     string
+		wantErr    bool
+	}{
+		{name: "exists", response: fakeResponse{http.StatusOK, `{"id":"B2C_1A_Signing","keys":[]}`}, wantExists: true, wantId: "B2C_1A_Signing"},
+		{name: "not found", response: fakeResponse{http.StatusNotFound, `{"error":{"code":"ResourceNotFound"}}`}},
+		{name: "b2c not found", response: fakeResponse{http.StatusBadRequest, `{"error":{"code":"AADB2C90073","message":"Keyset not found"}}`}},
+		{name: "forbidden", response: fakeResponse{http.StatusForbidden, `{"error":{"code":"Forbidden"}}`}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGraph{responses: map[string]fakeResponse{
+				"GET /v1.0/trustFramework/keySets/B2C_1A_Signing": tt.response,
+			}}
+			d := &PolicyKeyExistsDataSource{client: newFakeGraphClient(fake)}
+
+			schemaResp := &datasource.SchemaResponse{}
+			d.Schema(context.Background(), datasource.SchemaRequest{}, schemaResp)
+			objType := schemaResp.Schema.Type().TerraformType(context.Background()).(tftypes.Object)
+			values := map[string]tftypes.Value{}
+			for name, attrType := range objType.AttributeTypes {
+				values[name] = tftypes.NewValue(attrType, nil)
+			}
+			values["name"] = tftypes.NewValue(tftypes.String, "B2C_1A_Signing")
+			config := tfsdk.Config{Schema: schemaResp.Schema, Raw: tftypes.NewValue(objType, values)}
+
+			resp := &datasource.ReadResponse{State: tfsdk.State{Schema: schemaResp.Schema, Raw: config.Raw}}
+			d.Read(context.Background(), datasource.ReadRequest{Config: config}, resp)
+			if resp.Diagnostics.HasError() != tt.wantErr {
+				t.Fatalf("Read() diagnostics = %v, want error %v", resp.Diagnostics, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var data PolicyKeyExistsDataSourceModel
+			resp.State.Get(context.Background(), &data)
+			if data.Exists.ValueBool() != tt.wantExists {
+				t.Errorf("exists = %v, want %v", data.Exists, tt.wantExists)
+			}
+			if data.Id.ValueString() != tt.wantId || data.Id.IsNull() == tt.wantExists {
+				t.Errorf("id = %s, want %q", data.Id, tt.wantId)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+type PolicyKeyPublicDataSource struct {
+	client *GraphClient
+}
+
+type PolicyKeyPublicDataSourceModel struct {
+	Name         types.String `tfsdk:"name"`
+	HasPublicKey types.Bool   `tfsdk:"has_public_key"`
+	Kid          types.String `tfsdk:"kid"`
+	Kty          types.String `tfsdk:"kty"`
+	Use          types.String `tfsdk:"use"`
+	N            types.String `tfsdk:"n"`
+	E            types.String `tfsdk:"e"`
+	JWK          types.String `tfsdk:"jwk"`
+}
+
+// publicJWK holds the fields of the active key that are safe to publish.
+// Anything else Graph returns is dropped, so private material can't leak
+// through this data source.
+type publicJWK struct {
+	Kid string `json:"kid,omitempty"`
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+func NewPolicyKeyPublicDataSource() datasource.DataSource {
+	return &PolicyKeyPublicDataSource{}
+}
+
+func (d *PolicyKeyPublicDataSource) Metadata(
+	_ context.Context,
+	req datasource.MetadataRequest,
+	resp *datasource.MetadataResponse,
+) {
+	resp.TypeName = req.ProviderTypeName + "_policy_key_public"
+}
+
+func (d *PolicyKeyPublicDataSource) Schema(
+	_ context.Context,
+	_ datasource.SchemaRequest,
+	resp *datasource.SchemaResponse,
+) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Exposes the public key of the active key in a policy key container, e.g. for systems that validate tokens signed by Azure AD B2C. Only public RSA parameters are returned; containers holding an uploaded secret report `has_public_key = false`.",
+		Attributes: map[string]schema.Attribute{
+			"name": schema.StringAttribute{
+				Required:            true,
+				MarkdownDescription: "The key container name, e.g. `B2C_1A_TokenSigningKeyContainer`.",
+			},
+			"has_public_key": schema.BoolAttribute{
+				Computed:            true,
+				MarkdownDescription: "Whether the active key has a public part. `false` for secrets (`kty = \"oct\"`), in which case `n`, `e` and `jwk` are null.",
+			},
+			"kid": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "ID of the active key.",
+			},
+			"kty": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "Key type of the active key, e.g. `RSA` or `oct`.",
+			},
+			"use": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "Use of the active key, `sig` or `enc`.",
+			},
+			"n": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "RSA modulus, base64url encoded.",
+			},
+			"e": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "RSA public exponent, base64url encoded.",
+			},
+			"jwk": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "The public key as a JSON Web Key, ready to be placed in a JWKS `keys` array.",
+			},
+		},
+	}
+}
+
+func (d *PolicyKeyPublicDataSource) Configure(
+	_ context.Context,
+	req datasource.ConfigureRequest,
+	resp *datasource.ConfigureResponse,
+) {
+	if req.ProviderData == nil {
+		return
+	}
+	d.client = req.ProviderData.(*GraphClient)
+}
+
+func (d *PolicyKeyPublicDataSource) Read(
+	ctx context.Context,
+	req datasource.ReadRequest,
+	resp *datasource.ReadResponse,
+) {
+	if d.client == nil {
+		resp.Diagnostics.AddError(
+			"Provider not configured",
+			"The provider must be configured before reading the policy key public data source.",
+		)
+		return
+	}
+
+	var data PolicyKeyPublicDataSourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	name := data.Name.ValueString()
+	gr, err := d.client.readGraph(ctx, "/trustFramework/keySets/%s/getActiveKey", name)
+	if errors.Is(err, ErrNotFound) {
+		resp.Diagnostics.AddError("Active key not found", fmt.Sprintf("Key container %s does not exist or has no active key.", name))
+		return
+	}
+	if err != nil {
+		addErrorDiagnostic(&resp.Diagnostics, "Error reading active key", err)
+		return
+	}
+	if err := d.client.expectStatus(gr, http.StatusOK); err != nil {
+		addErrorDiagnostic(&resp.Diagnostics, "Error reading active key", err)
+		return
+	}
+
+	var key publicJWK
+	if err := json.Unmarshal(d.client.readBodyBytes(gr), &key); err != nil {
+		addErrorDiagnostic(&resp.Diagnostics, "Error parsing active key", err)
+		return
+	}
+
+	data.Kid = types.StringValue(key.Kid)
+	data.Kty = types.StringValue(key.Kty)
+	data.Use = types.StringValue(key.Use)
+	data.HasPublicKey = types.BoolValue(key.N != "" && key.E != "")
+	data.N = types.StringNull()
+	data.E = types.StringNull()
+	data.JWK = types.StringNull()
+	if data.HasPublicKey.ValueBool() {
+		jwk, err := json.Marshal(key)
+		if err != nil {
+			addErrorDiagnostic(&resp.Diagnostics, "Error encoding public key", err)
+			return
+		}
+		data.N = types.StringValue(key.N)
+		data.E = types.StringValue(key.E)
+		data.JWK = types.StringValue(string(jwk))
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	tflog.Debug(ctx, "Policy key public READ complete", map[string]any{
+		"name":           name,
+		"kid":            key.Kid,
+		"has_public_key": data.HasPublicKey.ValueBool(),
+	})
+}
@@ -0,0 +1,69 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+)
+
+func TestPolicyKeyPublicDataSourceRead(t *testing.T) {
+	tests := []struct {
+		name       string
+		activeKey  string
+		wantPublic bool
+		wantJWK    string
+	}{
+		{
+			name:       "rsa signing key",
+			activeKey:  `{"kid":"abc","use":"sig","kty":"RSA","n":"modulus","e":"AQAB","nbf":1700000000}`,
+			wantPublic: true,
+			wantJWK:    `{"kid":"abc","kty":"RSA","use":"sig","n":"modulus","e":"AQAB"}`,
+		},
+		{
+			name:      "uploaded secret",
+			activeKey: `{"kid":"def","use":"sig","kty":"oct","k":"should-never-be-returned"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGraph{responses: map[string]fakeResponse{
+				"GET /v1.0/trustFramework/keySets/B2C_1A_Signing/getActiveKey": {http.StatusOK, tt.activeKey},
+			}}
+			d := &PolicyKeyPublicDataSource{client: newFakeGraphClient(fake)}
+
+			schemaResp := &datasource.SchemaResponse{}
+			d.Schema(context.Background(), datasource.SchemaRequest{}, schemaResp)
+			objType := schemaResp.Schema.Type().TerraformType(context.Background()).(tftypes.Object)
+			values := map[string]tftypes.Value{}
+			for name, attrType := range objType.AttributeTypes {
+				values[name] = tftypes.NewValue(attrType, nil)
+			}
+			values["name"] = tftypes.NewValue(tftypes.String, "B2C_1A_Signing")
+			config := tfsdk.Config{Schema: schemaResp.Schema, Raw: tftypes.NewValue(objType, values)}
+
+			resp := &datasource.ReadResponse{State: tfsdk.State{Schema: schemaResp.Schema, Raw: config.Raw}}
+			d.Read(context.Background(), datasource.ReadRequest{Config: config}, resp)
+			if resp.Diagnostics.HasError() {
+				t.Fatalf("Read() unexpected error: %v", resp.Diagnostics)
+			}
+
+			var data PolicyKeyPublicDataSourceModel
+			resp.State.Get(context.Background(), &data)
+			if data.HasPublicKey.ValueBool() != tt.wantPublic {
+				t.Errorf("has_public_key = %v, want %v", data.HasPublicKey, tt.wantPublic)
+			}
+			if got := data.JWK.ValueString(); got != tt.wantJWK {
+				t.Errorf("jwk = %q, want %q", got, tt.wantJWK)
+			}
+			if strings.Contains(resp.State.Raw.String(), "should-never-be-returned") {
+				t.Errorf("state contains private key material: %s", resp.State.Raw)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+type PolicyKeyReferencesDataSource struct {
+	client *GraphClient
+}
+
+type PolicyKeyReferencesDataSourceModel struct {
+	Name      types.String `tfsdk:"name"`
+	PolicyIds types.List   `tfsdk:"policy_ids"`
+}
+
+func NewPolicyKeyReferencesDataSource() datasource.DataSource {
+	return &PolicyKeyReferencesDataSource{}
+}
+
+func (d *PolicyKeyReferencesDataSource) Metadata(
+	_ context.Context,
+	req datasource.MetadataRequest,
+	resp *datasource.MetadataResponse,
+) {
+	resp.TypeName = req.ProviderTypeName + "_policy_key_references"
+}
+
+func (d *PolicyKeyReferencesDataSource) Schema(
+	_ context.Context,
+	_ datasource.SchemaRequest,
+	resp *datasource.SchemaResponse,
+) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Finds the Trust Framework policies that reference a policy key container, e.g. before rotating or deleting the key. Every policy in the tenant is downloaded, so reading this data source makes one Graph request per policy.",
+		Attributes: map[string]schema.Attribute{
+			"name": schema.StringAttribute{
+				Required:            true,
+				MarkdownDescription: "The key container name, e.g. `B2C_1A_TokenSigningKeyContainer`.",
+			},
+			"policy_ids": schema.ListAttribute{
+				Computed:            true,
+				ElementType:         types.StringType,
+				MarkdownDescription: "IDs of the policies whose XML mentions the container.",
+			},
+		},
+	}
+}
+
+func (d *PolicyKeyReferencesDataSource) Configure(
+	_ context.Context,
+	req datasource.ConfigureRequest,
+	resp *datasource.ConfigureResponse,
+) {
+	if req.ProviderData == nil {
+		return
+	}
+	d.client = req.ProviderData.(*GraphClient)
+}
+
+// keyReferencePattern matches name as a whole identifier, so a container is
+// not reported for policies that only reference a longer name starting with it
+func keyReferencePattern(name string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(name) + `\b`)
+}
+
+// policiesReferencing downloads every policy in the tenant and returns the IDs
+// of those whose XML mentions the key container name, along with how many
+// policies were scanned
+func (c *GraphClient) policiesReferencing(ctx context.Context, name string) ([]string, int, error) {
+	items, err := c.getAllPages(ctx, "/trustFramework/policies")
+	if err != nil {
+		return nil, 0, fmt.Errorf("listing policies: %w", err)
+	}
+
+	pattern := keyReferencePattern(name)
+	ids := []string{}
+	for _, item := range items {
+		var policy struct {
+			Id string `json:"id"`
+		}
+		if err := json.Unmarshal(item, &policy); err != nil {
+			return nil, 0, fmt.Errorf("parsing policy %s: %w", string(item), err)
+		}
+		policyXml, err := c.getRemotePolicy(ctx, policy.Id)
+		if errors.Is(err, ErrNotFound) {
+			// Deleted between listing and download
+			continue
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("downloading policy %s: %w", policy.Id, err)
+		}
+		if pattern.MatchString(policyXml) {
+			ids = append(ids, policy.Id)
+		}
+	}
+	return ids, len(items), nil
+}
+
+func (d *PolicyKeyReferencesDataSource) Read(
+	ctx context.Context,
+	req datasource.ReadRequest,
+	resp *datasource.ReadResponse,
+) {
+	if d.client == nil {
+		resp.Diagnostics.AddError(
+			"Provider not configured",
+			"The provider must be configured before reading the policy key references data source.",
+		)
+		return
+	}
+
+	var data PolicyKeyReferencesDataSourceModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ids, scanned, err := d.client.policiesReferencing(ctx, data.Name.ValueString())
+	if err != nil {
+		addErrorDiagnostic(&resp.Diagnostics, "Error finding policy key references", err)
+		return
+	}
+
+	list, diags := types.ListValueFrom(ctx, types.StringType, ids)
+	resp.Diagnostics.Append(diags...)
+	data.PolicyIds = list
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	tflog.Debug(ctx, "Policy key references READ complete", map[string]any{
+		"name":     data.Name.ValueString(),
+		"policies": scanned,
+		"matches":  len(ids),
+	})
+}
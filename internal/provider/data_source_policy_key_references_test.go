@@ -0,0 +1,71 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+func TestPolicyKeyReferencesDataSourceRead(t *testing.T) {
+	fake := &fakeGraph{responses: map[string]fakeResponse{
+		"GET /trustFramework/policies": {
+			http.StatusOK,
+			`{"value":[{"id":"B2C_1A_Base"},{"id":"B2C_1A_Extensions"},{"id":"B2C_1A_Gone"}]}`,
+		},
+		"GET /trustFramework/policies/B2C_1A_Base/$value": {
+			http.StatusOK,
+			`<TrustFrameworkPolicy PolicyId="B2C_1A_Base"><Key Id="issuer_secret" StorageReferenceId="B2C_1A_TokenSigningKeyContainer"/></TrustFrameworkPolicy>`,
+		},
+		"GET /trustFramework/policies/B2C_1A_Extensions/$value": {
+			http.StatusOK,
+			`<TrustFrameworkPolicy PolicyId="B2C_1A_Extensions"><Key Id="issuer_secret" StorageReferenceId="B2C_1A_TokenSigningKeyContainerV2"/></TrustFrameworkPolicy>`,
+		},
+	}}
+	d := &PolicyKeyReferencesDataSource{client: newFakeGraphClient(fake)}
+
+	schemaResp := &datasource.SchemaResponse{}
+	d.Schema(context.Background(), datasource.SchemaRequest{}, schemaResp)
+	objType := schemaResp.Schema.Type().TerraformType(context.Background()).(tftypes.Object)
+	config := tfsdk.Config{
+		Schema: schemaResp.Schema,
+		Raw: tftypes.NewValue(objType, map[string]tftypes.Value{
+			"name":       tftypes.NewValue(tftypes.String, "B2C_1A_TokenSigningKeyContainer"),
+			"policy_ids": tftypes.NewValue(objType.AttributeTypes["policy_ids"], nil),
+		}),
+	}
+	resp := &datasource.ReadResponse{State: tfsdk.State{Schema: schemaResp.Schema, Raw: config.Raw}}
+	d.Read(context.Background(), datasource.ReadRequest{Config: config}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Read() unexpected error: %v", resp.Diagnostics)
+	}
+
+	var data PolicyKeyReferencesDataSourceModel
+	resp.State.Get(context.Background(), &data)
+	var ids []string
+	data.PolicyIds.ElementsAs(context.Background(), &ids, false)
+	if len(ids) != 1 || ids[0] != "B2C_1A_Base" {
+		t.Errorf("policy_ids = %v, want [B2C_1A_Base]", ids)
+	}
+}
+
+func TestAccPolicyKeyReferencesDataSource_Basic(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(t),
+		Steps: []resource.TestStep{
+			{
+				Config: `data "azure_b2c_ief_policy_key_references" "test" {
+  name = "B2C_1A_TokenSigningKeyContainer"
+}`,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrSet("data.azure_b2c_ief_policy_key_references.test", "policy_ids.#"),
+				),
+			},
+		},
+	})
+}
@@ -0,0 +1,57 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+)
+
+func TestPolicyDataSourceRead(t *testing.T) {
+	const policyXml = `<TrustFrameworkPolicy PolicyId="B2C_1A_Base"></TrustFrameworkPolicy>`
+	fake := &fakeGraph{responses: map[string]fakeResponse{
+		"GET /v1.0/trustFramework/policies/B2C_1A_Base/$value": {http.StatusOK, policyXml},
+	}}
+	d := &PolicyDataSource{client: newFakeGraphClient(fake)}
+
+	schemaResp := &datasource.SchemaResponse{}
+	d.Schema(context.Background(), datasource.SchemaRequest{}, schemaResp)
+	objType := schemaResp.Schema.Type().TerraformType(context.Background()).(tftypes.Object)
+
+	tests := []struct {
+		name     string
+		policyId string
+		wantErr  bool
+	}{
+		{name: "published", policyId: "B2C_1A_Base"},
+		{name: "missing", policyId: "B2C_1A_Missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tfsdk.Config{
+				Schema: schemaResp.Schema,
+				Raw: tftypes.NewValue(objType, map[string]tftypes.Value{
+					"policy_id": tftypes.NewValue(tftypes.String, tt.policyId),
+					"xml":       tftypes.NewValue(tftypes.String, nil),
+				}),
+			}
+			resp := &datasource.ReadResponse{State: tfsdk.State{Schema: schemaResp.Schema, Raw: config.Raw}}
+			d.Read(context.Background(), datasource.ReadRequest{Config: config}, resp)
+			if resp.Diagnostics.HasError() != tt.wantErr {
+				t.Fatalf("Read() error = %v, wantErr %v", resp.Diagnostics, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var data PolicyDataSourceModel
+			resp.State.Get(context.Background(), &data)
+			if data.XML.ValueString() != policyXml {
+				t.Errorf("xml = %q, want %q", data.XML.ValueString(), policyXml)
+			}
+		})
+	}
+}
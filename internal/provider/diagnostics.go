@@ -0,0 +1,129 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+)
+
+// Summary prefixes of the diagnostics for classified errors. They are
+// stable, so automation can tell configuration mistakes from remote failures
+// by the summary text.
+const (
+	configErrorSummary = "Configuration error"
+	graphErrorSummary  = "Microsoft Graph error"
+	authErrorSummary   = "Authentication error"
+)
+
+// ConfigError is a problem with the configuration or the local files it
+// points at. Retrying will not fix it.
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+func configErrorf(format string, args ...any) error {
+	return &ConfigError{Err: fmt.Errorf(format, args...)}
+}
+
+// GraphError is a Graph response with a status the operation does not accept
+type GraphError struct {
+	// Request is the method and path of the failed request, when known
+	Request    string
+	StatusCode int
+	Expected   []int
+	// Code and Message are parsed from Graph's error body, when present
+	Code    string
+	Message string
+	// Detail is the response body, with a permission hint for a 403
+	Detail string
+}
+
+func (e *GraphError) Error() string {
+	expected := make([]string, len(e.Expected))
+	for i, code := range e.Expected {
+		expected[i] = strconv.Itoa(code)
+	}
+	request := e.Request
+	if request == "" {
+		request = "Graph request"
+	}
+	msg := fmt.Sprintf("%s: Graph answered %d %s, expected %s", request, e.StatusCode, http.StatusText(e.StatusCode), strings.Join(expected, " or "))
+	if e.Code != "" {
+		msg += fmt.Sprintf("\nGraph error %s: %s", e.Code, e.Message)
+	}
+	return msg + "\n" + e.Detail
+}
+
+// AuthError is a failure to get an access token for Graph
+type AuthError struct {
+	Err error
+}
+
+func (e *AuthError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// attributeError ties an error to the attribute that caused it, so the
+// diagnostic can point the user at the offending field.
+type attributeError struct {
+	path path.Path
+	err  error
+}
+
+func (e *attributeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *attributeError) Unwrap() error {
+	return e.err
+}
+
+// newAttributeError returns a ConfigError on the attribute at p
+func newAttributeError(p path.Path, msg string) error {
+	return &attributeError{path: p, err: &ConfigError{Err: errors.New(msg)}}
+}
+
+// errorSummary prefixes summary with the class of err, when it has one
+func errorSummary(summary string, err error) string {
+	var configErr *ConfigError
+	var graphErr *GraphError
+	var authErr *AuthError
+	switch {
+	case errors.As(err, &authErr):
+		return authErrorSummary + ": " + summary
+	case errors.As(err, &graphErr):
+		return graphErrorSummary + ": " + summary
+	case errors.As(err, &configErr):
+		return configErrorSummary + ": " + summary
+	}
+	return summary
+}
+
+// addErrorDiagnostic adds err to diags under a summary naming its class, on
+// the attribute path when err carries one
+func addErrorDiagnostic(diags *diag.Diagnostics, summary string, err error) {
+	summary = errorSummary(summary, err)
+	var attrErr *attributeError
+	if errors.As(err, &attrErr) {
+		diags.AddAttributeError(attrErr.path, summary, attrErr.Error())
+		return
+	}
+	diags.AddError(summary, err.Error())
+}
@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+)
+
+func TestAddErrorDiagnostic(t *testing.T) {
+	t.Run("AttributeError", func(t *testing.T) {
+		var diags diag.Diagnostics
+		p := path.Root("upload").AtName("value")
+		addErrorDiagnostic(&diags, "summary", newAttributeError(p, "bad value"))
+
+		if len(diags) != 1 {
+			t.Fatalf("Expected 1 diagnostic, got %d", len(diags))
+		}
+		withPath, ok := diags[0].(diag.DiagnosticWithPath)
+		if !ok {
+			t.Fatalf("Expected diagnostic with attribute path, got %T", diags[0])
+		}
+		if !withPath.Path().Equal(p) {
+			t.Errorf("Expected path %s, got %s", p, withPath.Path())
+		}
+		if diags[0].Detail() != "bad value" {
+			t.Errorf("Expected detail %q, got %q", "bad value", diags[0].Detail())
+		}
+	})
+
+	t.Run("PlainError", func(t *testing.T) {
+		var diags diag.Diagnostics
+		addErrorDiagnostic(&diags, "summary", errors.New("remote failure"))
+
+		if len(diags) != 1 {
+			t.Fatalf("Expected 1 diagnostic, got %d", len(diags))
+		}
+		if _, ok := diags[0].(diag.DiagnosticWithPath); ok {
+			t.Errorf("Expected diagnostic without attribute path")
+		}
+	})
+}
+
+func TestErrorSummary(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "config", err: configErrorf("File path %s does not exist", "base.xml"), want: "Configuration error: summary"},
+		{name: "attribute", err: newAttributeError(path.Root("file"), "bad file"), want: "Configuration error: summary"},
+		{name: "graph", err: &GraphError{StatusCode: 500, Expected: []int{200}}, want: "Microsoft Graph error: summary"},
+		{name: "wrapped graph", err: fmt.Errorf("Error creating policy!\n %w", &GraphError{StatusCode: 500, Expected: []int{200}}), want: "Microsoft Graph error: summary"},
+		{name: "auth", err: &AuthError{Err: errors.New("invalid client secret")}, want: "Authentication error: summary"},
+		{name: "unclassified", err: errors.New("connection reset"), want: "summary"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var diags diag.Diagnostics
+			addErrorDiagnostic(&diags, "summary", tt.err)
+			if got := diags[0].Summary(); got != tt.want {
+				t.Errorf("summary = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraphErrorFromStatus(t *testing.T) {
+	fake := &fakeGraph{responses: map[string]fakeResponse{
+		"GET /trustFramework/keySets/B2C_1A_Test": {http.StatusInternalServerError, `{"error":{"code":"InternalServerError","message":"Try again later."}}`},
+	}}
+	c := newFakeGraphClient(fake)
+	resp, err := c.doGraph(context.Background(), "GET", c.endpoint("/trustFramework/keySets/%s", "B2C_1A_Test"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var graphErr *GraphError
+	if err := c.expectStatus(resp, http.StatusOK); !errors.As(err, &graphErr) {
+		t.Fatalf("expectStatus() = %v, want a GraphError", err)
+	}
+	if graphErr.StatusCode != http.StatusInternalServerError || graphErr.Code != "InternalServerError" {
+		t.Errorf("GraphError = %+v, want status 500 and code InternalServerError", graphErr)
+	}
+}
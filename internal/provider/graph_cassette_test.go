@@ -0,0 +1,307 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// cassetteDir holds the Graph traffic recorded by acceptance tests, one file
+// per test, so CI can replay it without Azure credentials
+const cassetteDir = "testdata/cassettes"
+
+// replayTenant is the tenant acceptance tests run against while replaying
+const replayTenant = "replay.onmicrosoft.com"
+
+// cassetteHeaders are the response headers worth recording; the rest, such
+// as request IDs and diagnostics, vary per request and nothing reads them
+var cassetteHeaders = []string{"Content-Type", "Location", "Retry-After"}
+
+type cassette struct {
+	// Timestamp names the test's resources, so a replay requests the same
+	// URLs as the recording
+	Timestamp    int           `json:"timestamp"`
+	Interactions []interaction `json:"interactions"`
+}
+
+type interaction struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body"`
+}
+
+// cassetteTransport records the Graph responses next returns, or replays
+// recorded ones when next is nil. A request is answered by the first unused
+// interaction with the same method and URL, so repeated reads replay in
+// order. Token requests go through the identity library's own transport and
+// are never recorded.
+type cassetteTransport struct {
+	mu       sync.Mutex
+	cassette cassette
+	used     []bool
+	next     http.RoundTripper
+}
+
+func (c *cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if c.next == nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return c.replay(req)
+	}
+	resp, err := c.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	header := http.Header{}
+	for _, name := range cassetteHeaders {
+		if v := resp.Header.Values(name); len(v) > 0 {
+			header[name] = v
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cassette.Interactions = append(c.cassette.Interactions, interaction{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Status: resp.StatusCode,
+		Header: header,
+		Body:   string(body),
+	})
+	return resp, nil
+}
+
+func (c *cassetteTransport) replay(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, in := range c.cassette.Interactions {
+		if c.used[i] || in.Method != req.Method || in.URL != req.URL.String() {
+			continue
+		}
+		c.used[i] = true
+		header := in.Header.Clone()
+		if header == nil {
+			header = http.Header{}
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Status, http.StatusText(in.Status)),
+			StatusCode:    in.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(strings.NewReader(in.Body)),
+			ContentLength: int64(len(in.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("the cassette has no unused interaction for %s %s; record it again with RECORD=1", req.Method, req.URL)
+}
+
+// scrub replaces every occurrence of tenant in the recorded traffic with
+// replayTenant, so cassettes do not name the tenant they were recorded in
+func (c *cassetteTransport) scrub(tenant string) {
+	if tenant == "" || tenant == replayTenant {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, in := range c.cassette.Interactions {
+		in.URL = strings.ReplaceAll(in.URL, tenant, replayTenant)
+		in.Body = strings.ReplaceAll(in.Body, tenant, replayTenant)
+		for name, values := range in.Header {
+			for j, v := range values {
+				values[j] = strings.ReplaceAll(v, tenant, replayTenant)
+			}
+			in.Header[name] = values
+		}
+		c.cassette.Interactions[i] = in
+	}
+}
+
+// save writes the recorded cassette to p
+func (c *cassetteTransport) save(p string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, err := json.MarshalIndent(c.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, append(b, '\n'), 0o644)
+}
+
+// loadCassette reads the cassette at p for replay
+func loadCassette(p string) (*cassetteTransport, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var c cassette
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("Unable to parse cassette %s: %s", p, err)
+	}
+	return &cassetteTransport{cassette: c, used: make([]bool, len(c.Interactions))}, nil
+}
+
+var (
+	testAccCassettesMu sync.Mutex
+	testAccCassettes   = map[string]*cassetteTransport{}
+)
+
+// testAccCassette returns the transport acceptance test t sends Graph
+// requests through, or nil to use the provider's own. With RECORD=1 the real
+// Graph traffic is recorded to testdata/cassettes/<test>.json once the test
+// passes. Otherwise an existing cassette is replayed without credentials,
+// with a placeholder tenant and access token. Recordings are scrubbed of the
+// tenant, and both modes pin graph_api_version to beta so the requests do not
+// depend on which reads the tenant serves on v1.0.
+func testAccCassette(t *testing.T) *cassetteTransport {
+	testAccCassettesMu.Lock()
+	defer testAccCassettesMu.Unlock()
+	if c, ok := testAccCassettes[t.Name()]; ok {
+		return c
+	}
+
+	p := filepath.Join(cassetteDir, strings.ReplaceAll(t.Name(), "/", "_")+".json")
+	var c *cassetteTransport
+	switch {
+	case os.Getenv("RECORD") == "1":
+		tenant := os.Getenv("AZURE_TENANT_ID")
+		c = &cassetteTransport{cassette: cassette{Timestamp: int(time.Now().Unix())}, next: http.DefaultTransport}
+		t.Cleanup(func() {
+			if t.Failed() || t.Skipped() || len(c.cassette.Interactions) == 0 {
+				return
+			}
+			c.scrub(tenant)
+			if err := c.save(p); err != nil {
+				t.Errorf("Unable to save cassette %s: %s", p, err)
+			}
+		})
+	default:
+		var err error
+		c, err = loadCassette(p)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("AZURE_TENANT_ID", replayTenant)
+		t.Setenv(providerEnvVar("tenant_id"), replayTenant)
+		t.Setenv(providerEnvVar("graph_access_token"), "replay")
+	}
+	t.Setenv(providerEnvVar("graph_api_version"), graphVersionBeta)
+	testAccCassettes[t.Name()] = c
+	t.Cleanup(func() {
+		testAccCassettesMu.Lock()
+		defer testAccCassettesMu.Unlock()
+		delete(testAccCassettes, t.Name())
+	})
+	return c
+}
+
+// replaying reports whether the cassette answers requests without Graph
+func (c *cassetteTransport) replaying() bool {
+	return c != nil && c.next == nil
+}
+
+func TestCassetteRecordReplay(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Request-Id", "varies")
+		fmt.Fprintf(w, `{"path":%q,"n":%d}`, r.URL.Path, requests)
+	}))
+	t.Cleanup(srv.Close)
+
+	send := func(rt http.RoundTripper, method, url string) (string, error) {
+		req, _ := http.NewRequest(method, url, strings.NewReader(`{"k":"secret"}`))
+		resp, err := (&http.Client{Transport: rt}).Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Sprintf("%d %s %s", resp.StatusCode, resp.Header.Get("Content-Type"), b), nil
+	}
+
+	recorder := &cassetteTransport{cassette: cassette{Timestamp: 42}, next: http.DefaultTransport}
+	var recorded []string
+	for _, path := range []string{"/beta/trustFramework/keySets/a", "/beta/trustFramework/keySets/a", "/beta/trustFramework/keySets/b"} {
+		got, err := send(recorder, http.MethodGet, srv.URL+path)
+		if err != nil {
+			t.Fatalf("recording: %s", err)
+		}
+		recorded = append(recorded, got)
+	}
+	p := filepath.Join(t.TempDir(), "cassettes", "TestRecorded.json")
+	if err := recorder.save(p); err != nil {
+		t.Fatalf("save() unexpected error: %s", err)
+	}
+	saved, _ := os.ReadFile(p)
+	if strings.Contains(string(saved), "secret") || strings.Contains(string(saved), "Request-Id") {
+		t.Errorf("cassette holds request bodies or volatile headers:\n%s", saved)
+	}
+
+	scrubbed := &cassetteTransport{cassette: cassette{Interactions: []interaction{{
+		Method: http.MethodGet,
+		URL:    "https://graph.microsoft.com/beta/trustFramework/policies/B2C_1A_Base/$value",
+		Header: http.Header{"Location": {"https://contoso.onmicrosoft.com/policies"}},
+		Body:   `<TrustFrameworkPolicy TenantId="contoso.onmicrosoft.com" PublicPolicyUri="http://contoso.onmicrosoft.com/B2C_1A_Base"/>`,
+	}}}}
+	scrubbed.scrub("contoso.onmicrosoft.com")
+	if in := scrubbed.cassette.Interactions[0]; strings.Contains(in.Body+in.Header.Get("Location"), "contoso") || !strings.Contains(in.Body, replayTenant) {
+		t.Errorf("scrubbed interaction still names the tenant: %+v", in)
+	}
+
+	player, err := loadCassette(p)
+	if err != nil {
+		t.Fatalf("loadCassette() unexpected error: %s", err)
+	}
+	if !player.replaying() || player.cassette.Timestamp != 42 {
+		t.Fatalf("loaded cassette = %+v, want a replay of timestamp 42", player.cassette)
+	}
+	// Requests to the same URL replay in recorded order
+	for i, path := range []string{"/beta/trustFramework/keySets/b", "/beta/trustFramework/keySets/a", "/beta/trustFramework/keySets/a"} {
+		want := map[int]string{0: recorded[2], 1: recorded[0], 2: recorded[1]}[i]
+		got, err := send(player, http.MethodGet, srv.URL+path)
+		if err != nil {
+			t.Fatalf("replaying %s: %s", path, err)
+		}
+		if got != want {
+			t.Errorf("replay of %s = %s, want %s", path, got, want)
+		}
+	}
+	if requests != 3 {
+		t.Errorf("server received %d requests, want only the 3 recorded", requests)
+	}
+	if _, err := send(player, http.MethodGet, srv.URL+"/beta/trustFramework/keySets/a"); err == nil {
+		t.Errorf("replay answered a request the cassette has no unused interaction for")
+	}
+	if _, err := send(player, http.MethodDelete, srv.URL+"/beta/trustFramework/keySets/b"); err == nil {
+		t.Errorf("replay answered a DELETE with a recorded GET")
+	}
+}
@@ -0,0 +1,94 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	fwresource "github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+)
+
+const fakeGraphBaseURL = "https://graph.test"
+
+type fakeResponse struct {
+	status int
+	body   string
+}
+
+// fakeGraph answers Graph requests from canned responses keyed by
+// "METHOD path". Beta paths are keyed without a version prefix; other
+// versions keep theirs, e.g. "GET /v1.0/trustFramework/policies".
+// Gzipped uploads are keyed with a " gzip" suffix.
+type fakeGraph struct {
+	responses map[string]fakeResponse
+	calls     []string
+}
+
+func (f *fakeGraph) respond(method, url string) (*http.Response, error) {
+	return f.respondKey(method, url, "")
+}
+
+func (f *fakeGraph) respondKey(method, url, suffix string) (*http.Response, error) {
+	key := method + " " + strings.TrimPrefix(strings.TrimPrefix(url, fakeGraphBaseURL), "/beta") + suffix
+	f.calls = append(f.calls, key)
+	r, ok := f.responses[key]
+	if !ok {
+		r = fakeResponse{status: http.StatusNotFound, body: `{"error":{"code":"Request_ResourceNotFound"}}`}
+	}
+	req, _ := http.NewRequest(method, url, nil)
+	return &http.Response{
+		Status:     http.StatusText(r.status),
+		StatusCode: r.status,
+		Body:       io.NopCloser(strings.NewReader(r.body)),
+		Request:    req,
+	}, nil
+}
+
+func (f *fakeGraph) doGraph(_ context.Context, method, url string, _ any) (*http.Response, error) {
+	return f.respond(method, url)
+}
+
+func (f *fakeGraph) doGraphXML(_ context.Context, method, url string, _ *string) (*http.Response, error) {
+	return f.respond(method, url)
+}
+
+func (f *fakeGraph) doGraphXMLGzip(_ context.Context, method, url string, _ string) (*http.Response, error) {
+	return f.respondKey(method, url, " gzip")
+}
+
+func newFakeGraphClient(f *fakeGraph) *GraphClient {
+	return &GraphClient{
+		tenantId:     "00000000-0000-0000-0000-000000000000",
+		clientId:     "11111111-1111-1111-1111-111111111111",
+		maxBodyBytes: defaultMaxBodyBytes,
+		environment:  defaultEnvironment,
+		graphBaseURL: fakeGraphBaseURL,
+		doer:         f,
+	}
+}
+
+// testResourceState builds state for r with the given attribute values and
+// every other attribute null
+func testResourceState(t *testing.T, r fwresource.Resource, values map[string]tftypes.Value) tfsdk.State {
+	t.Helper()
+	schemaResp := &fwresource.SchemaResponse{}
+	r.Schema(context.Background(), fwresource.SchemaRequest{}, schemaResp)
+
+	objType := schemaResp.Schema.Type().TerraformType(context.Background()).(tftypes.Object)
+	all := map[string]tftypes.Value{}
+	for name, attrType := range objType.AttributeTypes {
+		if v, ok := values[name]; ok {
+			all[name] = v
+			continue
+		}
+		all[name] = tftypes.NewValue(attrType, nil)
+	}
+	return tfsdk.State{
+		Schema: schemaResp.Schema,
+		Raw:    tftypes.NewValue(objType, all),
+	}
+}
@@ -2,21 +2,56 @@ package provider
 
 import (
 	"context"
+	"net/http"
+	"regexp"
+	"time"
 
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
 	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/provider"
 	"github.com/hashicorp/terraform-plugin-framework/provider/schema"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
 	"github.com/hashicorp/terraform-plugin-framework/types"
 )
 
 type b2ciefProvider struct {
+	// httpClient, when set, sends every Graph request instead of a client
+	// built from the transport attributes. Acceptance tests use it to record
+	// and replay Graph traffic.
+	httpClient *http.Client
 }
 
 type providerConfig struct {
-	TenantId     types.String `tfsdk:"tenant_id"`
-	ClientId     types.String `tfsdk:"client_id"`
-	ClientSecret types.String `tfsdk:"client_secret"`
+	TenantId              types.String `tfsdk:"tenant_id"`
+	ClientId              types.String `tfsdk:"client_id"`
+	ClientSecret          types.String `tfsdk:"client_secret"`
+	GraphAccessToken      types.String `tfsdk:"graph_access_token"`
+	GeneratePollTimeout   types.Int64  `tfsdk:"generate_poll_timeout_seconds"`
+	GeneratePollInterval  types.Int64  `tfsdk:"generate_poll_interval_seconds"`
+	PublishPollTimeout    types.Int64  `tfsdk:"publish_poll_timeout_seconds"`
+	RequestTimeout        types.Int64  `tfsdk:"request_timeout_seconds"`
+	PolicyContentType     types.String `tfsdk:"policy_content_type"`
+	PublishPollInterval   types.Int64  `tfsdk:"publish_poll_interval_seconds"`
+	MaxResponseBodyBytes  types.Int64  `tfsdk:"max_response_body_bytes"`
+	ExtraHeaders          types.Map    `tfsdk:"extra_headers"`
+	GraphBaseURL          types.String `tfsdk:"graph_base_url"`
+	InsecureSkipTLSVerify types.Bool   `tfsdk:"insecure_skip_tls_verify"`
+	SkipCredentialCheck   types.Bool   `tfsdk:"skip_credential_validation"`
+	CompressUploads       types.Bool   `tfsdk:"compress_uploads"`
+	ReadOnly              types.Bool   `tfsdk:"read_only"`
+	TrustFrameworkSegment types.String `tfsdk:"trust_framework_segment"`
+	DebugEmitCurl         types.Bool   `tfsdk:"debug_emit_curl"`
+	PolicyUploadPrefer    types.String `tfsdk:"policy_upload_prefer"`
+	GraphAPIVersion       types.String `tfsdk:"graph_api_version"`
+	DisableHTTP2          types.Bool   `tfsdk:"disable_http2"`
+	IdleConnTimeout       types.Int64  `tfsdk:"idle_conn_timeout_seconds"`
+	MaxIdleConnsPerHost   types.Int64  `tfsdk:"max_idle_conns_per_host"`
+	RetryBudget           types.Int64  `tfsdk:"retry_budget_seconds"`
+	PostWriteDelay        types.Int64  `tfsdk:"post_write_delay_ms"`
+	SetPolicyTenantId     types.Bool   `tfsdk:"set_policy_tenant_id"`
 }
 
 func New() provider.Provider {
@@ -29,25 +64,187 @@ func (p *b2ciefProvider) Metadata(_ context.Context, _ provider.MetadataRequest,
 
 func (p *b2ciefProvider) Schema(ctx context.Context, req provider.SchemaRequest, resp *provider.SchemaResponse) {
 	resp.Schema = schema.Schema{
-		MarkdownDescription: "The Azure AD B2C IEF (Identity Experience Framework) provider allows managing custom policies and policy keys in Azure AD B2C via the Microsoft Graph API.",
+		MarkdownDescription: "The Azure AD B2C IEF (Identity Experience Framework) provider allows managing custom policies and policy keys in Azure AD B2C via the Microsoft Graph API.\n\n" +
+			"Every string, boolean and number attribute can also be set with an environment variable named after it, `AZURE_B2C_IEF_` followed by the attribute name in upper case, e.g. `AZURE_B2C_IEF_TENANT_ID` or `AZURE_B2C_IEF_GRAPH_BASE_URL`. " +
+			"A value set in the configuration takes precedence over the environment variable, which takes precedence over the attribute's default. Empty environment variables are ignored. Values from environment variables are checked like configured ones, and an invalid one fails with an error naming the variable. There is no `environment` attribute, so `AZURE_B2C_IEF_ENVIRONMENT` is not read; reach a national cloud with `graph_base_url` instead.\n\n" +
+			"Error summaries start with `Configuration error:` for problems with the configuration or the files it references, `Microsoft Graph error:` when Graph answers a request with an unexpected status, and `Authentication error:` when no access token could be obtained, so automation can classify failures by the summary.",
 		Attributes: map[string]schema.Attribute{
 			"tenant_id": schema.StringAttribute{
-				Required:            true,
-				MarkdownDescription: "The Azure AD B2C tenant ID (e.g. `yourtenant.onmicrosoft.com` or a UUID).",
+				Optional:            true,
+				MarkdownDescription: "The Azure AD B2C tenant ID (e.g. `yourtenant.onmicrosoft.com` or a UUID). Required, either here or in `AZURE_B2C_IEF_TENANT_ID`.",
 			},
 			"client_id": schema.StringAttribute{
-				Required:            true,
-				MarkdownDescription: "The Application (client) ID of the Service Principal with `TrustFramework.ReadWrite.All` and `Policy.ReadWrite.TrustFramework` permissions.",
+				Optional:            true,
+				MarkdownDescription: "The Application (client) ID of the Service Principal with `TrustFramework.ReadWrite.All` and `Policy.ReadWrite.TrustFramework` permissions. Required unless `graph_access_token` is set.",
 			},
 			"client_secret": schema.StringAttribute{
-				Required:            true,
+				Optional:            true,
 				Sensitive:           true,
-				MarkdownDescription: "The Client Secret for the Service Principal.",
+				MarkdownDescription: "The Client Secret for the Service Principal. Required unless `graph_access_token` is set.",
+			},
+			"graph_access_token": schema.StringAttribute{
+				Optional:            true,
+				Sensitive:           true,
+				MarkdownDescription: "A Microsoft Graph access token to use as-is instead of requesting one with `client_id` and `client_secret`, for automation that already holds a token. The provider cannot refresh it, so requests fail once it expires; keep runs shorter than the token lifetime.",
+			},
+			"max_response_body_bytes": schema.Int64Attribute{
+				Optional:            true,
+				MarkdownDescription: "Maximum number of bytes read from a Microsoft Graph response body. Larger responses are truncated and a warning is logged. Defaults to 10 MiB.",
+				Validators: []validator.Int64{
+					int64validator.AtLeast(1),
+				},
+			},
+			"extra_headers": schema.MapAttribute{
+				Optional:            true,
+				Sensitive:           true,
+				ElementType:         types.StringType,
+				MarkdownDescription: "Additional HTTP headers sent with every Microsoft Graph request, e.g. an API gateway key. The `Authorization` and `Content-Type` headers are managed by the provider and cannot be overridden.",
+			},
+			"graph_api_version": schema.StringAttribute{
+				Optional:            true,
+				MarkdownDescription: "Microsoft Graph API version every request uses, `beta` or `v1.0`. When unset, writes such as `generateKey` and `uploadSecret` use `beta`, where Microsoft documents them, reads try `v1.0` first and fall back to `beta`, and a warning is shown because beta behavior can change without notice. Set it to `beta` to keep those writes and silence the warning, or to `v1.0` once your tenant serves everything the configuration uses there.",
+				Validators: []validator.String{
+					stringvalidator.OneOf(graphVersionBeta, graphVersionV1),
+				},
+			},
+			"graph_base_url": schema.StringAttribute{
+				Optional:            true,
+				MarkdownDescription: "Base URL of the Microsoft Graph API. Defaults to `https://graph.microsoft.com`. Set it to a national cloud's Graph, e.g. `https://graph.microsoft.us`, to manage a tenant there; every resource and data source then uses it and tokens are requested for it. Also useful for pointing the provider at a mock Graph in tests.",
+			},
+			"insecure_skip_tls_verify": schema.BoolAttribute{
+				Optional:            true,
+				MarkdownDescription: "**For test harnesses only.** Disables TLS certificate verification for Graph requests, e.g. for a local mock Graph with a self-signed certificate. Configuration fails if this is set while `graph_base_url` points at a real Microsoft Graph host.",
+			},
+			"disable_http2": schema.BoolAttribute{
+				Optional:            true,
+				MarkdownDescription: "Use HTTP/1.1 for every Graph request, for proxies and gateways that misbehave with HTTP/2. By default HTTP/2 is negotiated over TLS, which lets the many small Graph calls share one connection. Defaults to `false`.",
+			},
+			"idle_conn_timeout_seconds": schema.Int64Attribute{
+				Optional:            true,
+				MarkdownDescription: "How long an idle keep-alive connection to Graph is kept open for reuse. Defaults to `90`.",
+				Validators: []validator.Int64{
+					int64validator.AtLeast(1),
+				},
+			},
+			"max_idle_conns_per_host": schema.Int64Attribute{
+				Optional:            true,
+				MarkdownDescription: "How many idle keep-alive HTTP/1.1 connections to Graph are kept open for reuse. Raise it towards Terraform's `-parallelism` when `disable_http2` is set. Defaults to `2`.",
+				Validators: []validator.Int64{
+					int64validator.AtLeast(1),
+				},
+			},
+			"skip_credential_validation": schema.BoolAttribute{
+				Optional:            true,
+				MarkdownDescription: "Skip requesting a token when the provider is configured, so plans that never call Graph (e.g. config validation in air-gapped CI) succeed without network access. Credential problems are then reported on the first Graph request instead. Defaults to `false`.",
+			},
+			"compress_uploads": schema.BoolAttribute{
+				Optional:            true,
+				MarkdownDescription: "Gzip policy XML uploads (`Content-Encoding: gzip`), which speeds up large merged policies. If Graph rejects a compressed upload that it accepts uncompressed, the provider falls back to uncompressed uploads for the rest of the run. Defaults to `false`.",
+			},
+			"debug_emit_curl": schema.BoolAttribute{
+				Optional:            true,
+				MarkdownDescription: "Log every failed Graph request, one that gets no response or an error status, as an equivalent `curl` command at `WARN` level so it can be reproduced by hand. The access token, `extra_headers` values and secrets in request bodies are redacted. Defaults to `false`.",
+			},
+			"read_only": schema.BoolAttribute{
+				Optional:            true,
+				MarkdownDescription: "Never change the tenant: creating, updating or deleting any resource fails with an error instead of calling Graph, and only `GET` requests are sent. Reads and data sources work as usual, so `terraform plan` can detect drift safely. Defaults to `false`.",
+			},
+			"generate_poll_timeout_seconds": schema.Int64Attribute{
+				Optional:            true,
+				MarkdownDescription: "How long to wait after generating a key for Graph to list it in its key container, so a policy published right afterwards can use it. The apply does not fail if the key is not listed in time; a warning is logged instead. Defaults to `30`; `0` disables the wait.",
+				Validators: []validator.Int64{
+					int64validator.AtLeast(0),
+				},
+			},
+			"generate_poll_interval_seconds": schema.Int64Attribute{
+				Optional:            true,
+				MarkdownDescription: "Seconds between checks while waiting for a generated key. Defaults to `2`.",
+				Validators: []validator.Int64{
+					int64validator.AtLeast(1),
+				},
+			},
+			"policy_content_type": schema.StringAttribute{
+				Optional:            true,
+				MarkdownDescription: "`Content-Type` sent with policy XML, e.g. `text/xml` or `application/xml; charset=utf-8` for gateways in front of Graph that insist on it. Policies uploaded through `azure_b2c_ief_policy_suite` are wrapped in a JSON `$batch` request and keep `application/xml`. Defaults to `application/xml`.",
+				Validators: []validator.String{
+					stringvalidator.RegexMatches(regexp.MustCompile(`^[A-Za-z0-9!#$&^_.+-]+/[A-Za-z0-9!#$&^_.+-]+(\s*;.*)?$`), "must be a media type such as application/xml"),
+				},
+			},
+			"policy_upload_prefer": schema.StringAttribute{
+				Optional:            true,
+				MarkdownDescription: "`Prefer` header sent with policy uploads, e.g. `return=representation`. With `return=representation`, a create whose response already contains the policy skips the wait controlled by `publish_poll_timeout_seconds`. Policies uploaded through `azure_b2c_ief_policy_suite` are sent in a `$batch` request without it. Defaults to no `Prefer` header.",
+				Validators: []validator.String{
+					stringvalidator.LengthAtLeast(1),
+				},
+			},
+			"set_policy_tenant_id": schema.BoolAttribute{
+				Optional:            true,
+				MarkdownDescription: "Set the `TenantId` attribute of every policy's `TrustFrameworkPolicy` root element to `tenant_id` when rendering it for `azure_b2c_ief_policy` and `azure_b2c_ief_policy_suite`, so policy files need not template it. Only an existing `TenantId` is rewritten. Requires `tenant_id` to be the tenant's domain, e.g. `yourtenant.onmicrosoft.com`, rather than its UUID. Defaults to `false`, which uploads `TenantId` as the file sets it.",
+			},
+			"request_timeout_seconds": schema.Int64Attribute{
+				Optional:            true,
+				MarkdownDescription: "Timeout for each Graph request, and for the token request that checks the credentials when the provider is configured. Defaults to `10`.",
+				Validators: []validator.Int64{
+					int64validator.AtLeast(1),
+				},
+			},
+			"retry_budget_seconds": schema.Int64Attribute{
+				Optional:            true,
+				MarkdownDescription: "Total time the provider may spend waiting to retry throttled (429) Graph requests during one run, across all resources and data sources. Once another wait would exceed it, the request fails with an error instead of retrying, which bounds how long a heavily throttled apply can take. Defaults to no limit.",
+				Validators: []validator.Int64{
+					int64validator.AtLeast(1),
+				},
+			},
+			"post_write_delay_ms": schema.Int64Attribute{
+				Optional:            true,
+				MarkdownDescription: "Milliseconds to wait after every successful Graph write, such as creating a key container or uploading a policy, before the next request. A workaround for Graph's eventual consistency when a request right after a create finds the object missing or stale. Defaults to `0`, which disables the wait.",
+				Validators: []validator.Int64{
+					int64validator.AtLeast(0),
+				},
+			},
+			"publish_poll_timeout_seconds": schema.Int64Attribute{
+				Optional:            true,
+				MarkdownDescription: "How long to wait after creating a published policy for Graph to serve it, so the refresh that follows does not find it missing and drop it from state. The apply does not fail if the policy is not served in time; a warning is logged instead. Defaults to `0`, which disables the wait.",
+				Validators: []validator.Int64{
+					int64validator.AtLeast(0),
+				},
+			},
+			"publish_poll_interval_seconds": schema.Int64Attribute{
+				Optional:            true,
+				MarkdownDescription: "Seconds between checks while waiting for a created policy. Defaults to `2`.",
+				Validators: []validator.Int64{
+					int64validator.AtLeast(1),
+				},
+			},
+			"trust_framework_segment": schema.StringAttribute{
+				Optional:            true,
+				MarkdownDescription: "Graph path used in place of `trustFramework` for policy and keyset requests, e.g. to target another trust framework context behind a Graph proxy. Public Microsoft Graph serves a single context per tenant, so leave this unset unless your endpoint supports it.",
+				Validators: []validator.String{
+					stringvalidator.RegexMatches(regexp.MustCompile(`^[A-Za-z0-9_.()'-]+(/[A-Za-z0-9_.()'-]+)*$`), "must be a relative Graph path such as trustFramework"),
+				},
 			},
 		},
 	}
 }
 
+// tenantUUIDPattern matches a tenant given by its UUID rather than its domain
+var tenantUUIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Defaults for waiting on generated keys and created policies
+const (
+	defaultKeyPollTimeout      = 30 * time.Second
+	defaultKeyPollInterval     = 2 * time.Second
+	defaultPublishPollInterval = 2 * time.Second
+)
+
+// secondsOr returns v as a duration in seconds, or def when v is not set
+func secondsOr(v types.Int64, def time.Duration) time.Duration {
+	if v.IsNull() || v.IsUnknown() {
+		return def
+	}
+	return time.Duration(v.ValueInt64()) * time.Second
+}
+
 func (p *b2ciefProvider) Configure(ctx context.Context, req provider.ConfigureRequest, resp *provider.ConfigureResponse) {
 	var cfg providerConfig
 	diags := req.Config.Get(ctx, &cfg)
@@ -55,15 +252,90 @@ func (p *b2ciefProvider) Configure(ctx context.Context, req provider.ConfigureRe
 	if resp.Diagnostics.HasError() {
 		return
 	}
+	schemaResp := &provider.SchemaResponse{}
+	p.Schema(ctx, provider.SchemaRequest{}, schemaResp)
+	resp.Diagnostics.Append(applyEnvDefaults(ctx, &cfg, schemaResp.Schema)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if isNullOrEmpty(cfg.TenantId) {
+		resp.Diagnostics.AddAttributeError(path.Root("tenant_id"), "Missing tenant_id", "Set tenant_id or the AZURE_B2C_IEF_TENANT_ID environment variable.")
+		return
+	}
+	if cfg.SetPolicyTenantId.ValueBool() && tenantUUIDPattern.MatchString(cfg.TenantId.ValueString()) {
+		resp.Diagnostics.AddAttributeError(path.Root("tenant_id"), "Tenant domain required", "set_policy_tenant_id writes tenant_id into each policy's TenantId, which Azure AD B2C expects to be the tenant's domain, e.g. yourtenant.onmicrosoft.com, not its UUID.")
+		return
+	}
+	if isNullOrEmpty(cfg.GraphAccessToken) {
+		if isNullOrEmpty(cfg.ClientId) {
+			resp.Diagnostics.AddAttributeError(path.Root("client_id"), "Missing client_id", "Set client_id and client_secret, or graph_access_token.")
+		}
+		if isNullOrEmpty(cfg.ClientSecret) {
+			resp.Diagnostics.AddAttributeError(path.Root("client_secret"), "Missing client_secret", "Set client_id and client_secret, or graph_access_token.")
+		}
+		if resp.Diagnostics.HasError() {
+			return
+		}
+	} else {
+		resp.Diagnostics.AddAttributeWarning(
+			path.Root("graph_access_token"),
+			"Using a pre-fetched Graph access token",
+			"The provider uses graph_access_token as-is and does not refresh it. Requests made after it expires fail with 401 Unauthorized.",
+		)
+	}
+
+	if cfg.GraphAPIVersion.IsNull() {
+		resp.Diagnostics.AddAttributeWarning(
+			path.Root("graph_api_version"),
+			"Using the Microsoft Graph beta API",
+			"Policy and key writes are sent to the Graph beta API, whose behavior can change without notice. Set graph_api_version = \"beta\" to acknowledge this and silence the warning, or \"v1.0\" if your tenant serves everything this configuration uses there.",
+		)
+	}
+
+	extraHeaders := make(map[string]string, len(cfg.ExtraHeaders.Elements()))
+	if !cfg.ExtraHeaders.IsNull() && !cfg.ExtraHeaders.IsUnknown() {
+		resp.Diagnostics.Append(cfg.ExtraHeaders.ElementsAs(ctx, &extraHeaders, false)...)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+	}
 
-	client, err := NewGraphClient(
-		ctx,
-		cfg.TenantId.ValueString(),
-		cfg.ClientId.ValueString(),
-		cfg.ClientSecret.ValueString(),
-	)
+	opts := GraphClientOptions{
+		MaxBodyBytes:          cfg.MaxResponseBodyBytes.ValueInt64(),
+		ExtraHeaders:          extraHeaders,
+		GraphBaseURL:          cfg.GraphBaseURL.ValueString(),
+		InsecureSkipTLSVerify: cfg.InsecureSkipTLSVerify.ValueBool(),
+		SkipCredentialCheck:   cfg.SkipCredentialCheck.ValueBool(),
+		CompressUploads:       cfg.CompressUploads.ValueBool(),
+		ReadOnly:              cfg.ReadOnly.ValueBool(),
+		TrustFrameworkSegment: cfg.TrustFrameworkSegment.ValueString(),
+		AccessToken:           cfg.GraphAccessToken.ValueString(),
+		DebugEmitCurl:         cfg.DebugEmitCurl.ValueBool(),
+		UploadPrefer:          cfg.PolicyUploadPrefer.ValueString(),
+		APIVersion:            cfg.GraphAPIVersion.ValueString(),
+		DisableHTTP2:          cfg.DisableHTTP2.ValueBool(),
+		IdleConnTimeout:       secondsOr(cfg.IdleConnTimeout, 0),
+		MaxIdleConnsPerHost:   int(cfg.MaxIdleConnsPerHost.ValueInt64()),
+		RetryBudget:           secondsOr(cfg.RetryBudget, 0),
+		PostWriteDelay:        time.Duration(cfg.PostWriteDelay.ValueInt64()) * time.Millisecond,
+		SetPolicyTenantId:     cfg.SetPolicyTenantId.ValueBool(),
+		KeyPollTimeout:        secondsOr(cfg.GeneratePollTimeout, defaultKeyPollTimeout),
+		KeyPollInterval:       secondsOr(cfg.GeneratePollInterval, defaultKeyPollInterval),
+		PublishPollTimeout:    secondsOr(cfg.PublishPollTimeout, 0),
+		RequestTimeout:        secondsOr(cfg.RequestTimeout, defaultRequestTimeout),
+		XMLContentType:        cfg.PolicyContentType.ValueString(),
+		PublishPollInterval:   secondsOr(cfg.PublishPollInterval, defaultPublishPollInterval),
+	}
+	var client *GraphClient
+	var err error
+	if p.httpClient != nil {
+		client, err = newGraphClient(ctx, cfg.TenantId.ValueString(), cfg.ClientId.ValueString(), cfg.ClientSecret.ValueString(), opts, p.httpClient)
+	} else {
+		client, err = NewGraphClient(ctx, cfg.TenantId.ValueString(), cfg.ClientId.ValueString(), cfg.ClientSecret.ValueString(), opts)
+	}
 	if err != nil {
-		resp.Diagnostics.AddError("Unable to create Graph client", err.Error())
+		addErrorDiagnostic(&resp.Diagnostics, "Unable to create Graph client", err)
 		return
 	}
 
@@ -75,9 +347,22 @@ func (p *b2ciefProvider) Resources(_ context.Context) []func() resource.Resource
 	return []func() resource.Resource{
 		NewPolicyKeyResource,
 		NewIEFPolicyResource,
+		NewPolicySuiteResource,
+		NewPolicyKeyRotationResource,
 	}
 }
 
 func (p *b2ciefProvider) DataSources(_ context.Context) []func() datasource.DataSource {
-	return nil
+	return []func() datasource.DataSource{
+		NewContextDataSource,
+		NewPingDataSource,
+		NewPoliciesDataSource,
+		NewKeysetsDataSource,
+		NewInventoryDataSource,
+		NewPolicyKeyReferencesDataSource,
+		NewPolicyDataSource,
+		NewPolicyKeyPublicDataSource,
+		NewPermissionsDataSource,
+		NewPolicyKeyExistsDataSource,
+	}
 }
@@ -0,0 +1,112 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/provider/schema"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// envVarPrefix prefixes the environment variable read for each provider
+// attribute, e.g. AZURE_B2C_IEF_GRAPH_BASE_URL for graph_base_url
+const envVarPrefix = "AZURE_B2C_IEF_"
+
+// providerEnvVar returns the environment variable that sets attribute
+func providerEnvVar(attribute string) string {
+	return envVarPrefix + strings.ToUpper(attribute)
+}
+
+// applyEnvDefaults fills every string, bool and number attribute left unset
+// in cfg from its environment variable, so explicit configuration wins over
+// the environment and the environment over the provider's defaults. Empty
+// variables are ignored. Map attributes such as extra_headers can only be
+// set in configuration. Terraform validates only the configuration, so the
+// values taken from the environment are checked against the attribute
+// validators of s here.
+func applyEnvDefaults(ctx context.Context, cfg *providerConfig, s schema.Schema) diag.Diagnostics {
+	var diags diag.Diagnostics
+	v := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		attribute := v.Type().Field(i).Tag.Get("tfsdk")
+		envVar := providerEnvVar(attribute)
+		raw := os.Getenv(envVar)
+		if raw == "" {
+			continue
+		}
+
+		field := v.Field(i)
+		before := field.Interface()
+		switch value := before.(type) {
+		case types.String:
+			if value.IsNull() {
+				field.Set(reflect.ValueOf(types.StringValue(raw)))
+			}
+		case types.Bool:
+			if value.IsNull() {
+				b, err := strconv.ParseBool(raw)
+				if err != nil {
+					diags.AddAttributeError(path.Root(attribute), "Invalid environment variable", fmt.Sprintf("%s must be true or false, got %q.", envVar, raw))
+					continue
+				}
+				field.Set(reflect.ValueOf(types.BoolValue(b)))
+			}
+		case types.Int64:
+			if value.IsNull() {
+				n, err := strconv.ParseInt(raw, 10, 64)
+				if err != nil {
+					diags.AddAttributeError(path.Root(attribute), "Invalid environment variable", fmt.Sprintf("%s must be a whole number, got %q.", envVar, raw))
+					continue
+				}
+				field.Set(reflect.ValueOf(types.Int64Value(n)))
+			}
+		default:
+			continue
+		}
+		// Only a value taken from the environment still needs validating
+		if field.Interface() != before {
+			diags.Append(validateEnvValue(ctx, s.Attributes[attribute], attribute, envVar, field.Interface())...)
+		}
+	}
+	return diags
+}
+
+// validateEnvValue runs the validators of attr on value, read from envVar,
+// and reports their errors against the environment variable
+func validateEnvValue(ctx context.Context, attr schema.Attribute, attribute, envVar string, value any) diag.Diagnostics {
+	p := path.Root(attribute)
+	var found diag.Diagnostics
+	switch attr := attr.(type) {
+	case schema.StringAttribute:
+		for _, v := range attr.Validators {
+			resp := &validator.StringResponse{}
+			v.ValidateString(ctx, validator.StringRequest{Path: p, PathExpression: p.Expression(), ConfigValue: value.(types.String)}, resp)
+			found.Append(resp.Diagnostics...)
+		}
+	case schema.Int64Attribute:
+		for _, v := range attr.Validators {
+			resp := &validator.Int64Response{}
+			v.ValidateInt64(ctx, validator.Int64Request{Path: p, PathExpression: p.Expression(), ConfigValue: value.(types.Int64)}, resp)
+			found.Append(resp.Diagnostics...)
+		}
+	case schema.BoolAttribute:
+		for _, v := range attr.Validators {
+			resp := &validator.BoolResponse{}
+			v.ValidateBool(ctx, validator.BoolRequest{Path: p, PathExpression: p.Expression(), ConfigValue: value.(types.Bool)}, resp)
+			found.Append(resp.Diagnostics...)
+		}
+	}
+
+	var diags diag.Diagnostics
+	for _, d := range found.Errors() {
+		diags.AddAttributeError(p, "Invalid environment variable", fmt.Sprintf("%s: %s", envVar, d.Detail()))
+	}
+	return diags
+}
@@ -0,0 +1,287 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/provider"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+)
+
+// testProviderConfig builds provider configuration with the given attribute
+// values and every other attribute null
+func testProviderConfig(t *testing.T, p provider.Provider, values map[string]tftypes.Value) tfsdk.Config {
+	t.Helper()
+	schemaResp := &provider.SchemaResponse{}
+	p.Schema(context.Background(), provider.SchemaRequest{}, schemaResp)
+
+	objType := schemaResp.Schema.Type().TerraformType(context.Background()).(tftypes.Object)
+	all := map[string]tftypes.Value{}
+	for name, attrType := range objType.AttributeTypes {
+		if v, ok := values[name]; ok {
+			all[name] = v
+			continue
+		}
+		all[name] = tftypes.NewValue(attrType, nil)
+	}
+	return tfsdk.Config{
+		Schema: schemaResp.Schema,
+		Raw:    tftypes.NewValue(objType, all),
+	}
+}
+
+// TestProviderConfigureAliases configures two provider instances the way
+// Terraform does for aliased providers and checks each client only talks to
+// its own tenant
+func TestProviderConfigureAliases(t *testing.T) {
+	type request struct{ path, auth string }
+	var mu sync.Mutex
+	received := map[string][]request{}
+	newGraph := func(name string) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			received[name] = append(received[name], request{r.URL.Path, r.Header.Get("Authorization")})
+			mu.Unlock()
+			w.Write([]byte(`{"value":[]}`))
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	graphA, graphB := newGraph("a"), newGraph("b")
+
+	configure := func(tenant, baseURL, token string) *GraphClient {
+		p := New()
+		resp := &provider.ConfigureResponse{}
+		p.Configure(context.Background(), provider.ConfigureRequest{
+			Config: testProviderConfig(t, p, map[string]tftypes.Value{
+				"tenant_id":          tftypes.NewValue(tftypes.String, tenant),
+				"graph_access_token": tftypes.NewValue(tftypes.String, token),
+				"graph_base_url":     tftypes.NewValue(tftypes.String, baseURL),
+				"compress_uploads":   tftypes.NewValue(tftypes.Bool, true),
+				"extra_headers": tftypes.NewValue(tftypes.Map{ElementType: tftypes.String}, map[string]tftypes.Value{
+					"X-Tenant": tftypes.NewValue(tftypes.String, tenant),
+				}),
+			}),
+		}, resp)
+		if resp.Diagnostics.HasError() {
+			t.Fatalf("Configure() unexpected error: %v", resp.Diagnostics)
+		}
+		client, ok := resp.ResourceData.(*GraphClient)
+		if !ok || resp.DataSourceData != resp.ResourceData {
+			t.Fatalf("Configure() did not hand the same client to resources and data sources")
+		}
+		return client
+	}
+	a := configure("tenant-a.onmicrosoft.com", graphA.URL, "token-a")
+	b := configure("tenant-b.onmicrosoft.com", graphB.URL, "token-b")
+
+	if a == b {
+		t.Fatal("aliased providers share a GraphClient")
+	}
+	if a.tenantId == b.tenantId || a.graphBaseURL == b.graphBaseURL || a.extraHeaders["X-Tenant"] == b.extraHeaders["X-Tenant"] {
+		t.Errorf("clients share configuration: a=%s %s, b=%s %s", a.tenantId, a.graphBaseURL, b.tenantId, b.graphBaseURL)
+	}
+
+	// Per-run fallbacks learned by one instance must not affect the other
+	a.v1Unsupported.Store(true)
+	a.compressUploads.Store(false)
+	if b.v1Unsupported.Load() || !b.compressUploads.Load() {
+		t.Errorf("state learned by one client leaked into the other")
+	}
+
+	for _, c := range []*GraphClient{a, b} {
+		if _, err := c.readGraph(context.Background(), "/trustFramework/policies"); err != nil {
+			t.Fatalf("readGraph() unexpected error: %v", err)
+		}
+	}
+	want := map[string]request{
+		"a": {"/beta/trustFramework/policies", "Bearer token-a"},
+		"b": {"/v1.0/trustFramework/policies", "Bearer token-b"},
+	}
+	for name, w := range want {
+		got := received[name]
+		if len(got) != 1 || got[0] != w {
+			t.Errorf("graph %s received %v, want [%v]", name, got, w)
+		}
+	}
+}
+
+func TestClaimPolicyIdPerInstance(t *testing.T) {
+	a, b := newFakeGraphClient(&fakeGraph{}), newFakeGraphClient(&fakeGraph{})
+	if other := a.claimPolicyId("B2C_1A_AliasBase", "tenant-a/base.xml"); other != "" {
+		t.Fatalf("first claim returned %s", other)
+	}
+	if other := b.claimPolicyId("B2C_1A_AliasBase", "tenant-b/base.xml"); other != "" {
+		t.Errorf("same PolicyId under another provider instance reported as a duplicate of %s", other)
+	}
+	if other := a.claimPolicyId("b2c_1a_aliasbase", "tenant-a/copy.xml"); other != "tenant-a/base.xml" {
+		t.Errorf("duplicate under the same instance returned %q, want tenant-a/base.xml", other)
+	}
+}
+
+func TestProviderConfigureBetaWarning(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  tftypes.Value
+		wantWarn bool
+	}{
+		{name: "unset", version: tftypes.NewValue(tftypes.String, nil), wantWarn: true},
+		{name: "pinned to beta", version: tftypes.NewValue(tftypes.String, "beta")},
+		{name: "pinned to v1.0", version: tftypes.NewValue(tftypes.String, "v1.0")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New()
+			resp := &provider.ConfigureResponse{}
+			p.Configure(context.Background(), provider.ConfigureRequest{
+				Config: testProviderConfig(t, p, map[string]tftypes.Value{
+					"tenant_id":          tftypes.NewValue(tftypes.String, "tenant"),
+					"graph_access_token": tftypes.NewValue(tftypes.String, "token"),
+					"graph_api_version":  tt.version,
+				}),
+			}, resp)
+			if resp.Diagnostics.HasError() {
+				t.Fatalf("Configure() unexpected error: %v", resp.Diagnostics)
+			}
+			warned := false
+			for _, d := range resp.Diagnostics.Warnings() {
+				warned = warned || d.Summary() == "Using the Microsoft Graph beta API"
+			}
+			if warned != tt.wantWarn {
+				t.Errorf("beta warning = %v, want %v: %v", warned, tt.wantWarn, resp.Diagnostics)
+			}
+		})
+	}
+}
+
+func TestProviderConfigureSetPolicyTenantId(t *testing.T) {
+	tests := []struct {
+		name    string
+		tenant  string
+		wantErr bool
+	}{
+		{name: "tenant domain", tenant: "contoso.onmicrosoft.com"},
+		{name: "tenant UUID", tenant: "00000000-0000-0000-0000-000000000000", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New()
+			resp := &provider.ConfigureResponse{}
+			p.Configure(context.Background(), provider.ConfigureRequest{
+				Config: testProviderConfig(t, p, map[string]tftypes.Value{
+					"tenant_id":            tftypes.NewValue(tftypes.String, tt.tenant),
+					"graph_access_token":   tftypes.NewValue(tftypes.String, "token"),
+					"graph_api_version":    tftypes.NewValue(tftypes.String, "beta"),
+					"set_policy_tenant_id": tftypes.NewValue(tftypes.Bool, true),
+				}),
+			}, resp)
+			if resp.Diagnostics.HasError() != tt.wantErr {
+				t.Fatalf("Configure() error = %v, wantErr %v", resp.Diagnostics, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if client := resp.ResourceData.(*GraphClient); !client.setPolicyTenantId {
+				t.Errorf("set_policy_tenant_id not passed to the client")
+			}
+		})
+	}
+}
+
+func TestProviderConfigureEnvValidated(t *testing.T) {
+	tests := []struct {
+		attribute string
+		value     string
+	}{
+		{attribute: "generate_poll_interval_seconds", value: "0"},
+		{attribute: "publish_poll_interval_seconds", value: "0"},
+		{attribute: "request_timeout_seconds", value: "-5"},
+		{attribute: "trust_framework_segment", value: "trust framework"},
+		{attribute: "graph_api_version", value: "v2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.attribute, func(t *testing.T) {
+			envVar := providerEnvVar(tt.attribute)
+			t.Setenv(envVar, tt.value)
+			p := New()
+			resp := &provider.ConfigureResponse{}
+			p.Configure(context.Background(), provider.ConfigureRequest{
+				Config: testProviderConfig(t, p, map[string]tftypes.Value{
+					"tenant_id":          tftypes.NewValue(tftypes.String, "tenant"),
+					"graph_access_token": tftypes.NewValue(tftypes.String, "token"),
+				}),
+			}, resp)
+			if !resp.Diagnostics.HasError() {
+				t.Fatalf("Configure() accepted %s=%s", envVar, tt.value)
+			}
+			d := resp.Diagnostics.Errors()[0]
+			withPath, ok := d.(diag.DiagnosticWithPath)
+			if !ok || !withPath.Path().Equal(path.Root(tt.attribute)) || !strings.Contains(d.Detail(), envVar) {
+				t.Errorf("Configure() error = %s: %s, want it on %s naming %s", d.Summary(), d.Detail(), tt.attribute, envVar)
+			}
+		})
+	}
+
+	// The environment is not validated when the configuration sets the value
+	t.Setenv("AZURE_B2C_IEF_REQUEST_TIMEOUT_SECONDS", "-5")
+	p := New()
+	resp := &provider.ConfigureResponse{}
+	p.Configure(context.Background(), provider.ConfigureRequest{
+		Config: testProviderConfig(t, p, map[string]tftypes.Value{
+			"tenant_id":               tftypes.NewValue(tftypes.String, "tenant"),
+			"graph_access_token":      tftypes.NewValue(tftypes.String, "token"),
+			"request_timeout_seconds": tftypes.NewValue(tftypes.Number, 5),
+		}),
+	}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Errorf("Configure() validated an environment variable the configuration overrides: %v", resp.Diagnostics)
+	}
+}
+
+func TestProviderConfigureEnv(t *testing.T) {
+	t.Setenv("AZURE_B2C_IEF_TENANT_ID", "env-tenant")
+	t.Setenv("AZURE_B2C_IEF_GRAPH_ACCESS_TOKEN", "env-token")
+	t.Setenv("AZURE_B2C_IEF_GRAPH_BASE_URL", "https://env.example.com")
+	t.Setenv("AZURE_B2C_IEF_GRAPH_API_VERSION", "v1.0")
+	t.Setenv("AZURE_B2C_IEF_READ_ONLY", "true")
+
+	p := New()
+	resp := &provider.ConfigureResponse{}
+	p.Configure(context.Background(), provider.ConfigureRequest{
+		Config: testProviderConfig(t, p, map[string]tftypes.Value{
+			"graph_base_url": tftypes.NewValue(tftypes.String, "https://config.example.com"),
+		}),
+	}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Configure() unexpected error: %v", resp.Diagnostics)
+	}
+	client := resp.ResourceData.(*GraphClient)
+	if client.tenantId != "env-tenant" {
+		t.Errorf("tenantId = %q, want env-tenant", client.tenantId)
+	}
+	if client.graphBaseURL != "https://config.example.com" {
+		t.Errorf("graphBaseURL = %q, configuration should take precedence over the environment", client.graphBaseURL)
+	}
+	if client.apiVersion != "v1.0" || !client.readOnly {
+		t.Errorf("apiVersion = %q, readOnly = %v, want v1.0 and true from the environment", client.apiVersion, client.readOnly)
+	}
+
+	t.Setenv("AZURE_B2C_IEF_READ_ONLY", "sometimes")
+	resp = &provider.ConfigureResponse{}
+	p.Configure(context.Background(), provider.ConfigureRequest{
+		Config: testProviderConfig(t, p, nil),
+	}, resp)
+	if !resp.Diagnostics.HasError() {
+		t.Fatalf("Configure() accepted an unparsable AZURE_B2C_IEF_READ_ONLY")
+	}
+}
@@ -1,17 +1,30 @@
 package provider
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/hashicorp/terraform-plugin-framework-validators/resourcevalidator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
 	"github.com/hashicorp/terraform-plugin-framework/types"
 	"github.com/hashicorp/terraform-plugin-log/tflog"
 )
@@ -21,11 +34,32 @@ type PolicyResource struct {
 }
 
 type IEFPolicyModel struct {
-	ID          types.String `tfsdk:"id"`
-	XML         types.String `tfsdk:"xml"`
-	File        types.String `tfsdk:"file"`
-	AppSettings types.Map    `tfsdk:"app_settings"`
-	Publish     types.Bool   `tfsdk:"publish"`
+	ID                 types.String `tfsdk:"id"`
+	XML                types.String `tfsdk:"xml"`
+	File               types.String `tfsdk:"file"`
+	AppSettings        types.Map    `tfsdk:"app_settings"`
+	Publish            types.Bool   `tfsdk:"publish"`
+	PreferRemote       types.Bool   `tfsdk:"prefer_remote"`
+	ReadFromRemoteOnly types.Bool   `tfsdk:"read_from_remote_only"`
+	FileEncoding       types.String `tfsdk:"file_encoding"`
+	IsPublished        types.Bool   `tfsdk:"is_published"`
+	PolicyIdPrefix     types.String `tfsdk:"policy_id_prefix"`
+	LastHttpStatus     types.Int64  `tfsdk:"last_http_status"`
+	SkipInjection      types.Bool   `tfsdk:"skip_injection"`
+	SettingsByEnv      types.Map    `tfsdk:"app_settings_by_environment"`
+	Environment        types.String `tfsdk:"environment"`
+	StoreRenderedXML   types.Bool   `tfsdk:"store_rendered_xml"`
+	XMLSha256          types.String `tfsdk:"xml_sha256"`
+	Enabled            types.Bool   `tfsdk:"enabled"`
+	XSDPath            types.String `tfsdk:"xsd_path"`
+	FileContent        types.String `tfsdk:"file_content"`
+	FileSha256         types.String `tfsdk:"file_sha256"`
+	SensitiveSettings  types.Set    `tfsdk:"sensitive_settings"`
+	EffectiveSettings  types.Map    `tfsdk:"effective_app_settings"`
+	ManagedBy          types.String `tfsdk:"managed_by"`
+	StrictRoot         types.Bool   `tfsdk:"strict_root"`
+	Triggers           types.Map    `tfsdk:"triggers"`
+	BasePolicyId       types.String `tfsdk:"base_policy_id"`
 }
 
 func NewIEFPolicyResource() resource.Resource {
@@ -50,29 +84,346 @@ func (r *PolicyResource) Schema(
 		Attributes: map[string]schema.Attribute{
 			"id": schema.StringAttribute{
 				Computed:            true,
-				MarkdownDescription: "The Policy ID (extracted from the XML `PolicyId` attribute).",
+				MarkdownDescription: "The Policy ID (extracted from the XML `PolicyId` attribute). Destroying the resource deletes exactly this policy, so policies staged under related IDs, e.g. `B2C_1A_signup_signin` and `B2C_1A_signup_signin_v2`, can be managed and destroyed independently. Delete is refused when this ID does not exactly match the `PolicyId` of the XML in state.",
+			},
+			"base_policy_id": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "The `PolicyId` of the policy's `BasePolicy`, parsed from the XML. Null for a policy without a base, such as `TrustFrameworkBase`. Reference the base resource's `id` from the extension, e.g. in `triggers`, so Terraform uploads the base first without `depends_on`, and check it against this attribute in a `postcondition`.",
 			},
 			"file": schema.StringAttribute{
 				Required:            true,
-				MarkdownDescription: "Path to the XML policy file on the local file system.",
+				MarkdownDescription: "Path to the XML policy file on the local file system. Each policy resource must upload a different `PolicyId`; a warning is shown when two resources with different files declare the same one, since they would overwrite each other in the tenant.",
+			},
+			"strict_root": schema.BoolAttribute{
+				Optional:            true,
+				MarkdownDescription: "Fail when the root element of `file` is not `TrustFrameworkPolicy`, naming the root element found, to catch a resource pointing at the wrong file. Otherwise the `PolicyId` of the first `TrustFrameworkPolicy` element is used, or of the root element when there is none. Defaults to `false`.",
+			},
+			"file_encoding": schema.StringAttribute{
+				Optional:            true,
+				MarkdownDescription: "Encoding of the policy file. Set to `base64` when the file holds base64-encoded XML; it is decoded before app settings are injected. Defaults to plain XML.",
+				Validators: []validator.String{
+					stringvalidator.OneOf(policyFileEncodingBase64),
+				},
 			},
 			"app_settings": schema.MapAttribute{
-				Required:            true,
+				Optional:            true,
+				ElementType:         types.StringType,
+				MarkdownDescription: "A map of key-value pairs used for variable injection in the XML policy. Use `{settings:key}` in your XML to reference these values. Only settings the policy references affect the rendered `xml`, so changing any other setting does not upload the policy again; a warning lists those settings.",
+			},
+			"app_settings_by_environment": schema.MapAttribute{
+				Optional:            true,
+				ElementType:         types.MapType{ElemType: types.StringType},
+				MarkdownDescription: "App settings per environment, for deploying one policy to several environments from a single resource. The map for `environment` is merged over the `default` entry and injected like `app_settings`. Cannot be combined with `app_settings`.",
+			},
+			"environment": schema.StringAttribute{
+				Optional:            true,
+				MarkdownDescription: "Key of `app_settings_by_environment` to inject, e.g. `prod`. When unset only the `default` entry is used.",
+				Validators: []validator.String{
+					stringvalidator.AlsoRequires(path.MatchRoot("app_settings_by_environment")),
+				},
+			},
+			"managed_by": schema.StringAttribute{
+				Optional:            true,
+				MarkdownDescription: "Marker naming the owner of the policy, e.g. the Terraform workspace, for audits. It is embedded as an XML comment `<!-- managed_by: ... -->` at the start of the `TrustFrameworkPolicy` element, so it travels with the policy in the tenant, even with `skip_injection`. Cannot contain `--`.",
+				Validators: []validator.String{
+					stringvalidator.RegexMatches(managedByPattern, "must not contain -- or end with -, which XML comments cannot hold"),
+				},
+			},
+			"triggers": schema.MapAttribute{
+				Optional:            true,
+				ElementType:         types.StringType,
+				MarkdownDescription: "Arbitrary values that upload the policy again whenever any of them changes, even when the rendered XML is the same. Reference another resource's attributes here, e.g. a policy key's `active_kid`, so rotating the key re-publishes the policies that use it in the same apply. The values are not injected into the policy.",
+			},
+			"sensitive_settings": schema.SetAttribute{
+				Optional:            true,
+				ElementType:         types.StringType,
+				MarkdownDescription: "Keys of app settings whose values are redacted in `effective_app_settings`, e.g. client secrets. The values are still injected, and still stored in `xml` unless `store_rendered_xml` is `false`.",
+			},
+			"effective_app_settings": schema.MapAttribute{
+				Computed:            true,
 				ElementType:         types.StringType,
-				MarkdownDescription: "A map of key-value pairs used for variable injection in the XML policy. Use `{settings:key}` in your XML to reference these values.",
+				MarkdownDescription: "The app settings injected into the policy after merging `app_settings_by_environment`, with the values of `sensitive_settings` replaced by `<redacted>`. Null when `skip_injection` is `true`.",
+			},
+			"skip_injection": schema.BoolAttribute{
+				Optional:            true,
+				MarkdownDescription: "Upload the policy file verbatim, without replacing `{settings:key}` placeholders. For pre-rendered policies, or documents that contain such text literally. Cannot be combined with `app_settings`. Defaults to `false`.",
 			},
 			"publish": schema.BoolAttribute{
 				Required:            true,
 				MarkdownDescription: "Whether to upload/publish the policy to the B2C tenant. If `false`, the provider only performs local processing (variable injection) and stores the result in the `xml` attribute.",
 			},
+			"xsd_path": schema.StringAttribute{
+				Optional:            true,
+				MarkdownDescription: "Path to an XML schema, e.g. the published `TrustFrameworkPolicy_0.3.0.0.xsd`, the rendered policy is checked against before it is uploaded. Violations are reported with their line and column in the rendered XML. Only element names, nesting and attributes are checked, not element order, occurrence counts or value types. No validation is done when unset.",
+			},
+			"policy_id_prefix": schema.StringAttribute{
+				Optional:            true,
+				MarkdownDescription: "Prefix the `PolicyId` and `BasePolicy` `PolicyId` in the XML must start with before the policy is uploaded. Defaults to `B2C_1A_`, which Azure AD B2C requires for custom policies. Set to an empty string to disable the check.",
+			},
+			"is_published": schema.BoolAttribute{
+				Computed:            true,
+				MarkdownDescription: "Whether the policy was found in the B2C tenant the last time it was applied or refreshed. Unlike `publish`, which is the desired state, this reflects what Graph reports.",
+			},
+			"last_http_status": schema.Int64Attribute{
+				Computed:            true,
+				MarkdownDescription: "HTTP status Graph returned for the policy upload in the last create or update, e.g. `200` or `201`. Null when the last apply did not upload, i.e. `publish` is false.",
+			},
 			"xml": schema.StringAttribute{
 				Computed:            true,
-				MarkdownDescription: "The final processed XML content after variable injection.",
+				MarkdownDescription: "The final processed XML content after variable injection. Null when `store_rendered_xml` is `false`.",
+			},
+			"xml_sha256": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "Hex SHA-256 of the processed XML. Refresh compares it with the local file or the published policy to detect drift.",
+			},
+			"file_content": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "The policy file content before app settings are injected, as of the last apply. When `file` no longer exists, the policy is rendered from this content with a warning, so a change to only the app settings can still be applied. Null when `store_rendered_xml` is `false`.",
+			},
+			"file_sha256": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "Hex SHA-256 of `file_content`. An update that changes the app settings warns when the file changed as well.",
+			},
+			"enabled": schema.BoolAttribute{
+				Optional:            true,
+				MarkdownDescription: "Set to `false` to keep the resource in state but inert, e.g. for an environment that should not receive the policy. The XML is still rendered locally, but the provider sends no Graph requests for the policy: nothing is uploaded or deleted, and refresh does not check the tenant. `is_published` is `false` while disabled. Defaults to `true`.",
+			},
+			"store_rendered_xml": schema.BoolAttribute{
+				Optional:            true,
+				MarkdownDescription: "Whether to store the processed XML in `xml`. Set to `false` to keep large policies, and any secrets injected through app settings, out of state; only `xml_sha256` is stored then, which is enough to detect drift. With `prefer_remote`, the remote XML is not kept in state either. Defaults to `true`.",
+			},
+			"read_from_remote_only": schema.BoolAttribute{
+				Optional:            true,
+				MarkdownDescription: "When `true`, refreshing the resource does not read the local `file` and only compares the published policy with the `xml` in state; a difference causes the policy to be uploaded again. Useful in CI where the source tree at refresh time may differ from apply time. Conflicts with `prefer_remote`.",
+			},
+			"prefer_remote": schema.BoolAttribute{
+				Optional:            true,
+				MarkdownDescription: "When `true` and `publish` is `true`, refreshing the resource stores the policy XML currently live in the tenant in `xml` instead of recreating the policy when it was edited outside Terraform (e.g. in the portal). By default the local file is the source of truth and any difference causes the policy to be uploaded again. With this enabled, edits to the local file are not detected until `file` or `app_settings` change.",
 			},
 		},
 	}
 }
 
+func (r *PolicyResource) ConfigValidators(
+	ctx context.Context,
+) []resource.ConfigValidator {
+	return []resource.ConfigValidator{
+		resourcevalidator.Conflicting(
+			path.MatchRoot("prefer_remote"),
+			path.MatchRoot("read_from_remote_only"),
+		),
+		resourcevalidator.Conflicting(
+			path.MatchRoot("app_settings"),
+			path.MatchRoot("app_settings_by_environment"),
+		),
+	}
+}
+
+// ValidateConfig warns when the policy file declares a PolicyId that another
+// policy resource, configured from a different file, already declared in
+// this run. Resources cannot see each other, so this relies on the provider
+// process validating every resource.
+func (r *PolicyResource) ValidateConfig(
+	ctx context.Context,
+	req resource.ValidateConfigRequest,
+	resp *resource.ValidateConfigResponse,
+) {
+	var data IEFPolicyModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	if data.SkipInjection.ValueBool() && !data.AppSettings.IsNull() {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("app_settings"),
+			"Conflicting configuration",
+			"app_settings cannot be used with skip_injection = true, as the settings would never be injected.",
+		)
+	}
+	if data.SkipInjection.ValueBool() && !data.SettingsByEnv.IsNull() {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("app_settings_by_environment"),
+			"Conflicting configuration",
+			"app_settings_by_environment cannot be used with skip_injection = true, as the settings would never be injected.",
+		)
+	}
+	if isNullOrEmpty(data.File) || data.FileEncoding.IsUnknown() {
+		return
+	}
+
+	// Unreadable files are reported by Create and Update
+	raw, err := os.ReadFile(data.File.ValueString())
+	if err != nil {
+		return
+	}
+	content, err := decodePolicyFile(raw, data.FileEncoding)
+	if err != nil {
+		return
+	}
+	warnUnusedSettings(ctx, data, content, &resp.Diagnostics)
+	if !data.checkRoot(content, &resp.Diagnostics) {
+		return
+	}
+	refs, err := parsePolicyRefs(content)
+	if err != nil || refs.PolicyId == "" {
+		return
+	}
+	// The provider is not configured while Terraform validates the
+	// configuration, so the instance, and with it the tenant, the policy is
+	// uploaded to is unknown. The check runs again when planning.
+	if r.client == nil {
+		return
+	}
+	if other := r.client.claimPolicyId(refs.PolicyId, data.File.ValueString()); other != "" {
+		resp.Diagnostics.AddAttributeWarning(
+			path.Root("file"),
+			"Duplicate PolicyId",
+			fmt.Sprintf("%s declares PolicyId %s, which %s also declares. Both azure_b2c_ief_policy resources would upload to the same policy in the tenant and overwrite each other. Give one of them a different PolicyId.", data.File.ValueString(), refs.PolicyId, other),
+		)
+	}
+}
+
+// warnUnusedSettings warns about app settings the policy file never
+// references. They are not injected anywhere, so changing them does not
+// change the uploaded policy, which usually means a typo in the key or the
+// placeholder.
+func warnUnusedSettings(ctx context.Context, data IEFPolicyModel, content string, diags *diag.Diagnostics) {
+	if data.SkipInjection.ValueBool() || data.AppSettings.IsUnknown() || data.SettingsByEnv.IsUnknown() || data.Environment.IsUnknown() {
+		return
+	}
+	settings := map[string]types.String{}
+	if d := data.AppSettings.ElementsAs(ctx, &settings, false); d.HasError() {
+		return
+	}
+	settings, err := data.withEnvironmentSettings(ctx, settings)
+	if err != nil {
+		return
+	}
+	_, unused := referencedSettings(content, settings)
+	if len(unused) == 0 {
+		return
+	}
+	attr := path.Root("app_settings")
+	if !data.SettingsByEnv.IsNull() {
+		attr = path.Root("app_settings_by_environment")
+	}
+	diags.AddAttributeWarning(
+		attr,
+		"Unused app settings",
+		fmt.Sprintf("%s has no {settings:key} placeholder for %s. Changing these settings does not change the uploaded policy.", data.File.ValueString(), strings.Join(unused, ", ")),
+	)
+}
+
+// claimPolicyId records file as declaring policyId in the tenant of this
+// provider instance, returning the file that declared it first when that is
+// a different file. Aliased providers served by the same process each have
+// their own client, so they never see each other's policies.
+func (c *GraphClient) claimPolicyId(policyId, file string) string {
+	c.policyIdFilesMu.Lock()
+	defer c.policyIdFilesMu.Unlock()
+
+	if c.policyIdFiles == nil {
+		c.policyIdFiles = map[string]string{}
+	}
+	key := strings.ToUpper(policyId)
+	file = filepath.Clean(file)
+	first, ok := c.policyIdFiles[key]
+	if !ok {
+		c.policyIdFiles[key] = file
+		return ""
+	}
+	if first == file {
+		return ""
+	}
+	return first
+}
+
+// ModifyPlan keeps the computed attributes of an existing policy when the
+// planned change does not alter the rendered XML, e.g. an edit to an app
+// setting the policy never references, so the plan does not show the policy
+// being uploaded again. Update skips the upload in the same case.
+func (r *PolicyResource) ModifyPlan(
+	ctx context.Context,
+	req resource.ModifyPlanRequest,
+	resp *resource.ModifyPlanResponse,
+) {
+	if req.State.Raw.IsNull() || req.Plan.Raw.IsNull() {
+		return
+	}
+	var state, plan IEFPolicyModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	policyXml, ok := plan.plannedRender(ctx)
+	if !ok {
+		return
+	}
+	policyXml = r.client.withPolicyTenant(policyXml)
+	plan.BasePolicyId = basePolicyIdValue(policyXml)
+	if !plan.uploadUnchanged(state, policyXml) {
+		resp.Diagnostics.Append(resp.Plan.Set(ctx, &plan)...)
+		return
+	}
+	plan.setRendered(policyXml)
+	plan.ID = state.ID
+	plan.IsPublished = state.IsPublished
+	plan.LastHttpStatus = state.LastHttpStatus
+	plan.FileContent = state.FileContent
+	plan.FileSha256 = state.FileSha256
+	resp.Diagnostics.Append(resp.Plan.Set(ctx, &plan)...)
+}
+
+// plannedRender renders the planned policy from the local file. Settings the
+// file does not reference are left out, so they may still be unknown. It
+// reports false when the policy cannot be rendered at plan time.
+func (data IEFPolicyModel) plannedRender(ctx context.Context) (string, bool) {
+	if isNullOrEmpty(data.File) || data.FileEncoding.IsUnknown() || data.SkipInjection.IsUnknown() || data.ManagedBy.IsUnknown() ||
+		data.AppSettings.IsUnknown() || data.SettingsByEnv.IsUnknown() || data.Environment.IsUnknown() {
+		return "", false
+	}
+	raw, err := os.ReadFile(data.File.ValueString())
+	if err != nil {
+		return "", false
+	}
+	content, err := decodePolicyFile(raw, data.FileEncoding)
+	if err != nil {
+		return "", false
+	}
+	settings := map[string]types.String{}
+	if diags := data.AppSettings.ElementsAs(ctx, &settings, false); diags.HasError() {
+		return "", false
+	}
+	settings, err = data.withEnvironmentSettings(ctx, settings)
+	if err != nil {
+		return "", false
+	}
+	referenced, _ := referencedSettings(content, settings)
+	for _, v := range referenced {
+		if v.IsUnknown() {
+			return "", false
+		}
+	}
+	return data.render(ctx, content, referenced), true
+}
+
+// uploadUnchanged reports whether applying data over state would upload the
+// policy state already holds, with nothing else that affects the upload
+// changed
+func (data IEFPolicyModel) uploadUnchanged(state IEFPolicyModel, policyXml string) bool {
+	if data.Publish.IsUnknown() || data.Enabled.IsUnknown() || data.StoreRenderedXML.IsUnknown() ||
+		!data.Triggers.Equal(state.Triggers) {
+		return false
+	}
+	storesXML := func(m IEFPolicyModel) bool { return m.StoreRenderedXML.IsNull() || m.StoreRenderedXML.ValueBool() }
+	return state.matchesRendered(policyXml) &&
+		data.Publish.ValueBool() == state.Publish.ValueBool() &&
+		data.isEnabled() == state.isEnabled() &&
+		storesXML(data) == storesXML(state) &&
+		(!data.Publish.ValueBool() || !data.isEnabled() || state.IsPublished.ValueBool())
+}
+
 func (r *PolicyResource) Configure(
 	_ context.Context,
 	req resource.ConfigureRequest,
@@ -88,26 +439,90 @@ func isNullOrEmpty(a types.String) bool {
 	return a.IsUnknown() || a.IsNull() || "" == a.ValueString()
 }
 
-func getPolicyId(p string) string {
-	result := ""
+// policyRootElement is the root element of every Trust Framework Policy
+const policyRootElement = "TrustFrameworkPolicy"
+
+// policyElements returns the root element of the document and the first
+// TrustFrameworkPolicy element in it, which is nil when there is none
+func policyElements(p string) (xml.StartElement, *xml.StartElement, error) {
+	var root xml.StartElement
 	decoder := xml.NewDecoder(strings.NewReader(p))
-	for {
+	for depth := 0; ; {
 		tok, err := decoder.Token()
+		if err == io.EOF && depth == 0 && root.Name.Local != "" {
+			return root, nil, nil
+		}
 		if err != nil {
-			break
+			return root, nil, err
 		}
 		switch se := tok.(type) {
 		case xml.StartElement:
-			fmt.Println("First element name:", se.Name.Local)
-			for _, attr := range se.Attr {
-				if attr.Name.Local == "PolicyId" {
-					result = attr.Value
-				}
+			if depth == 0 {
+				root = se
 			}
-			return result
+			if se.Name.Local == policyRootElement {
+				return root, &se, nil
+			}
+			depth++
+		case xml.EndElement:
+			depth--
 		}
 	}
-	return result
+}
+
+// getPolicyId returns the PolicyId of the TrustFrameworkPolicy element, or of
+// the root element when the document has none
+func getPolicyId(p string) string {
+	root, policy, _ := policyElements(p)
+	if policy != nil {
+		root = *policy
+	}
+	for _, attr := range root.Attr {
+		if attr.Name.Local == "PolicyId" {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// checkRoot reports false, adding an error, when strict_root is set and the
+// rendered policy's root element is not TrustFrameworkPolicy
+func (data IEFPolicyModel) checkRoot(policyXml string, diags *diag.Diagnostics) bool {
+	if !data.StrictRoot.ValueBool() {
+		return true
+	}
+	if err := checkPolicyRoot(policyXml); err != nil {
+		diags.AddAttributeError(path.Root("file"), errorSummary("Invalid policy file", err), err.Error())
+		return false
+	}
+	return true
+}
+
+// checkPolicyId adds an error and returns false when the rendered policy has
+// no PolicyId to upload it under
+func (data IEFPolicyModel) checkPolicyId(diags *diag.Diagnostics) bool {
+	if data.ID.ValueString() != "" {
+		return true
+	}
+	diags.AddAttributeError(
+		path.Root("file"),
+		"Missing PolicyId",
+		fmt.Sprintf("The policy rendered from %s has no PolicyId attribute on its TrustFrameworkPolicy element, so it cannot be uploaded. Check the file, and any {settings:...} placeholder used for the PolicyId.", data.File.ValueString()),
+	)
+	return false
+}
+
+// checkPolicyRoot errors when the root element of the document is not
+// TrustFrameworkPolicy, which usually means file names the wrong document
+func checkPolicyRoot(p string) error {
+	root, _, err := policyElements(p)
+	if err != nil {
+		return configErrorf("Unable to parse policy XML: %s", err)
+	}
+	if root.Name.Local != policyRootElement {
+		return configErrorf("The root element is %s, not %s. Check that file references a custom policy.", root.Name.Local, policyRootElement)
+	}
+	return nil
 }
 
 func injectAppSettings(
@@ -117,9 +532,7 @@ func injectAppSettings(
 ) string {
 	result := xml
 	for k, v := range app_settings {
-		re := regexp.MustCompile(fmt.Sprintf(
-			`(?i)\{settings:%s\}`, k),
-		)
+		re := settingPattern(k)
 		if !isNullOrEmpty(v) {
 			result = re.ReplaceAllString(result, v.ValueString())
 			tflog.Debug(ctx, "App setting found!", map[string]any{
@@ -136,30 +549,415 @@ func injectAppSettings(
 	return result
 }
 
-func (r *PolicyResource) putPolicy(ctx context.Context, policyXml string) error {
+// settingPattern matches the {settings:key} placeholders for key, ignoring case
+func settingPattern(key string) *regexp.Regexp {
+	return regexp.MustCompile(fmt.Sprintf(`(?i)\{settings:%s\}`, key))
+}
+
+// referencedSettings splits settings into those content has a placeholder
+// for, which are the only ones that can change the rendered policy, and the
+// sorted keys of those it never references
+func referencedSettings(content string, settings map[string]types.String) (map[string]types.String, []string) {
+	referenced := make(map[string]types.String, len(settings))
+	var unused []string
+	for k, v := range settings {
+		if settingPattern(k).MatchString(content) {
+			referenced[k] = v
+		} else {
+			unused = append(unused, k)
+		}
+	}
+	sort.Strings(unused)
+	return referenced, unused
+}
+
+// defaultSettingsEnvironment is the app_settings_by_environment entry every
+// environment is merged over
+const defaultSettingsEnvironment = "default"
+
+// withEnvironmentSettings returns settings plus the app_settings_by_environment
+// entries for the selected environment, merged over the default entry
+func (data IEFPolicyModel) withEnvironmentSettings(ctx context.Context, settings map[string]types.String) (map[string]types.String, error) {
+	if data.SettingsByEnv.IsNull() || data.SettingsByEnv.IsUnknown() {
+		return settings, nil
+	}
+	var byEnv map[string]map[string]types.String
+	if diags := data.SettingsByEnv.ElementsAs(ctx, &byEnv, false); diags.HasError() {
+		return nil, newAttributeError(path.Root("app_settings_by_environment"), "Unable to read app_settings_by_environment as a map of maps of strings.")
+	}
+	env := data.Environment.ValueString()
+	if env != "" {
+		if _, ok := byEnv[env]; !ok {
+			return nil, newAttributeError(path.Root("environment"), fmt.Sprintf("app_settings_by_environment has no entry for environment %q", env))
+		}
+	}
+	merged := make(map[string]types.String, len(settings))
+	for k, v := range settings {
+		merged[k] = v
+	}
+	for k, v := range byEnv[defaultSettingsEnvironment] {
+		merged[k] = v
+	}
+	for k, v := range byEnv[env] {
+		merged[k] = v
+	}
+	return merged, nil
+}
+
+// setEffectiveSettings records the merged settings injected into the policy,
+// redacting the keys listed in sensitive_settings
+func (data *IEFPolicyModel) setEffectiveSettings(ctx context.Context, settings map[string]types.String) {
+	if data.SkipInjection.ValueBool() {
+		data.EffectiveSettings = types.MapNull(types.StringType)
+		return
+	}
+	var sensitive []string
+	data.SensitiveSettings.ElementsAs(ctx, &sensitive, false)
+	effective := make(map[string]types.String, len(settings))
+	for k, v := range settings {
+		effective[k] = v
+	}
+	for _, k := range sensitive {
+		if _, ok := effective[k]; ok {
+			effective[k] = types.StringValue(redacted)
+		}
+	}
+	data.EffectiveSettings, _ = types.MapValueFrom(ctx, types.StringType, effective)
+}
+
+// xmlChecksum returns the hex SHA-256 of a rendered policy
+func xmlChecksum(policyXml string) string {
+	sum := sha256.Sum256([]byte(policyXml))
+	return hex.EncodeToString(sum[:])
+}
+
+// isEnabled reports whether the policy should be synced with Graph
+func (data IEFPolicyModel) isEnabled() bool {
+	return data.Enabled.IsNull() || data.Enabled.ValueBool()
+}
+
+// setRendered records the rendered policy in state: always its checksum, and
+// the XML itself unless store_rendered_xml is false
+func (data *IEFPolicyModel) setRendered(policyXml string) {
+	data.XMLSha256 = types.StringValue(xmlChecksum(policyXml))
+	if data.StoreRenderedXML.IsNull() || data.StoreRenderedXML.ValueBool() {
+		data.XML = types.StringValue(policyXml)
+	} else {
+		data.XML = types.StringNull()
+	}
+}
+
+// setFileContent caches the policy file content in state: always its
+// checksum, and the content itself unless store_rendered_xml is false
+func (data *IEFPolicyModel) setFileContent(content string) {
+	data.FileSha256 = types.StringValue(xmlChecksum(content))
+	if data.StoreRenderedXML.IsNull() || data.StoreRenderedXML.ValueBool() {
+		data.FileContent = types.StringValue(content)
+	} else {
+		data.FileContent = types.StringNull()
+	}
+}
+
+// readFileContent reads and decodes the policy file. When the file no longer
+// exists, the content state cached from the same path is used with a
+// warning. op names the operation in diagnostics.
+func (data IEFPolicyModel) readFileContent(ctx context.Context, state IEFPolicyModel, op string, diags *diag.Diagnostics) (string, bool) {
+	p := data.File.ValueString()
+	_, err := os.Stat(p)
+	if err != nil && os.IsNotExist(err) {
+		if state.File.ValueString() != p || state.FileContent.IsNull() || state.FileContent.IsUnknown() {
+			diags.AddAttributeError(
+				path.Root("file"),
+				fmt.Sprintf("File does not exist! (%s)", op),
+				fmt.Sprintf("File path %s does not exist", p),
+			)
+			return "", false
+		}
+		diags.AddAttributeWarning(
+			path.Root("file"),
+			"Using cached policy file",
+			fmt.Sprintf("File path %s does not exist, so the policy is rendered from the file content cached in state by the last apply.", p),
+		)
+		return state.FileContent.ValueString(), true
+	}
+	raw_byte, err := os.ReadFile(p)
+	if err != nil {
+		tflog.Error(ctx, "Error reading file!", map[string]any{
+			"path": p,
+		})
+		diags.AddAttributeError(
+			path.Root("file"),
+			"Invalid config",
+			fmt.Sprintf("Invalid Path! %s", p),
+		)
+		return "", false
+	}
+	content, err := decodePolicyFile(raw_byte, data.FileEncoding)
+	if err != nil {
+		diags.AddAttributeError(
+			path.Root("file_encoding"),
+			errorSummary("Invalid policy file", err),
+			err.Error(),
+		)
+		return "", false
+	}
+	return content, true
+}
+
+// settingsChanged reports whether data injects different app settings than
+// state
+func (data IEFPolicyModel) settingsChanged(state IEFPolicyModel) bool {
+	return !data.AppSettings.Equal(state.AppSettings) ||
+		!data.SettingsByEnv.Equal(state.SettingsByEnv) ||
+		!data.Environment.Equal(state.Environment)
+}
+
+// matchesRendered reports whether policyXml is the policy recorded in state.
+// State written before xml_sha256 existed only has the XML to compare with.
+func (data IEFPolicyModel) matchesRendered(policyXml string) bool {
+	if !isNullOrEmpty(data.XMLSha256) {
+		return data.XMLSha256.ValueString() == xmlChecksum(policyXml)
+	}
+	return data.XML.ValueString() == policyXml
+}
+
+// render returns the policy to upload: content with the app settings
+// injected, or content unchanged when skip_injection is set
+func (data IEFPolicyModel) render(ctx context.Context, content string, settings map[string]types.String) string {
+	if !data.SkipInjection.ValueBool() {
+		content = injectAppSettings(ctx, content, settings)
+	}
+	if isNullOrEmpty(data.ManagedBy) {
+		return content
+	}
+	return withManagedBy(content, data.ManagedBy.ValueString())
+}
+
+// managedByPattern keeps managed_by valid inside an XML comment
+var managedByPattern = regexp.MustCompile(`^(?:[^-]|-[^-])*$`)
+
+// withManagedBy embeds the managed_by marker as a comment at the start of the
+// root element, or before it when the root element is empty. Documents that
+// cannot be parsed are returned unchanged for upload to report.
+func withManagedBy(policyXml string, marker string) string {
+	comment := "<!-- managed_by: " + marker + " -->"
+	decoder := xml.NewDecoder(strings.NewReader(policyXml))
+	for {
+		start := decoder.InputOffset()
+		tok, err := decoder.Token()
+		if err != nil {
+			return policyXml
+		}
+		if _, ok := tok.(xml.StartElement); !ok {
+			continue
+		}
+		end := int(decoder.InputOffset())
+		if strings.HasSuffix(policyXml[:end], "/>") {
+			return policyXml[:start] + comment + policyXml[start:]
+		}
+		return policyXml[:end] + comment + policyXml[end:]
+	}
+}
+
+// tenantIdAttrPattern matches the TenantId attribute and its quoted value
+var tenantIdAttrPattern = regexp.MustCompile(`(\sTenantId\s*=\s*)("[^"]*"|'[^']*')`)
+
+// withTenantId sets the TenantId attribute of the root element to tenant.
+// Documents without a root element or without a TenantId on it are returned
+// unchanged, for upload to report.
+func withTenantId(policyXml string, tenant string) string {
+	decoder := xml.NewDecoder(strings.NewReader(policyXml))
+	for {
+		start := decoder.InputOffset()
+		tok, err := decoder.Token()
+		if err != nil {
+			return policyXml
+		}
+		if _, ok := tok.(xml.StartElement); !ok {
+			continue
+		}
+		loc := tenantIdAttrPattern.FindStringSubmatchIndex(policyXml[start:decoder.InputOffset()])
+		if loc == nil {
+			return policyXml
+		}
+		var value strings.Builder
+		xml.EscapeText(&value, []byte(tenant))
+		valueStart, valueEnd := int(start)+loc[4], int(start)+loc[5]
+		return policyXml[:valueStart] + `"` + value.String() + `"` + policyXml[valueEnd:]
+	}
+}
+
+// defaultPolicyIdPrefix is the prefix Azure AD B2C gives custom policy IDs
+const defaultPolicyIdPrefix = "B2C_1A_"
+
+// policyRefs holds the policy IDs a TrustFrameworkPolicy document declares
+// and references
+type policyRefs struct {
+	PolicyId     string `xml:"PolicyId,attr"`
+	BasePolicyId string `xml:"BasePolicy>PolicyId"`
+}
+
+// basePolicyIdValue returns the BasePolicy PolicyId of policyXml, or null
+// when the policy has no base
+func basePolicyIdValue(policyXml string) types.String {
+	refs, err := parsePolicyRefs(policyXml)
+	if err != nil || refs.BasePolicyId == "" {
+		return types.StringNull()
+	}
+	return types.StringValue(refs.BasePolicyId)
+}
+
+func parsePolicyRefs(policyXml string) (policyRefs, error) {
+	var refs policyRefs
+	if err := xml.Unmarshal([]byte(policyXml), &refs); err != nil {
+		return policyRefs{}, fmt.Errorf("Unable to parse policy XML: %s", err)
+	}
+	refs.BasePolicyId = strings.TrimSpace(refs.BasePolicyId)
+	return refs, nil
+}
+
+// checkSchema validates the rendered policy against xsd_path when it is set
+func (m IEFPolicyModel) checkSchema(policyXml string) error {
+	if isNullOrEmpty(m.XSDPath) {
+		return nil
+	}
+	if err := validateAgainstSchema(policyXml, m.XSDPath.ValueString()); err != nil {
+		return &ConfigError{Err: err}
+	}
+	return nil
+}
+
+// checkPolicyPrefix errors when the policy or its base policy is missing the
+// configured prefix, which Graph would otherwise report as a missing base
+// policy at upload time. A null prefix means defaultPolicyIdPrefix.
+func checkPolicyPrefix(policyXml string, prefix types.String) error {
+	want := defaultPolicyIdPrefix
+	if !prefix.IsNull() && !prefix.IsUnknown() {
+		want = prefix.ValueString()
+	}
+	if want == "" {
+		return nil
+	}
+	refs, err := parsePolicyRefs(policyXml)
+	if err != nil {
+		return &ConfigError{Err: err}
+	}
+	if !strings.HasPrefix(refs.PolicyId, want) {
+		return configErrorf("PolicyId %q does not start with %q", refs.PolicyId, want)
+	}
+	if refs.BasePolicyId != "" && !strings.HasPrefix(refs.BasePolicyId, want) {
+		return configErrorf("BasePolicy PolicyId %q of policy %s does not start with %q", refs.BasePolicyId, refs.PolicyId, want)
+	}
+	return nil
+}
+
+const policyFileEncodingBase64 = "base64"
+
+// decodePolicyFile turns the raw bytes of a policy file into XML according to
+// the configured file_encoding
+func decodePolicyFile(raw []byte, encoding types.String) (string, error) {
+	if encoding.ValueString() != policyFileEncodingBase64 {
+		return string(raw), nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil {
+		return "", configErrorf("Policy file is not valid base64: %s", err)
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(decoded))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", configErrorf("Decoded policy file is not valid XML: %s", err)
+		}
+	}
+	return string(decoded), nil
+}
+
+// renderPolicyFile reads the policy at p and injects appSettings into it
+func renderPolicyFile(ctx context.Context, p string, appSettings types.Map) (string, error) {
+	raw_byte, err := os.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", configErrorf("File path %s does not exist", p)
+		}
+		return "", configErrorf("Invalid Path! %s", p)
+	}
+	settings := make(map[string]types.String, len(appSettings.Elements()))
+	if !appSettings.IsNull() && !appSettings.IsUnknown() {
+		diags := appSettings.ElementsAs(ctx, &settings, false)
+		if diags.HasError() {
+			return "", configErrorf("Unable to read app_settings for %s as a map of strings", p)
+		}
+	}
+	return injectAppSettings(ctx, string(raw_byte), settings), nil
+}
+
+// resolvePolicyId renders the policy file the way Create does and returns the
+// PolicyId it declares, for state that lost its id
+func (data IEFPolicyModel) resolvePolicyId(ctx context.Context) (string, error) {
+	if isNullOrEmpty(data.File) {
+		return "", errors.New("file is not set")
+	}
+	raw, err := os.ReadFile(data.File.ValueString())
+	if err != nil {
+		return "", err
+	}
+	content, err := decodePolicyFile(raw, data.FileEncoding)
+	if err != nil {
+		return "", err
+	}
+	settings := map[string]types.String{}
+	if diags := data.AppSettings.ElementsAs(ctx, &settings, false); diags.HasError() {
+		return "", errors.New("Unable to read app_settings as a map of strings.")
+	}
+	settings, err = data.withEnvironmentSettings(ctx, settings)
+	if err != nil {
+		return "", err
+	}
+	policyId := getPolicyId(data.render(ctx, content, settings))
+	if policyId == "" {
+		return "", fmt.Errorf("%s declares no PolicyId", data.File.ValueString())
+	}
+	return policyId, nil
+}
+
+// putPolicy uploads the policy, returning the HTTP status Graph answered
+// with, or 0 when no response was received, and whether Graph returned the
+// stored policy, which policy_upload_prefer can ask for
+func (r *PolicyResource) putPolicy(ctx context.Context, policyXml string) (int, bool, error) {
 	policyId := getPolicyId(policyXml)
 	tflog.Debug(ctx, "Policy ID", map[string]any{
 		"ID": policyId,
 	})
-	endpoint := fmt.Sprintf(
-		"https://graph.microsoft.com/beta/trustFramework/policies/%s/$value",
+	if policyId == "" {
+		return 0, false, errors.New("The policy has no PolicyId to upload it under")
+	}
+	endpoint := r.client.endpoint(
+		"/trustFramework/policies/%s/$value",
 		policyId,
 	)
-	gr, err := r.client.doGraphXML(
-		ctx, "PUT",
-		endpoint,
-		&policyXml,
-	)
+	gr, err := r.client.putXML(ctx, endpoint, policyXml)
 	if err != nil {
-		return err
+		return 0, false, err
 	}
-	if gr.StatusCode != http.StatusOK && gr.StatusCode != http.StatusCreated {
-		return errors.New(fmt.Sprintf(
-			"Error code received from graph! %s \n%s", gr.Status,
-			readBodyString(gr),
-		))
+	// Some update flows answer 204 with no body
+	if err := r.client.expectStatus(gr, http.StatusOK, http.StatusCreated, http.StatusNoContent); err != nil {
+		return gr.StatusCode, false, err
 	}
-	return nil
+	return gr.StatusCode, r.client.prefersRepresentation() && r.client.returnedPolicy(gr, policyId), nil
+}
+
+// returnedPolicy reports whether resp carries the policy policyId, as Graph
+// answers an upload made with Prefer: return=representation
+func (c *GraphClient) returnedPolicy(resp *http.Response, policyId string) bool {
+	if resp.StatusCode == http.StatusNoContent {
+		return false
+	}
+	refs, err := parsePolicyRefs(c.readBodyString(resp))
+	return err == nil && policyId != "" && strings.EqualFold(refs.PolicyId, policyId)
 }
 
 func (r *PolicyResource) Create(
@@ -167,12 +965,18 @@ func (r *PolicyResource) Create(
 	req resource.CreateRequest,
 	resp *resource.CreateResponse,
 ) {
+	ctx, throttled := withThrottleStats(ctx)
+	defer throttled.warn(&resp.Diagnostics)
+
 	var data IEFPolicyModel
 	diags := req.Config.Get(ctx, &data)
 	resp.Diagnostics.Append(diags...)
 	if resp.Diagnostics.HasError() {
 		return
 	}
+	if data.isEnabled() && r.client.refuseWrite(&resp.Diagnostics) {
+		return
+	}
 	tflog.Debug(ctx, "Create plan: ", map[string]any{
 		"FILE":    data.File.ValueString(),
 		"PUBLISH": data.Publish.ValueBool(),
@@ -182,7 +986,8 @@ func (r *PolicyResource) Create(
 	var content string
 	if isNullOrEmpty(data.File) {
 		tflog.Error(ctx, "XML is not defined and file path is not defined!")
-		resp.Diagnostics.AddError(
+		resp.Diagnostics.AddAttributeError(
+			path.Root("file"),
 			"Invalid config",
 			"XML is not defined and file path is not defined!",
 		)
@@ -191,7 +996,8 @@ func (r *PolicyResource) Create(
 	p := data.File.ValueString()
 	_, err := os.Stat(p)
 	if err != nil && os.IsNotExist(err) {
-		resp.Diagnostics.AddError(
+		resp.Diagnostics.AddAttributeError(
+			path.Root("file"),
 			"File does not exist!",
 			fmt.Sprintf("File path %s does not exist (Create)", p),
 		)
@@ -202,35 +1008,85 @@ func (r *PolicyResource) Create(
 		tflog.Error(ctx, "Error reading file!", map[string]any{
 			"path": p,
 		})
-		resp.Diagnostics.AddError(
+		resp.Diagnostics.AddAttributeError(
+			path.Root("file"),
 			"Invalid config",
 			fmt.Sprintf("Invalid Path! %s", p),
 		)
 		return
 	}
-	content = string(raw_byte)
+	content, err = decodePolicyFile(raw_byte, data.FileEncoding)
+	if err != nil {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("file_encoding"),
+			errorSummary("Invalid policy file", err),
+			err.Error(),
+		)
+		return
+	}
 	settings := make(map[string]types.String, len(data.AppSettings.Elements()))
 	diags = data.AppSettings.ElementsAs(ctx, &settings, false)
 	if diags.HasError() {
 		tflog.Error(ctx, "Failed to read AppSettings", map[string]interface{}{
 			"diagnostics": diags,
 		})
+		resp.Diagnostics.AddAttributeError(
+			path.Root("app_settings"),
+			"Invalid app_settings",
+			"Unable to read app_settings as a map of strings.",
+		)
+		return
+	}
+	settings, err = data.withEnvironmentSettings(ctx, settings)
+	if err != nil {
+		addErrorDiagnostic(&resp.Diagnostics, "Invalid app_settings_by_environment", err)
+		return
+	}
+	ief_policy_raw := r.client.withPolicyTenant(data.render(ctx, content, settings))
+	if !data.checkRoot(ief_policy_raw, &resp.Diagnostics) {
+		return
 	}
-	ief_policy_raw := injectAppSettings(ctx, content, settings)
-	data.XML = types.StringValue(ief_policy_raw)
+	data.setRendered(ief_policy_raw)
+	data.setFileContent(content)
+	data.setEffectiveSettings(ctx, settings)
 	data.ID = types.StringValue(getPolicyId(ief_policy_raw))
+	data.BasePolicyId = basePolicyIdValue(ief_policy_raw)
 
-	if data.Publish.ValueBool() {
-		err = r.putPolicy(ctx, ief_policy_raw)
-		if err != nil {
-			resp.Diagnostics.AddError(
-				"Error uploading policy",
-				fmt.Sprintf(
-					"Error creating policy!\n %s",
-					err.Error(),
-				),
+	if !data.isEnabled() {
+		data.IsPublished = types.BoolValue(false)
+	} else if data.Publish.ValueBool() {
+		if !data.checkPolicyId(&resp.Diagnostics) {
+			return
+		}
+		if err := data.checkSchema(ief_policy_raw); err != nil {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("xsd_path"),
+				errorSummary("Invalid policy XML", err),
+				err.Error(),
+			)
+			return
+		}
+		if err := checkPolicyPrefix(ief_policy_raw, data.PolicyIdPrefix); err != nil {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("policy_id_prefix"),
+				errorSummary("Invalid policy ID", err),
+				err.Error(),
 			)
+			return
+		}
+		var status int
+		var returned bool
+		status, returned, err = r.putPolicy(ctx, ief_policy_raw)
+		data.LastHttpStatus = httpStatusValue(status)
+		if err != nil {
+			addErrorDiagnostic(&resp.Diagnostics, "Error uploading policy", fmt.Errorf("Error creating policy!\n %w", err))
 		}
+		data.IsPublished = types.BoolValue(err == nil)
+		if err == nil && !returned {
+			r.waitForPolicy(ctx, data.ID.ValueString())
+		}
+	} else {
+		r.observePublished(ctx, &data, &resp.Diagnostics)
 	}
 	resp.State.Set(ctx, &data)
 	tflog.Debug(ctx, "Create policy complete!", map[string]any{
@@ -243,56 +1099,61 @@ func (r *PolicyResource) Read(
 	req resource.ReadRequest,
 	resp *resource.ReadResponse,
 ) {
+	ctx, throttled := withThrottleStats(ctx)
+	defer throttled.warn(&resp.Diagnostics)
+
 	var data IEFPolicyModel
 	diags := req.State.Get(ctx, &data)
 	resp.Diagnostics.Append(diags...)
 	if resp.Diagnostics.HasError() {
 		return
 	}
-	p := data.File.ValueString()
-	_, err := os.Stat(p)
-	if err != nil && os.IsNotExist(err) {
-		resp.Diagnostics.AddError(
-			"File does not exist! (Read)",
-			fmt.Sprintf("File path %s does not exist", p),
-		)
+	if data.isEnabled() && data.PreferRemote.ValueBool() && data.Publish.ValueBool() {
+		r.readRemote(ctx, &data, resp)
 		return
 	}
-	raw_byte, err := os.ReadFile(p)
-	if err != nil {
-		tflog.Error(ctx, "Error reading file!", map[string]any{
-			"path": p,
-		})
-		resp.Diagnostics.AddError(
-			"Invalid config",
-			fmt.Sprintf("Invalid Path! %s", p),
-		)
+	if data.isEnabled() && data.ReadFromRemoteOnly.ValueBool() {
+		r.readRemoteOnly(ctx, &data, resp)
+		return
+	}
+
+	content, ok := data.readFileContent(ctx, data, "Read", &resp.Diagnostics)
+	if !ok {
 		return
 	}
-	content := string(raw_byte)
 	settings := make(map[string]types.String, len(data.AppSettings.Elements()))
 	diags = data.AppSettings.ElementsAs(ctx, &settings, false)
 	if diags.HasError() {
 		tflog.Error(ctx, "Failed to read AppSettings", map[string]interface{}{
 			"diagnostics": diags,
 		})
+		resp.Diagnostics.AddAttributeError(
+			path.Root("app_settings"),
+			"Invalid app_settings",
+			"Unable to read app_settings as a map of strings.",
+		)
+		return
 	}
-	ief_policy_raw := injectAppSettings(ctx, content, settings)
-	read_xml := data.XML.ValueString()
-	if read_xml != ief_policy_raw {
+	settings, err := data.withEnvironmentSettings(ctx, settings)
+	if err != nil {
+		addErrorDiagnostic(&resp.Diagnostics, "Invalid app_settings_by_environment", err)
+		return
+	}
+	ief_policy_raw := r.client.withPolicyTenant(data.render(ctx, content, settings))
+	if !data.matchesRendered(ief_policy_raw) {
 		resp.State.RemoveResource(ctx)
 		return
 	}
+	data.setRendered(ief_policy_raw)
+	data.setEffectiveSettings(ctx, settings)
+	data.BasePolicyId = basePolicyIdValue(ief_policy_raw)
 
-	if data.Publish.ValueBool() {
-		policy_id := getPolicyId(ief_policy_raw)
-		endpoint := fmt.Sprintf("https://graph.microsoft.com/beta/trustFramework/policies/%s/$value", policy_id)
-		gr, err := r.client.doGraphXML(ctx, "GET", endpoint, nil)
-		if err != nil {
-			resp.State.RemoveResource(ctx)
+	if data.isEnabled() {
+		r.observePublished(ctx, &data, &resp.Diagnostics)
+		if resp.Diagnostics.HasError() {
 			return
 		}
-		if gr.StatusCode != http.StatusOK {
+		if data.Publish.ValueBool() && !data.IsPublished.ValueBool() {
 			resp.State.RemoveResource(ctx)
 			return
 		}
@@ -301,14 +1162,126 @@ func (r *PolicyResource) Read(
 	tflog.Debug(ctx, "READ complete")
 }
 
+// readRemote refreshes data.XML from the policy live in the tenant
+func (r *PolicyResource) readRemote(
+	ctx context.Context,
+	data *IEFPolicyModel,
+	resp *resource.ReadResponse,
+) {
+	remote_xml, err := r.client.getRemotePolicy(ctx, data.ID.ValueString())
+	if errors.Is(err, ErrNotFound) {
+		resp.State.RemoveResource(ctx)
+		return
+	}
+	if err != nil {
+		addErrorDiagnostic(&resp.Diagnostics, "Error reading policy", err)
+		return
+	}
+	data.IsPublished = types.BoolValue(true)
+	if !data.matchesRendered(remote_xml) {
+		tflog.Warn(ctx, "Remote policy differs from state, keeping the remote XML", map[string]any{
+			"ID": data.ID.ValueString(),
+		})
+	}
+	data.setRendered(remote_xml)
+	resp.State.Set(ctx, data)
+	tflog.Debug(ctx, "READ complete")
+}
+
+// readRemoteOnly detects drift from the published policy alone, without
+// touching the local file, so refresh works when the file is not available
+func (r *PolicyResource) readRemoteOnly(
+	ctx context.Context,
+	data *IEFPolicyModel,
+	resp *resource.ReadResponse,
+) {
+	if data.Publish.ValueBool() {
+		remote_xml, err := r.client.getRemotePolicy(ctx, data.ID.ValueString())
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			addErrorDiagnostic(&resp.Diagnostics, "Error reading policy", err)
+			return
+		}
+		if err != nil || !data.matchesRendered(remote_xml) {
+			resp.State.RemoveResource(ctx)
+			return
+		}
+		data.IsPublished = types.BoolValue(true)
+	} else {
+		r.observePublished(ctx, data, &resp.Diagnostics)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+	}
+	resp.State.Set(ctx, data)
+	tflog.Debug(ctx, "READ complete")
+}
+
+// observePublished sets data.IsPublished from whether Graph has the policy
+func (r *PolicyResource) observePublished(
+	ctx context.Context,
+	data *IEFPolicyModel,
+	diags *diag.Diagnostics,
+) {
+	_, err := r.client.getRemotePolicy(ctx, data.ID.ValueString())
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		addErrorDiagnostic(diags, "Error reading policy", err)
+		return
+	}
+	data.IsPublished = types.BoolValue(err == nil)
+}
+
+// getRemotePolicy downloads the XML of the published policy, returning
+// ErrNotFound when it is not in the tenant
+func (c *GraphClient) getRemotePolicy(ctx context.Context, policyId string) (string, error) {
+	gr, err := c.readGraphXML(ctx, "/trustFramework/policies/%s/$value", policyId)
+	if err != nil {
+		return "", err
+	}
+	if err := c.expectStatus(gr, http.StatusOK); err != nil {
+		return "", err
+	}
+	return c.readBodyString(gr), nil
+}
+
+// waitForPolicy polls Graph until it serves the policy just created, as a
+// Read straight after the upload can otherwise find it missing and remove
+// the resource. It gives up with a warning after the provider's
+// publish_poll_timeout_seconds.
+func (r *PolicyResource) waitForPolicy(ctx context.Context, policyId string) {
+	timeout := r.client.publishPollTimeout
+	if timeout <= 0 {
+		return
+	}
+	deadline := time.Now().Add(timeout)
+	for attempt := 1; ; attempt++ {
+		if _, err := r.client.getRemotePolicy(ctx, policyId); err == nil {
+			tflog.Debug(ctx, fmt.Sprintf("policy %s is retrievable after %d attempt(s)", policyId, attempt))
+			return
+		}
+		if !time.Now().Add(r.client.publishPollInterval).Before(deadline) {
+			tflog.Warn(ctx, fmt.Sprintf("policy %s was not retrievable within %s; the next refresh may not find it", policyId, timeout))
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.client.publishPollInterval):
+		}
+	}
+}
+
 func (r *PolicyResource) Update(
 	ctx context.Context,
 	req resource.UpdateRequest,
 	resp *resource.UpdateResponse,
 ) {
-	var data IEFPolicyModel
+	ctx, throttled := withThrottleStats(ctx)
+	defer throttled.warn(&resp.Diagnostics)
+
+	var data, stateData IEFPolicyModel
 	diags := req.Config.Get(ctx, &data)
 	resp.Diagnostics.Append(diags...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &stateData)...)
 	if resp.Diagnostics.HasError() {
 		return
 	}
@@ -317,56 +1290,104 @@ func (r *PolicyResource) Update(
 	var content string
 	if isNullOrEmpty(data.File) {
 		tflog.Error(ctx, "XML is not defined and file path is not defined!")
-		resp.Diagnostics.AddError(
+		resp.Diagnostics.AddAttributeError(
+			path.Root("file"),
 			"Invalid config",
 			"XML is not defined and file path is not defined!",
 		)
 		return
 	}
-	p := data.File.ValueString()
-	_, err := os.Stat(p)
-	if err != nil && os.IsNotExist(err) {
-		resp.Diagnostics.AddError(
-			"File does not exist! (Update)",
-			fmt.Sprintf("File path %s does not exist", p),
-		)
+	content, ok := data.readFileContent(ctx, stateData, "Update", &resp.Diagnostics)
+	if !ok {
 		return
 	}
-	raw_byte, err := os.ReadFile(p)
-	if err != nil {
-		tflog.Error(ctx, "Error reading file!", map[string]any{
-			"path": p,
-		})
-		resp.Diagnostics.AddError(
-			"Invalid config",
-			fmt.Sprintf("Invalid Path! %s", p),
+	if data.settingsChanged(stateData) && data.File.Equal(stateData.File) &&
+		!isNullOrEmpty(stateData.FileSha256) && stateData.FileSha256.ValueString() != xmlChecksum(content) {
+		resp.Diagnostics.AddAttributeWarning(
+			path.Root("file"),
+			"Policy file changed",
+			fmt.Sprintf("%s changed since the last apply, so the file changes are uploaded along with the app settings change.", data.File.ValueString()),
 		)
-		return
 	}
-	content = string(raw_byte)
 	settings := make(map[string]types.String, len(data.AppSettings.Elements()))
 	diags = data.AppSettings.ElementsAs(ctx, &settings, false)
 	if diags.HasError() {
 		tflog.Error(ctx, "Failed to read AppSettings", map[string]interface{}{
 			"diagnostics": diags,
 		})
+		resp.Diagnostics.AddAttributeError(
+			path.Root("app_settings"),
+			"Invalid app_settings",
+			"Unable to read app_settings as a map of strings.",
+		)
+		return
+	}
+	settings, err := data.withEnvironmentSettings(ctx, settings)
+	if err != nil {
+		addErrorDiagnostic(&resp.Diagnostics, "Invalid app_settings_by_environment", err)
+		return
 	}
 
-	ief_policy_raw := injectAppSettings(ctx, content, settings)
-	data.XML = types.StringValue(ief_policy_raw)
+	ief_policy_raw := r.client.withPolicyTenant(data.render(ctx, content, settings))
+	if !data.checkRoot(ief_policy_raw, &resp.Diagnostics) {
+		return
+	}
+	if data.uploadUnchanged(stateData, ief_policy_raw) {
+		// Only settings the policy does not reference changed
+		tflog.Debug(ctx, "Rendered policy unchanged, skipping upload", map[string]any{
+			"ID": stateData.ID.ValueString(),
+		})
+		data.setRendered(ief_policy_raw)
+		data.ID = stateData.ID
+		data.BasePolicyId = basePolicyIdValue(ief_policy_raw)
+		data.IsPublished = stateData.IsPublished
+		data.LastHttpStatus = stateData.LastHttpStatus
+		data.FileContent = stateData.FileContent
+		data.FileSha256 = stateData.FileSha256
+		data.setEffectiveSettings(ctx, settings)
+		resp.State.Set(ctx, &data)
+		return
+	}
+	if data.isEnabled() && r.client.refuseWrite(&resp.Diagnostics) {
+		return
+	}
+	data.setRendered(ief_policy_raw)
+	data.setFileContent(content)
+	data.setEffectiveSettings(ctx, settings)
 	data.ID = types.StringValue(getPolicyId(ief_policy_raw))
+	data.BasePolicyId = basePolicyIdValue(ief_policy_raw)
 
-	if data.Publish.ValueBool() {
-		err = r.putPolicy(ctx, ief_policy_raw)
-		if err != nil {
-			resp.Diagnostics.AddError(
-				"Error uploading policy",
-				fmt.Sprintf(
-					"Error creating policy!\n %s",
-					err.Error(),
-				),
+	if !data.isEnabled() {
+		data.IsPublished = types.BoolValue(false)
+	} else if data.Publish.ValueBool() {
+		if !data.checkPolicyId(&resp.Diagnostics) {
+			return
+		}
+		if err := data.checkSchema(ief_policy_raw); err != nil {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("xsd_path"),
+				errorSummary("Invalid policy XML", err),
+				err.Error(),
 			)
+			return
+		}
+		if err := checkPolicyPrefix(ief_policy_raw, data.PolicyIdPrefix); err != nil {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("policy_id_prefix"),
+				errorSummary("Invalid policy ID", err),
+				err.Error(),
+			)
+			return
+		}
+		var status int
+		status, _, err = r.putPolicy(ctx, ief_policy_raw)
+		data.LastHttpStatus = httpStatusValue(status)
+		if err != nil {
+			addErrorDiagnostic(&resp.Diagnostics, "Error uploading policy", fmt.Errorf("Error creating policy!\n %w", err))
 		}
+		data.IsPublished = types.BoolValue(err == nil)
+	} else {
+		r.observePublished(ctx, &data, &resp.Diagnostics)
 	}
 	resp.State.Set(ctx, &data)
 	tflog.Debug(ctx, "Create policy complete!", map[string]any{
@@ -374,11 +1395,36 @@ func (r *PolicyResource) Update(
 	})
 }
 
+// checkDeleteTarget refuses to delete policyId unless it names exactly one
+// policy: a plain ID that Graph cannot read as another path or pattern, equal
+// to the PolicyId of the XML in state, when state has it. A mismatch means
+// the state no longer describes the policy, e.g. the id was edited by hand,
+// and deleting could remove a sibling policy staged under a related ID.
+func (data IEFPolicyModel) checkDeleteTarget(policyId string) error {
+	if !deletablePolicyIdPattern.MatchString(policyId) {
+		return fmt.Errorf("Refusing to delete policy %q: it is not a plain policy ID. Delete it in the tenant by hand and remove it from state with `terraform state rm` if it still exists.", policyId)
+	}
+	if isNullOrEmpty(data.XML) {
+		return nil
+	}
+	if stored := getPolicyId(data.XML.ValueString()); stored != "" && stored != policyId {
+		return fmt.Errorf("Refusing to delete policy %s: the XML in state declares PolicyId %s. Only a policy whose ID matches exactly is deleted, so a sibling policy is never removed by mistake. Check which policy this resource manages, then delete it by hand or fix the state.", policyId, stored)
+	}
+	return nil
+}
+
+// deletablePolicyIdPattern matches a policy ID that is safe to put in a
+// delete URL
+var deletablePolicyIdPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
 func (r *PolicyResource) Delete(
 	ctx context.Context,
 	req resource.DeleteRequest,
 	resp *resource.DeleteResponse,
 ) {
+	ctx, throttled := withThrottleStats(ctx)
+	defer throttled.warn(&resp.Diagnostics)
+
 	tflog.Debug(ctx, "%s: DELETE begin")
 
 	var data IEFPolicyModel
@@ -387,10 +1433,29 @@ func (r *PolicyResource) Delete(
 	if resp.Diagnostics.HasError() {
 		return
 	}
+	if data.isEnabled() && r.client.refuseWrite(&resp.Diagnostics) {
+		return
+	}
 
-	if data.Publish.ValueBool() {
+	if data.isEnabled() && data.Publish.ValueBool() {
 		n := data.ID.ValueString()
-		deleteURL := fmt.Sprintf("https://graph.microsoft.com/beta/trustFramework/policies/%s", n)
+		if n == "" {
+			resolved, err := data.resolvePolicyId(ctx)
+			if err != nil {
+				resp.Diagnostics.AddWarning(
+					"Policy not deleted",
+					fmt.Sprintf("The state has no id for this policy and it could not be resolved from file: %s. Nothing was deleted; delete the policy in the tenant by hand if it still exists.", err),
+				)
+				return
+			}
+			tflog.Warn(ctx, fmt.Sprintf("State has no policy id, deleting policy %s resolved from %s", resolved, data.File.ValueString()))
+			n = resolved
+		}
+		if err := data.checkDeleteTarget(n); err != nil {
+			resp.Diagnostics.AddError("Policy not deleted", err.Error())
+			return
+		}
+		deleteURL := r.client.endpoint("/trustFramework/policies/%s", n)
 		gr, err := r.client.doGraphXML(ctx, "DELETE", deleteURL, nil)
 		if err != nil {
 			resp.Diagnostics.AddError(
@@ -402,14 +1467,11 @@ func (r *PolicyResource) Delete(
 			)
 			return
 		}
-		if gr.StatusCode != http.StatusNoContent {
-			resp.Diagnostics.AddError(
-				"Error deleting ief policy",
-				fmt.Sprintf(
-					"Graph Error deleting policy!\n %s",
-					readBodyString(gr),
-				),
-			)
+		if _, err := r.client.checkNotFound(gr, nil, deleteURL); errors.Is(err, ErrNotFound) {
+			// Already gone, e.g. deleted in the portal; nothing left to destroy
+			tflog.Info(ctx, fmt.Sprintf("Policy %s was already deleted", n))
+		} else if err := r.client.expectStatus(gr, http.StatusNoContent); err != nil {
+			addErrorDiagnostic(&resp.Diagnostics, "Error deleting ief policy", err)
 			return
 		}
 	}
@@ -3,18 +3,30 @@ package provider
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
 	"github.com/hashicorp/terraform-plugin-framework-validators/resourcevalidator"
 	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
 	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
 	"github.com/hashicorp/terraform-plugin-framework/types"
 	"github.com/hashicorp/terraform-plugin-log/tflog"
@@ -33,20 +45,173 @@ type PolicyKeyResource struct {
 }
 
 type PolicyKeyModel struct {
-	ID       types.String       `tfsdk:"id"`
-	Name     types.String       `tfsdk:"name"`
-	Usage    types.String       `tfsdk:"usage"`
-	Upload   *PolicyKeyUpload   `tfsdk:"upload"`
-	Generate *PolicyKeyGenerate `tfsdk:"generate"`
+	ID             types.String       `tfsdk:"id"`
+	Name           types.String       `tfsdk:"name"`
+	Usage          types.String       `tfsdk:"usage"`
+	Upload         *PolicyKeyUpload   `tfsdk:"upload"`
+	Generate       *PolicyKeyGenerate `tfsdk:"generate"`
+	ExpiresAt      types.String       `tfsdk:"expires_at"`
+	OdataId        types.String       `tfsdk:"odata_id"`
+	ValueSha256    types.String       `tfsdk:"value_sha256"`
+	ValueSalt      types.String       `tfsdk:"value_salt"`
+	LastHttpStatus types.Int64        `tfsdk:"last_http_status"`
+	CheckRefs      types.Bool         `tfsdk:"check_references_on_delete"`
+	Kid            types.String       `tfsdk:"kid"`
+	GraphURL       types.String       `tfsdk:"graph_url"`
+	ManagedBy      types.String       `tfsdk:"managed_by"`
+	ActiveKid      types.String       `tfsdk:"active_kid"`
 }
 
 type PolicyKeyUpload struct {
 	Value        types.String `tfsdk:"value"`
 	ValueVersion types.Int64  `tfsdk:"value_version"`
+	NotBefore    types.String `tfsdk:"not_before"`
+	Expires      types.String `tfsdk:"expires"`
+	MinLength    types.Int64  `tfsdk:"min_length"`
+	Use          types.String `tfsdk:"use"`
+	ForceUpload  types.Bool   `tfsdk:"force_upload"`
+	Alg          types.String `tfsdk:"alg"`
+}
+
+// joseAlgorithms are the JWS and JWE key management algorithms of RFC 7518
+// accepted for upload.alg
+var joseAlgorithms = []string{
+	"HS256", "HS384", "HS512",
+	"RS256", "RS384", "RS512",
+	"ES256", "ES384", "ES512",
+	"PS256", "PS384", "PS512",
+	"RSA1_5", "RSA-OAEP", "RSA-OAEP-256",
+	"A128KW", "A192KW", "A256KW", "dir",
+	"ECDH-ES", "ECDH-ES+A128KW", "ECDH-ES+A192KW", "ECDH-ES+A256KW",
+	"A128GCMKW", "A192GCMKW", "A256GCMKW",
+	"PBES2-HS256+A128KW", "PBES2-HS384+A192KW", "PBES2-HS512+A256KW",
+}
+
+// keyUse returns the use to upload the secret with: upload.use when set,
+// otherwise the container usage
+func (u PolicyKeyUpload) keyUse(usage string) string {
+	if !isNullOrEmpty(u.Use) {
+		return u.Use.ValueString()
+	}
+	return usage
+}
+
+// withoutValue returns a copy of the upload block with the write-only value
+// cleared, keeping everything else for state
+func (u PolicyKeyUpload) withoutValue() *PolicyKeyUpload {
+	u.Value = types.StringNull()
+	return &u
+}
+
+// minSecretLength is the shortest secret accepted for each usage when
+// upload.min_length is unset. B2C signs HS256 tokens with sig keys, which
+// needs at least 128 bits.
+var minSecretLength = map[string]int64{"sig": 16}
+
+// checkLength rejects a secret shorter than the minimum for usage. Graph
+// accepts short secrets and B2C only fails later, when it signs a token.
+func (u PolicyKeyUpload) checkLength(usage string) error {
+	if u.Value.IsNull() || u.Value.IsUnknown() {
+		return nil
+	}
+	minLength := minSecretLength[usage]
+	if !u.MinLength.IsNull() && !u.MinLength.IsUnknown() {
+		minLength = u.MinLength.ValueInt64()
+	}
+	if n := int64(len(u.Value.ValueString())); n < minLength {
+		return newAttributeError(
+			path.Root("upload").AtName("value"),
+			fmt.Sprintf("The secret is %d bytes long, but %s keys need at least %d. Azure AD B2C accepts shorter secrets but fails when it uses them to sign tokens. Upload a longer secret, or set upload.min_length if this key is never used for signing.", n, usage, minLength),
+		)
+	}
+	return nil
+}
+
+// forcesUpload reports whether force_upload was switched on since the last
+// apply, which uploads the secret regardless of value_version
+func (u PolicyKeyUpload) forcesUpload(state *PolicyKeyUpload) bool {
+	if !u.ForceUpload.ValueBool() {
+		return false
+	}
+	return state == nil || !state.ForceUpload.ValueBool()
+}
+
+// validity parses the optional not_before and expires timestamps
+func (u PolicyKeyUpload) validity() (nbf *time.Time, exp *time.Time, err error) {
+	if !isNullOrEmpty(u.NotBefore) {
+		t, err := time.Parse(time.RFC3339, u.NotBefore.ValueString())
+		if err != nil {
+			return nil, nil, newAttributeError(path.Root("upload").AtName("not_before"), "not_before must be an RFC 3339 timestamp, e.g. 2026-01-01T00:00:00Z")
+		}
+		nbf = &t
+	}
+	if !isNullOrEmpty(u.Expires) {
+		t, err := time.Parse(time.RFC3339, u.Expires.ValueString())
+		if err != nil {
+			return nil, nil, newAttributeError(path.Root("upload").AtName("expires"), "expires must be an RFC 3339 timestamp, e.g. 2027-01-01T00:00:00Z")
+		}
+		exp = &t
+	}
+	if nbf != nil && exp != nil && !exp.After(*nbf) {
+		return nil, nil, newAttributeError(path.Root("upload").AtName("expires"), "expires must be later than not_before")
+	}
+	return nbf, exp, nil
 }
 
 type PolicyKeyGenerate struct {
-	Type types.String `tfsdk:"type"`
+	Type         types.String `tfsdk:"type"`
+	ValidForDays types.Int64  `tfsdk:"valid_for_days"`
+	KeyId        types.String `tfsdk:"key_id"`
+}
+
+// equal reports whether g generates the same key as other
+func (g PolicyKeyGenerate) equal(other PolicyKeyGenerate) bool {
+	return g.Type.Equal(other.Type) && g.ValidForDays.Equal(other.ValidForDays) && g.KeyId.Equal(other.KeyId)
+}
+
+// secretChecksum returns the HMAC-SHA256 of an uploaded secret keyed with
+// salt, so the checksum in state cannot be looked up in precomputed tables
+func secretChecksum(salt string, value string) types.String {
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(value))
+	return types.StringValue(hex.EncodeToString(mac.Sum(nil)))
+}
+
+// secretSalt returns the salt secretChecksum keys a resource's secrets with,
+// reusing salt from state or generating a random one
+func secretSalt(salt types.String) types.String {
+	if salt.IsNull() || salt.IsUnknown() || salt.ValueString() == "" {
+		b := make([]byte, 16)
+		rand.Read(b)
+		return types.StringValue(hex.EncodeToString(b))
+	}
+	return salt
+}
+
+// keyExpiryWarningWindow is how close to expires_at Read starts warning
+const keyExpiryWarningWindow = 7 * 24 * time.Hour
+
+// keyIdPattern limits generate.key_id to characters that are safe in a JWKS
+// and in policy XML
+var keyIdPattern = regexp.MustCompile(`^[A-Za-z0-9._~-]+$`)
+
+// newGenerateKeyBody builds the generateKey request body. When valid_for_days
+// is set the key is valid from now until now+N days and the expiry is returned.
+func newGenerateKeyBody(data PolicyKeyModel, now time.Time) (map[string]any, *time.Time) {
+	body := map[string]any{
+		"use": data.Usage.ValueString(),
+		"kty": data.Generate.Type.ValueString(), //THIS could be hard-code "RSA" lol
+	}
+	if !isNullOrEmpty(data.Generate.KeyId) {
+		body["kid"] = data.Generate.KeyId.ValueString()
+	}
+	if data.Generate.ValidForDays.IsNull() || data.Generate.ValidForDays.IsUnknown() {
+		return body, nil
+	}
+	exp := now.Add(time.Duration(data.Generate.ValidForDays.ValueInt64()) * 24 * time.Hour)
+	body["nbf"] = now.Unix()
+	body["exp"] = exp.Unix()
+	return body, &exp
 }
 
 // sanitizeWriteOnlyFields ensures write-only attributes are null before state is set
@@ -58,15 +223,13 @@ func sanitizeWriteOnlyFields(data *PolicyKeyModel) {
 			tflog.Warn(context.Background(), "🔒 CLEANING DETECTED SECRET: upload.value was found in state and has been sanitized")
 		}
 
-		data.Upload = &PolicyKeyUpload{
-			ValueVersion: data.Upload.ValueVersion,
-			Value:        types.StringNull(), // Force null for write-only field
-		}
+		data.Upload = data.Upload.withoutValue() // Force null for write-only field
 	}
 }
 
-// sanitizeLegacyState detects and cleans existing secrets from state files
-func sanitizeLegacyState(ctx context.Context, data *PolicyKeyModel) {
+// sanitizeLegacyState detects and cleans existing secrets from state files,
+// reporting whether a secret was removed. value_version is left untouched.
+func sanitizeLegacyState(ctx context.Context, data *PolicyKeyModel) bool {
 	if data.Upload != nil && !data.Upload.Value.IsNull() {
 		// Log security event for user awareness
 		tflog.Warn(ctx, "🔒 LEGACY STATE CLEANUP: Removing write-only value from state. Previous provider version stored secrets in state - this has been fixed for security.")
@@ -77,7 +240,9 @@ func sanitizeLegacyState(ctx context.Context, data *PolicyKeyModel) {
 
 		// Sanitize the legacy secret
 		data.Upload.Value = types.StringNull()
+		return true
 	}
+	return false
 }
 
 func NewPolicyKeyResource() resource.Resource {
@@ -97,22 +262,87 @@ func (r *PolicyKeyResource) Schema(
 		MarkdownDescription: "Manages an Azure AD B2C IEF policy key container. Policy keys are used by the Identity Experience Framework for signing, encryption, and integration with external identity providers.",
 
 		Attributes: map[string]schema.Attribute{
+			"odata_id": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "The `@odata.id` Graph reports for the key container, when present. Useful for correlating state with Graph and the Azure portal.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+
+			"graph_url": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "Microsoft Graph URL of the key container, built from the provider's `graph_base_url`, `trust_framework_segment` and `id`, e.g. `https://graph.microsoft.com/beta/trustFramework/keySets/B2C_1A_Example`.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
+			},
+
+			"value_sha256": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "Hex HMAC-SHA256 of the last uploaded `upload.value`, keyed with `value_salt` so identical secrets do not share a checksum and it cannot be matched against precomputed hashes. Changes whenever a new secret is uploaded, so it can be audited without exposing the secret. Null for generated keys.",
+			},
+
+			"value_salt": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "Random hex key of the `value_sha256` HMAC, generated on the first upload and kept for the life of the resource. Null for generated keys.",
+			},
+
+			"expires_at": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "RFC 3339 expiry of the current key, from `generate.valid_for_days` or `upload.expires`. Refreshing warns once the key is within 7 days of expiring.",
+			},
+
+			"check_references_on_delete": schema.BoolAttribute{
+				Optional:            true,
+				MarkdownDescription: "Before deleting the key container, download every policy in the tenant and fail the destroy if any of them still references it, naming those policies. This costs one Graph request per policy. Defaults to `false`, in which case Graph's own error is reported if it refuses to delete a container in use.",
+			},
+
+			"managed_by": schema.StringAttribute{
+				Optional:            true,
+				MarkdownDescription: "Free-form marker naming the owner of the key, e.g. the Terraform workspace, for audits. Key containers cannot hold arbitrary metadata, so unlike `azure_b2c_ief_policy`'s `managed_by` it is only kept in Terraform state and never sent to Graph; changing it does not touch the key.",
+			},
+
+			"kid": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "ID (`kid`) of the key Graph reported for the last generated or uploaded key. Null until Graph has reported one.",
+			},
+
+			"active_kid": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "ID (`kid`) of the key Azure AD B2C currently uses from the container, as reported by Graph's `getActiveKey`, for uploaded and generated keys alike. Refreshed on every read, so a key rotated outside Terraform shows up here. Null while the container has no active key, e.g. before `upload.not_before`. Reference it in an `azure_b2c_ief_policy`'s `triggers` to upload the policy again whenever the key rotates.",
+			},
+
+			"last_http_status": schema.Int64Attribute{
+				Computed:            true,
+				MarkdownDescription: "HTTP status of the final Graph request in the last create or update, e.g. `201` for a keyset created with its secret inline or `200` for an upload or key generation. Null when the last update sent nothing to Graph.",
+			},
+
 			"id": schema.StringAttribute{
 				Computed:            true,
-				MarkdownDescription: "The object ID of the key container in Microsoft Graph. Use this to reference the policy key in a policy.",
+				MarkdownDescription: "The object ID of the key container in Microsoft Graph. Use this to reference the policy key in a policy, e.g. `app_settings = { signing_key = azure_b2c_ief_policy_key.example.id }`. Referencing it also makes Terraform create the key before the policy.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.UseStateForUnknown(),
+				},
 			},
 
 			"name": schema.StringAttribute{
 				Required:            true,
-				MarkdownDescription: "The IEF policy key container name. The `B2C_1A_` prefix is not added automatically by this provider! You must include it in your policy XML if you reference this key.",
+				MarkdownDescription: "The IEF policy key container name. The `B2C_1A_` prefix is not added automatically by this provider! You must include it in your policy XML if you reference this key. Changing this forces a new key container to be created.",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
 			},
 
 			"usage": schema.StringAttribute{
 				Required:            true,
-				MarkdownDescription: "Key usage: `sig` (signing) or `enc` (encryption).",
+				MarkdownDescription: "Key usage: `sig` (signing) or `enc` (encryption). Graph cannot change the usage of an existing key container, so changing this forces a new key container to be created. Because the container is identified by `name`, a replacement under the same `name` deletes the old container before creating the new one, so policies referencing the key fail until the new key is provisioned, and the plan warns about it. To replace the key without that window, set `lifecycle { create_before_destroy = true }` on the resource and change `name` together with `usage`, then point your policies at the new `name`. `create_before_destroy` alone is not enough: the replacement would be created under the name the old container still holds, and the create fails because that container already has keys.",
 				Validators: []validator.String{
 					stringvalidator.OneOf("sig", "enc"),
 				},
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
 			},
 		},
 
@@ -122,11 +352,26 @@ func (r *PolicyKeyResource) Schema(
 				Attributes: map[string]schema.Attribute{
 					"type": schema.StringAttribute{
 						Optional:            true,
-						MarkdownDescription: "Key type. Currently, only `RSA` is supported by Azure AD B2C for generated keys.",
+						MarkdownDescription: "Key type. Currently, only `RSA` is supported by Azure AD B2C for generated keys. Graph chooses the key size and offers no elliptic-curve keys, so there are no curve or key size options. Elliptic-curve keys and RSA keys of a chosen size are not supported by this provider: `upload` only sends symmetric secrets through `uploadSecret`, and certificate or PKCS#12 uploads are not implemented.",
 						Validators: []validator.String{
 							stringvalidator.OneOf("RSA"),
 						},
 					},
+					"valid_for_days": schema.Int64Attribute{
+						Optional:            true,
+						MarkdownDescription: "Number of days the generated key is valid for, starting when it is generated. Azure AD B2C stops using the key after it expires, so rotation is enforced by the tenant. The resolved expiry is exported as `expires_at`.",
+						Validators: []validator.Int64{
+							int64validator.AtLeast(1),
+						},
+					},
+					"key_id": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "`kid` to request for the generated key, so policies and token validators can refer to a predictable ID. Up to 128 letters, digits, `.`, `_`, `-` or `~`. Graph may not honor it; the apply then fails and reports the `kid` Graph assigned instead. Exported as `kid`.",
+						Validators: []validator.String{
+							stringvalidator.LengthBetween(1, 128),
+							stringvalidator.RegexMatches(keyIdPattern, "may only contain letters, digits, '.', '_', '-' and '~'"),
+						},
+					},
 				},
 			},
 
@@ -140,7 +385,40 @@ func (r *PolicyKeyResource) Schema(
 					},
 					"value_version": schema.Int64Attribute{
 						Optional:            true,
-						MarkdownDescription: "A version tracker for the secret value. Omit to always upload on every apply, set to a non-negative integer to manage versions, or set to `-1` to force an upload.",
+						MarkdownDescription: "A version tracker for the secret value. Omit to always upload on every apply, set to a non-negative integer to manage versions, or set to `-1` to force an upload. Graph exposes no version for uploaded secrets, so drift is detected from key IDs: when refreshing finds that the key Terraform last uploaded (`kid`) was removed, or that another key is active while it is valid, the secret was rotated outside Terraform and `value_version` is cleared from state so the next apply uploads `upload.value` again. Without a recorded `kid`, tracking is local only.",
+					},
+					"not_before": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "RFC 3339 time from which Azure AD B2C may use the secret (`nbf`). Applied when the secret is uploaded, so change `value_version` to re-upload with a new window.",
+					},
+					"expires": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "RFC 3339 time after which Azure AD B2C stops using the secret (`exp`). Exported as `expires_at` once uploaded. Applied when the secret is uploaded, so change `value_version` to re-upload with a new window.",
+					},
+					"min_length": schema.Int64Attribute{
+						Optional:            true,
+						MarkdownDescription: "Minimum secret length in bytes, checked before uploading. Defaults to `16` for `sig` keys, which Azure AD B2C needs to sign tokens, and no minimum for `enc` keys. Set to `0` to turn the check off.",
+						Validators: []validator.Int64{
+							int64validator.AtLeast(0),
+						},
+					},
+					"force_upload": schema.BoolAttribute{
+						Optional:            true,
+						MarkdownDescription: "Operational override for recovery, e.g. after the container was recreated outside Terraform: the apply that changes this from unset or `false` to `true` uploads the secret even though `value_version` is unchanged. Later applies follow `value_version` again while it stays `true`; set it back to `false` once recovered so it can be used again.",
+					},
+					"use": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Use of the uploaded key, `sig` or `enc`, when it should differ from the container `usage`. Defaults to `usage`. Also selects the default `min_length`. Applied when the secret is uploaded, so change `value_version` to re-upload with a new use.",
+						Validators: []validator.String{
+							stringvalidator.OneOf("sig", "enc"),
+						},
+					},
+					"alg": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "JOSE algorithm of the uploaded secret (`alg`), e.g. `HS256`, for uses where Graph needs it stated alongside the secret. One of the algorithms of RFC 7518. Omitted from the upload when unset. Applied when the secret is uploaded, so change `value_version` to re-upload with a new algorithm.",
+						Validators: []validator.String{
+							stringvalidator.OneOf(joseAlgorithms...),
+						},
 					},
 				},
 			},
@@ -160,6 +438,36 @@ func (r *PolicyKeyResource) ConfigValidators(
 	}
 }
 
+// ValidateConfig rejects an upload block without a secret at plan time rather
+// than failing in uploadOrGenerate during apply
+func (r *PolicyKeyResource) ValidateConfig(
+	ctx context.Context,
+	req resource.ValidateConfigRequest,
+	resp *resource.ValidateConfigResponse,
+) {
+	var data PolicyKeyModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if data.Upload != nil && data.Upload.Value.IsNull() {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("upload").AtName("value"),
+			"Missing upload value",
+			"The upload block requires a value. Set upload.value or use a generate block instead.",
+		)
+	}
+	if data.Upload != nil {
+		if _, _, err := data.Upload.validity(); err != nil {
+			addErrorDiagnostic(&resp.Diagnostics, "Invalid upload validity window", err)
+		}
+		if err := data.Upload.checkLength(data.Upload.keyUse(data.Usage.ValueString())); err != nil {
+			addErrorDiagnostic(&resp.Diagnostics, "Secret too short", err)
+		}
+	}
+}
+
 func (r *PolicyKeyResource) Configure(_ context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
 	if req.ProviderData == nil {
 		return
@@ -168,20 +476,313 @@ func (r *PolicyKeyResource) Configure(_ context.Context, req resource.ConfigureR
 }
 
 type CreateKeysetResponse struct {
-	Id string `json:"id"`
+	Id      string            `json:"id"`
+	OdataId string            `json:"@odata.id"`
+	Keys    []json.RawMessage `json:"keys"`
+	// Unknown holds the top-level fields the provider does not read, and
+	// known fields whose value no longer has the expected type
+	Unknown map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON decodes a keyset without failing on the beta schema changing
+// under it: unknown fields are kept in Unknown, and a known field of an
+// unexpected type is left empty instead of failing the whole keyset. Only a
+// body that is not a JSON object is an error.
+func (k *CreateKeysetResponse) UnmarshalJSON(b []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	*k = CreateKeysetResponse{}
+	for name, raw := range fields {
+		var err error
+		switch {
+		case name == "id":
+			err = json.Unmarshal(raw, &k.Id)
+		case name == "@odata.id":
+			err = json.Unmarshal(raw, &k.OdataId)
+		case name == "keys":
+			err = json.Unmarshal(raw, &k.Keys)
+		case strings.HasPrefix(name, "@odata."):
+			// Other OData annotations, e.g. @odata.context, carry no keyset data
+			continue
+		default:
+			err = errors.New("unknown field")
+		}
+		if err != nil {
+			if k.Unknown == nil {
+				k.Unknown = map[string]json.RawMessage{}
+			}
+			k.Unknown[name] = raw
+		}
+	}
+	return nil
+}
+
+// decodeKeyset parses a keyset from Graph and logs the fields it did not
+// understand, so a change to the beta schema shows up in debug logs before
+// it shows up as a bug
+func decodeKeyset(ctx context.Context, body []byte) (CreateKeysetResponse, error) {
+	var keyset CreateKeysetResponse
+	if err := json.Unmarshal(body, &keyset); err != nil {
+		return CreateKeysetResponse{}, err
+	}
+	if len(keyset.Unknown) > 0 {
+		fields := slices.Sorted(maps.Keys(keyset.Unknown))
+		tflog.Debug(ctx, fmt.Sprintf("%s: keyset %s has unknown or unexpected fields, ignoring them: %s", logPrefix, keyset.Id, strings.Join(fields, ", ")))
+	}
+	return keyset, nil
+}
+
+// parseCreatedKeyset parses the body of a successful keyset create. Some beta
+// endpoints answer 200 with an error envelope instead of the keyset, so a
+// body holding an error or no id is a failed create.
+func parseCreatedKeyset(ctx context.Context, body []byte) (CreateKeysetResponse, error) {
+	var failure graphErrorBody
+	if json.Unmarshal(body, &failure) == nil && (failure.Error.Code != "" || failure.Error.Message != "") {
+		return CreateKeysetResponse{}, fmt.Errorf("Graph reported success but returned error %s: %s", failure.Error.Code, failure.Error.Message)
+	}
+	keyset, err := decodeKeyset(ctx, body)
+	if err != nil {
+		return CreateKeysetResponse{}, fmt.Errorf("Unable to parse the created keyset: %s\n%s", err, body)
+	}
+	if keyset.Id == "" {
+		return CreateKeysetResponse{}, fmt.Errorf("Graph returned no id for the created keyset: %s", body)
+	}
+	return keyset, nil
+}
+
+// kidValue returns the kid of the first key in the created keyset, or null
+// when it holds no key
+func (k CreateKeysetResponse) kidValue() types.String {
+	if len(k.Keys) == 0 {
+		return types.StringNull()
+	}
+	var key struct {
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(k.Keys[0], &key); err != nil || key.Kid == "" {
+		return types.StringNull()
+	}
+	return types.StringValue(key.Kid)
+}
+
+// rotatedOutOfBand reports whether a key Terraform did not upload has taken
+// over the container from the key kid it did: kid is gone from the
+// container, or another key is active while kid is within its validity
+// window. Graph exposes no version for an uploaded secret, only the kid of
+// each key, so without a recorded kid nothing can be compared.
+func (k CreateKeysetResponse) rotatedOutOfBand(kid, activeKid types.String, now time.Time) bool {
+	if isNullOrEmpty(kid) {
+		return false
+	}
+	for _, raw := range k.Keys {
+		var key struct {
+			Kid string `json:"kid"`
+			Nbf int64  `json:"nbf"`
+			Exp int64  `json:"exp"`
+		}
+		if err := json.Unmarshal(raw, &key); err != nil || key.Kid != kid.ValueString() {
+			continue
+		}
+		if isNullOrEmpty(activeKid) || activeKid.Equal(kid) {
+			return false
+		}
+		// Another key is expected to be active before nbf and after exp
+		return (key.Nbf == 0 || key.Nbf <= now.Unix()) && (key.Exp == 0 || key.Exp > now.Unix())
+	}
+	return true
+}
+
+// activeKid returns the kid of the key Azure AD B2C currently uses from the
+// container, or null when it has no active key
+func (r *PolicyKeyResource) activeKid(ctx context.Context, id types.String) types.String {
+	if isNullOrEmpty(id) {
+		return types.StringNull()
+	}
+	graphResp, err := r.client.readGraph(ctx, "/trustFramework/keySets/%s/getActiveKey", id.ValueString())
+	if err != nil || graphResp.StatusCode != http.StatusOK {
+		tflog.Debug(ctx, fmt.Sprintf("%s: no active key reported for keyset %s", logPrefix, id.ValueString()))
+		return types.StringNull()
+	}
+	var key struct {
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(r.client.readBodyBytes(graphResp), &key); err != nil || key.Kid == "" {
+		return types.StringNull()
+	}
+	return types.StringValue(key.Kid)
+}
+
+// keysetURL returns the Graph URL of the key container with the given id
+func (r *PolicyKeyResource) keysetURL(id types.String) types.String {
+	if isNullOrEmpty(id) {
+		return types.StringNull()
+	}
+	return types.StringValue(r.client.endpoint("/trustFramework/keySets/%s", id.ValueString()))
+}
+
+// odataIdValue returns the keyset's @odata.id, or null when Graph omitted it
+func (k CreateKeysetResponse) odataIdValue() types.String {
+	if k.OdataId == "" {
+		return types.StringNull()
+	}
+	return types.StringValue(k.OdataId)
+}
+
+// Retry settings for a keyset create that raced with another apply
+const keysetConflictRetries = 3
+
+var keysetConflictDelay = 2 * time.Second
+
+// keysetExists reports whether a keyset create failed because the container
+// is already there, either from a concurrent apply or from an earlier run that
+// stopped between creating the container and adding its key
+func (c *GraphClient) keysetExists(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusConflict {
+		return true
+	}
+	return resp.StatusCode == http.StatusBadRequest &&
+		strings.Contains(strings.ToLower(c.readBodyString(resp)), "already exists")
+}
+
+// resolveCreateConflict handles a keyset create that found the container
+// already present. It reads the container, retrying while a concurrent apply
+// is still creating it, then adopts it if it has no keys yet and fails if it
+// is already provisioned.
+func (r *PolicyKeyResource) resolveCreateConflict(ctx context.Context, name string) (CreateKeysetResponse, error) {
+	for attempt := 0; attempt <= keysetConflictRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return CreateKeysetResponse{}, ctx.Err()
+			case <-time.After(keysetConflictDelay):
+			}
+		}
+
+		tflog.Debug(ctx, fmt.Sprintf("%s: keyset %s already exists, reading it (attempt %d)", logPrefix, name, attempt+1))
+		graphResp, err := r.client.readGraph(ctx, "/trustFramework/keySets/%s", name)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return CreateKeysetResponse{}, err
+		}
+		if graphResp.StatusCode != http.StatusOK {
+			continue
+		}
+
+		keyset, err := decodeKeyset(ctx, r.client.readBodyBytes(graphResp))
+		if err != nil || keyset.Id == "" {
+			return CreateKeysetResponse{}, fmt.Errorf("Error parsing keyset %s after create conflict: %s", name, r.client.readBodyString(graphResp))
+		}
+		if len(keyset.Keys) > 0 {
+			return CreateKeysetResponse{}, fmt.Errorf("Keyset %s already exists and contains keys. Import it with `terraform import` to manage it with Terraform.", keyset.Id)
+		}
+		tflog.Warn(ctx, fmt.Sprintf("%s: adopting existing empty keyset %s", logPrefix, keyset.Id))
+		return keyset, nil
+	}
+	return CreateKeysetResponse{}, fmt.Errorf("Keyset %s reported a create conflict but did not become readable after %d attempts", name, keysetConflictRetries+1)
+}
+
+// resolveKeysetId checks that the id Graph returned from keyset create can be
+// read back, falling back to the configured name when it can't. Graph
+// normally returns the name as the id, so a divergence is logged as a quirk.
+func (r *PolicyKeyResource) resolveKeysetId(ctx context.Context, returnedId string, name string) string {
+	if returnedId == name {
+		return returnedId
+	}
+	tflog.Warn(ctx, fmt.Sprintf("%s: keyset create returned id %s for name %s", logPrefix, returnedId, name))
+
+	_, err := r.client.readGraph(ctx, "/trustFramework/keySets/%s", returnedId)
+	if err == nil {
+		return returnedId
+	}
+	if _, nameErr := r.client.readGraph(ctx, "/trustFramework/keySets/%s", name); nameErr == nil {
+		tflog.Warn(ctx, fmt.Sprintf("%s: keyset id %s is not readable (%s), using name %s instead", logPrefix, returnedId, err, name))
+		return name
+	}
+	return returnedId
+}
+
+// trustFrameworkKey is a single key as accepted in a keySet create body
+type trustFrameworkKey struct {
+	Use string `json:"use,omitempty"`
+	Kty string `json:"kty,omitempty"`
+	K   string `json:"k,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Nbf int64  `json:"nbf,omitempty"`
+	Exp int64  `json:"exp,omitempty"`
+}
+
+type createKeysetRequest struct {
+	Id    string              `json:"id"`
+	Usage string              `json:"usage"`
+	Keys  []trustFrameworkKey `json:"keys"`
+}
+
+// newCreateKeysetRequest builds the keySet create body. An uploaded secret is
+// sent inline so the container never exists without a key; generated keys
+// are left to the generateKey call.
+func newCreateKeysetRequest(data PolicyKeyModel) createKeysetRequest {
+	body := createKeysetRequest{
+		Id:    data.Name.ValueString(),
+		Usage: data.Usage.ValueString(),
+		Keys:  []trustFrameworkKey{},
+	}
+	if data.Upload != nil && !isNullOrEmpty(data.Upload.Value) {
+		key := trustFrameworkKey{
+			Use: data.Upload.keyUse(data.Usage.ValueString()),
+			Kty: "oct",
+			K:   data.Upload.Value.ValueString(),
+			Alg: data.Upload.Alg.ValueString(),
+		}
+		nbf, exp, _ := data.Upload.validity() // validated in ValidateConfig
+		if nbf != nil {
+			key.Nbf = nbf.Unix()
+		}
+		if exp != nil {
+			key.Exp = exp.Unix()
+		}
+		body.Keys = append(body.Keys, key)
+	}
+	return body
 }
 
-func (r *PolicyKeyResource) uploadOrGenerate(ctx context.Context, data PolicyKeyModel, configData PolicyKeyModel, stateData PolicyKeyModel) error {
+// redacted returns a copy safe for logging, with secret material removed
+func (b createKeysetRequest) redacted() createKeysetRequest {
+	keys := make([]trustFrameworkKey, len(b.Keys))
+	for i, k := range b.Keys {
+		if k.K != "" {
+			k.K = "<redacted>"
+		}
+		keys[i] = k
+	}
+	b.Keys = keys
+	return b
+}
+
+func (r *PolicyKeyResource) uploadOrGenerate(ctx context.Context, data *PolicyKeyModel, configData PolicyKeyModel, stateData PolicyKeyModel) error {
 	var uploadBody map[string]any
 	var endpoint string
 
+	data.ExpiresAt = types.StringNull()
+	data.ValueSha256 = stateData.ValueSha256
+	data.ValueSalt = stateData.ValueSalt
+	data.Kid = stateData.Kid
+	if data.Kid.IsUnknown() {
+		data.Kid = types.StringNull()
+	}
 	if data.Generate != nil {
-		uploadBody = map[string]any{
-			"use": data.Usage.ValueString(),
-			"kty": data.Generate.Type.ValueString(), //THIS could be hard-code "RSA" lol
+		data.ValueSha256 = types.StringNull()
+		data.ValueSalt = types.StringNull()
+		var exp *time.Time
+		uploadBody, exp = newGenerateKeyBody(*data, time.Now())
+		if exp != nil {
+			data.ExpiresAt = types.StringValue(exp.UTC().Format(time.RFC3339))
 		}
-		endpoint = fmt.Sprintf(
-			"https://graph.microsoft.com/beta/trustFramework/keySets/%s/generateKey",
+		endpoint = r.client.endpoint(
+			"/trustFramework/keySets/%s/generateKey",
 			data.ID.ValueString(),
 		)
 	} else if data.Upload != nil {
@@ -189,20 +790,31 @@ func (r *PolicyKeyResource) uploadOrGenerate(ctx context.Context, data PolicyKey
 		if !configData.Upload.ValueVersion.IsNull() {
 			version := configData.Upload.ValueVersion.ValueInt64()
 			if version < 0 && version != -1 {
-				return errors.New("value_version must be -1 or >= 0")
+				return newAttributeError(
+					path.Root("upload").AtName("value_version"),
+					"value_version must be -1 or >= 0",
+				)
 			}
 		}
 
 		// Check if we should upload based on version
-		shouldUpload := configData.Upload.ValueVersion.IsNull() || // Null = always upload
+		shouldUpload := configData.Upload.forcesUpload(stateData.Upload) ||
+			configData.Upload.ValueVersion.IsNull() || // Null = always upload
 			configData.Upload.ValueVersion.ValueInt64() == -1 || // Explicit -1 = upload
 			(configData.Upload.ValueVersion.ValueInt64() >= 0 && // Non-negative check + version change
-				stateData.Upload != nil &&
-				configData.Upload.ValueVersion.ValueInt64() != stateData.Upload.ValueVersion.ValueInt64())
+				(stateData.Upload == nil || // Nothing uploaded yet
+					stateData.Upload.ValueVersion.IsNull() || // Version unknown, e.g. rotated outside Terraform
+					configData.Upload.ValueVersion.ValueInt64() != stateData.Upload.ValueVersion.ValueInt64()))
 
 		if shouldUpload {
 			if configData.Upload.Value.IsNull() {
-				return errors.New("upload.value cannot be null when upload block is specified")
+				return newAttributeError(
+					path.Root("upload").AtName("value"),
+					"upload.value cannot be null when upload block is specified",
+				)
+			}
+			if err := configData.Upload.checkLength(configData.Upload.keyUse(data.Usage.ValueString())); err != nil {
+				return err
 			}
 
 			// Add debug log for null version
@@ -213,15 +825,31 @@ func (r *PolicyKeyResource) uploadOrGenerate(ctx context.Context, data PolicyKey
 			}
 
 			uploadBody = map[string]any{
-				"use": data.Usage.ValueString(),
+				"use": configData.Upload.keyUse(data.Usage.ValueString()),
 				"k":   configData.Upload.Value.ValueString(), // Use config value for write-only access
 			}
-			endpoint = fmt.Sprintf(
-				"https://graph.microsoft.com/beta/trustFramework/keySets/%s/uploadSecret",
+			if !isNullOrEmpty(configData.Upload.Alg) {
+				uploadBody["alg"] = configData.Upload.Alg.ValueString()
+			}
+			nbf, exp, err := configData.Upload.validity()
+			if err != nil {
+				return err
+			}
+			if nbf != nil {
+				uploadBody["nbf"] = nbf.Unix()
+			}
+			if exp != nil {
+				uploadBody["exp"] = exp.Unix()
+				data.ExpiresAt = types.StringValue(exp.UTC().Format(time.RFC3339))
+			}
+			endpoint = r.client.endpoint(
+				"/trustFramework/keySets/%s/uploadSecret",
 				data.ID.ValueString(),
 			)
 		} else {
-			// No upload needed, return early
+			// No upload needed, the uploaded secret keeps its expiry
+			data.ExpiresAt = stateData.ExpiresAt
+			data.LastHttpStatus = types.Int64Null()
 			return nil
 		}
 	} else {
@@ -229,26 +857,125 @@ func (r *PolicyKeyResource) uploadOrGenerate(ctx context.Context, data PolicyKey
 		return errors.New("No provisioning method specified OR an invalid block was given")
 	}
 
-	tflog.Debug(ctx, fmt.Sprintf("%s: POST %s\nBody:\n%s", logPrefix, endpoint, jsonDebug(uploadBody)))
+	tflog.Debug(ctx, fmt.Sprintf("%s: POST %s\nBody:\n%s", logPrefix, endpoint, maskSecrets([]byte(jsonDebug(uploadBody)))))
 
 	graphResp, err := r.client.doGraph(ctx, "POST", endpoint, uploadBody)
 	if err != nil {
 		tflog.Error(ctx, fmt.Sprintf("%s: Upload secret error: %s", logPrefix, err))
 		return err
-	} else if graphResp.StatusCode != http.StatusOK {
-		tflog.Error(ctx, fmt.Sprintf("Error in create secret response!\n%s", readBodyString(graphResp)))
-		return errors.New(readBodyString(graphResp))
 	}
-	logHTTPResponse(ctx, "Upload secret response", graphResp)
+	data.LastHttpStatus = httpStatusValue(graphResp.StatusCode)
+	if graphResp.StatusCode != http.StatusOK {
+		if data.Generate == nil {
+			if err := r.client.invalidKeyError(graphResp, data.Upload.keyUse(data.Usage.ValueString())); err != nil {
+				tflog.Debug(ctx, fmt.Sprintf("Upload secret rejected!\n%s", maskSecrets(r.client.readBodyBytes(graphResp))))
+				return err
+			}
+		}
+		tflog.Error(ctx, fmt.Sprintf("Error in create secret response!\n%s", maskSecrets(r.client.readBodyBytes(graphResp))))
+		return r.client.expectStatus(graphResp, http.StatusOK)
+	}
+	r.client.logHTTPResponse(ctx, "Upload secret response", graphResp)
+	var key struct {
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(r.client.readBodyBytes(graphResp), &key); err == nil && key.Kid != "" {
+		data.Kid = types.StringValue(key.Kid)
+	}
+	if data.Generate == nil {
+		data.ValueSalt = secretSalt(data.ValueSalt)
+		data.ValueSha256 = secretChecksum(data.ValueSalt.ValueString(), configData.Upload.Value.ValueString())
+		return nil
+	}
+	if key.Kid != "" {
+		r.waitForKey(ctx, data.ID.ValueString(), key.Kid)
+	}
+	if want := data.Generate.KeyId.ValueString(); want != "" && key.Kid != want {
+		return newAttributeError(
+			path.Root("generate").AtName("key_id"),
+			fmt.Sprintf("Graph generated the key with kid %q instead of the requested %q, so it does not honor generate.key_id for this tenant. Remove key_id and reference the kid attribute instead.", key.Kid, want),
+		)
+	}
 	return nil
 }
 
+// waitForKey polls the keyset until it lists the key kid, as some tenants
+// answer generateKey before the key can be used by a policy. It gives up
+// with a warning after the provider's generate_poll_timeout_seconds.
+func (r *PolicyKeyResource) waitForKey(ctx context.Context, keysetId, kid string) {
+	timeout := r.client.keyPollTimeout
+	if timeout <= 0 {
+		return
+	}
+	deadline := time.Now().Add(timeout)
+	for attempt := 1; ; attempt++ {
+		graphResp, err := r.client.readGraph(ctx, "/trustFramework/keySets/%s", keysetId)
+		if err == nil && graphResp.StatusCode == http.StatusOK {
+			if keyset, err := decodeKeyset(ctx, r.client.readBodyBytes(graphResp)); err == nil {
+				for _, raw := range keyset.Keys {
+					var k struct {
+						Kid string `json:"kid"`
+					}
+					if json.Unmarshal(raw, &k) == nil && k.Kid == kid {
+						tflog.Debug(ctx, fmt.Sprintf("%s: generated key %s is available after %d attempt(s)", logPrefix, kid, attempt))
+						return
+					}
+				}
+			}
+		}
+		if !time.Now().Add(r.client.keyPollInterval).Before(deadline) {
+			tflog.Warn(ctx, fmt.Sprintf("%s: generated key %s was not listed in keyset %s within %s; policies using it may fail to publish until it is", logPrefix, kid, keysetId, timeout))
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.client.keyPollInterval):
+		}
+	}
+}
+
 // ────────────────────────────────────────────────────────────────────────────────
 //
 //	CREATE
 //
 // ────────────────────────────────────────────────────────────────────────────────
+// ModifyPlan warns when a usage change replaces the key container under the
+// same name. Graph cannot hold two containers with one name, so the old one
+// has to be deleted first and policies referencing it fail until the
+// replacement is provisioned.
+func (r *PolicyKeyResource) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	if req.State.Raw.IsNull() || req.Plan.Raw.IsNull() {
+		return
+	}
+
+	var stateName, planName, stateUsage, planUsage types.String
+	resp.Diagnostics.Append(req.State.GetAttribute(ctx, path.Root("name"), &stateName)...)
+	resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("name"), &planName)...)
+	resp.Diagnostics.Append(req.State.GetAttribute(ctx, path.Root("usage"), &stateUsage)...)
+	resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("usage"), &planUsage)...)
+	if resp.Diagnostics.HasError() || planName.IsUnknown() || planUsage.IsUnknown() {
+		return
+	}
+	if planUsage.Equal(stateUsage) || !planName.Equal(stateName) {
+		return
+	}
+	resp.Diagnostics.AddAttributeWarning(
+		path.Root("usage"),
+		"Key container replaced destroy-first",
+		fmt.Sprintf("Changing usage replaces %s under the same name, so the old container is deleted before the new one exists and policies referencing it fail in between. "+
+			"To avoid that window, change name as well and set lifecycle { create_before_destroy = true }, then point the policies at the new name.", stateName.ValueString()),
+	)
+}
+
 func (r *PolicyKeyResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	ctx, throttled := withThrottleStats(ctx)
+	defer throttled.warn(&resp.Diagnostics)
+
+	if r.client.refuseWrite(&resp.Diagnostics) {
+		return
+	}
+
 	tflog.Debug(ctx, fmt.Sprintf("%s: CREATE begin", logPrefix))
 
 	var data PolicyKeyModel
@@ -257,49 +984,83 @@ func (r *PolicyKeyResource) Create(ctx context.Context, req resource.CreateReque
 
 	tflog.Debug(ctx, fmt.Sprintf("%s: Create plan: %s", logPrefix, jsonDebug(data)))
 
-	// 1. Create keyset
-	createBody := map[string]any{
-		"id":    data.Name.ValueString(),
-		"usage": data.Usage.ValueString(),
-		"keys":  []any{},
+	if data.Upload != nil {
+		if err := data.Upload.checkLength(data.Upload.keyUse(data.Usage.ValueString())); err != nil {
+			addErrorDiagnostic(&resp.Diagnostics, "Secret too short", err)
+			return
+		}
 	}
 
-	createURL := "https://graph.microsoft.com/beta/trustFramework/keySets"
-	tflog.Debug(ctx, fmt.Sprintf("%s: POST %s\nBody:\n%s", logPrefix, createURL, jsonDebug(createBody)))
+	// 1. Create keyset, with the uploaded secret inline when there is one
+	createBody := newCreateKeysetRequest(data)
+
+	createURL := r.client.endpoint("/trustFramework/keySets")
+	tflog.Debug(ctx, fmt.Sprintf("%s: POST %s\nBody:\n%s", logPrefix, createURL, jsonDebug(createBody.redacted())))
 
 	graphResp, err := r.client.doGraph(ctx, "POST", createURL, createBody)
+	adopted := false
 	if err != nil {
 		tflog.Error(ctx, fmt.Sprintf("%s: Create keyset error: %s", logPrefix, err))
-		resp.Diagnostics.AddError("Create keyset failed", err.Error())
+		addErrorDiagnostic(&resp.Diagnostics, "Create keyset failed", err)
 		return
-		//TODO handle _ already exists error
-	} else if graphResp.StatusCode != http.StatusCreated {
+	} else if r.client.keysetExists(graphResp) {
+		r.client.logHTTPResponse(ctx, "Create keyset conflict", graphResp)
+		keyset, err := r.resolveCreateConflict(ctx, data.Name.ValueString())
+		if err != nil {
+			addErrorDiagnostic(&resp.Diagnostics, "Create keyset failed", err)
+			return
+		}
+		data.ID = types.StringValue(keyset.Id)
+		data.OdataId = keyset.odataIdValue()
+		adopted = true
+	} else if err := r.client.expectStatus(graphResp, http.StatusCreated, http.StatusOK); err != nil {
+		if len(createBody.Keys) > 0 {
+			if err := r.client.invalidKeyError(graphResp, data.Upload.keyUse(data.Usage.ValueString())); err != nil {
+				tflog.Debug(ctx, fmt.Sprintf("Create keyset rejected the inline secret!\n%s", maskSecrets(r.client.readBodyBytes(graphResp))))
+				addErrorDiagnostic(&resp.Diagnostics, "Create keyset failed", err)
+				return
+			}
+		}
 		tflog.Debug(ctx, graphResp.Status)
-		tflog.Error(ctx, fmt.Sprintf("Error in create keyset response!\n%s", readBodyString(graphResp)))
-		resp.Diagnostics.AddError("Create keyset failed", readBodyString(graphResp))
-		return
-	}
-	logHTTPResponse(ctx, "Create keyset response", graphResp)
-	// set ID to proper ID
-	var keysetResp CreateKeysetResponse
-	err = json.Unmarshal(readBodyBytes(graphResp), &keysetResp)
-	if err != nil || keysetResp.Id == "" {
-		tflog.Error(ctx, fmt.Sprintf("Error in create keyset response!\n%s", readBodyString(graphResp)))
-		resp.Diagnostics.AddError("Create keyset failed", readBodyString(graphResp))
+		tflog.Error(ctx, fmt.Sprintf("Error in create keyset response!\n%s", r.client.readBodyString(graphResp)))
+		addErrorDiagnostic(&resp.Diagnostics, "Create keyset failed", err)
 		return
+	} else {
+		r.client.logHTTPResponse(ctx, "Create keyset response", graphResp)
+		// set ID to proper ID
+		keysetResp, err := parseCreatedKeyset(ctx, r.client.readBodyBytes(graphResp))
+		if err != nil {
+			tflog.Error(ctx, fmt.Sprintf("Error in create keyset response!\n%s", r.client.readBodyString(graphResp)))
+			addErrorDiagnostic(&resp.Diagnostics, "Create keyset failed", err)
+			return
+		}
+		data.ID = types.StringValue(r.resolveKeysetId(ctx, keysetResp.Id, data.Name.ValueString()))
+		data.OdataId = keysetResp.odataIdValue()
+		data.Kid = keysetResp.kidValue()
 	}
-	data.ID = types.StringValue(keysetResp.Id)
 
 	//TODO Create upload methods for x.509 and PKCS
-	//TODO Not-good-before and expiry for keys :)
-	// 2. Upload secret /generate secret !
-	err = r.uploadOrGenerate(ctx, data, data, PolicyKeyModel{}) // Use data as both config and plan
+	// 2. Upload secret /generate secret ! Graph has no inline key generation,
+	// so generated keys always take the second call.
+	// An adopted container was created without our inline key.
+	if len(createBody.Keys) == 0 || adopted {
+		err = r.uploadOrGenerate(ctx, &data, data, PolicyKeyModel{}) // Use data as both config and plan
+	} else {
+		data.ValueSalt = secretSalt(types.StringNull())
+		data.ValueSha256 = secretChecksum(data.ValueSalt.ValueString(), data.Upload.Value.ValueString())
+		data.LastHttpStatus = httpStatusValue(graphResp.StatusCode)
+		data.ExpiresAt = types.StringNull()
+		if exp := createBody.Keys[0].Exp; exp != 0 {
+			data.ExpiresAt = types.StringValue(time.Unix(exp, 0).UTC().Format(time.RFC3339))
+		}
+	}
+	data.ActiveKid = types.StringNull()
 	if err != nil {
-		resp.Diagnostics.AddError(
-			"Error creating or uploading policy key",
-			err.Error(),
-		)
+		addErrorDiagnostic(&resp.Diagnostics, "Error creating or uploading policy key", err)
+	} else {
+		data.ActiveKid = r.activeKid(ctx, data.ID)
 	}
+	data.GraphURL = r.keysetURL(data.ID)
 
 	// Sanitize write-only fields before storing in state
 	sanitizeWriteOnlyFields(&data)
@@ -314,6 +1075,9 @@ func (r *PolicyKeyResource) Create(ctx context.Context, req resource.CreateReque
 //
 // ────────────────────────────────────────────────────────────────────────────────
 func (r *PolicyKeyResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	ctx, throttled := withThrottleStats(ctx)
+	defer throttled.warn(&resp.Diagnostics)
+
 	tflog.Debug(ctx, fmt.Sprintf("%s: READ begin", logPrefix))
 
 	var data PolicyKeyModel
@@ -321,39 +1085,43 @@ func (r *PolicyKeyResource) Read(ctx context.Context, req resource.ReadRequest,
 	resp.Diagnostics.Append(diags...)
 
 	// CRITICAL: Always sanitize legacy state for backwards compatibility
-	sanitizeLegacyState(ctx, &data)
+	if sanitizeLegacyState(ctx, &data) {
+		resp.Diagnostics.AddWarning(
+			"Secret removed from state",
+			fmt.Sprintf(
+				"The state for policy key %s held the plaintext upload.value written by an older provider version. "+
+					"It has been removed and value_version was kept. Run `terraform apply` (or `terraform apply -refresh-only`) "+
+					"so the cleaned state is saved, and rotate the secret if the old state file may have been shared.",
+				data.Name.ValueString(),
+			),
+		)
+	}
 
 	tflog.Debug(ctx, fmt.Sprintf("%s: State after legacy cleanup: %s", logPrefix, jsonDebug(data)))
 
 	n := data.ID.ValueString()
-	getURL := fmt.Sprintf("https://graph.microsoft.com/beta/trustFramework/keySets/%s", n)
+	tflog.Debug(ctx, fmt.Sprintf("%s: GET keyset %s", logPrefix, n))
 
-	tflog.Debug(ctx, fmt.Sprintf("%s: GET %s", logPrefix, getURL))
-
-	graphResp, err := r.client.doGraph(ctx, "GET", getURL, nil)
+	graphResp, err := r.client.readGraph(ctx, "/trustFramework/keySets/%s", n)
+	if errors.Is(err, ErrNotFound) {
+		//We know the keysets don't exist under the name, remove the id
+		tflog.Debug(ctx, "Keyset does not exist, we will reset!")
+		resp.State.RemoveResource(ctx)
+		return
+	}
 	if err != nil {
 		tflog.Error(ctx, fmt.Sprintf("%s: Read error: %s", logPrefix, err))
-		resp.Diagnostics.AddError("Read keysets failed", err.Error())
+		addErrorDiagnostic(&resp.Diagnostics, "Read keysets failed", err)
 		return
 	}
-	logHTTPResponse(ctx, "Read keysets response", graphResp)
+	r.client.logHTTPResponse(ctx, "Read keysets response", graphResp)
 
-	if graphResp.StatusCode != http.StatusOK {
-		body := readBodyString(graphResp)
-		if strings.Contains(body, "AADB2C90073") { // ___ DOES NOT EXIST IN DIRECTORY ERROR CODE
-			//We know the keysets don't exist under the name, remove the id
-			tflog.Debug(ctx, "Keyset does not exist, we will reset!")
-			resp.State.RemoveResource(ctx)
-			return
-		}
-		resp.Diagnostics.AddError(
-			fmt.Sprintf("Graph returned %s", graphResp.Status),
-			body,
-		)
+	if err := r.client.expectStatus(graphResp, http.StatusOK); err != nil {
+		addErrorDiagnostic(&resp.Diagnostics, "Read keysets failed", err)
+		return
 	}
-	var parsed_resp CreateKeysetResponse
-	raw_body := readBodyBytes(graphResp)
-	err = json.Unmarshal(raw_body, &parsed_resp)
+	raw_body := r.client.readBodyBytes(graphResp)
+	parsed_resp, err := decodeKeyset(ctx, raw_body)
 	if err != nil {
 		tflog.Error(ctx, fmt.Sprintf("Keyset Parsing error! Error value: %s", err))
 		tflog.Error(ctx, fmt.Sprintf("Raw response: %s", string(raw_body)))
@@ -363,6 +1131,9 @@ func (r *PolicyKeyResource) Read(ctx context.Context, req resource.ReadRequest,
 		)
 		return
 	}
+	data.OdataId = parsed_resp.odataIdValue()
+	data.GraphURL = r.keysetURL(data.ID)
+	data.ActiveKid = r.activeKid(ctx, data.ID)
 
 	// Get current state to preserve write-only field structure and version tracking
 	var currentState PolicyKeyModel
@@ -370,12 +1141,26 @@ func (r *PolicyKeyResource) Read(ctx context.Context, req resource.ReadRequest,
 
 	// Preserve version tracking from state
 	if currentState.Upload != nil && data.Upload == nil {
-		data.Upload = &PolicyKeyUpload{
-			ValueVersion: currentState.Upload.ValueVersion,
-			Value:        types.StringNull(), // Keep write-only field null
-		}
+		data.Upload = currentState.Upload.withoutValue() // Keep write-only field null
 	}
 
+	// A secret rotated outside Terraform makes value_version stale. Clearing
+	// it shows the drift in the plan and uploads upload.value again.
+	if data.Upload != nil && !data.Upload.ValueVersion.IsNull() && parsed_resp.rotatedOutOfBand(data.Kid, data.ActiveKid, time.Now()) {
+		resp.Diagnostics.AddWarning(
+			"Secret rotated outside Terraform",
+			fmt.Sprintf(
+				"Key container %s no longer uses key %s, the last one Terraform uploaded; its active key is %s. "+
+					"value_version has been cleared so the next apply uploads upload.value again. "+
+					"To keep the new secret instead, set upload.value to it and apply.",
+				data.Name.ValueString(), data.Kid.ValueString(), data.ActiveKid.ValueString(),
+			),
+		)
+		data.Upload.ValueVersion = types.Int64Null()
+	}
+
+	warnKeyExpiry(data, time.Now(), &resp.Diagnostics)
+
 	// Ensure write-only fields are sanitized before storing in state
 	sanitizeWriteOnlyFields(&data)
 
@@ -389,6 +1174,13 @@ func (r *PolicyKeyResource) Read(ctx context.Context, req resource.ReadRequest,
 //
 // ────────────────────────────────────────────────────────────────────────────────
 func (r *PolicyKeyResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	ctx, throttled := withThrottleStats(ctx)
+	defer throttled.warn(&resp.Diagnostics)
+
+	if r.client.refuseWrite(&resp.Diagnostics) {
+		return
+	}
+
 	tflog.Debug(ctx, fmt.Sprintf("%s: UPDATE begin", logPrefix))
 
 	// Get both config and state data for version comparison
@@ -406,20 +1198,40 @@ func (r *PolicyKeyResource) Update(ctx context.Context, req resource.UpdateReque
 
 	tflog.Debug(ctx, fmt.Sprintf("%s: Update plan: %s", logPrefix, jsonDebug(configData)))
 
-	err := r.uploadOrGenerate(ctx, configData, configData, stateData)
-	if err != nil {
-		resp.Diagnostics.AddError(
-			"Error updating or uploading policy key",
-			err.Error(),
-		)
+	// id is computed, so it is only known from state
+	configData.ID = stateData.ID
+
+	if configData.Generate != nil && stateData.Generate != nil && configData.Generate.equal(*stateData.Generate) {
+		// Generating again would replace the key, so a change to attributes
+		// only kept in state, such as managed_by, leaves Graph alone
+		configData.ExpiresAt = stateData.ExpiresAt
+		configData.ValueSha256 = stateData.ValueSha256
+		configData.ValueSalt = stateData.ValueSalt
+		configData.Kid = stateData.Kid
+		configData.LastHttpStatus = stateData.LastHttpStatus
+		configData.ActiveKid = stateData.ActiveKid
+	} else if err := r.uploadOrGenerate(ctx, &configData, configData, stateData); err != nil {
+		addErrorDiagnostic(&resp.Diagnostics, "Error updating or uploading policy key", err)
 		return
+	} else {
+		configData.ActiveKid = r.activeKid(ctx, configData.ID)
 	}
 
 	// Rebuild state data from sanitized sources - don't use plan data directly
 	data := PolicyKeyModel{
-		ID:    configData.ID,
-		Name:  configData.Name,
-		Usage: configData.Usage,
+		ID:             configData.ID,
+		Name:           configData.Name,
+		Usage:          configData.Usage,
+		ExpiresAt:      configData.ExpiresAt,
+		OdataId:        stateData.OdataId,
+		ValueSha256:    configData.ValueSha256,
+		ValueSalt:      configData.ValueSalt,
+		LastHttpStatus: configData.LastHttpStatus,
+		CheckRefs:      configData.CheckRefs,
+		Kid:            configData.Kid,
+		GraphURL:       r.keysetURL(configData.ID),
+		ManagedBy:      configData.ManagedBy,
+		ActiveKid:      configData.ActiveKid,
 	}
 
 	// Handle generate block if present
@@ -429,16 +1241,10 @@ func (r *PolicyKeyResource) Update(ctx context.Context, req resource.UpdateReque
 
 	// Handle upload block with proper version tracking
 	if configData.Upload != nil {
-		data.Upload = &PolicyKeyUpload{
-			ValueVersion: configData.Upload.ValueVersion,
-			Value:        types.StringNull(), // Explicitly null for write-only field
-		}
+		data.Upload = configData.Upload.withoutValue() // Explicitly null for write-only field
 	} else if stateData.Upload != nil {
 		// Preserve existing upload structure if no upload in config
-		data.Upload = &PolicyKeyUpload{
-			ValueVersion: stateData.Upload.ValueVersion,
-			Value:        types.StringNull(), // Explicitly null for write-only field
-		}
+		data.Upload = stateData.Upload.withoutValue() // Explicitly null for write-only field
 	}
 
 	// Ensure write-only fields are sanitized before storing in state
@@ -454,6 +1260,13 @@ func (r *PolicyKeyResource) Update(ctx context.Context, req resource.UpdateReque
 //
 // ────────────────────────────────────────────────────────────────────────────────
 func (r *PolicyKeyResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	ctx, throttled := withThrottleStats(ctx)
+	defer throttled.warn(&resp.Diagnostics)
+
+	if r.client.refuseWrite(&resp.Diagnostics) {
+		return
+	}
+
 	tflog.Debug(ctx, fmt.Sprintf("%s: DELETE begin", logPrefix))
 
 	var data PolicyKeyModel
@@ -464,43 +1277,82 @@ func (r *PolicyKeyResource) Delete(ctx context.Context, req resource.DeleteReque
 	sanitizeLegacyState(ctx, &data)
 
 	tflog.Debug(ctx, fmt.Sprintf("%s: Delete target: %s", logPrefix, jsonDebug(data)))
+	if data.CheckRefs.ValueBool() {
+		ids, _, err := r.client.policiesReferencing(ctx, data.Name.ValueString())
+		if err != nil {
+			resp.Diagnostics.AddError("Delete failed", fmt.Sprintf("Checking which policies reference %s failed: %s", data.Name.ValueString(), err))
+			return
+		}
+		if len(ids) > 0 {
+			resp.Diagnostics.AddError("Policy key is in use", keyInUseRemediation(data.Name.ValueString(), ids))
+			return
+		}
+	}
 	n := data.ID.ValueString()
-	deleteURL := fmt.Sprintf("https://graph.microsoft.com/beta/trustFramework/keySets/%s", n)
+	deleteURL := r.client.endpoint("/trustFramework/keySets/%s", n)
 
 	tflog.Debug(ctx, fmt.Sprintf("%s: DELETE %s", logPrefix, deleteURL))
 
 	graphResp, err := r.client.doGraph(ctx, "DELETE", deleteURL, nil)
 	if err != nil {
 		tflog.Error(ctx, fmt.Sprintf("%s: Delete error: %s", logPrefix, err))
-		resp.Diagnostics.AddError("Delete failed", err.Error())
+		addErrorDiagnostic(&resp.Diagnostics, "Delete failed", err)
 		return
 	}
 
-	logHTTPResponse(ctx, "Delete response", graphResp)
+	r.client.logHTTPResponse(ctx, "Delete response", graphResp)
 
 	// Expected result from success is 204: No Content
-	if graphResp.StatusCode != http.StatusNoContent {
-		body := readBodyString(graphResp)
-		resp.Diagnostics.AddError(
-			fmt.Sprintf("Graph returned %s", graphResp.Status),
-			body,
-		)
+	if r.client.keyInUse(graphResp) {
+		resp.Diagnostics.AddError("Policy key is in use", keyInUseRemediation(data.Name.ValueString(), nil)+"\n\n"+r.client.errorDetail(graphResp))
+	} else if err := r.client.expectStatus(graphResp, http.StatusNoContent); err != nil {
+		addErrorDiagnostic(&resp.Diagnostics, "Delete failed", err)
 	}
 
 	tflog.Debug(ctx, fmt.Sprintf("%s: DELETE complete", logPrefix))
 }
 
-func logHTTPResponse(ctx context.Context, title string, resp *http.Response) {
-	body := readBodyString(resp)
+// warnKeyExpiry adds a warning when the current key is expired or close to it
+func warnKeyExpiry(data PolicyKeyModel, now time.Time, diags *diag.Diagnostics) {
+	if isNullOrEmpty(data.ExpiresAt) {
+		return
+	}
+	exp, err := time.Parse(time.RFC3339, data.ExpiresAt.ValueString())
+	if err != nil {
+		return
+	}
+	if now.After(exp) {
+		diags.AddAttributeWarning(
+			path.Root("expires_at"),
+			"Policy key has expired",
+			fmt.Sprintf("The key in %s expired at %s. Re-apply with a change to the generate block, or a new upload.value_version, to replace it.", data.Name.ValueString(), data.ExpiresAt.ValueString()),
+		)
+	} else if exp.Sub(now) < keyExpiryWarningWindow {
+		diags.AddAttributeWarning(
+			path.Root("expires_at"),
+			"Policy key expires soon",
+			fmt.Sprintf("The key in %s expires at %s.", data.Name.ValueString(), data.ExpiresAt.ValueString()),
+		)
+	}
+}
+
+func (c *GraphClient) logHTTPResponse(ctx context.Context, title string, resp *http.Response) {
+	body := maskSecrets(c.readBodyBytes(resp))
 	tflog.Debug(ctx, fmt.Sprintf("%s: %s\nStatus: %s\nBody:\n%s", logPrefix, title, resp.Status, body))
 }
 
-func readBodyBytes(resp *http.Response) []byte {
+// readBodyBytes reads resp's body up to the configured
+// max_response_body_bytes, leaving it readable again afterwards
+func (c *GraphClient) readBodyBytes(resp *http.Response) []byte {
 	if resp == nil || resp.Body == nil {
 		return []byte{}
 	}
 	defer resp.Body.Close()
-	b, _ := io.ReadAll(resp.Body)
+	limit := c.maxBodyBytes
+	if limit <= 0 {
+		limit = defaultMaxBodyBytes
+	}
+	b := readLimited(context.Background(), resp.Body, limit)
 
 	// Rewind the body so Terraform doesn't panic later when it tries to read it again
 	resp.Body = io.NopCloser(bytes.NewBuffer(b))
@@ -508,15 +1360,111 @@ func readBodyBytes(resp *http.Response) []byte {
 	return b
 }
 
-func readBodyString(resp *http.Response) string {
-	if resp == nil || resp.Body == nil {
-		return ""
+func (c *GraphClient) readBodyString(resp *http.Response) string {
+	return string(c.readBodyBytes(resp))
+}
+
+// graphErrorBody is the error envelope of a failed Graph request
+type graphErrorBody struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// invalidKeyHints explain the ways Graph rejects uploaded key material. Each
+// is matched against the lower-cased error code and message; %s is the usage.
+var invalidKeyHints = []struct {
+	match []string
+	hint  string
+}{
+	{
+		match: []string{"base64"},
+		hint:  "Graph expects the secret for this key to be base64 encoded. Encode upload.value, e.g. with base64encode(), and apply again.",
+	},
+	{
+		match: []string{"too short", "key size", "keysize", "minimum length"},
+		hint:  "The secret is too short for a %s key. Upload a longer secret; signing keys need at least 16 bytes.",
+	},
+	{
+		match: []string{"invalid key", "invalidkey", "key material"},
+		hint:  "Graph rejected upload.value as key material for a %s key. Check that it is the raw secret, without surrounding whitespace, quotes or a trailing newline.",
+	},
+}
+
+// invalidKeyError turns a 400 from uploadSecret that rejects the key material
+// into an actionable error on upload.value, or returns nil when the response
+// is some other failure
+func (c *GraphClient) invalidKeyError(resp *http.Response, usage string) error {
+	if resp.StatusCode != http.StatusBadRequest {
+		return nil
 	}
-	defer resp.Body.Close()
-	b, _ := io.ReadAll(resp.Body)
+	var body graphErrorBody
+	if err := json.Unmarshal(c.readBodyBytes(resp), &body); err != nil {
+		return nil
+	}
+	text := strings.ToLower(body.Error.Code + " " + body.Error.Message)
+	for _, h := range invalidKeyHints {
+		for _, m := range h.match {
+			if strings.Contains(text, m) {
+				hint := h.hint
+				if strings.Contains(hint, "%s") {
+					hint = fmt.Sprintf(hint, usage)
+				}
+				return newAttributeError(
+					path.Root("upload").AtName("value"),
+					fmt.Sprintf("%s\n\nGraph error %s: %s", hint, body.Error.Code, body.Error.Message),
+				)
+			}
+		}
+	}
+	return nil
+}
 
-	// Rewind the body so Terraform doesn't panic later when it tries to read it again
-	resp.Body = io.NopCloser(bytes.NewBuffer(b))
+// keyInUseMarkers are matched against the lower-cased error code and message
+// of a failed keySet delete to recognise a container still used by a policy.
+// Graph does not document a dedicated code for this.
+var keyInUseMarkers = []string{"in use", "being used", "referenced by"}
 
-	return string(b)
+// keyInUse reports whether Graph refused a keySet delete because a policy
+// still references the container
+func (c *GraphClient) keyInUse(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusBadRequest && resp.StatusCode != http.StatusConflict {
+		return false
+	}
+	var body graphErrorBody
+	if err := json.Unmarshal(c.readBodyBytes(resp), &body); err != nil {
+		return false
+	}
+	text := strings.ToLower(body.Error.Code + " " + body.Error.Message)
+	for _, m := range keyInUseMarkers {
+		if strings.Contains(text, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// keyInUseRemediation explains how to destroy a key container that policies
+// still use. policyIds may be nil when Graph did not say which ones.
+func keyInUseRemediation(name string, policyIds []string) string {
+	users := "one or more policies"
+	if len(policyIds) > 0 {
+		users = strings.Join(policyIds, ", ")
+	}
+	return fmt.Sprintf(
+		"The key container %s is still referenced by %s, so it was not deleted. Remove the reference from those policies and publish them, or destroy them first. "+
+			"When the policies are managed by Terraform, reference azure_b2c_ief_policy_key.<name>.id from them (e.g. in app_settings) so Terraform destroys them before the key. "+
+			"The azure_b2c_ief_policy_key_references data source lists the policies that use a container.",
+		name, users,
+	)
+}
+
+// httpStatusValue returns status for last_http_status, or null when no
+// response was received
+func httpStatusValue(status int) types.Int64 {
+	if status == 0 {
+		return types.Int64Null()
+	}
+	return types.Int64Value(int64(status))
 }
@@ -0,0 +1,398 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework-validators/int64validator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/listvalidator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/resourcevalidator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/stringvalidator"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+type PolicyKeyRotationResource struct {
+	client *GraphClient
+}
+
+type PolicyKeyRotationModel struct {
+	ID           types.String               `tfsdk:"id"`
+	Containers   types.List                 `tfsdk:"containers"`
+	Usage        types.String               `tfsdk:"usage"`
+	ValueVersion types.Int64                `tfsdk:"value_version"`
+	UploadValue  types.String               `tfsdk:"upload_value"`
+	Generate     *PolicyKeyRotationGenerate `tfsdk:"generate"`
+	Status       types.List                 `tfsdk:"status"`
+}
+
+type PolicyKeyRotationGenerate struct {
+	Type         types.String `tfsdk:"type"`
+	ValidForDays types.Int64  `tfsdk:"valid_for_days"`
+}
+
+// PolicyKeyRotationStatus records whether one container of the rotation got
+// its new key
+type PolicyKeyRotationStatus struct {
+	Container types.String `tfsdk:"container"`
+	Kid       types.String `tfsdk:"kid"`
+	Rotated   types.Bool   `tfsdk:"rotated"`
+}
+
+var policyKeyRotationStatusType = types.ObjectType{AttrTypes: map[string]attr.Type{
+	"container": types.StringType,
+	"kid":       types.StringType,
+	"rotated":   types.BoolType,
+}}
+
+func NewPolicyKeyRotationResource() resource.Resource {
+	return &PolicyKeyRotationResource{}
+}
+
+func (r *PolicyKeyRotationResource) Metadata(
+	_ context.Context,
+	req resource.MetadataRequest,
+	resp *resource.MetadataResponse,
+) {
+	resp.TypeName = req.ProviderTypeName + "_policy_key_rotation"
+}
+
+func (r *PolicyKeyRotationResource) Schema(
+	_ context.Context,
+	_ resource.SchemaRequest,
+	resp *resource.SchemaResponse,
+) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Rotates the key of several existing policy key containers in one apply, either uploading the same secret to each or generating a new key in each. Every container is rotated even when another one fails, and `status` reports which ones got their new key. Containers whose rotation failed are planned for another rotation, so the next apply retries them even when the configuration is unchanged. When the first apply rotates only some containers, the failures are reported as warnings rather than errors, so Terraform keeps the resource instead of replacing it and rotating every container again. Changing `value_version` rotates every container again; otherwise an apply only rotates containers that were added to `containers` or whose last rotation failed. The containers themselves are not managed: destroying this resource leaves them and their keys in place.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "Comma separated list of the rotated container names.",
+			},
+			"containers": schema.ListAttribute{
+				Required:            true,
+				ElementType:         types.StringType,
+				MarkdownDescription: "Names of the key containers to rotate, including the `B2C_1A_` prefix, e.g. `azure_b2c_ief_policy_key.signing.id`. The containers must already exist.",
+				Validators: []validator.List{
+					listvalidator.SizeAtLeast(1),
+					listvalidator.UniqueValues(),
+				},
+			},
+			"usage": schema.StringAttribute{
+				Required:            true,
+				MarkdownDescription: "Key usage of the new keys: `sig` (signing) or `enc` (encryption).",
+				Validators: []validator.String{
+					stringvalidator.OneOf("sig", "enc"),
+				},
+			},
+			"value_version": schema.Int64Attribute{
+				Required:            true,
+				MarkdownDescription: "Version of the rotation shared by all containers. Change it to rotate every container again.",
+				Validators: []validator.Int64{
+					int64validator.AtLeast(0),
+				},
+			},
+			"upload_value": schema.StringAttribute{
+				WriteOnly:           true,
+				Optional:            true,
+				MarkdownDescription: "Raw secret uploaded to every container. This attribute is write-only and is never stored in the Terraform state. Exactly one of `upload_value` or `generate` must be set.",
+			},
+			"status": schema.ListNestedAttribute{
+				Computed:            true,
+				MarkdownDescription: "Rotation status of every container, in the order of `containers`.",
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"container": schema.StringAttribute{
+							Computed:            true,
+							MarkdownDescription: "Name of the key container.",
+						},
+						"kid": schema.StringAttribute{
+							Computed:            true,
+							MarkdownDescription: "ID (`kid`) Graph reported for the new key. Null when the rotation failed or Graph reported none.",
+						},
+						"rotated": schema.BoolAttribute{
+							Computed:            true,
+							MarkdownDescription: "Whether the container got the key of the current `value_version`. Containers that failed are rotated again on the next apply.",
+						},
+					},
+				},
+			},
+		},
+		Blocks: map[string]schema.Block{
+			"generate": schema.SingleNestedBlock{
+				MarkdownDescription: "Generate a new key in every container instead of uploading a secret.",
+				Attributes: map[string]schema.Attribute{
+					"type": schema.StringAttribute{
+						Optional:            true,
+						MarkdownDescription: "Key type. Currently, only `RSA` is supported by Azure AD B2C for generated keys.",
+						Validators: []validator.String{
+							stringvalidator.OneOf("RSA"),
+						},
+					},
+					"valid_for_days": schema.Int64Attribute{
+						Optional:            true,
+						MarkdownDescription: "Number of days the generated keys are valid for, starting when they are generated.",
+						Validators: []validator.Int64{
+							int64validator.AtLeast(1),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (r *PolicyKeyRotationResource) ConfigValidators(
+	ctx context.Context,
+) []resource.ConfigValidator {
+	return []resource.ConfigValidator{
+		resourcevalidator.ExactlyOneOf(
+			path.MatchRoot("generate"),
+			path.MatchRoot("upload_value"),
+		),
+	}
+}
+
+func (r *PolicyKeyRotationResource) Configure(
+	_ context.Context,
+	req resource.ConfigureRequest,
+	resp *resource.ConfigureResponse,
+) {
+	if req.ProviderData == nil {
+		return
+	}
+	r.client = req.ProviderData.(*GraphClient)
+}
+
+// keyModel builds the azure_b2c_ief_policy_key model that rotates container
+func (data PolicyKeyRotationModel) keyModel(container string) PolicyKeyModel {
+	key := PolicyKeyModel{
+		ID:    types.StringValue(container),
+		Name:  types.StringValue(container),
+		Usage: data.Usage,
+		Kid:   types.StringNull(),
+	}
+	if data.Generate != nil {
+		key.Generate = &PolicyKeyGenerate{
+			Type:         data.Generate.Type,
+			ValidForDays: data.Generate.ValidForDays,
+			KeyId:        types.StringNull(),
+		}
+		return key
+	}
+	key.Upload = &PolicyKeyUpload{
+		Value:        data.UploadValue,
+		ValueVersion: data.ValueVersion,
+		MinLength:    types.Int64Null(),
+		Use:          types.StringNull(),
+		Alg:          types.StringNull(),
+	}
+	return key
+}
+
+// rotatedContainers returns the status of the containers that already have
+// the key of the state's value_version
+func (m PolicyKeyRotationModel) rotatedContainers(ctx context.Context) map[string]PolicyKeyRotationStatus {
+	rotated := map[string]PolicyKeyRotationStatus{}
+	if m.Status.IsNull() || m.Status.IsUnknown() {
+		return rotated
+	}
+	var status []PolicyKeyRotationStatus
+	if diags := m.Status.ElementsAs(ctx, &status, false); diags.HasError() {
+		return rotated
+	}
+	for _, s := range status {
+		if s.Rotated.ValueBool() {
+			rotated[s.Container.ValueString()] = s
+		}
+	}
+	return rotated
+}
+
+// rotate uploads or generates the new key in every container missing from
+// done, and records the status of all containers in data. A failing
+// container does not stop the others; its error is added to diags.
+func (r *PolicyKeyRotationResource) rotate(ctx context.Context, data *PolicyKeyRotationModel, done map[string]PolicyKeyRotationStatus, diags *diag.Diagnostics) {
+	var containers []string
+	diags.Append(data.Containers.ElementsAs(ctx, &containers, false)...)
+	if diags.HasError() {
+		return
+	}
+
+	keys := &PolicyKeyResource{client: r.client}
+	status := make([]PolicyKeyRotationStatus, 0, len(containers))
+	for _, container := range containers {
+		if s, ok := done[container]; ok {
+			status = append(status, s)
+			continue
+		}
+		key := data.keyModel(container)
+		s := PolicyKeyRotationStatus{
+			Container: types.StringValue(container),
+			Kid:       types.StringNull(),
+			Rotated:   types.BoolValue(false),
+		}
+		if err := keys.uploadOrGenerate(ctx, &key, key, PolicyKeyModel{}); err != nil {
+			tflog.Error(ctx, fmt.Sprintf("%s: Rotating %s failed: %s", logPrefix, container, err))
+			addErrorDiagnostic(diags, fmt.Sprintf("Error rotating %s", container), err)
+		} else {
+			s.Kid = key.Kid
+			s.Rotated = types.BoolValue(true)
+		}
+		status = append(status, s)
+	}
+
+	data.ID = types.StringValue(strings.Join(containers, ","))
+	data.UploadValue = types.StringNull()
+	list, d := types.ListValueFrom(ctx, policyKeyRotationStatusType, status)
+	diags.Append(d...)
+	data.Status = list
+}
+
+// pendingContainers reports whether a container in the state did not get
+// the key of its value_version
+func (m PolicyKeyRotationModel) pendingContainers(ctx context.Context) bool {
+	var status []PolicyKeyRotationStatus
+	m.Status.ElementsAs(ctx, &status, false)
+	for _, s := range status {
+		if !s.Rotated.ValueBool() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *PolicyKeyRotationResource) ModifyPlan(
+	ctx context.Context,
+	req resource.ModifyPlanRequest,
+	resp *resource.ModifyPlanResponse,
+) {
+	if req.State.Raw.IsNull() || req.Plan.Raw.IsNull() {
+		return
+	}
+
+	var state PolicyKeyRotationModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Containers whose rotation failed force an update even when the
+	// configuration is unchanged, so the next apply retries them
+	if !state.pendingContainers(ctx) {
+		return
+	}
+	resp.Diagnostics.Append(resp.Plan.SetAttribute(ctx, path.Root("status"), types.ListUnknown(policyKeyRotationStatusType))...)
+}
+
+func (r *PolicyKeyRotationResource) Create(
+	ctx context.Context,
+	req resource.CreateRequest,
+	resp *resource.CreateResponse,
+) {
+	ctx, throttled := withThrottleStats(ctx)
+	defer throttled.warn(&resp.Diagnostics)
+
+	if r.client.refuseWrite(&resp.Diagnostics) {
+		return
+	}
+
+	var data PolicyKeyRotationModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	var diags diag.Diagnostics
+	r.rotate(ctx, &data, nil, &diags)
+	// Terraform taints a resource whose create fails, and replacing it would
+	// rotate every container again. Once any container is rotated, the
+	// failures are reported as warnings instead and stay in state for the
+	// next apply to retry.
+	if len(data.rotatedContainers(ctx)) == 0 {
+		resp.Diagnostics.Append(diags...)
+		return
+	}
+	for _, d := range diags {
+		if d.Severity() == diag.SeverityError {
+			resp.Diagnostics.AddWarning(d.Summary(), d.Detail()+"\n\nThe containers that were rotated are kept in state; the next apply retries the rest.")
+		} else {
+			resp.Diagnostics.Append(d)
+		}
+	}
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	tflog.Debug(ctx, "Create policy key rotation complete!", map[string]any{
+		"ID": data.ID.ValueString(),
+	})
+}
+
+func (r *PolicyKeyRotationResource) Read(
+	ctx context.Context,
+	req resource.ReadRequest,
+	resp *resource.ReadResponse,
+) {
+	// The rotation has no Graph object of its own, so state is kept as is
+	var data PolicyKeyRotationModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *PolicyKeyRotationResource) Update(
+	ctx context.Context,
+	req resource.UpdateRequest,
+	resp *resource.UpdateResponse,
+) {
+	ctx, throttled := withThrottleStats(ctx)
+	defer throttled.warn(&resp.Diagnostics)
+
+	if r.client.refuseWrite(&resp.Diagnostics) {
+		return
+	}
+
+	var data PolicyKeyRotationModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	var state PolicyKeyRotationModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// A new value_version rotates every container, otherwise only the
+	// containers added since the last apply or that failed then
+	var done map[string]PolicyKeyRotationStatus
+	if data.ValueVersion.Equal(state.ValueVersion) {
+		done = state.rotatedContainers(ctx)
+	}
+
+	r.rotate(ctx, &data, done, &resp.Diagnostics)
+	if !data.Status.IsNull() {
+		resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	}
+	tflog.Debug(ctx, "Update policy key rotation complete!", map[string]any{
+		"ID": data.ID.ValueString(),
+	})
+}
+
+func (r *PolicyKeyRotationResource) Delete(
+	ctx context.Context,
+	req resource.DeleteRequest,
+	resp *resource.DeleteResponse,
+) {
+	// The containers and their keys are left in place; Terraform removes the
+	// resource from state
+	tflog.Debug(ctx, "Delete policy key rotation complete!")
+}
@@ -0,0 +1,178 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	fwresource "github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+func TestPolicyKeyRotationRetriesFailedContainers(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeGraph{responses: map[string]fakeResponse{
+		"POST /trustFramework/keySets/B2C_1A_First/uploadSecret":  {http.StatusOK, `{"kid":"first","use":"sig","kty":"oct"}`},
+		"POST /trustFramework/keySets/B2C_1A_Second/uploadSecret": {http.StatusNotFound, `{"error":{"code":"NotFound","message":"The key container was not found."}}`},
+	}}
+	r := &PolicyKeyRotationResource{client: newFakeGraphClient(fake)}
+
+	containers, _ := types.ListValueFrom(ctx, types.StringType, []string{"B2C_1A_First", "B2C_1A_Second"})
+	config := PolicyKeyRotationModel{
+		ID:           types.StringNull(),
+		Containers:   containers,
+		Usage:        types.StringValue("sig"),
+		ValueVersion: types.Int64Value(1),
+		UploadValue:  types.StringValue("0123456789abcdef0123456789abcdef"),
+		Status:       types.ListNull(policyKeyRotationStatusType),
+	}
+	newState := func(m PolicyKeyRotationModel) tfsdk.State {
+		state := testResourceState(t, r, nil)
+		if diags := state.Set(ctx, &m); diags.HasError() {
+			t.Fatalf("setting state: %v", diags)
+		}
+		return state
+	}
+	status := func(state tfsdk.State) string {
+		var m PolicyKeyRotationModel
+		state.Get(ctx, &m)
+		var status []PolicyKeyRotationStatus
+		m.Status.ElementsAs(ctx, &status, false)
+		got := make([]string, len(status))
+		for i, s := range status {
+			got[i] = fmt.Sprintf("%s:%t", s.Container.ValueString(), s.Rotated.ValueBool())
+		}
+		return strings.Join(got, ",")
+	}
+	uploads := func(container string) int {
+		n := 0
+		for _, call := range fake.calls {
+			if strings.Contains(call, "/keySets/"+container+"/uploadSecret") {
+				n++
+			}
+		}
+		return n
+	}
+
+	configState := newState(config)
+	createResp := &fwresource.CreateResponse{State: testResourceState(t, r, nil)}
+	r.Create(ctx, fwresource.CreateRequest{
+		Config: tfsdk.Config{Schema: configState.Schema, Raw: configState.Raw},
+	}, createResp)
+	// A partial first rotation must not taint the resource, or replacing it
+	// would rotate B2C_1A_First again
+	if createResp.Diagnostics.HasError() {
+		t.Fatalf("Create() unexpected error: %v", createResp.Diagnostics)
+	}
+	if !strings.Contains(fmt.Sprint(createResp.Diagnostics.Warnings()), "Error rotating B2C_1A_Second") {
+		t.Errorf("Create() diagnostics = %v, want a warning naming the failing container", createResp.Diagnostics)
+	}
+	if got := status(createResp.State); got != "B2C_1A_First:true,B2C_1A_Second:false" {
+		t.Fatalf("status after create = %s", got)
+	}
+
+	// plan runs ModifyPlan the way Terraform plans an unchanged or changed
+	// configuration: computed attributes keep their state value, and are
+	// unknown when the configuration changed them
+	plan := func(state tfsdk.State, config PolicyKeyRotationModel) tfsdk.Plan {
+		var prior PolicyKeyRotationModel
+		state.Get(ctx, &prior)
+		// Write-only values are never part of a plan
+		config.ID, config.Status, config.UploadValue = prior.ID, prior.Status, types.StringNull()
+		if !config.ValueVersion.Equal(prior.ValueVersion) {
+			config.Status = types.ListUnknown(policyKeyRotationStatusType)
+		}
+		planned := newState(config)
+		resp := &fwresource.ModifyPlanResponse{Plan: tfsdk.Plan{Schema: planned.Schema, Raw: planned.Raw}}
+		r.ModifyPlan(ctx, fwresource.ModifyPlanRequest{State: state, Plan: resp.Plan}, resp)
+		if resp.Diagnostics.HasError() {
+			t.Fatalf("ModifyPlan() unexpected error: %v", resp.Diagnostics)
+		}
+		return resp.Plan
+	}
+	update := func(state tfsdk.State, config PolicyKeyRotationModel) *fwresource.UpdateResponse {
+		p := plan(state, config)
+		if p.Raw.Equal(state.Raw) {
+			t.Fatalf("plan shows no change, so Terraform would not call Update")
+		}
+		configState := newState(config)
+		resp := &fwresource.UpdateResponse{State: state}
+		r.Update(ctx, fwresource.UpdateRequest{
+			Config: tfsdk.Config{Schema: configState.Schema, Raw: configState.Raw},
+			Plan:   p,
+			State:  state,
+		}, resp)
+		return resp
+	}
+
+	// The failed container forces a plan with the same configuration, which
+	// only retries it
+	fake.responses["POST /trustFramework/keySets/B2C_1A_Second/uploadSecret"] = fakeResponse{http.StatusOK, `{"kid":"second","use":"sig","kty":"oct"}`}
+	updateResp := update(createResp.State, config)
+	if updateResp.Diagnostics.HasError() {
+		t.Fatalf("Update() unexpected error: %v", updateResp.Diagnostics)
+	}
+	if got := status(updateResp.State); got != "B2C_1A_First:true,B2C_1A_Second:true" {
+		t.Errorf("status after retry = %s", got)
+	}
+	if uploads("B2C_1A_First") != 1 || uploads("B2C_1A_Second") != 2 {
+		t.Errorf("retry uploaded %v, want only B2C_1A_Second again", fake.calls)
+	}
+
+	// Once every container is rotated, an unchanged configuration plans nothing
+	if p := plan(updateResp.State, config); !p.Raw.Equal(updateResp.State.Raw) {
+		t.Errorf("plan after a complete rotation shows a change")
+	}
+
+	// A new value_version rotates every container
+	config.ValueVersion = types.Int64Value(2)
+	updateResp = update(updateResp.State, config)
+	if updateResp.Diagnostics.HasError() {
+		t.Fatalf("Update() unexpected error: %v", updateResp.Diagnostics)
+	}
+	if uploads("B2C_1A_First") != 2 || uploads("B2C_1A_Second") != 3 {
+		t.Errorf("new value_version uploaded %v, want every container again", fake.calls)
+	}
+
+	var m PolicyKeyRotationModel
+	updateResp.State.Get(ctx, &m)
+	if !m.UploadValue.IsNull() {
+		t.Errorf("upload_value = %s, want it kept out of state", m.UploadValue)
+	}
+	if m.ID.ValueString() != "B2C_1A_First,B2C_1A_Second" {
+		t.Errorf("id = %s", m.ID)
+	}
+}
+
+func TestPolicyKeyRotationCreateAllFailed(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeGraph{responses: map[string]fakeResponse{}}
+	r := &PolicyKeyRotationResource{client: newFakeGraphClient(fake)}
+
+	containers, _ := types.ListValueFrom(ctx, types.StringType, []string{"B2C_1A_First"})
+	configState := testResourceState(t, r, nil)
+	if diags := configState.Set(ctx, &PolicyKeyRotationModel{
+		Containers:   containers,
+		Usage:        types.StringValue("sig"),
+		ValueVersion: types.Int64Value(1),
+		UploadValue:  types.StringValue("0123456789abcdef0123456789abcdef"),
+		Status:       types.ListNull(policyKeyRotationStatusType),
+	}); diags.HasError() {
+		t.Fatalf("setting config: %v", diags)
+	}
+	resp := &fwresource.CreateResponse{State: testResourceState(t, r, nil)}
+	r.Create(ctx, fwresource.CreateRequest{
+		Config: tfsdk.Config{Schema: configState.Schema, Raw: configState.Raw},
+	}, resp)
+	if !resp.Diagnostics.HasError() {
+		t.Fatalf("Create() expected an error when no container was rotated")
+	}
+	var m PolicyKeyRotationModel
+	resp.State.Get(ctx, &m)
+	if !m.Status.IsNull() {
+		t.Errorf("Create() kept status %s although nothing was rotated", m.Status)
+	}
+}
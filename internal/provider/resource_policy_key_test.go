@@ -1,16 +1,34 @@
 package provider
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/providerserver"
+	fwresource "github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
 	"github.com/hashicorp/terraform-plugin-framework/types"
 	"github.com/hashicorp/terraform-plugin-go/tfprotov6"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	"github.com/hashicorp/terraform-plugin-log/tflogtest"
 	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/plancheck"
 	"github.com/hashicorp/terraform-plugin-testing/terraform"
 )
 
@@ -18,6 +36,10 @@ func testAccPreCheck(t *testing.T) {
 	if os.Getenv("TF_ACC") == "" {
 		t.Skip("TF_ACC environment variable not set - skipping acceptance tests")
 	}
+	// A recorded cassette answers every request, no credentials needed
+	if testAccCassette(t).replaying() {
+		return
+	}
 
 	requiredVars := []string{"AZURE_TENANT_ID", "AZURE_CLIENT_ID", "AZURE_CLIENT_SECRET"}
 	for _, envVar := range requiredVars {
@@ -27,26 +49,37 @@ func testAccPreCheck(t *testing.T) {
 	}
 }
 
-func testAccProtoV6ProviderFactories() map[string]func() (tfprotov6.ProviderServer, error) {
+// testAccProtoV6ProviderFactories serves the provider to acceptance test t,
+// sending Graph requests through its cassette when recording or replaying
+func testAccProtoV6ProviderFactories(t *testing.T) map[string]func() (tfprotov6.ProviderServer, error) {
 	return map[string]func() (tfprotov6.ProviderServer, error){
 		"azure-b2c-ief": func() (tfprotov6.ProviderServer, error) {
-			serverFunc := providerserver.NewProtocol6(New())
+			p := &b2ciefProvider{}
+			if c := testAccCassette(t); c != nil {
+				p.httpClient = &http.Client{Transport: c}
+			}
+			serverFunc := providerserver.NewProtocol6(p)
 			return serverFunc(), nil
 		},
 	}
 }
 
-func getTimestamp() int {
+// getTimestamp returns the timestamp acceptance test t names its resources
+// with: the recorded one when replaying a cassette, else the current time
+func getTimestamp(t *testing.T) int {
+	if c := testAccCassette(t); c != nil {
+		return c.cassette.Timestamp
+	}
 	return int(time.Now().Unix())
 }
 
 func TestAccPolicyKey_BasicCreate(t *testing.T) {
 	resourceName := "azure_b2c_ief_policy_key.acc_test_basic"
-	rName := fmt.Sprintf("acc-basic-key-%d", getTimestamp())
+	rName := fmt.Sprintf("acc-basic-key-%d", getTimestamp(t))
 
 	resource.Test(t, resource.TestCase{
 		PreCheck:                 func() { testAccPreCheck(t) },
-		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(),
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(t),
 		CheckDestroy:             testAccCheckPolicyKeyDestroy,
 		Steps: []resource.TestStep{
 			{
@@ -57,6 +90,7 @@ func TestAccPolicyKey_BasicCreate(t *testing.T) {
 					resource.TestCheckResourceAttr(resourceName, "usage", "sig"),
 					resource.TestCheckResourceAttrSet(resourceName, "id"),
 					resource.TestCheckNoResourceAttr(resourceName, "upload.value"), // Ensure write-only field is not stored
+					testAccCheckPolicyKeyChecksum(resourceName, "test-secret-api-key-basic"),
 				),
 			},
 		},
@@ -65,11 +99,11 @@ func TestAccPolicyKey_BasicCreate(t *testing.T) {
 
 func TestAccPolicyKey_GenerateRSA(t *testing.T) {
 	resourceName := "azure_b2c_ief_policy_key.acc_test_generated"
-	rName := fmt.Sprintf("acc-generated-key-%d", getTimestamp())
+	rName := fmt.Sprintf("acc-generated-key-%d", getTimestamp(t))
 
 	resource.Test(t, resource.TestCase{
 		PreCheck:                 func() { testAccPreCheck(t) },
-		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(),
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(t),
 		CheckDestroy:             testAccCheckPolicyKeyDestroy,
 		Steps: []resource.TestStep{
 			{
@@ -88,13 +122,46 @@ func TestAccPolicyKey_GenerateRSA(t *testing.T) {
 	})
 }
 
+func TestAccPolicyKey_UsageChangeReplaces(t *testing.T) {
+	resourceName := "azure_b2c_ief_policy_key.acc_test_usage"
+	rName := fmt.Sprintf("acc-usage-key-%d", getTimestamp(t))
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(t),
+		CheckDestroy:             testAccCheckPolicyKeyDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccPolicyKeyConfig_usage(rName, "sig"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckPolicyKeyExists(resourceName),
+					resource.TestCheckResourceAttr(resourceName, "usage", "sig"),
+				),
+			},
+			{
+				Config: testAccPolicyKeyConfig_usage(rName, "enc"),
+				ConfigPlanChecks: resource.ConfigPlanChecks{
+					PreApply: []plancheck.PlanCheck{
+						plancheck.ExpectResourceAction(resourceName, plancheck.ResourceActionDestroyBeforeCreate),
+					},
+				},
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckPolicyKeyExists(resourceName),
+					resource.TestCheckResourceAttr(resourceName, "usage", "enc"),
+					resource.TestCheckResourceAttr(resourceName, "generate.type", "RSA"),
+				),
+			},
+		},
+	})
+}
+
 func TestAccPolicyKey_Import(t *testing.T) {
 	resourceName := "azure_b2c_ief_policy_key.test_import"
-	rName := fmt.Sprintf("acc-import-key-%d", getTimestamp())
+	rName := fmt.Sprintf("acc-import-key-%d", getTimestamp(t))
 
 	resource.Test(t, resource.TestCase{
 		PreCheck:                 func() { testAccPreCheck(t) },
-		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(),
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(t),
 		CheckDestroy:             testAccCheckPolicyKeyDestroy,
 		Steps: []resource.TestStep{
 			{
@@ -117,11 +184,11 @@ func TestAccPolicyKey_Import(t *testing.T) {
 
 func TestAccPolicyKey_WriteOnlyValueNotInState(t *testing.T) {
 	resourceName := "azure_b2c_ief_policy_key.test_writeonly"
-	rName := fmt.Sprintf("acc-writeonly-%d", getTimestamp())
+	rName := fmt.Sprintf("acc-writeonly-%d", getTimestamp(t))
 
 	resource.Test(t, resource.TestCase{
 		PreCheck:                 func() { testAccPreCheck(t) },
-		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(),
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(t),
 		CheckDestroy:             testAccCheckPolicyKeyDestroy,
 		Steps: []resource.TestStep{
 			{
@@ -148,11 +215,11 @@ func TestAccPolicyKey_WriteOnlyValueNotInState(t *testing.T) {
 
 func TestAccPolicyKey_WriteOnlyVersionTracking(t *testing.T) {
 	resourceName := "azure_b2c_ief_policy_key.test_version"
-	rName := fmt.Sprintf("acc-version-%d", getTimestamp())
+	rName := fmt.Sprintf("acc-version-%d", getTimestamp(t))
 
 	resource.Test(t, resource.TestCase{
 		PreCheck:                 func() { testAccPreCheck(t) },
-		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(),
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(t),
 		CheckDestroy:             testAccCheckPolicyKeyDestroy,
 		Steps: []resource.TestStep{
 			{
@@ -202,6 +269,18 @@ resource "azure_b2c_ief_policy_key" "acc_test_generated" {
 `, rName)
 }
 
+func testAccPolicyKeyConfig_usage(rName string, usage string) string {
+	return fmt.Sprintf(`
+resource "azure_b2c_ief_policy_key" "acc_test_usage" {
+  name  = "%s"
+  usage = "%s"
+  generate {
+    type = "RSA"
+  }
+}
+`, rName, usage)
+}
+
 func testAccPolicyKeyConfig_writeOnly(rName string) string {
 	return fmt.Sprintf(`
 resource "azure_b2c_ief_policy_key" "test_writeonly" {
@@ -245,15 +324,32 @@ func testAccCheckPolicyKeyExists(resourceName string) resource.TestCheckFunc {
 	}
 }
 
+// testAccCheckPolicyKeyChecksum checks value_sha256 against secret and the
+// stored value_salt
+func testAccCheckPolicyKeyChecksum(resourceName string, secret string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rs, ok := s.RootModule().Resources[resourceName]
+		if !ok {
+			return fmt.Errorf("Not found: %s", resourceName)
+		}
+
+		want := secretChecksum(rs.Primary.Attributes["value_salt"], secret).ValueString()
+		if got := rs.Primary.Attributes["value_sha256"]; got != want {
+			return fmt.Errorf("value_sha256 = %s, want %s", got, want)
+		}
+		return nil
+	}
+}
+
 func TestAccPolicyKey_WriteOnlyValueUpdateWithNoChange(t *testing.T) {
 	// This test specifically reproduces the bug where upload.value leaks into state
 	// during updates where no actual upload occurs (same version)
 	resourceName := "azure_b2c_ief_policy_key.test_writeonly_update"
-	rName := fmt.Sprintf("acc-writeonly-update-%d", getTimestamp())
+	rName := fmt.Sprintf("acc-writeonly-update-%d", getTimestamp(t))
 
 	resource.Test(t, resource.TestCase{
 		PreCheck:                 func() { testAccPreCheck(t) },
-		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(),
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(t),
 		CheckDestroy:             testAccCheckPolicyKeyDestroy,
 		Steps: []resource.TestStep{
 			{
@@ -386,3 +482,1234 @@ func testAccCheckPolicyKeyDestroy(s *terraform.State) error {
 
 	return nil
 }
+
+func TestNewCreateKeysetRequest(t *testing.T) {
+	t.Run("UploadIsInlined", func(t *testing.T) {
+		data := PolicyKeyModel{
+			Name:  types.StringValue("B2C_1A_Inline"),
+			Usage: types.StringValue("sig"),
+			Upload: &PolicyKeyUpload{
+				Value:        types.StringValue("inline-secret"),
+				ValueVersion: types.Int64Value(1),
+			},
+		}
+
+		body := newCreateKeysetRequest(data)
+		if body.Id != "B2C_1A_Inline" {
+			t.Errorf("Expected id B2C_1A_Inline, got %s", body.Id)
+		}
+		if len(body.Keys) != 1 {
+			t.Fatalf("Expected 1 inline key, got %d", len(body.Keys))
+		}
+		if body.Keys[0].K != "inline-secret" || body.Keys[0].Use != "sig" || body.Keys[0].Kty != "oct" {
+			t.Errorf("Unexpected inline key: %+v", body.Keys[0])
+		}
+
+		// The redacted copy must not leak the secret or modify the original
+		if body.redacted().Keys[0].K == "inline-secret" {
+			t.Errorf("Expected redacted body to hide the secret")
+		}
+		if body.Keys[0].K != "inline-secret" {
+			t.Errorf("Expected redaction to leave the original body untouched")
+		}
+	})
+
+	t.Run("UploadUse", func(t *testing.T) {
+		data := PolicyKeyModel{
+			Name:  types.StringValue("B2C_1A_Mixed"),
+			Usage: types.StringValue("sig"),
+			Upload: &PolicyKeyUpload{
+				Value: types.StringValue("inline-secret"),
+				Use:   types.StringValue("enc"),
+			},
+		}
+
+		body := newCreateKeysetRequest(data)
+		if body.Usage != "sig" || len(body.Keys) != 1 || body.Keys[0].Use != "enc" {
+			t.Errorf("Expected a sig container with an enc key, got %+v", body.redacted())
+		}
+	})
+
+	t.Run("UploadValidity", func(t *testing.T) {
+		data := PolicyKeyModel{
+			Name:  types.StringValue("B2C_1A_Uploaded"),
+			Usage: types.StringValue("sig"),
+			Upload: &PolicyKeyUpload{
+				Value:     types.StringValue("inline-secret"),
+				NotBefore: types.StringValue("2026-01-01T00:00:00Z"),
+				Expires:   types.StringValue("2027-01-01T00:00:00Z"),
+			},
+		}
+
+		body := newCreateKeysetRequest(data)
+		if len(body.Keys) != 1 {
+			t.Fatalf("Expected one inline key, got %+v", body.Keys)
+		}
+		if want := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).Unix(); body.Keys[0].Nbf != want {
+			t.Errorf("Expected nbf %d, got %d", want, body.Keys[0].Nbf)
+		}
+		if want := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC).Unix(); body.Keys[0].Exp != want {
+			t.Errorf("Expected exp %d, got %d", want, body.Keys[0].Exp)
+		}
+	})
+
+	t.Run("UploadAlg", func(t *testing.T) {
+		data := PolicyKeyModel{
+			Name:  types.StringValue("B2C_1A_Uploaded"),
+			Usage: types.StringValue("sig"),
+			Upload: &PolicyKeyUpload{
+				Value: types.StringValue("inline-secret"),
+				Alg:   types.StringValue("HS256"),
+			},
+		}
+
+		raw, _ := json.Marshal(newCreateKeysetRequest(data).redacted())
+		if !strings.Contains(string(raw), `"alg":"HS256"`) {
+			t.Errorf("Expected alg in the inline key, got %s", raw)
+		}
+
+		data.Upload.Alg = types.StringNull()
+		raw, _ = json.Marshal(newCreateKeysetRequest(data).redacted())
+		if strings.Contains(string(raw), `"alg"`) {
+			t.Errorf("Expected alg to be omitted when unset, got %s", raw)
+		}
+	})
+
+	t.Run("GenerateHasNoKeys", func(t *testing.T) {
+		data := PolicyKeyModel{
+			Name:     types.StringValue("B2C_1A_Generated"),
+			Usage:    types.StringValue("sig"),
+			Generate: &PolicyKeyGenerate{Type: types.StringValue("RSA")},
+		}
+
+		body := newCreateKeysetRequest(data)
+		if body.Keys == nil || len(body.Keys) != 0 {
+			t.Errorf("Expected an empty keys list for generated keys, got %+v", body.Keys)
+		}
+	})
+}
+
+// testPolicyKeyConfig builds a tfsdk.Config for the policy key schema from the
+// given upload block, or a generate block when upload is nil
+func testPolicyKeyConfig(t *testing.T, upload map[string]tftypes.Value) tfsdk.Config {
+	t.Helper()
+	r := &PolicyKeyResource{}
+	schemaResp := &fwresource.SchemaResponse{}
+	r.Schema(context.Background(), fwresource.SchemaRequest{}, schemaResp)
+
+	objType := schemaResp.Schema.Type().TerraformType(context.Background()).(tftypes.Object)
+	uploadType := objType.AttributeTypes["upload"]
+	generateType := objType.AttributeTypes["generate"]
+
+	uploadValue := tftypes.NewValue(uploadType, nil)
+	generateValue := tftypes.NewValue(generateType, map[string]tftypes.Value{
+		"type":           tftypes.NewValue(tftypes.String, "RSA"),
+		"valid_for_days": tftypes.NewValue(tftypes.Number, nil),
+		"key_id":         tftypes.NewValue(tftypes.String, nil),
+	})
+	if upload != nil {
+		for name, attrType := range uploadType.(tftypes.Object).AttributeTypes {
+			if _, ok := upload[name]; !ok {
+				upload[name] = tftypes.NewValue(attrType, nil)
+			}
+		}
+		uploadValue = tftypes.NewValue(uploadType, upload)
+		generateValue = tftypes.NewValue(generateType, nil)
+	}
+
+	values := map[string]tftypes.Value{}
+	for name, attrType := range objType.AttributeTypes {
+		values[name] = tftypes.NewValue(attrType, nil)
+	}
+	values["name"] = tftypes.NewValue(tftypes.String, "B2C_1A_Test")
+	values["usage"] = tftypes.NewValue(tftypes.String, "sig")
+	values["upload"] = uploadValue
+	values["generate"] = generateValue
+
+	return tfsdk.Config{
+		Schema: schemaResp.Schema,
+		Raw:    tftypes.NewValue(objType, values),
+	}
+}
+
+func TestPolicyKeyValidateConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		upload    map[string]tftypes.Value
+		wantError bool
+		wantPath  path.Path
+	}{
+		{
+			name:      "generate block",
+			upload:    nil,
+			wantError: false,
+		},
+		{
+			name: "upload with value",
+			upload: map[string]tftypes.Value{
+				"value":         tftypes.NewValue(tftypes.String, "0123456789abcdef0123456789abcdef"),
+				"value_version": tftypes.NewValue(tftypes.Number, 1),
+			},
+			wantError: false,
+		},
+		{
+			name: "upload with unknown value",
+			upload: map[string]tftypes.Value{
+				"value":         tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+				"value_version": tftypes.NewValue(tftypes.Number, nil),
+			},
+			wantError: false,
+		},
+		{
+			name: "empty upload block",
+			upload: map[string]tftypes.Value{
+				"value":         tftypes.NewValue(tftypes.String, nil),
+				"value_version": tftypes.NewValue(tftypes.Number, nil),
+			},
+			wantError: true,
+			wantPath:  path.Root("upload").AtName("value"),
+		},
+		{
+			name: "sig secret too short",
+			upload: map[string]tftypes.Value{
+				"value": tftypes.NewValue(tftypes.String, "short"),
+			},
+			wantError: true,
+			wantPath:  path.Root("upload").AtName("value"),
+		},
+		{
+			name: "short secret with min_length override",
+			upload: map[string]tftypes.Value{
+				"value":      tftypes.NewValue(tftypes.String, "short"),
+				"min_length": tftypes.NewValue(tftypes.Number, 0),
+			},
+			wantError: false,
+		},
+		{
+			name: "short secret uploaded for enc",
+			upload: map[string]tftypes.Value{
+				"value": tftypes.NewValue(tftypes.String, "short"),
+				"use":   tftypes.NewValue(tftypes.String, "enc"),
+			},
+			wantError: false,
+		},
+		{
+			name: "upload with validity window",
+			upload: map[string]tftypes.Value{
+				"value":      tftypes.NewValue(tftypes.String, "0123456789abcdef0123456789abcdef"),
+				"not_before": tftypes.NewValue(tftypes.String, "2026-01-01T00:00:00Z"),
+				"expires":    tftypes.NewValue(tftypes.String, "2027-01-01T00:00:00Z"),
+			},
+			wantError: false,
+		},
+		{
+			name: "upload with malformed not_before",
+			upload: map[string]tftypes.Value{
+				"value":      tftypes.NewValue(tftypes.String, "0123456789abcdef0123456789abcdef"),
+				"not_before": tftypes.NewValue(tftypes.String, "2026-01-01"),
+			},
+			wantError: true,
+			wantPath:  path.Root("upload").AtName("not_before"),
+		},
+		{
+			name: "upload expiring before not_before",
+			upload: map[string]tftypes.Value{
+				"value":      tftypes.NewValue(tftypes.String, "0123456789abcdef0123456789abcdef"),
+				"not_before": tftypes.NewValue(tftypes.String, "2027-01-01T00:00:00Z"),
+				"expires":    tftypes.NewValue(tftypes.String, "2026-01-01T00:00:00Z"),
+			},
+			wantError: true,
+			wantPath:  path.Root("upload").AtName("expires"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &PolicyKeyResource{}
+			req := fwresource.ValidateConfigRequest{Config: testPolicyKeyConfig(t, tt.upload)}
+			resp := &fwresource.ValidateConfigResponse{}
+			r.ValidateConfig(context.Background(), req, resp)
+
+			if resp.Diagnostics.HasError() != tt.wantError {
+				t.Fatalf("Expected error: %t, got diagnostics: %v", tt.wantError, resp.Diagnostics)
+			}
+			if tt.wantError {
+				withPath, ok := resp.Diagnostics[0].(diag.DiagnosticWithPath)
+				if !ok || !withPath.Path().Equal(tt.wantPath) {
+					t.Errorf("Expected error on %s, got %v", tt.wantPath, resp.Diagnostics[0])
+				}
+			}
+		})
+	}
+}
+
+func TestNewGenerateKeyBody(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("WithoutValidity", func(t *testing.T) {
+		data := PolicyKeyModel{
+			Usage:    types.StringValue("sig"),
+			Generate: &PolicyKeyGenerate{Type: types.StringValue("RSA"), ValidForDays: types.Int64Null()},
+		}
+		body, exp := newGenerateKeyBody(data, now)
+		if exp != nil {
+			t.Errorf("Expected no expiry, got %s", exp)
+		}
+		if _, ok := body["exp"]; ok {
+			t.Errorf("Expected no exp in body, got %v", body)
+		}
+	})
+
+	t.Run("WithValidity", func(t *testing.T) {
+		data := PolicyKeyModel{
+			Usage:    types.StringValue("sig"),
+			Generate: &PolicyKeyGenerate{Type: types.StringValue("RSA"), ValidForDays: types.Int64Value(30)},
+		}
+		body, exp := newGenerateKeyBody(data, now)
+		if body["nbf"] != now.Unix() {
+			t.Errorf("Expected nbf %d, got %v", now.Unix(), body["nbf"])
+		}
+		if body["exp"] != now.Unix()+30*86400 {
+			t.Errorf("Expected exp %d, got %v", now.Unix()+30*86400, body["exp"])
+		}
+		if exp == nil || !exp.Equal(now.AddDate(0, 0, 30)) {
+			t.Errorf("Expected expiry 30 days out, got %v", exp)
+		}
+	})
+
+	t.Run("WithKeyId", func(t *testing.T) {
+		data := PolicyKeyModel{
+			Usage: types.StringValue("sig"),
+			Generate: &PolicyKeyGenerate{
+				Type:         types.StringValue("RSA"),
+				ValidForDays: types.Int64Null(),
+				KeyId:        types.StringValue("signing-2025"),
+			},
+		}
+		body, _ := newGenerateKeyBody(data, now)
+		if body["kid"] != "signing-2025" {
+			t.Errorf("Expected kid signing-2025, got %v", body["kid"])
+		}
+	})
+}
+
+func TestUploadOrGenerateKeyId(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyId   types.String
+		kid     string
+		wantErr bool
+	}{
+		{name: "no key_id", keyId: types.StringNull(), kid: "assigned"},
+		{name: "key_id honored", keyId: types.StringValue("signing-2025"), kid: "signing-2025"},
+		{name: "key_id ignored", keyId: types.StringValue("signing-2025"), kid: "assigned", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGraph{responses: map[string]fakeResponse{
+				"POST /trustFramework/keySets/B2C_1A_Test/generateKey": {http.StatusOK, `{"kid":"` + tt.kid + `","use":"sig","kty":"RSA"}`},
+			}}
+			r := &PolicyKeyResource{client: newFakeGraphClient(fake)}
+			data := PolicyKeyModel{
+				ID:       types.StringValue("B2C_1A_Test"),
+				Name:     types.StringValue("B2C_1A_Test"),
+				Usage:    types.StringValue("sig"),
+				Kid:      types.StringUnknown(),
+				Generate: &PolicyKeyGenerate{Type: types.StringValue("RSA"), ValidForDays: types.Int64Null(), KeyId: tt.keyId},
+			}
+
+			err := r.uploadOrGenerate(context.Background(), &data, data, PolicyKeyModel{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("uploadOrGenerate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				var withPath *attributeError
+				if !errors.As(err, &withPath) || !strings.Contains(err.Error(), `"assigned"`) {
+					t.Errorf("Expected key_id error naming the assigned kid, got %v", err)
+				}
+				return
+			}
+			if data.Kid.ValueString() != tt.kid {
+				t.Errorf("kid = %s, want %s", data.Kid, tt.kid)
+			}
+		})
+	}
+}
+
+func TestWarnKeyExpiry(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		expiresAt types.String
+		warnings  int
+	}{
+		{name: "no expiry", expiresAt: types.StringNull(), warnings: 0},
+		{name: "far from expiry", expiresAt: types.StringValue("2025-06-01T00:00:00Z"), warnings: 0},
+		{name: "expires soon", expiresAt: types.StringValue("2025-01-03T00:00:00Z"), warnings: 1},
+		{name: "expired", expiresAt: types.StringValue("2024-12-01T00:00:00Z"), warnings: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var diags diag.Diagnostics
+			warnKeyExpiry(PolicyKeyModel{Name: types.StringValue("B2C_1A_Test"), ExpiresAt: tt.expiresAt}, now, &diags)
+			if diags.WarningsCount() != tt.warnings {
+				t.Errorf("Expected %d warnings, got %v", tt.warnings, diags)
+			}
+		})
+	}
+}
+
+func TestCreateKeysetResponseOdataId(t *testing.T) {
+	var withOdata CreateKeysetResponse
+	err := json.Unmarshal([]byte(`{"@odata.id":"https://graph.microsoft.com/v2/tenant/trustFramework/keySets('B2C_1A_Test')","id":"B2C_1A_Test","keys":[]}`), &withOdata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := withOdata.odataIdValue(); got.ValueString() != "https://graph.microsoft.com/v2/tenant/trustFramework/keySets('B2C_1A_Test')" {
+		t.Errorf("Unexpected odata_id: %s", got)
+	}
+
+	var withoutOdata CreateKeysetResponse
+	err = json.Unmarshal([]byte(`{"id":"B2C_1A_Test","keys":[]}`), &withoutOdata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !withoutOdata.odataIdValue().IsNull() {
+		t.Errorf("Expected null odata_id when Graph omits it")
+	}
+}
+
+func TestDecodeKeysetTolerant(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantId      string
+		wantKeys    int
+		wantUnknown []string
+		wantErr     bool
+	}{
+		{
+			name:     "known fields",
+			body:     `{"@odata.context":"https://graph.microsoft.com/beta/$metadata#keySets/$entity","id":"B2C_1A_Test","keys":[{"kid":"a"}]}`,
+			wantId:   "B2C_1A_Test",
+			wantKeys: 1,
+		},
+		{
+			name:        "added fields",
+			body:        `{"id":"B2C_1A_Test","keys":[{"kid":"a"},{"kid":"b"}],"status":"enabled","metadata":{"owner":"x"}}`,
+			wantId:      "B2C_1A_Test",
+			wantKeys:    2,
+			wantUnknown: []string{"metadata", "status"},
+		},
+		{
+			name:        "keys changed type",
+			body:        `{"id":"B2C_1A_Test","keys":{"value":[]}}`,
+			wantId:      "B2C_1A_Test",
+			wantUnknown: []string{"keys"},
+		},
+		{
+			name:    "not an object",
+			body:    `[{"id":"B2C_1A_Test"}]`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyset, err := decodeKeyset(context.Background(), []byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeKeyset() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if keyset.Id != tt.wantId || len(keyset.Keys) != tt.wantKeys {
+				t.Errorf("decodeKeyset() = id %q with %d keys, want %q with %d", keyset.Id, len(keyset.Keys), tt.wantId, tt.wantKeys)
+			}
+			if got := slices.Sorted(maps.Keys(keyset.Unknown)); !slices.Equal(got, tt.wantUnknown) {
+				t.Errorf("unknown fields = %v, want %v", got, tt.wantUnknown)
+			}
+		})
+	}
+}
+
+func TestPolicyKeyCreateResponseBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{name: "created", status: http.StatusCreated, body: `{"id":"B2C_1A_Test","keys":[]}`},
+		{name: "ok", status: http.StatusOK, body: `{"id":"B2C_1A_Test","keys":[]}`},
+		{name: "ok with error body", status: http.StatusOK, body: `{"error":{"code":"BadRequest","message":"The keyset could not be created"}}`, wantErr: "The keyset could not be created"},
+		{name: "ok without id", status: http.StatusOK, body: `{"keys":[]}`, wantErr: "no id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			fake := &fakeGraph{responses: map[string]fakeResponse{
+				"POST /trustFramework/keySets": {tt.status, tt.body},
+			}}
+			r := &PolicyKeyResource{client: newFakeGraphClient(fake)}
+			config := testResourceState(t, r, nil)
+			diags := config.Set(ctx, &PolicyKeyModel{
+				Name:   types.StringValue("B2C_1A_Test"),
+				Usage:  types.StringValue("sig"),
+				Upload: &PolicyKeyUpload{Value: types.StringValue("0123456789abcdef0123456789abcdef")},
+			})
+			if diags.HasError() {
+				t.Fatalf("setting config: %v", diags)
+			}
+
+			resp := &fwresource.CreateResponse{State: testResourceState(t, r, nil)}
+			r.Create(ctx, fwresource.CreateRequest{
+				Config: tfsdk.Config{Schema: config.Schema, Raw: config.Raw},
+				Plan:   tfsdk.Plan{Schema: config.Schema, Raw: config.Raw},
+			}, resp)
+
+			var id types.String
+			resp.State.GetAttribute(ctx, path.Root("id"), &id)
+			if tt.wantErr == "" {
+				if resp.Diagnostics.HasError() {
+					t.Fatalf("Create() unexpected error: %v", resp.Diagnostics)
+				}
+				if id.ValueString() != "B2C_1A_Test" {
+					t.Errorf("id = %s, want B2C_1A_Test", id)
+				}
+				return
+			}
+			if !resp.Diagnostics.HasError() || !strings.Contains(resp.Diagnostics.Errors()[0].Detail(), tt.wantErr) {
+				t.Fatalf("Create() diagnostics = %v, want an error containing %q", resp.Diagnostics, tt.wantErr)
+			}
+			if !id.IsNull() {
+				t.Errorf("id = %s, want no id stored for a failed create", id)
+			}
+		})
+	}
+}
+
+func TestKeysetExists(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		expected bool
+	}{
+		{"conflict", http.StatusConflict, `{"error":{"code":"Conflict"}}`, true},
+		{"bad request already exists", http.StatusBadRequest, `{"error":{"message":"The key container 'B2C_1A_Test' Already Exists."}}`, true},
+		{"other bad request", http.StatusBadRequest, `{"error":{"message":"Invalid usage."}}`, false},
+		{"created", http.StatusCreated, `{"id":"B2C_1A_Test","keys":[]}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Body: io.NopCloser(strings.NewReader(tt.body))}
+			if got := (&GraphClient{}).keysetExists(resp); got != tt.expected {
+				t.Errorf("keysetExists() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPolicyKeyRead(t *testing.T) {
+	tests := []struct {
+		name        string
+		response    fakeResponse
+		wantRemoved bool
+		wantError   bool
+	}{
+		{
+			name:     "keyset exists",
+			response: fakeResponse{http.StatusOK, `{"@odata.id":"https://graph.test/keySets('B2C_1A_Test')","id":"B2C_1A_Test","keys":[{"kid":"abc"}]}`},
+		},
+		{
+			name:        "404 removes the resource",
+			response:    fakeResponse{http.StatusNotFound, `{}`},
+			wantRemoved: true,
+		},
+		{
+			name:        "b2c not found code removes the resource",
+			response:    fakeResponse{http.StatusBadRequest, `{"error":{"message":"AADB2C90073: Keyset does not exist."}}`},
+			wantRemoved: true,
+		},
+		{
+			name:      "server error is reported",
+			response:  fakeResponse{http.StatusInternalServerError, `{"error":{"code":"InternalServerError"}}`},
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGraph{responses: map[string]fakeResponse{
+				"GET /trustFramework/keySets/B2C_1A_Test":              tt.response,
+				"GET /trustFramework/keySets/B2C_1A_Test/getActiveKey": {http.StatusOK, `{"kid":"abc","use":"sig","kty":"oct"}`},
+			}}
+			r := &PolicyKeyResource{client: newFakeGraphClient(fake)}
+			state := testResourceState(t, r, map[string]tftypes.Value{
+				"id":    tftypes.NewValue(tftypes.String, "B2C_1A_Test"),
+				"name":  tftypes.NewValue(tftypes.String, "B2C_1A_Test"),
+				"usage": tftypes.NewValue(tftypes.String, "sig"),
+			})
+			resp := &fwresource.ReadResponse{State: state}
+			r.Read(context.Background(), fwresource.ReadRequest{State: state}, resp)
+
+			if got := resp.Diagnostics.HasError(); got != tt.wantError {
+				t.Fatalf("HasError() = %v, want %v: %v", got, tt.wantError, resp.Diagnostics)
+			}
+			if got := resp.State.Raw.IsNull(); got != tt.wantRemoved {
+				t.Errorf("resource removed = %v, want %v", got, tt.wantRemoved)
+			}
+			if tt.wantRemoved || tt.wantError {
+				return
+			}
+			var odataId types.String
+			resp.State.GetAttribute(context.Background(), path.Root("odata_id"), &odataId)
+			if odataId.ValueString() != "https://graph.test/keySets('B2C_1A_Test')" {
+				t.Errorf("Unexpected odata_id: %s", odataId)
+			}
+			var graphURL types.String
+			resp.State.GetAttribute(context.Background(), path.Root("graph_url"), &graphURL)
+			if graphURL.ValueString() != fakeGraphBaseURL+"/beta/trustFramework/keySets/B2C_1A_Test" {
+				t.Errorf("Unexpected graph_url: %s", graphURL)
+			}
+			var activeKid types.String
+			resp.State.GetAttribute(context.Background(), path.Root("active_kid"), &activeKid)
+			if activeKid.ValueString() != "abc" {
+				t.Errorf("Unexpected active_kid: %s", activeKid)
+			}
+		})
+	}
+}
+
+func TestPolicyKeyReadRotatedOutOfBand(t *testing.T) {
+	now := time.Now()
+	future := now.Add(24 * time.Hour).Unix()
+	tests := []struct {
+		name        string
+		keys        string
+		activeKid   string
+		wantRotated bool
+	}{
+		{name: "still active", keys: `[{"kid":"ours"}]`, activeKid: "ours"},
+		{name: "another key active", keys: `[{"kid":"ours"},{"kid":"theirs"}]`, activeKid: "theirs", wantRotated: true},
+		{name: "key removed", keys: `[{"kid":"theirs"}]`, activeKid: "theirs", wantRotated: true},
+		{name: "not yet valid", keys: fmt.Sprintf(`[{"kid":"ours","nbf":%d},{"kid":"old"}]`, future), activeKid: "old"},
+		{name: "no active key", keys: `[{"kid":"ours"}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			fake := &fakeGraph{responses: map[string]fakeResponse{
+				"GET /trustFramework/keySets/B2C_1A_Test": {http.StatusOK, `{"id":"B2C_1A_Test","keys":` + tt.keys + `}`},
+			}}
+			if tt.activeKid != "" {
+				fake.responses["GET /trustFramework/keySets/B2C_1A_Test/getActiveKey"] = fakeResponse{http.StatusOK, `{"kid":"` + tt.activeKid + `"}`}
+			}
+			r := &PolicyKeyResource{client: newFakeGraphClient(fake)}
+			state := testResourceState(t, r, nil)
+			if diags := state.Set(ctx, &PolicyKeyModel{
+				ID:     types.StringValue("B2C_1A_Test"),
+				Name:   types.StringValue("B2C_1A_Test"),
+				Usage:  types.StringValue("sig"),
+				Kid:    types.StringValue("ours"),
+				Upload: &PolicyKeyUpload{ValueVersion: types.Int64Value(3)},
+			}); diags.HasError() {
+				t.Fatalf("setting state: %v", diags)
+			}
+			resp := &fwresource.ReadResponse{State: state}
+			r.Read(ctx, fwresource.ReadRequest{State: state}, resp)
+			if resp.Diagnostics.HasError() {
+				t.Fatalf("Read() unexpected error: %v", resp.Diagnostics)
+			}
+
+			var data PolicyKeyModel
+			resp.State.Get(ctx, &data)
+			if rotated := data.Upload.ValueVersion.IsNull(); rotated != tt.wantRotated {
+				t.Errorf("value_version = %s, want it cleared: %v", data.Upload.ValueVersion, tt.wantRotated)
+			}
+			if warned := resp.Diagnostics.WarningsCount() == 1; warned != tt.wantRotated {
+				t.Errorf("warned = %v, want %v: %v", warned, tt.wantRotated, resp.Diagnostics)
+			}
+
+			// The cleared version uploads the configured secret again
+			if !tt.wantRotated {
+				return
+			}
+			fake.responses["POST /trustFramework/keySets/B2C_1A_Test/uploadSecret"] = fakeResponse{http.StatusOK, `{"kid":"new"}`}
+			config := data
+			config.Upload = &PolicyKeyUpload{Value: types.StringValue("0123456789abcdef0123456789abcdef"), ValueVersion: types.Int64Value(3)}
+			if err := r.uploadOrGenerate(ctx, &config, config, data); err != nil {
+				t.Fatalf("uploadOrGenerate() unexpected error: %s", err)
+			}
+			if config.Kid.ValueString() != "new" {
+				t.Errorf("kid = %s, want the secret uploaded again", config.Kid)
+			}
+		})
+	}
+}
+
+func TestSecretChecksum(t *testing.T) {
+	salt := secretSalt(types.StringNull())
+	if other := secretSalt(types.StringNull()); other == salt || len(salt.ValueString()) != 32 {
+		t.Errorf("secretSalt() = %s then %s, want distinct random salts", salt, other)
+	}
+	if got := secretSalt(salt); got != salt {
+		t.Errorf("secretSalt(%s) = %s, want the stored salt kept", salt, got)
+	}
+
+	first := secretChecksum(salt.ValueString(), "s3cret")
+	if first != secretChecksum(salt.ValueString(), "s3cret") {
+		t.Errorf("checksum is not deterministic")
+	}
+	if first == secretChecksum(salt.ValueString(), "rotated") {
+		t.Errorf("checksum did not change with the secret")
+	}
+	if first == secretChecksum(secretSalt(types.StringNull()).ValueString(), "s3cret") {
+		t.Errorf("checksum is not keyed with the salt")
+	}
+	if unsalted := sha256.Sum256([]byte("s3cret")); first.ValueString() == hex.EncodeToString(unsalted[:]) {
+		t.Errorf("checksum is a plain SHA-256 of the secret")
+	}
+	if len(first.ValueString()) != 64 || strings.Contains(first.ValueString(), "s3cret") {
+		t.Errorf("unexpected checksum %s", first)
+	}
+}
+
+func TestReadBodyBytesLimit(t *testing.T) {
+	body := strings.Repeat("x", int(defaultMaxBodyBytes)+10)
+	tests := []struct {
+		name  string
+		limit int64
+		want  int
+	}{
+		{name: "configured above the default", limit: defaultMaxBodyBytes * 2, want: len(body)},
+		{name: "configured below the default", limit: 1024, want: 1024},
+		{name: "unset", want: int(defaultMaxBodyBytes)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &GraphClient{maxBodyBytes: tt.limit}
+			resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body))}
+			if got := len(c.readBodyBytes(resp)); got != tt.want {
+				t.Errorf("readBodyBytes() read %d bytes, want %d", got, tt.want)
+			}
+			if got := len(c.readBodyBytes(resp)); got != tt.want {
+				t.Errorf("second readBodyBytes() read %d bytes, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadSecretNotLogged(t *testing.T) {
+	const secret = "super-secret-client-value"
+	const token = "bearer-token-value"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		// Graph does not return the secret, but a response that did must
+		// not leak it into the logs either
+		_, _ = w.Write([]byte(`{"kid":"abc","use":"sig","kty":"oct","k":"` + secret + `"}`))
+	}))
+	defer srv.Close()
+
+	var logs bytes.Buffer
+	ctx := tflogtest.RootLogger(context.Background(), &logs)
+	r := &PolicyKeyResource{client: &GraphClient{
+		credential:   staticTokenCredential{token: token},
+		client:       srv.Client(),
+		maxBodyBytes: defaultMaxBodyBytes,
+		graphBaseURL: srv.URL,
+	}}
+	data := PolicyKeyModel{
+		ID:    types.StringValue("B2C_1A_Test"),
+		Name:  types.StringValue("B2C_1A_Test"),
+		Usage: types.StringValue("sig"),
+		Upload: &PolicyKeyUpload{
+			Value:        types.StringValue(secret),
+			ValueVersion: types.Int64Null(),
+		},
+	}
+
+	if err := r.uploadOrGenerate(ctx, &data, data, PolicyKeyModel{}); err != nil {
+		t.Fatalf("uploadOrGenerate() unexpected error: %s", err)
+	}
+	if data.LastHttpStatus.ValueInt64() != http.StatusOK {
+		t.Errorf("last_http_status = %s, want 200", data.LastHttpStatus)
+	}
+	if strings.Contains(logs.String(), secret) {
+		t.Errorf("secret found in logs:\n%s", logs.String())
+	}
+	if strings.Contains(logs.String(), token) {
+		t.Errorf("access token found in logs:\n%s", logs.String())
+	}
+	if !strings.Contains(logs.String(), `\"k\":\"***\"`) {
+		t.Errorf("expected the masked k field in logs:\n%s", logs.String())
+	}
+}
+
+func TestMaskSecrets(t *testing.T) {
+	got := maskSecrets([]byte(`{"id":"B2C_1A_Test","keys":[{"k":"one","kty":"oct"}],"credentials":{"password":"two"}}`))
+	if strings.Contains(got, "one") || strings.Contains(got, "two") {
+		t.Errorf("secrets not masked: %s", got)
+	}
+	if !strings.Contains(got, `"kty":"oct"`) || !strings.Contains(got, `"id":"B2C_1A_Test"`) {
+		t.Errorf("non-secret fields changed: %s", got)
+	}
+	if got := maskSecrets([]byte("<xml/>")); got != "<xml/>" {
+		t.Errorf("non-JSON body changed: %s", got)
+	}
+}
+
+func TestPolicyKeyRead_LegacyState(t *testing.T) {
+	fake := &fakeGraph{responses: map[string]fakeResponse{
+		"GET /trustFramework/keySets/B2C_1A_Legacy": {http.StatusOK, `{"id":"B2C_1A_Legacy","keys":[{"kid":"abc"}]}`},
+	}}
+	r := &PolicyKeyResource{client: newFakeGraphClient(fake)}
+
+	schemaResp := &fwresource.SchemaResponse{}
+	r.Schema(context.Background(), fwresource.SchemaRequest{}, schemaResp)
+	uploadType := schemaResp.Schema.Type().TerraformType(context.Background()).(tftypes.Object).AttributeTypes["upload"]
+
+	// State as written by provider versions that stored the secret
+	state := testResourceState(t, r, map[string]tftypes.Value{
+		"id":    tftypes.NewValue(tftypes.String, "B2C_1A_Legacy"),
+		"name":  tftypes.NewValue(tftypes.String, "B2C_1A_Legacy"),
+		"usage": tftypes.NewValue(tftypes.String, "sig"),
+		"upload": tftypes.NewValue(uploadType, map[string]tftypes.Value{
+			"value":         tftypes.NewValue(tftypes.String, "legacy-secret-stored-in-state"),
+			"value_version": tftypes.NewValue(tftypes.Number, 3),
+			"not_before":    tftypes.NewValue(tftypes.String, nil),
+			"expires":       tftypes.NewValue(tftypes.String, nil),
+			"min_length":    tftypes.NewValue(tftypes.Number, nil),
+			"use":           tftypes.NewValue(tftypes.String, nil),
+			"force_upload":  tftypes.NewValue(tftypes.Bool, nil),
+			"alg":           tftypes.NewValue(tftypes.String, nil),
+		}),
+	})
+	resp := &fwresource.ReadResponse{State: state}
+	r.Read(context.Background(), fwresource.ReadRequest{State: state}, resp)
+
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Read() unexpected error: %v", resp.Diagnostics)
+	}
+	if resp.Diagnostics.WarningsCount() != 1 {
+		t.Errorf("expected one warning about the removed secret, got %v", resp.Diagnostics)
+	}
+
+	var data PolicyKeyModel
+	resp.State.Get(context.Background(), &data)
+	if data.Upload == nil || !data.Upload.Value.IsNull() {
+		t.Fatalf("upload.value was not removed from state: %+v", data.Upload)
+	}
+	if data.Upload.ValueVersion.ValueInt64() != 3 {
+		t.Errorf("value_version = %d, want 3", data.Upload.ValueVersion.ValueInt64())
+	}
+
+	// A clean state refreshes without the warning
+	resp2 := &fwresource.ReadResponse{State: resp.State}
+	r.Read(context.Background(), fwresource.ReadRequest{State: resp.State}, resp2)
+	if resp2.Diagnostics.WarningsCount() != 0 {
+		t.Errorf("expected no warning once state is clean, got %v", resp2.Diagnostics)
+	}
+}
+
+func TestResolveKeysetId(t *testing.T) {
+	const keyset = `{"id":"B2C_1A_Test","keys":[]}`
+	tests := []struct {
+		name       string
+		returnedId string
+		responses  map[string]fakeResponse
+		want       string
+	}{
+		{
+			name:       "id matches name",
+			returnedId: "B2C_1A_Test",
+			want:       "B2C_1A_Test",
+		},
+		{
+			name:       "divergent id is readable",
+			returnedId: "B2C_1A_B2C_1A_Test",
+			responses: map[string]fakeResponse{
+				"GET /trustFramework/keySets/B2C_1A_B2C_1A_Test": {http.StatusOK, keyset},
+			},
+			want: "B2C_1A_B2C_1A_Test",
+		},
+		{
+			name:       "falls back to name",
+			returnedId: "00000000-aaaa",
+			responses: map[string]fakeResponse{
+				"GET /trustFramework/keySets/B2C_1A_Test": {http.StatusOK, keyset},
+			},
+			want: "B2C_1A_Test",
+		},
+		{
+			name:       "neither readable keeps returned id",
+			returnedId: "00000000-aaaa",
+			want:       "00000000-aaaa",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGraph{responses: tt.responses}
+			r := &PolicyKeyResource{client: newFakeGraphClient(fake)}
+			if got := r.resolveKeysetId(context.Background(), tt.returnedId, "B2C_1A_Test"); got != tt.want {
+				t.Errorf("resolveKeysetId() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvalidKeyError(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		wantHint string
+	}{
+		{
+			name:     "not base64",
+			status:   http.StatusBadRequest,
+			body:     `{"error":{"code":"AADB2C","message":"The key value is not a valid Base64 string."}}`,
+			wantHint: "base64 encoded",
+		},
+		{
+			name:     "too short",
+			status:   http.StatusBadRequest,
+			body:     `{"error":{"code":"AADB2C","message":"The key size is too small for the requested use."}}`,
+			wantHint: "too short for a sig key",
+		},
+		{
+			name:     "invalid key material",
+			status:   http.StatusBadRequest,
+			body:     `{"error":{"code":"InvalidKey","message":"The provided key is not valid."}}`,
+			wantHint: "key material for a sig key",
+		},
+		{
+			name:   "other bad request",
+			status: http.StatusBadRequest,
+			body:   `{"error":{"code":"Request_BadRequest","message":"Keyset name is invalid."}}`,
+		},
+		{
+			name:   "not a bad request",
+			status: http.StatusForbidden,
+			body:   `{"error":{"code":"Authorization_RequestDenied","message":"Invalid key"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Body: io.NopCloser(strings.NewReader(tt.body))}
+			err := (&GraphClient{}).invalidKeyError(resp, "sig")
+			if tt.wantHint == "" {
+				if err != nil {
+					t.Errorf("expected no translation, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantHint) {
+				t.Errorf("error = %v, want hint %q", err, tt.wantHint)
+			}
+		})
+	}
+}
+
+func TestWaitForKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		timeout   time.Duration
+		keyset    string
+		wantCalls int
+		wantMore  bool
+	}{
+		{name: "disabled", timeout: 0, keyset: `{"id":"B2C_1A_Test","keys":[]}`, wantCalls: 0},
+		{name: "key listed", timeout: time.Second, keyset: `{"id":"B2C_1A_Test","keys":[{"kid":"old"},{"kid":"new"}]}`, wantCalls: 1},
+		{name: "key never listed", timeout: 30 * time.Millisecond, keyset: `{"id":"B2C_1A_Test","keys":[{"kid":"old"}]}`, wantCalls: 2, wantMore: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGraph{responses: map[string]fakeResponse{
+				"GET /v1.0/trustFramework/keySets/B2C_1A_Test": {http.StatusOK, tt.keyset},
+			}}
+			client := newFakeGraphClient(fake)
+			client.keyPollTimeout = tt.timeout
+			client.keyPollInterval = 10 * time.Millisecond
+			r := &PolicyKeyResource{client: client}
+
+			r.waitForKey(context.Background(), "B2C_1A_Test", "new")
+			if tt.wantMore && len(fake.calls) < tt.wantCalls || !tt.wantMore && len(fake.calls) != tt.wantCalls {
+				t.Errorf("got %d keyset reads, want %d (or more: %v): %v", len(fake.calls), tt.wantCalls, tt.wantMore, fake.calls)
+			}
+		})
+	}
+}
+
+func TestUploadOrGenerateForceUpload(t *testing.T) {
+	tests := []struct {
+		name       string
+		noState    bool
+		stateForce types.Bool
+		force      types.Bool
+		wantUpload bool
+	}{
+		{name: "nothing uploaded yet", noState: true, force: types.BoolNull(), wantUpload: true},
+		{name: "unchanged version", stateForce: types.BoolNull(), force: types.BoolNull()},
+		{name: "force switched on", stateForce: types.BoolNull(), force: types.BoolValue(true), wantUpload: true},
+		{name: "force switched on from false", stateForce: types.BoolValue(false), force: types.BoolValue(true), wantUpload: true},
+		{name: "force left on", stateForce: types.BoolValue(true), force: types.BoolValue(true)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGraph{responses: map[string]fakeResponse{
+				"POST /trustFramework/keySets/B2C_1A_Test/uploadSecret": {http.StatusOK, `{"kid":"abc","use":"sig","kty":"oct"}`},
+			}}
+			r := &PolicyKeyResource{client: newFakeGraphClient(fake)}
+			state := PolicyKeyModel{
+				ID:     types.StringValue("B2C_1A_Test"),
+				Usage:  types.StringValue("sig"),
+				Upload: &PolicyKeyUpload{ValueVersion: types.Int64Value(1), ForceUpload: tt.stateForce},
+			}
+			if tt.noState {
+				state.Upload = nil
+			}
+			config := PolicyKeyModel{
+				ID:    types.StringValue("B2C_1A_Test"),
+				Name:  types.StringValue("B2C_1A_Test"),
+				Usage: types.StringValue("sig"),
+				Upload: &PolicyKeyUpload{
+					Value:        types.StringValue("0123456789abcdef0123456789abcdef"),
+					ValueVersion: types.Int64Value(1),
+					ForceUpload:  tt.force,
+				},
+			}
+
+			if err := r.uploadOrGenerate(context.Background(), &config, config, state); err != nil {
+				t.Fatalf("uploadOrGenerate() unexpected error: %s", err)
+			}
+			if uploaded := len(fake.calls) > 0; uploaded != tt.wantUpload {
+				t.Errorf("uploaded = %v, want %v: %v", uploaded, tt.wantUpload, fake.calls)
+			}
+		})
+	}
+}
+
+func TestResolveCreateConflict(t *testing.T) {
+	delay := keysetConflictDelay
+	keysetConflictDelay = 0
+	t.Cleanup(func() { keysetConflictDelay = delay })
+
+	tests := []struct {
+		name      string
+		keyset    *fakeResponse
+		wantError string
+	}{
+		{
+			name:   "empty container adopted",
+			keyset: &fakeResponse{http.StatusOK, `{"id":"B2C_1A_Test","keys":[]}`},
+		},
+		{
+			name:      "populated container",
+			keyset:    &fakeResponse{http.StatusOK, `{"id":"B2C_1A_Test","keys":[{"kid":"abc","use":"sig","kty":"oct"}]}`},
+			wantError: "already exists and contains keys",
+		},
+		{
+			name:      "container never readable",
+			wantError: "did not become readable after 4 attempts",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGraph{responses: map[string]fakeResponse{
+				"POST /trustFramework/keySets": {http.StatusConflict, `{"error":{"code":"Conflict","message":"The key container already exists."}}`},
+			}}
+			if tt.keyset != nil {
+				fake.responses["GET /trustFramework/keySets/B2C_1A_Test"] = *tt.keyset
+			}
+			r := &PolicyKeyResource{client: newFakeGraphClient(fake)}
+			ctx := context.Background()
+
+			graphResp, err := r.client.doGraph(ctx, http.MethodPost, r.client.endpoint("/trustFramework/keySets"), map[string]any{"id": "B2C_1A_Test"})
+			if err != nil || !r.client.keysetExists(graphResp) {
+				t.Fatalf("create = %v, %v, want a conflict", graphResp, err)
+			}
+			keyset, err := r.resolveCreateConflict(ctx, "B2C_1A_Test")
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("resolveCreateConflict() error = %v, want %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveCreateConflict() unexpected error: %s", err)
+			}
+			if keyset.Id != "B2C_1A_Test" {
+				t.Errorf("adopted keyset id = %q, want B2C_1A_Test", keyset.Id)
+			}
+		})
+	}
+}
+
+func TestPolicyKeyDeleteInUse(t *testing.T) {
+	const policies = `{"value":[{"id":"B2C_1A_Base"}]}`
+	const basePolicy = `<TrustFrameworkPolicy PolicyId="B2C_1A_Base"><Key StorageReferenceId="B2C_1A_Test"/></TrustFrameworkPolicy>`
+	tests := []struct {
+		name       string
+		checkRefs  bool
+		responses  map[string]fakeResponse
+		wantError  string
+		wantDelete bool
+	}{
+		{
+			name:       "deleted",
+			responses:  map[string]fakeResponse{"DELETE /trustFramework/keySets/B2C_1A_Test": {http.StatusNoContent, ``}},
+			wantDelete: true,
+		},
+		{
+			name: "graph reports the container in use",
+			responses: map[string]fakeResponse{
+				"DELETE /trustFramework/keySets/B2C_1A_Test": {http.StatusBadRequest, `{"error":{"code":"AADB2C","message":"The key container is in use by a policy."}}`},
+			},
+			wantError:  "Remove the reference",
+			wantDelete: true,
+		},
+		{
+			name:      "reference check finds a policy",
+			checkRefs: true,
+			responses: map[string]fakeResponse{
+				"GET /trustFramework/policies":                         {http.StatusOK, policies},
+				"GET /v1.0/trustFramework/policies/B2C_1A_Base/$value": {http.StatusOK, basePolicy},
+			},
+			wantError: "B2C_1A_Base",
+		},
+		{
+			name:      "reference check finds nothing",
+			checkRefs: true,
+			responses: map[string]fakeResponse{
+				"GET /trustFramework/policies":               {http.StatusOK, `{"value":[]}`},
+				"DELETE /trustFramework/keySets/B2C_1A_Test": {http.StatusNoContent, ``},
+			},
+			wantDelete: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGraph{responses: tt.responses}
+			r := &PolicyKeyResource{client: newFakeGraphClient(fake)}
+			state := testResourceState(t, r, map[string]tftypes.Value{
+				"id":                         tftypes.NewValue(tftypes.String, "B2C_1A_Test"),
+				"name":                       tftypes.NewValue(tftypes.String, "B2C_1A_Test"),
+				"usage":                      tftypes.NewValue(tftypes.String, "sig"),
+				"check_references_on_delete": tftypes.NewValue(tftypes.Bool, tt.checkRefs),
+			})
+			resp := &fwresource.DeleteResponse{State: state}
+			r.Delete(context.Background(), fwresource.DeleteRequest{State: state}, resp)
+
+			if got := resp.Diagnostics.HasError(); got != (tt.wantError != "") {
+				t.Fatalf("HasError() = %v, want %v: %v", got, tt.wantError != "", resp.Diagnostics)
+			}
+			if tt.wantError != "" && !strings.Contains(resp.Diagnostics[0].Detail(), tt.wantError) {
+				t.Errorf("error detail %q does not mention %q", resp.Diagnostics[0].Detail(), tt.wantError)
+			}
+			deleted := slices.Contains(fake.calls, "DELETE /trustFramework/keySets/B2C_1A_Test")
+			if deleted != tt.wantDelete {
+				t.Errorf("DELETE sent = %v, want %v: %v", deleted, tt.wantDelete, fake.calls)
+			}
+		})
+	}
+}
+
+func TestPolicyKeyUpdateManagedBy(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeGraph{}
+	r := &PolicyKeyResource{client: newFakeGraphClient(fake)}
+
+	prior := PolicyKeyModel{
+		ID:       types.StringValue("B2C_1A_Test"),
+		Name:     types.StringValue("B2C_1A_Test"),
+		Usage:    types.StringValue("sig"),
+		Generate: &PolicyKeyGenerate{Type: types.StringValue("RSA")},
+		Kid:      types.StringValue("abc"),
+	}
+	state := testResourceState(t, r, nil)
+	if diags := state.Set(ctx, &prior); diags.HasError() {
+		t.Fatalf("setting state: %v", diags)
+	}
+	config := prior
+	config.ID = types.StringUnknown()
+	config.Kid = types.StringUnknown()
+	config.ManagedBy = types.StringValue("workspace-prod")
+	configState := testResourceState(t, r, nil)
+	if diags := configState.Set(ctx, &config); diags.HasError() {
+		t.Fatalf("setting config: %v", diags)
+	}
+
+	resp := &fwresource.UpdateResponse{State: state}
+	r.Update(ctx, fwresource.UpdateRequest{
+		Config: tfsdk.Config{Schema: configState.Schema, Raw: configState.Raw},
+		Plan:   tfsdk.Plan{Schema: configState.Schema, Raw: configState.Raw},
+		State:  state,
+	}, resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Update() unexpected error: %v", resp.Diagnostics)
+	}
+	if len(fake.calls) != 0 {
+		t.Errorf("Expected no Graph requests for a managed_by change, got %v", fake.calls)
+	}
+	var got PolicyKeyModel
+	resp.State.Get(ctx, &got)
+	if got.ManagedBy.ValueString() != "workspace-prod" || got.Kid.ValueString() != "abc" {
+		t.Errorf("state managed_by = %s, kid = %s, want workspace-prod and the kid kept", got.ManagedBy, got.Kid)
+	}
+}
+
+func TestPolicyKeyModifyPlanUsageReplacement(t *testing.T) {
+	tests := []struct {
+		name     string
+		planName string
+		usage    string
+		create   bool
+		wantWarn bool
+	}{
+		{name: "usage unchanged", planName: "B2C_1A_Test", usage: "sig"},
+		{name: "usage changed under the same name", planName: "B2C_1A_Test", usage: "enc", wantWarn: true},
+		{name: "usage changed with a new name", planName: "B2C_1A_TestV2", usage: "enc"},
+		{name: "create", planName: "B2C_1A_Test", usage: "enc", create: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &PolicyKeyResource{}
+			state := testResourceState(t, r, map[string]tftypes.Value{
+				"id":    tftypes.NewValue(tftypes.String, "B2C_1A_Test"),
+				"name":  tftypes.NewValue(tftypes.String, "B2C_1A_Test"),
+				"usage": tftypes.NewValue(tftypes.String, "sig"),
+			})
+			if tt.create {
+				state.Raw = tftypes.NewValue(state.Schema.Type().TerraformType(context.Background()), nil)
+			}
+			planState := testResourceState(t, r, map[string]tftypes.Value{
+				"id":    tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+				"name":  tftypes.NewValue(tftypes.String, tt.planName),
+				"usage": tftypes.NewValue(tftypes.String, tt.usage),
+			})
+			plan := tfsdk.Plan{Schema: planState.Schema, Raw: planState.Raw}
+
+			resp := &fwresource.ModifyPlanResponse{Plan: plan}
+			r.ModifyPlan(context.Background(), fwresource.ModifyPlanRequest{State: state, Plan: plan}, resp)
+			if resp.Diagnostics.HasError() {
+				t.Fatalf("ModifyPlan() unexpected error: %v", resp.Diagnostics)
+			}
+			if warned := resp.Diagnostics.WarningsCount() > 0; warned != tt.wantWarn {
+				t.Errorf("warned = %v, want %v: %v", warned, tt.wantWarn, resp.Diagnostics)
+			}
+		})
+	}
+}
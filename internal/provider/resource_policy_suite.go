@@ -0,0 +1,586 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework-validators/listvalidator"
+	"github.com/hashicorp/terraform-plugin-framework-validators/resourcevalidator"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+type PolicySuiteResource struct {
+	client *GraphClient
+}
+
+type PolicySuiteModel struct {
+	ID             types.String       `tfsdk:"id"`
+	Policies       []PolicySuiteEntry `tfsdk:"policies"`
+	PolicyIds      types.List         `tfsdk:"policy_ids"`
+	XML            types.Map          `tfsdk:"xml"`
+	PolicyIdPrefix types.String       `tfsdk:"policy_id_prefix"`
+	Glob           types.String       `tfsdk:"glob"`
+	AppSettings    types.Map          `tfsdk:"app_settings"`
+	UploadStatus   types.List         `tfsdk:"upload_status"`
+}
+
+type PolicySuiteEntry struct {
+	File        types.String `tfsdk:"file"`
+	AppSettings types.Map    `tfsdk:"app_settings"`
+}
+
+// PolicySuiteUpload records whether one policy of the suite is uploaded
+type PolicySuiteUpload struct {
+	File     types.String `tfsdk:"file"`
+	PolicyId types.String `tfsdk:"policy_id"`
+	Uploaded types.Bool   `tfsdk:"uploaded"`
+}
+
+var policySuiteUploadType = types.ObjectType{AttrTypes: map[string]attr.Type{
+	"file":      types.StringType,
+	"policy_id": types.StringType,
+	"uploaded":  types.BoolType,
+}}
+
+func NewPolicySuiteResource() resource.Resource {
+	return &PolicySuiteResource{}
+}
+
+func (r *PolicySuiteResource) Metadata(
+	_ context.Context,
+	req resource.MetadataRequest,
+	resp *resource.MetadataResponse,
+) {
+	resp.TypeName = req.ProviderTypeName + "_policy_suite"
+}
+
+func (r *PolicySuiteResource) Schema(
+	_ context.Context,
+	_ resource.SchemaRequest,
+	resp *resource.SchemaResponse,
+) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Uploads a set of Trust Framework Policies in a single Microsoft Graph `$batch` request. Policies are uploaded in the order given, each one only after the previous one succeeded, so list base policies before the policies that inherit from them. Policies matched by `glob` are ordered automatically from their `BasePolicy` references. Graph does not roll back policies uploaded before a failure. When an update fails midway, `upload_status` records which policies were uploaded and the next apply only uploads the rest. When a create fails midway, the suite is kept in state with the policies that were uploaded, so Terraform marks it tainted and replaces it on the next apply.",
+		Attributes: map[string]schema.Attribute{
+			"id": schema.StringAttribute{
+				Computed:            true,
+				MarkdownDescription: "Comma separated list of the Policy IDs in the suite.",
+			},
+			"policies": schema.ListNestedAttribute{
+				Optional:            true,
+				MarkdownDescription: "The policies to upload, in upload order. At most 20 policies can be uploaded in one batch. Exactly one of `policies` or `glob` must be set.",
+				Validators: []validator.List{
+					listvalidator.SizeBetween(1, maxBatchRequests),
+				},
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"file": schema.StringAttribute{
+							Required:            true,
+							MarkdownDescription: "Path to the XML policy file on the local file system.",
+						},
+						"app_settings": schema.MapAttribute{
+							Optional:            true,
+							ElementType:         types.StringType,
+							MarkdownDescription: "A map of key-value pairs used for variable injection in the XML policy. Use `{settings:key}` in your XML to reference these values.",
+						},
+					},
+				},
+			},
+			"glob": schema.StringAttribute{
+				Optional:            true,
+				MarkdownDescription: "Glob pattern, e.g. `policies/*.xml`, matching the policy files to upload. Every match is rendered with `app_settings` and the suite is uploaded base policies first. Matching no files, or two files declaring the same `PolicyId`, is an error.",
+			},
+			"app_settings": schema.MapAttribute{
+				Optional:            true,
+				ElementType:         types.StringType,
+				MarkdownDescription: "A map of key-value pairs injected into every policy matched by `glob`. Use `{settings:key}` in your XML to reference these values.",
+			},
+			"policy_id_prefix": schema.StringAttribute{
+				Optional:            true,
+				MarkdownDescription: "Prefix every `PolicyId` and `BasePolicy` `PolicyId` in the suite must start with before it is uploaded. Defaults to `B2C_1A_`. Set to an empty string to disable the check.",
+			},
+			"policy_ids": schema.ListAttribute{
+				Computed:            true,
+				ElementType:         types.StringType,
+				MarkdownDescription: "The Policy IDs in upload order.",
+			},
+			"xml": schema.MapAttribute{
+				Computed:            true,
+				ElementType:         types.StringType,
+				MarkdownDescription: "The final processed XML content after variable injection, keyed by Policy ID.",
+			},
+			"upload_status": schema.ListNestedAttribute{
+				Computed:            true,
+				MarkdownDescription: "Upload status of every policy in upload order. A policy whose upload failed, whose rendered XML changed, or which is missing from the tenant is marked as not uploaded and is uploaded on the next apply.",
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"file": schema.StringAttribute{
+							Computed:            true,
+							MarkdownDescription: "Path to the XML policy file.",
+						},
+						"policy_id": schema.StringAttribute{
+							Computed:            true,
+							MarkdownDescription: "The `PolicyId` declared by the file.",
+						},
+						"uploaded": schema.BoolAttribute{
+							Computed:            true,
+							MarkdownDescription: "Whether the current XML of the policy is uploaded.",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (r *PolicySuiteResource) ConfigValidators(
+	ctx context.Context,
+) []resource.ConfigValidator {
+	return []resource.ConfigValidator{
+		resourcevalidator.ExactlyOneOf(
+			path.MatchRoot("policies"),
+			path.MatchRoot("glob"),
+		),
+		resourcevalidator.Conflicting(
+			path.MatchRoot("policies"),
+			path.MatchRoot("app_settings"),
+		),
+	}
+}
+
+func (r *PolicySuiteResource) Configure(
+	_ context.Context,
+	req resource.ConfigureRequest,
+	resp *resource.ConfigureResponse,
+) {
+	if req.ProviderData == nil {
+		return
+	}
+	r.client = req.ProviderData.(*GraphClient)
+}
+
+// sourcePath is the attribute the suite's files come from, for diagnostics
+func (data PolicySuiteModel) sourcePath() path.Path {
+	if !isNullOrEmpty(data.Glob) {
+		return path.Root("glob")
+	}
+	return path.Root("policies")
+}
+
+// suiteEntries returns the files of the suite, expanding glob when it is set
+func suiteEntries(data PolicySuiteModel) ([]PolicySuiteEntry, error) {
+	if isNullOrEmpty(data.Glob) {
+		return data.Policies, nil
+	}
+	pattern := data.Glob.ValueString()
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, configErrorf("Invalid glob %s: %s", pattern, err)
+	}
+	if len(matches) == 0 {
+		return nil, configErrorf("Glob %s did not match any policy files", pattern)
+	}
+	if len(matches) > maxBatchRequests {
+		return nil, configErrorf("Glob %s matched %d files, but at most %d policies can be uploaded in one batch", pattern, len(matches), maxBatchRequests)
+	}
+	entries := make([]PolicySuiteEntry, 0, len(matches))
+	for _, m := range matches {
+		entries = append(entries, PolicySuiteEntry{
+			File:        types.StringValue(m),
+			AppSettings: data.AppSettings,
+		})
+	}
+	return entries, nil
+}
+
+// orderByBase reorders the rendered policies so every policy is uploaded
+// after the base policy it extends, keeping the input order otherwise
+func orderByBase(policies []string, ids []string) ([]string, []string, error) {
+	bases := make(map[string]string, len(ids))
+	for i, policyXml := range policies {
+		refs, err := parsePolicyRefs(policyXml)
+		if err != nil {
+			return nil, nil, &ConfigError{Err: err}
+		}
+		bases[ids[i]] = refs.BasePolicyId
+	}
+
+	orderedPolicies := make([]string, 0, len(policies))
+	orderedIds := make([]string, 0, len(ids))
+	done := make(map[string]bool, len(ids))
+	for len(orderedIds) < len(ids) {
+		progress := false
+		for i, id := range ids {
+			if done[id] {
+				continue
+			}
+			base := bases[id]
+			if _, inSuite := bases[base]; inSuite && !done[base] {
+				continue
+			}
+			orderedPolicies = append(orderedPolicies, policies[i])
+			orderedIds = append(orderedIds, id)
+			done[id] = true
+			progress = true
+		}
+		if !progress {
+			return nil, nil, configErrorf("Policies in the suite have circular BasePolicy references")
+		}
+	}
+	return orderedPolicies, orderedIds, nil
+}
+
+// renderPolicySuite processes every policy in the suite, returning the XML in
+// upload order along with the Policy IDs and the files they came from
+func renderPolicySuite(ctx context.Context, data PolicySuiteModel) ([]string, []string, []string, error) {
+	entries, err := suiteEntries(data)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	policies := make([]string, 0, len(entries))
+	ids := make([]string, 0, len(entries))
+	seen := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		p := entry.File.ValueString()
+		policyXml, err := renderPolicyFile(ctx, p, entry.AppSettings)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		policyId := getPolicyId(policyXml)
+		if policyId == "" {
+			return nil, nil, nil, configErrorf("No PolicyId found in %s", p)
+		}
+		if other, ok := seen[policyId]; ok {
+			return nil, nil, nil, configErrorf("PolicyId %s is defined by both %s and %s", policyId, other, p)
+		}
+		seen[policyId] = p
+		policies = append(policies, policyXml)
+		ids = append(ids, policyId)
+	}
+	if !isNullOrEmpty(data.Glob) {
+		policies, ids, err = orderByBase(policies, ids)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	files := make([]string, len(ids))
+	for i, id := range ids {
+		files[i] = seen[id]
+	}
+	return policies, ids, files, nil
+}
+
+// render renders the suite as renderPolicySuite does, with the TenantId the
+// provider configuration asks for
+func (r *PolicySuiteResource) render(ctx context.Context, data PolicySuiteModel) ([]string, []string, []string, error) {
+	policies, ids, files, err := renderPolicySuite(ctx, data)
+	for i, policyXml := range policies {
+		policies[i] = r.client.withPolicyTenant(policyXml)
+	}
+	return policies, ids, files, err
+}
+
+// setComputed fills the computed attributes from the rendered suite, with
+// uploaded holding whether each policy is uploaded
+func (m *PolicySuiteModel) setComputed(policies []string, ids []string, files []string, uploaded []bool) {
+	xmlById := make(map[string]string, len(ids))
+	status := make([]PolicySuiteUpload, len(ids))
+	for i, id := range ids {
+		xmlById[id] = policies[i]
+		status[i] = PolicySuiteUpload{
+			File:     types.StringValue(files[i]),
+			PolicyId: types.StringValue(id),
+			Uploaded: types.BoolValue(uploaded[i]),
+		}
+	}
+	m.ID = types.StringValue(strings.Join(ids, ","))
+	m.PolicyIds, _ = types.ListValueFrom(context.Background(), types.StringType, ids)
+	m.XML, _ = types.MapValueFrom(context.Background(), types.StringType, xmlById)
+	m.UploadStatus, _ = types.ListValueFrom(context.Background(), policySuiteUploadType, status)
+}
+
+// uploadedPolicies returns the stored XML of every policy recorded as
+// uploaded. State written before upload_status existed counts every policy
+// as uploaded.
+func (m PolicySuiteModel) uploadedPolicies(ctx context.Context) map[string]string {
+	stored := make(map[string]string, len(m.XML.Elements()))
+	m.XML.ElementsAs(ctx, &stored, false)
+	if m.UploadStatus.IsNull() || m.UploadStatus.IsUnknown() {
+		return stored
+	}
+	var status []PolicySuiteUpload
+	m.UploadStatus.ElementsAs(ctx, &status, false)
+	uploaded := make(map[string]string, len(status))
+	for _, s := range status {
+		if s.Uploaded.ValueBool() {
+			id := s.PolicyId.ValueString()
+			uploaded[id] = stored[id]
+		}
+	}
+	return uploaded
+}
+
+// pendingUploads returns whether any policy in the state still has to be
+// uploaded
+func (m PolicySuiteModel) pendingUploads(ctx context.Context) bool {
+	var status []PolicySuiteUpload
+	m.UploadStatus.ElementsAs(ctx, &status, false)
+	for _, s := range status {
+		if !s.Uploaded.ValueBool() {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadSuite uploads the policies that differ from uploaded, the previously
+// uploaded XML keyed by Policy ID, and returns whether each policy is
+// uploaded afterwards
+func (r *PolicySuiteResource) uploadSuite(ctx context.Context, policies []string, ids []string, uploaded map[string]string) ([]bool, error) {
+	done := make([]bool, len(ids))
+	var pending []int
+	var pendingXml []string
+	for i, id := range ids {
+		if xml, ok := uploaded[id]; ok && xml == policies[i] {
+			done[i] = true
+			continue
+		}
+		pending = append(pending, i)
+		pendingXml = append(pendingXml, policies[i])
+	}
+	if len(pending) == 0 {
+		return done, nil
+	}
+	tflog.Debug(ctx, "Uploading policy suite", map[string]any{
+		"pending": len(pending),
+		"skipped": len(ids) - len(pending),
+	})
+
+	requests := newPolicyBatch(pendingXml)
+	result, err := r.client.doGraphBatch(ctx, requests)
+	succeeded := batchSucceeded(result)
+	for j, i := range pending {
+		done[i] = succeeded[requests[j].Id]
+	}
+	return done, err
+}
+
+func (r *PolicySuiteResource) ModifyPlan(
+	ctx context.Context,
+	req resource.ModifyPlanRequest,
+	resp *resource.ModifyPlanResponse,
+) {
+	if req.State.Raw.IsNull() || req.Plan.Raw.IsNull() {
+		return
+	}
+
+	var state PolicySuiteModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Policies left over from a failed upload, or changed since, force an
+	// update even when the configuration is unchanged
+	if !state.pendingUploads(ctx) {
+		return
+	}
+	resp.Diagnostics.Append(resp.Plan.SetAttribute(ctx, path.Root("upload_status"), types.ListUnknown(policySuiteUploadType))...)
+	resp.Diagnostics.Append(resp.Plan.SetAttribute(ctx, path.Root("xml"), types.MapUnknown(types.StringType))...)
+}
+
+func (r *PolicySuiteResource) Create(
+	ctx context.Context,
+	req resource.CreateRequest,
+	resp *resource.CreateResponse,
+) {
+	ctx, throttled := withThrottleStats(ctx)
+	defer throttled.warn(&resp.Diagnostics)
+
+	if r.client.refuseWrite(&resp.Diagnostics) {
+		return
+	}
+
+	var data PolicySuiteModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	policies, ids, files, err := r.render(ctx, data)
+	if err != nil {
+		resp.Diagnostics.AddAttributeError(data.sourcePath(), errorSummary("Invalid config", err), err.Error())
+		return
+	}
+
+	for _, policyXml := range policies {
+		if err := checkPolicyPrefix(policyXml, data.PolicyIdPrefix); err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("policy_id_prefix"), errorSummary("Invalid policy ID", err), err.Error())
+			return
+		}
+	}
+
+	uploaded, err := r.uploadSuite(ctx, policies, ids, nil)
+	data.setComputed(policies, ids, files, uploaded)
+	if err != nil {
+		// Keep the policies that were uploaded in state so they are not
+		// orphaned in the tenant
+		if slices.Contains(uploaded, true) {
+			resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+		}
+		addErrorDiagnostic(&resp.Diagnostics, "Error uploading policy suite", fmt.Errorf("Error creating policy suite!\n %w", err))
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	tflog.Debug(ctx, "Create policy suite complete!", map[string]any{
+		"ID": data.ID.ValueString(),
+	})
+}
+
+func (r *PolicySuiteResource) Read(
+	ctx context.Context,
+	req resource.ReadRequest,
+	resp *resource.ReadResponse,
+) {
+	ctx, throttled := withThrottleStats(ctx)
+	defer throttled.warn(&resp.Diagnostics)
+
+	var data PolicySuiteModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	policies, ids, files, err := r.render(ctx, data)
+	if err != nil {
+		resp.Diagnostics.AddAttributeError(data.sourcePath(), errorSummary("Invalid config", err), err.Error())
+		return
+	}
+
+	// Policies changed locally or missing from the tenant are marked for
+	// upload, the rest of the suite is left alone
+	previous := data.uploadedPolicies(ctx)
+	stored := make(map[string]string, len(data.XML.Elements()))
+	resp.Diagnostics.Append(data.XML.ElementsAs(ctx, &stored, false)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	uploaded := make([]bool, len(ids))
+	for i, id := range ids {
+		if xml, ok := previous[id]; !ok || xml != policies[i] {
+			continue
+		}
+		gr, err := r.client.readGraphXML(ctx, "/trustFramework/policies/%s/$value", id)
+		uploaded[i] = err == nil && gr.StatusCode == http.StatusOK
+	}
+
+	// xml keeps what was last uploaded so an unchanged suite shows no diff
+	data.setComputed(policies, ids, files, uploaded)
+	data.XML, _ = types.MapValueFrom(ctx, types.StringType, stored)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	tflog.Debug(ctx, "Policy suite READ complete")
+}
+
+func (r *PolicySuiteResource) Update(
+	ctx context.Context,
+	req resource.UpdateRequest,
+	resp *resource.UpdateResponse,
+) {
+	ctx, throttled := withThrottleStats(ctx)
+	defer throttled.warn(&resp.Diagnostics)
+
+	if r.client.refuseWrite(&resp.Diagnostics) {
+		return
+	}
+
+	var data PolicySuiteModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	policies, ids, files, err := r.render(ctx, data)
+	if err != nil {
+		resp.Diagnostics.AddAttributeError(data.sourcePath(), errorSummary("Invalid config", err), err.Error())
+		return
+	}
+
+	for _, policyXml := range policies {
+		if err := checkPolicyPrefix(policyXml, data.PolicyIdPrefix); err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("policy_id_prefix"), errorSummary("Invalid policy ID", err), err.Error())
+			return
+		}
+	}
+
+	var state PolicySuiteModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	uploaded, err := r.uploadSuite(ctx, policies, ids, state.uploadedPolicies(ctx))
+	data.setComputed(policies, ids, files, uploaded)
+	if err != nil {
+		// Keep the partial upload in state so the next apply resumes it
+		resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+		addErrorDiagnostic(&resp.Diagnostics, "Error uploading policy suite", fmt.Errorf("Error updating policy suite!\n %w", err))
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	tflog.Debug(ctx, "Update policy suite complete!", map[string]any{
+		"ID": data.ID.ValueString(),
+	})
+}
+
+func (r *PolicySuiteResource) Delete(
+	ctx context.Context,
+	req resource.DeleteRequest,
+	resp *resource.DeleteResponse,
+) {
+	ctx, throttled := withThrottleStats(ctx)
+	defer throttled.warn(&resp.Diagnostics)
+
+	if r.client.refuseWrite(&resp.Diagnostics) {
+		return
+	}
+
+	var data PolicySuiteModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	var ids []string
+	resp.Diagnostics.Append(data.PolicyIds.ElementsAs(ctx, &ids, false)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// Delete leaf policies before the base policies they inherit from
+	for i := len(ids) - 1; i >= 0; i-- {
+		deleteURL := r.client.endpoint("/trustFramework/policies/%s", ids[i])
+		gr, err := r.client.doGraphXML(ctx, "DELETE", deleteURL, nil)
+		if err != nil {
+			addErrorDiagnostic(&resp.Diagnostics, "Error deleting ief policy", fmt.Errorf("Error deleting policy %s!\n %w", ids[i], err))
+			return
+		}
+		if err := r.client.expectStatus(gr, http.StatusNoContent, http.StatusNotFound); err != nil {
+			addErrorDiagnostic(&resp.Diagnostics, "Error deleting ief policy", err)
+			return
+		}
+	}
+
+	tflog.Debug(ctx, "Policy suite DELETE complete")
+}
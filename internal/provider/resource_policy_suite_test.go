@@ -0,0 +1,282 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	fwresource "github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+)
+
+func testPolicyXml(id, base string) string {
+	if base == "" {
+		return fmt.Sprintf(`<TrustFrameworkPolicy PolicyId="%s"/>`, id)
+	}
+	return fmt.Sprintf(`<TrustFrameworkPolicy PolicyId="%s"><BasePolicy><PolicyId>%s</PolicyId></BasePolicy></TrustFrameworkPolicy>`, id, base)
+}
+
+func TestOrderByBase(t *testing.T) {
+	ids := []string{"B2C_1A_SignUp", "B2C_1A_Extensions", "B2C_1A_Base", "B2C_1A_Localization"}
+	policies := []string{
+		testPolicyXml("B2C_1A_SignUp", "B2C_1A_Extensions"),
+		testPolicyXml("B2C_1A_Extensions", "B2C_1A_Localization"),
+		testPolicyXml("B2C_1A_Base", ""),
+		testPolicyXml("B2C_1A_Localization", "B2C_1A_Base"),
+	}
+
+	_, got, err := orderByBase(policies, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "B2C_1A_Base,B2C_1A_Localization,B2C_1A_Extensions,B2C_1A_SignUp"
+	if strings.Join(got, ",") != want {
+		t.Errorf("orderByBase() = %v, want %s", got, want)
+	}
+
+	_, _, err = orderByBase(
+		[]string{testPolicyXml("B2C_1A_A", "B2C_1A_B"), testPolicyXml("B2C_1A_B", "B2C_1A_A")},
+		[]string{"B2C_1A_A", "B2C_1A_B"},
+	)
+	if err == nil {
+		t.Errorf("orderByBase() expected an error for circular references")
+	}
+}
+
+func TestRenderPolicySuiteGlob(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a_signup.xml", testPolicyXml("B2C_1A_SignUp", "B2C_1A_Base"))
+	write("b_base.xml", `<TrustFrameworkPolicy PolicyId="B2C_1A_Base" Tenant="{settings:tenant}"/>`)
+
+	settings, _ := types.MapValueFrom(context.Background(), types.StringType, map[string]string{"tenant": "contoso"})
+	data := PolicySuiteModel{
+		Glob:        types.StringValue(filepath.Join(dir, "*.xml")),
+		AppSettings: settings,
+	}
+	policies, ids, files, err := renderPolicySuite(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ids, ",") != "B2C_1A_Base,B2C_1A_SignUp" {
+		t.Errorf("Unexpected upload order: %v", ids)
+	}
+	if filepath.Base(files[0]) != "b_base.xml" {
+		t.Errorf("files = %v, want them in upload order", files)
+	}
+	if !strings.Contains(policies[0], `Tenant="contoso"`) {
+		t.Errorf("Shared app_settings were not injected: %s", policies[0])
+	}
+
+	write("c_duplicate.xml", testPolicyXml("B2C_1A_Base", ""))
+	if _, _, _, err := renderPolicySuite(context.Background(), data); err == nil {
+		t.Errorf("Expected an error for a duplicate PolicyId")
+	}
+
+	data.Glob = types.StringValue(filepath.Join(dir, "*.json"))
+	if _, _, _, err := renderPolicySuite(context.Background(), data); err == nil {
+		t.Errorf("Expected an error for a glob matching no files")
+	}
+}
+
+// batchRecorder records the requests of every $batch call
+type batchRecorder struct {
+	*fakeGraph
+	batches [][]batchRequest
+}
+
+func (b *batchRecorder) doGraph(ctx context.Context, method, url string, body any) (*http.Response, error) {
+	if m, ok := body.(map[string]any); ok {
+		if requests, ok := m["requests"].([]batchRequest); ok {
+			b.batches = append(b.batches, requests)
+		}
+	}
+	return b.fakeGraph.doGraph(ctx, method, url, body)
+}
+
+func TestPolicySuiteResumeUpdate(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	baseFile := write("base.xml", testPolicyXml("B2C_1A_Base", ""))
+	signUpFile := write("signup.xml", testPolicyXml("B2C_1A_SignUp", "B2C_1A_Base"))
+
+	fake := &fakeGraph{responses: map[string]fakeResponse{
+		"POST /$batch": {http.StatusOK, `{"responses":[{"id":"1","status":200},{"id":"2","status":400,"body":{"error":"invalid policy"}}]}`},
+	}}
+	recorder := &batchRecorder{fakeGraph: fake}
+	client := newFakeGraphClient(fake)
+	client.doer = recorder
+	r := &PolicySuiteResource{client: client}
+
+	config := PolicySuiteModel{
+		Policies: []PolicySuiteEntry{
+			{File: types.StringValue(baseFile), AppSettings: types.MapNull(types.StringType)},
+			{File: types.StringValue(signUpFile), AppSettings: types.MapNull(types.StringType)},
+		},
+		ID:             types.StringUnknown(),
+		PolicyIds:      types.ListUnknown(types.StringType),
+		XML:            types.MapUnknown(types.StringType),
+		UploadStatus:   types.ListUnknown(policySuiteUploadType),
+		PolicyIdPrefix: types.StringNull(),
+		Glob:           types.StringNull(),
+		AppSettings:    types.MapNull(types.StringType),
+	}
+	ids := []string{"B2C_1A_Base", "B2C_1A_SignUp"}
+	files := []string{baseFile, signUpFile}
+	prior := config
+	prior.setComputed([]string{`<TrustFrameworkPolicy PolicyId="B2C_1A_Base" Old="1"/>`, `<TrustFrameworkPolicy PolicyId="B2C_1A_SignUp" Old="1"/>`}, ids, files, []bool{true, true})
+
+	newState := func(m PolicySuiteModel) tfsdk.State {
+		state := testResourceState(t, r, nil)
+		if diags := state.Set(ctx, &m); diags.HasError() {
+			t.Fatalf("setting state: %v", diags)
+		}
+		return state
+	}
+	update := func(state tfsdk.State, plan tfsdk.Plan) *fwresource.UpdateResponse {
+		configState := newState(config)
+		resp := &fwresource.UpdateResponse{State: state}
+		r.Update(ctx, fwresource.UpdateRequest{
+			Config: tfsdk.Config{Schema: configState.Schema, Raw: configState.Raw},
+			Plan:   plan,
+			State:  state,
+		}, resp)
+		return resp
+	}
+	uploadStatus := func(state tfsdk.State) []bool {
+		var m PolicySuiteModel
+		state.Get(ctx, &m)
+		var status []PolicySuiteUpload
+		m.UploadStatus.ElementsAs(ctx, &status, false)
+		got := make([]bool, len(status))
+		for i, s := range status {
+			got[i] = s.Uploaded.ValueBool()
+		}
+		return got
+	}
+
+	// Both policies changed, only the base policy uploads
+	configPlan := newState(config)
+	resp := update(newState(prior), tfsdk.Plan{Schema: configPlan.Schema, Raw: configPlan.Raw})
+	if !resp.Diagnostics.HasError() {
+		t.Fatalf("Update() expected an error for the failed upload")
+	}
+	if got := uploadStatus(resp.State); fmt.Sprint(got) != "[true false]" {
+		t.Fatalf("upload_status after failure = %v, want [true false]", got)
+	}
+
+	// The leftover policy forces an update even without config changes
+	partial := resp.State
+	planResp := &fwresource.ModifyPlanResponse{Plan: tfsdk.Plan{Schema: partial.Schema, Raw: partial.Raw}}
+	r.ModifyPlan(ctx, fwresource.ModifyPlanRequest{State: partial, Plan: planResp.Plan}, planResp)
+	var planned types.List
+	planResp.Plan.GetAttribute(ctx, path.Root("upload_status"), &planned)
+	if !planned.IsUnknown() {
+		t.Errorf("planned upload_status = %s, want unknown", planned)
+	}
+
+	fake.responses["POST /$batch"] = fakeResponse{http.StatusOK, `{"responses":[{"id":"1","status":200}]}`}
+	resp = update(partial, planResp.Plan)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("Update() unexpected error: %v", resp.Diagnostics)
+	}
+	if got := uploadStatus(resp.State); fmt.Sprint(got) != "[true true]" {
+		t.Errorf("upload_status after resume = %v, want [true true]", got)
+	}
+	last := recorder.batches[len(recorder.batches)-1]
+	if len(last) != 1 || last[0].URL != "/trustFramework/policies/B2C_1A_SignUp/$value" {
+		t.Errorf("resumed batch = %+v, want only B2C_1A_SignUp", last)
+	}
+
+	// A create that fails midway keeps the uploaded policies in state
+	create := func() *fwresource.CreateResponse {
+		configState := newState(config)
+		resp := &fwresource.CreateResponse{State: testResourceState(t, r, nil)}
+		r.Create(ctx, fwresource.CreateRequest{
+			Config: tfsdk.Config{Schema: configState.Schema, Raw: configState.Raw},
+			Plan:   tfsdk.Plan{Schema: configState.Schema, Raw: configState.Raw},
+		}, resp)
+		return resp
+	}
+	fake.responses["POST /$batch"] = fakeResponse{http.StatusOK, `{"responses":[{"id":"1","status":200},{"id":"2","status":400,"body":{"error":"invalid policy"}}]}`}
+	created := create()
+	if !created.Diagnostics.HasError() {
+		t.Fatalf("Create() expected an error for the failed upload")
+	}
+	if got := uploadStatus(created.State); fmt.Sprint(got) != "[true false]" {
+		t.Errorf("upload_status after failed create = %v, want [true false]", got)
+	}
+
+	fake.responses["POST /$batch"] = fakeResponse{http.StatusOK, `{"responses":[{"id":"1","status":400,"body":{"error":"invalid policy"}}]}`}
+	created = create()
+	if !created.Diagnostics.HasError() {
+		t.Fatalf("Create() expected an error for the failed upload")
+	}
+	if got := uploadStatus(created.State); len(got) != 0 {
+		t.Errorf("upload_status after create uploaded nothing = %v, want no state", got)
+	}
+}
+
+func TestAccPolicySuite_Basic(t *testing.T) {
+	resourceName := "azure_b2c_ief_policy_suite.test_suite"
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(t),
+		CheckDestroy:             testAccCheckResourceDestroy("azure_b2c_ief_policy_suite"),
+		Steps: []resource.TestStep{
+			{
+				Config: testAccPolicySuiteConfig_basic(),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(resourceName, "policy_ids.#", "2"),
+					resource.TestCheckResourceAttr(resourceName, "policy_ids.0", "B2C_1A_TestBasic"),
+					resource.TestCheckResourceAttr(resourceName, "policy_ids.1", "B2C_1A_TestAppSettings"),
+					resource.TestCheckResourceAttr(resourceName, "id", "B2C_1A_TestBasic,B2C_1A_TestAppSettings"),
+					resource.TestCheckResourceAttrSet(resourceName, "xml.B2C_1A_TestBasic"),
+				),
+			},
+		},
+	})
+}
+
+func testAccPolicySuiteConfig_basic() string {
+	return `
+resource "azure_b2c_ief_policy_suite" "test_suite" {
+  policies = [
+    {
+      file = "basic_policy.xml"
+      app_settings = {
+        CLIENT_ID = "test-client-id"
+        APP_NAME  = "Test App"
+        TENANT_ID = "test-tenant-id"
+      }
+    },
+    {
+      file = "policy_with_app_settings.xml"
+      app_settings = {
+        CLIENT_ID = "test-client-id"
+        TENANT_ID = "test-tenant-id"
+      }
+    },
+  ]
+}
+`
+}
@@ -2,13 +2,23 @@ package provider
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/xml"
 	"fmt"
 	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	fwresource "github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
 	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
 	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
 	"github.com/hashicorp/terraform-plugin-testing/terraform"
 )
@@ -79,15 +89,102 @@ func TestInjectAppSettings(t *testing.T) {
 	}
 }
 
+func TestDecodePolicyFile(t *testing.T) {
+	policy := `<TrustFrameworkPolicy PolicyId="B2C_1A_TEST"><BasePolicy/></TrustFrameworkPolicy>`
+	tests := []struct {
+		name     string
+		raw      string
+		encoding types.String
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "plain file is unchanged",
+			raw:      policy,
+			encoding: types.StringNull(),
+			expected: policy,
+		},
+		{
+			name:     "base64 file is decoded",
+			raw:      base64.StdEncoding.EncodeToString([]byte(policy)) + "\n",
+			encoding: types.StringValue("base64"),
+			expected: policy,
+		},
+		{
+			name:     "invalid base64",
+			raw:      "not base64!",
+			encoding: types.StringValue("base64"),
+			wantErr:  true,
+		},
+		{
+			name:     "decoded content is not XML",
+			raw:      base64.StdEncoding.EncodeToString([]byte("<TrustFrameworkPolicy>")),
+			encoding: types.StringValue("base64"),
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodePolicyFile([]byte(tt.raw), tt.encoding)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("decodePolicyFile() expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodePolicyFile() unexpected error: %s", err)
+			}
+			if got != tt.expected {
+				t.Errorf("decodePolicyFile() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCheckPolicyPrefix(t *testing.T) {
+	withBase := func(id, base string) string {
+		return fmt.Sprintf(`<TrustFrameworkPolicy xmlns="http://schemas.microsoft.com/online/cpim/schemas/2013/06" PolicyId="%s">
+  <BasePolicy>
+    <TenantId>contoso.onmicrosoft.com</TenantId>
+    <PolicyId> %s </PolicyId>
+  </BasePolicy>
+</TrustFrameworkPolicy>`, id, base)
+	}
+	tests := []struct {
+		name    string
+		xml     string
+		prefix  types.String
+		wantErr bool
+	}{
+		{"default prefix ok", withBase("B2C_1A_SignUp", "B2C_1A_TrustFrameworkExtensions"), types.StringNull(), false},
+		{"base missing prefix", withBase("B2C_1A_SignUp", "TrustFrameworkExtensions"), types.StringNull(), true},
+		{"policy missing prefix", `<TrustFrameworkPolicy PolicyId="SignUp"/>`, types.StringNull(), true},
+		{"no base policy", `<TrustFrameworkPolicy PolicyId="B2C_1A_TrustFrameworkBase"/>`, types.StringNull(), false},
+		{"custom prefix", withBase("B2C_1A_DEV_SignUp", "B2C_1A_TrustFrameworkExtensions"), types.StringValue("B2C_1A_DEV_"), true},
+		{"check disabled", withBase("SignUp", "Base"), types.StringValue(""), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPolicyPrefix(tt.xml, tt.prefix)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkPolicyPrefix() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 // Acceptance Tests
 
 func TestAccPolicy_BasicCreate(t *testing.T) {
 	resourceName := "azure_b2c_ief_policy.test_basic"
-	rName := fmt.Sprintf("acc-basic-policy-%d", getTimestamp())
+	rName := fmt.Sprintf("acc-basic-policy-%d", getTimestamp(t))
 
 	resource.Test(t, resource.TestCase{
 		PreCheck:                 func() { testAccPreCheck(t) },
-		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(),
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(t),
 		CheckDestroy:             testAccCheckPolicyDestroy,
 		Steps: []resource.TestStep{
 			{
@@ -96,6 +193,7 @@ func TestAccPolicy_BasicCreate(t *testing.T) {
 					testAccCheckPolicyExists(resourceName),
 					resource.TestCheckResourceAttr(resourceName, "file", "basic_policy.xml"),
 					resource.TestCheckResourceAttr(resourceName, "publish", "true"),
+					resource.TestCheckResourceAttr(resourceName, "is_published", "true"),
 					resource.TestCheckResourceAttrSet(resourceName, "id"),
 					resource.TestCheckResourceAttrSet(resourceName, "xml"),
 				),
@@ -106,11 +204,11 @@ func TestAccPolicy_BasicCreate(t *testing.T) {
 
 func TestAccPolicy_WithAppSettings(t *testing.T) {
 	resourceName := "azure_b2c_ief_policy.test_settings"
-	rName := fmt.Sprintf("acc-settings-policy-%d", getTimestamp())
+	rName := fmt.Sprintf("acc-settings-policy-%d", getTimestamp(t))
 
 	resource.Test(t, resource.TestCase{
 		PreCheck:                 func() { testAccPreCheck(t) },
-		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(),
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(t),
 		CheckDestroy:             testAccCheckPolicyDestroy,
 		Steps: []resource.TestStep{
 			{
@@ -134,11 +232,11 @@ func TestAccPolicy_WithAppSettings(t *testing.T) {
 
 func TestAccPolicy_Update(t *testing.T) {
 	resourceName := "azure_b2c_ief_policy.test_update"
-	rName := fmt.Sprintf("acc-update-policy-%d", getTimestamp())
+	rName := fmt.Sprintf("acc-update-policy-%d", getTimestamp(t))
 
 	resource.Test(t, resource.TestCase{
 		PreCheck:                 func() { testAccPreCheck(t) },
-		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(),
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(t),
 		CheckDestroy:             testAccCheckPolicyDestroy,
 		Steps: []resource.TestStep{
 			{
@@ -153,6 +251,8 @@ func TestAccPolicy_Update(t *testing.T) {
 				Check: resource.ComposeTestCheckFunc(
 					testAccCheckPolicyExists(resourceName),
 					resource.TestCheckResourceAttr(resourceName, "publish", "false"),
+					// Turning publish off does not remove the policy from the tenant
+					resource.TestCheckResourceAttr(resourceName, "is_published", "true"),
 					resource.TestCheckResourceAttr(resourceName, "app_settings.CLIENT_ID", "updated-client-id"),
 				),
 			},
@@ -162,11 +262,11 @@ func TestAccPolicy_Update(t *testing.T) {
 
 func TestAccPolicy_XmlGeneration(t *testing.T) {
 	resourceName := "azure_b2c_ief_policy.test_xml"
-	rName := fmt.Sprintf("acc-xml-policy-%d", getTimestamp())
+	rName := fmt.Sprintf("acc-xml-policy-%d", getTimestamp(t))
 
 	resource.Test(t, resource.TestCase{
 		PreCheck:                 func() { testAccPreCheck(t) },
-		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(),
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(t),
 		CheckDestroy:             testAccCheckPolicyDestroy,
 		Steps: []resource.TestStep{
 			{
@@ -185,11 +285,11 @@ func TestAccPolicy_XmlGeneration(t *testing.T) {
 
 func TestAccPolicy_AppSettingsInjection(t *testing.T) {
 	resourceName := "azure_b2c_ief_policy.test_injection"
-	rName := fmt.Sprintf("acc-injection-policy-%d", getTimestamp())
+	rName := fmt.Sprintf("acc-injection-policy-%d", getTimestamp(t))
 
 	resource.Test(t, resource.TestCase{
 		PreCheck:                 func() { testAccPreCheck(t) },
-		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(),
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(t),
 		CheckDestroy:             testAccCheckPolicyDestroy,
 		Steps: []resource.TestStep{
 			{
@@ -209,11 +309,11 @@ func TestAccPolicy_AppSettingsInjection(t *testing.T) {
 
 func TestAccPolicy_Import(t *testing.T) {
 	resourceName := "azure_b2c_ief_policy.test_import"
-	rName := fmt.Sprintf("acc-import-policy-%d", getTimestamp())
+	rName := fmt.Sprintf("acc-import-policy-%d", getTimestamp(t))
 
 	resource.Test(t, resource.TestCase{
 		PreCheck:                 func() { testAccPreCheck(t) },
-		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(),
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(t),
 		CheckDestroy:             testAccCheckPolicyDestroy,
 		Steps: []resource.TestStep{
 			{
@@ -234,6 +334,86 @@ func TestAccPolicy_Import(t *testing.T) {
 	})
 }
 
+func TestAccPolicy_ReferencesPolicyKey(t *testing.T) {
+	resourceName := "azure_b2c_ief_policy.test_key_ref"
+	keyResourceName := "azure_b2c_ief_policy_key.test_key_ref"
+	rName := fmt.Sprintf("acc-key-ref-%d", getTimestamp(t))
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(t),
+		CheckDestroy:             testAccCheckPolicyDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccPolicyConfig_withKeyReference(rName),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckPolicyKeyExists(keyResourceName),
+					testAccCheckPolicyExists(resourceName),
+					resource.TestCheckResourceAttrPair(resourceName, "app_settings.CLIENT_ID", keyResourceName, "id"),
+					resource.TestCheckResourceAttrPair(resourceName, "app_settings.APP_NAME", keyResourceName, "name"),
+					testAccCheckPolicyXmlNotContains(resourceName, "{settings:CLIENT_ID}"),
+				),
+			},
+			{
+				// Re-applying the same config must not produce a diff from the key's id
+				Config:   testAccPolicyConfig_withKeyReference(rName),
+				PlanOnly: true,
+			},
+		},
+	})
+}
+
+func TestAccPolicy_PreferRemote(t *testing.T) {
+	resourceName := "azure_b2c_ief_policy.test_prefer_remote"
+	rName := fmt.Sprintf("acc-prefer-remote-%d", getTimestamp(t))
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(t),
+		CheckDestroy:             testAccCheckPolicyDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccPolicyConfig_preferRemote(rName),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckPolicyExists(resourceName),
+					resource.TestCheckResourceAttr(resourceName, "prefer_remote", "true"),
+					resource.TestCheckResourceAttrSet(resourceName, "xml"),
+				),
+			},
+			{
+				// Refreshing with prefer_remote keeps the resource instead of recreating it
+				Config:   testAccPolicyConfig_preferRemote(rName),
+				PlanOnly: true,
+			},
+		},
+	})
+}
+
+func TestAccPolicy_ReadFromRemoteOnly(t *testing.T) {
+	resourceName := "azure_b2c_ief_policy.test_remote_only"
+	rName := fmt.Sprintf("acc-remote-only-%d", getTimestamp(t))
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories(t),
+		CheckDestroy:             testAccCheckPolicyDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccPolicyConfig_readFromRemoteOnly(rName),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckPolicyExists(resourceName),
+					resource.TestCheckResourceAttr(resourceName, "read_from_remote_only", "true"),
+				),
+			},
+			{
+				// Refreshing without reading the file keeps the resource when the tenant matches state
+				Config:   testAccPolicyConfig_readFromRemoteOnly(rName),
+				PlanOnly: true,
+			},
+		},
+	})
+}
+
 // Test configuration functions
 
 func testAccPolicyConfig_basic(rName string) string {
@@ -278,6 +458,67 @@ resource "azure_b2c_ief_policy" "test_settings" {
 `)
 }
 
+func testAccPolicyConfig_withKeyReference(rName string) string {
+	return fmt.Sprintf(`
+# Test configuration for a policy referencing a policy key container
+resource "azure_b2c_ief_policy_key" "test_key_ref" {
+  name  = "%s"
+  usage = "sig"
+  generate {
+    type = "RSA"
+  }
+}
+
+resource "azure_b2c_ief_policy" "test_key_ref" {
+  file = "basic_policy.xml"
+
+  app_settings = {
+    CLIENT_ID = azure_b2c_ief_policy_key.test_key_ref.id
+    APP_NAME  = azure_b2c_ief_policy_key.test_key_ref.name
+    TENANT_ID = "test-tenant-id"
+  }
+
+  publish = false
+}
+`, rName)
+}
+
+func testAccPolicyConfig_preferRemote(rName string) string {
+	return fmt.Sprintf(`
+# Test configuration for a policy refreshed from the tenant
+resource "azure_b2c_ief_policy" "test_prefer_remote" {
+  file = "basic_policy.xml"
+
+  app_settings = {
+    CLIENT_ID = "test-client-id"
+    APP_NAME  = "Test App"
+    TENANT_ID = "test-tenant-id"
+  }
+
+  publish       = true
+  prefer_remote = true
+}
+`)
+}
+
+func testAccPolicyConfig_readFromRemoteOnly(rName string) string {
+	return fmt.Sprintf(`
+# Test configuration for a policy refreshed without reading the local file
+resource "azure_b2c_ief_policy" "test_remote_only" {
+  file = "basic_policy.xml"
+
+  app_settings = {
+    CLIENT_ID = "test-client-id"
+    APP_NAME  = "Test App"
+    TENANT_ID = "test-tenant-id"
+  }
+
+  publish               = true
+  read_from_remote_only = true
+}
+`)
+}
+
 func testAccPolicyConfig_updated(rName string) string {
 	return fmt.Sprintf(`
 # Updated test configuration for policy
@@ -459,6 +700,36 @@ func FuzzInjectAppSettings(f *testing.F) {
 	})
 }
 
+func TestGetPolicyId(t *testing.T) {
+	tests := []struct {
+		name      string
+		xml       string
+		want      string
+		strictErr bool
+	}{
+		{name: "root", xml: `<?xml version="1.0"?><!-- c --><TrustFrameworkPolicy PolicyId="B2C_1A_A"/>`, want: "B2C_1A_A"},
+		{name: "wrapped", xml: `<Export><Meta PolicyId="x"/><TrustFrameworkPolicy PolicyId="B2C_1A_B"/></Export>`, want: "B2C_1A_B", strictErr: true},
+		{name: "other root", xml: `<RelyingParty PolicyId="B2C_1A_C"/>`, want: "B2C_1A_C", strictErr: true},
+		{name: "empty", xml: ``, want: "", strictErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getPolicyId(tt.xml); got != tt.want {
+				t.Errorf("getPolicyId() = %q, want %q", got, tt.want)
+			}
+			err := checkPolicyRoot(tt.xml)
+			if (err != nil) != tt.strictErr {
+				t.Errorf("checkPolicyRoot() error = %v, want error %v", err, tt.strictErr)
+			}
+		})
+	}
+
+	err := checkPolicyRoot(`<RelyingParty PolicyId="B2C_1A_C"/>`)
+	if err == nil || !strings.Contains(err.Error(), "root element is RelyingParty") {
+		t.Errorf("checkPolicyRoot() = %v, want the root element named", err)
+	}
+}
+
 func FuzzGetPolicyId(f *testing.F) {
 	// Seed corpus with initial test cases
 	f.Add([]byte("<?xml version=\"1.0\"?><TrustFrameworkPolicy PolicyId=\"B2C_1A_Test\"></TrustFrameworkPolicy>"))
@@ -519,3 +790,1105 @@ func FuzzPolicyValidation(f *testing.F) {
 		}
 	})
 }
+
+func TestPolicyReadFromRemoteOnly(t *testing.T) {
+	stored := `<TrustFrameworkPolicy PolicyId="B2C_1A_TEST"/>`
+	tests := []struct {
+		name          string
+		response      fakeResponse
+		wantRemoved   bool
+		wantError     bool
+		wantPublished bool
+	}{
+		{
+			name:          "remote matches state",
+			response:      fakeResponse{http.StatusOK, stored},
+			wantPublished: true,
+		},
+		{
+			name:        "remote drifted",
+			response:    fakeResponse{http.StatusOK, `<TrustFrameworkPolicy PolicyId="B2C_1A_TEST" changed="true"/>`},
+			wantRemoved: true,
+		},
+		{
+			name:        "policy missing",
+			response:    fakeResponse{http.StatusNotFound, `{}`},
+			wantRemoved: true,
+		},
+		{
+			name:      "graph error",
+			response:  fakeResponse{http.StatusForbidden, `{"error":{"code":"Authorization_RequestDenied"}}`},
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGraph{responses: map[string]fakeResponse{
+				"GET /trustFramework/policies/B2C_1A_TEST/$value": tt.response,
+			}}
+			r := &PolicyResource{client: newFakeGraphClient(fake)}
+			state := testResourceState(t, r, map[string]tftypes.Value{
+				"id":                    tftypes.NewValue(tftypes.String, "B2C_1A_TEST"),
+				"xml":                   tftypes.NewValue(tftypes.String, stored),
+				"file":                  tftypes.NewValue(tftypes.String, "does-not-exist.xml"),
+				"publish":               tftypes.NewValue(tftypes.Bool, true),
+				"read_from_remote_only": tftypes.NewValue(tftypes.Bool, true),
+			})
+			resp := &fwresource.ReadResponse{State: state}
+			r.Read(context.Background(), fwresource.ReadRequest{State: state}, resp)
+
+			if got := resp.Diagnostics.HasError(); got != tt.wantError {
+				t.Fatalf("HasError() = %v, want %v: %v", got, tt.wantError, resp.Diagnostics)
+			}
+			if got := resp.State.Raw.IsNull(); got != tt.wantRemoved {
+				t.Errorf("resource removed = %v, want %v", got, tt.wantRemoved)
+			}
+			if tt.wantRemoved || tt.wantError {
+				return
+			}
+			var published types.Bool
+			resp.State.GetAttribute(context.Background(), path.Root("is_published"), &published)
+			if published.ValueBool() != tt.wantPublished {
+				t.Errorf("is_published = %v, want %v", published, tt.wantPublished)
+			}
+		})
+	}
+}
+
+func TestPolicyDelete(t *testing.T) {
+	tests := []struct {
+		name      string
+		response  fakeResponse
+		wantError bool
+	}{
+		{
+			name:     "deleted",
+			response: fakeResponse{http.StatusNoContent, ``},
+		},
+		{
+			name:     "already deleted",
+			response: fakeResponse{http.StatusNotFound, `{"error":{"code":"ResourceNotFound"}}`},
+		},
+		{
+			name:     "already deleted with b2c code",
+			response: fakeResponse{http.StatusBadRequest, `{"error":{"code":"AADB2C90073","message":"Policy not found"}}`},
+		},
+		{
+			name:      "graph error",
+			response:  fakeResponse{http.StatusForbidden, `{"error":{"code":"Authorization_RequestDenied"}}`},
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGraph{responses: map[string]fakeResponse{
+				"DELETE /trustFramework/policies/B2C_1A_TEST": tt.response,
+			}}
+			r := &PolicyResource{client: newFakeGraphClient(fake)}
+			state := testResourceState(t, r, map[string]tftypes.Value{
+				"id":      tftypes.NewValue(tftypes.String, "B2C_1A_TEST"),
+				"file":    tftypes.NewValue(tftypes.String, "policy.xml"),
+				"publish": tftypes.NewValue(tftypes.Bool, true),
+			})
+			resp := &fwresource.DeleteResponse{State: state}
+			r.Delete(context.Background(), fwresource.DeleteRequest{State: state}, resp)
+
+			if got := resp.Diagnostics.HasError(); got != tt.wantError {
+				t.Fatalf("HasError() = %v, want %v: %v", got, tt.wantError, resp.Diagnostics)
+			}
+		})
+	}
+}
+
+func TestPolicyDeleteExactId(t *testing.T) {
+	tests := []struct {
+		name      string
+		id        string
+		xml       string
+		wantCalls []string
+	}{
+		{
+			name:      "matches the stored XML",
+			id:        "B2C_1A_SignUp_v2",
+			xml:       `<TrustFrameworkPolicy PolicyId="B2C_1A_SignUp_v2"/>`,
+			wantCalls: []string{"DELETE /trustFramework/policies/B2C_1A_SignUp_v2"},
+		},
+		{
+			name:      "no stored XML",
+			id:        "B2C_1A_SignUp_v2",
+			wantCalls: []string{"DELETE /trustFramework/policies/B2C_1A_SignUp_v2"},
+		},
+		{
+			name: "stored XML declares a sibling",
+			id:   "B2C_1A_SignUp",
+			xml:  `<TrustFrameworkPolicy PolicyId="B2C_1A_SignUp_v2"/>`,
+		},
+		{
+			name: "differs only in case",
+			id:   "B2C_1A_SIGNUP_V2",
+			xml:  `<TrustFrameworkPolicy PolicyId="B2C_1A_SignUp_v2"/>`,
+		},
+		{
+			name: "not a plain id",
+			id:   "B2C_1A_SignUp*",
+		},
+		{
+			name: "path in id",
+			id:   "B2C_1A_SignUp/../B2C_1A_Base",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGraph{responses: map[string]fakeResponse{
+				"DELETE /trustFramework/policies/" + tt.id: {http.StatusNoContent, ``},
+			}}
+			r := &PolicyResource{client: newFakeGraphClient(fake)}
+			xml := tftypes.NewValue(tftypes.String, nil)
+			if tt.xml != "" {
+				xml = tftypes.NewValue(tftypes.String, tt.xml)
+			}
+			state := testResourceState(t, r, map[string]tftypes.Value{
+				"id":      tftypes.NewValue(tftypes.String, tt.id),
+				"xml":     xml,
+				"file":    tftypes.NewValue(tftypes.String, "policy.xml"),
+				"publish": tftypes.NewValue(tftypes.Bool, true),
+			})
+			resp := &fwresource.DeleteResponse{State: state}
+			r.Delete(context.Background(), fwresource.DeleteRequest{State: state}, resp)
+
+			if got, want := resp.Diagnostics.HasError(), tt.wantCalls == nil; got != want {
+				t.Fatalf("HasError() = %v, want %v: %v", got, want, resp.Diagnostics)
+			}
+			if strings.Join(fake.calls, ",") != strings.Join(tt.wantCalls, ",") {
+				t.Errorf("calls = %v, want %v", fake.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestPolicyDeleteReadOnly(t *testing.T) {
+	fake := &fakeGraph{}
+	client := newFakeGraphClient(fake)
+	client.readOnly = true
+	r := &PolicyResource{client: client}
+	state := testResourceState(t, r, map[string]tftypes.Value{
+		"id":      tftypes.NewValue(tftypes.String, "B2C_1A_TEST"),
+		"file":    tftypes.NewValue(tftypes.String, "policy.xml"),
+		"publish": tftypes.NewValue(tftypes.Bool, true),
+	})
+	resp := &fwresource.DeleteResponse{State: state}
+	r.Delete(context.Background(), fwresource.DeleteRequest{State: state}, resp)
+
+	if !resp.Diagnostics.HasError() {
+		t.Errorf("expected a read-only error")
+	}
+	if len(fake.calls) != 0 {
+		t.Errorf("expected no Graph calls, got %v", fake.calls)
+	}
+}
+
+func TestPutPolicyStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		response   fakeResponse
+		wantStatus int
+		wantError  bool
+	}{
+		{name: "created", response: fakeResponse{http.StatusCreated, ``}, wantStatus: http.StatusCreated},
+		{name: "updated", response: fakeResponse{http.StatusOK, ``}, wantStatus: http.StatusOK},
+		{name: "updated without content", response: fakeResponse{http.StatusNoContent, ``}, wantStatus: http.StatusNoContent},
+		{name: "rejected", response: fakeResponse{http.StatusBadRequest, `{"error":{"code":"AADB2C"}}`}, wantStatus: http.StatusBadRequest, wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGraph{responses: map[string]fakeResponse{
+				"PUT /trustFramework/policies/B2C_1A_TEST/$value": tt.response,
+			}}
+			r := &PolicyResource{client: newFakeGraphClient(fake)}
+			status, _, err := r.putPolicy(context.Background(), `<TrustFrameworkPolicy PolicyId="B2C_1A_TEST"/>`)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("putPolicy() error = %v, wantError %v", err, tt.wantError)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestPolicyValidateConfigDuplicatePolicyId(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, policyId string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(testPolicyXml(policyId, "")), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	original := write("original.xml", "B2C_1A_DuplicateCheck")
+	copied := write("copied.xml", "B2C_1A_duplicatecheck")
+	other := write("other.xml", "B2C_1A_DuplicateCheckOther")
+
+	r := &PolicyResource{client: newFakeGraphClient(&fakeGraph{})}
+	validate := func(file string) int {
+		state := testResourceState(t, r, map[string]tftypes.Value{
+			"file":    tftypes.NewValue(tftypes.String, file),
+			"publish": tftypes.NewValue(tftypes.Bool, true),
+		})
+		resp := &fwresource.ValidateConfigResponse{}
+		r.ValidateConfig(context.Background(), fwresource.ValidateConfigRequest{
+			Config: tfsdk.Config{Schema: state.Schema, Raw: state.Raw},
+		}, resp)
+		if resp.Diagnostics.HasError() {
+			t.Fatalf("ValidateConfig() unexpected error: %v", resp.Diagnostics)
+		}
+		return resp.Diagnostics.WarningsCount()
+	}
+
+	if n := validate(original); n != 0 {
+		t.Errorf("first declaration: got %d warnings, want 0", n)
+	}
+	if n := validate(original); n != 0 {
+		t.Errorf("same file validated again: got %d warnings, want 0", n)
+	}
+	if n := validate(other); n != 0 {
+		t.Errorf("different PolicyId: got %d warnings, want 0", n)
+	}
+	if n := validate(copied); n != 1 {
+		t.Errorf("duplicate PolicyId: got %d warnings, want 1", n)
+	}
+
+	// Before the providers are configured, the aliases a policy belongs to
+	// are unknown, so nothing is compared
+	for _, alias := range []*PolicyResource{{}, {}} {
+		r = alias
+		if n := validate(filepath.Join(dir, "..", filepath.Base(dir), "copied.xml")); n != 0 {
+			t.Errorf("unconfigured provider: got %d warnings, want 0", n)
+		}
+		if n := validate(original); n != 0 {
+			t.Errorf("unconfigured provider: got %d warnings, want 0", n)
+		}
+	}
+}
+
+func TestPolicyRenderSkipInjection(t *testing.T) {
+	content := `<TrustFrameworkPolicy PolicyId="B2C_1A_TEST"><Item>{settings:tenant}</Item></TrustFrameworkPolicy>`
+	settings := map[string]types.String{"tenant": types.StringValue("contoso")}
+
+	injected := IEFPolicyModel{SkipInjection: types.BoolNull()}.render(context.Background(), content, settings)
+	if !strings.Contains(injected, "<Item>contoso</Item>") {
+		t.Errorf("expected the setting to be injected, got %s", injected)
+	}
+	verbatim := IEFPolicyModel{SkipInjection: types.BoolValue(true)}.render(context.Background(), content, settings)
+	if verbatim != content {
+		t.Errorf("expected the file verbatim, got %s", verbatim)
+	}
+}
+
+func TestPolicyValidateConfigSkipInjectionConflict(t *testing.T) {
+	r := &PolicyResource{}
+	state := testResourceState(t, r, map[string]tftypes.Value{
+		"publish":        tftypes.NewValue(tftypes.Bool, false),
+		"skip_injection": tftypes.NewValue(tftypes.Bool, true),
+		"app_settings": tftypes.NewValue(tftypes.Map{ElementType: tftypes.String}, map[string]tftypes.Value{
+			"tenant": tftypes.NewValue(tftypes.String, "contoso"),
+		}),
+	})
+	resp := &fwresource.ValidateConfigResponse{}
+	r.ValidateConfig(context.Background(), fwresource.ValidateConfigRequest{
+		Config: tfsdk.Config{Schema: state.Schema, Raw: state.Raw},
+	}, resp)
+	if !resp.Diagnostics.HasError() {
+		t.Errorf("expected app_settings to conflict with skip_injection")
+	}
+}
+
+func TestWithEnvironmentSettings(t *testing.T) {
+	byEnv, diags := types.MapValueFrom(context.Background(), types.MapType{ElemType: types.StringType}, map[string]map[string]string{
+		"default": {"tenant": "contoso", "api": "https://api.contoso.com"},
+		"dev":     {"api": "https://dev.contoso.com"},
+	})
+	if diags.HasError() {
+		t.Fatal(diags)
+	}
+
+	tests := []struct {
+		name        string
+		environment types.String
+		want        map[string]string
+		wantError   bool
+	}{
+		{
+			name:        "default only",
+			environment: types.StringNull(),
+			want:        map[string]string{"tenant": "contoso", "api": "https://api.contoso.com"},
+		},
+		{
+			name:        "environment merged over default",
+			environment: types.StringValue("dev"),
+			want:        map[string]string{"tenant": "contoso", "api": "https://dev.contoso.com"},
+		},
+		{
+			name:        "unknown environment",
+			environment: types.StringValue("prod"),
+			wantError:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := IEFPolicyModel{SettingsByEnv: byEnv, Environment: tt.environment}
+			got, err := data.withEnvironmentSettings(context.Background(), nil)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("withEnvironmentSettings() error = %v, wantError %v", err, tt.wantError)
+			}
+			if tt.wantError {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k].ValueString() != v {
+					t.Errorf("%s = %s, want %s", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestPolicyReadWithoutStoredXML(t *testing.T) {
+	stored := `<TrustFrameworkPolicy PolicyId="B2C_1A_TEST"/>`
+	tests := []struct {
+		name        string
+		remote      string
+		wantRemoved bool
+	}{
+		{name: "remote matches hash", remote: stored},
+		{name: "remote drifted", remote: `<TrustFrameworkPolicy PolicyId="B2C_1A_TEST" changed="true"/>`, wantRemoved: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGraph{responses: map[string]fakeResponse{
+				"GET /trustFramework/policies/B2C_1A_TEST/$value": {http.StatusOK, tt.remote},
+			}}
+			r := &PolicyResource{client: newFakeGraphClient(fake)}
+			state := testResourceState(t, r, map[string]tftypes.Value{
+				"id":                    tftypes.NewValue(tftypes.String, "B2C_1A_TEST"),
+				"xml_sha256":            tftypes.NewValue(tftypes.String, xmlChecksum(stored)),
+				"file":                  tftypes.NewValue(tftypes.String, "does-not-exist.xml"),
+				"publish":               tftypes.NewValue(tftypes.Bool, true),
+				"read_from_remote_only": tftypes.NewValue(tftypes.Bool, true),
+				"store_rendered_xml":    tftypes.NewValue(tftypes.Bool, false),
+			})
+			resp := &fwresource.ReadResponse{State: state}
+			r.Read(context.Background(), fwresource.ReadRequest{State: state}, resp)
+
+			if resp.Diagnostics.HasError() {
+				t.Fatalf("Read() unexpected error: %v", resp.Diagnostics)
+			}
+			if got := resp.State.Raw.IsNull(); got != tt.wantRemoved {
+				t.Fatalf("resource removed = %v, want %v", got, tt.wantRemoved)
+			}
+			if tt.wantRemoved {
+				return
+			}
+			var xml types.String
+			resp.State.GetAttribute(context.Background(), path.Root("xml"), &xml)
+			if !xml.IsNull() {
+				t.Errorf("xml = %s, want null when store_rendered_xml is false", xml)
+			}
+		})
+	}
+}
+
+func TestSetRendered(t *testing.T) {
+	policy := `<TrustFrameworkPolicy PolicyId="B2C_1A_TEST"/>`
+
+	stored := IEFPolicyModel{StoreRenderedXML: types.BoolNull()}
+	stored.setRendered(policy)
+	if stored.XML.ValueString() != policy || stored.XMLSha256.ValueString() != xmlChecksum(policy) {
+		t.Errorf("default: got xml %s, xml_sha256 %s", stored.XML, stored.XMLSha256)
+	}
+
+	hashed := IEFPolicyModel{StoreRenderedXML: types.BoolValue(false)}
+	hashed.setRendered(policy)
+	if !hashed.XML.IsNull() || hashed.XMLSha256.ValueString() != xmlChecksum(policy) {
+		t.Errorf("store_rendered_xml = false: got xml %s, xml_sha256 %s", hashed.XML, hashed.XMLSha256)
+	}
+	if !hashed.matchesRendered(policy) || hashed.matchesRendered(policy+" ") {
+		t.Errorf("matchesRendered() did not compare by checksum")
+	}
+}
+
+func TestWithManagedBy(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+		want string
+	}{
+		{
+			name: "comment inside the root element",
+			xml:  `<?xml version="1.0"?>` + "\n" + `<TrustFrameworkPolicy PolicyId="B2C_1A_TEST"><BasePolicy/></TrustFrameworkPolicy>`,
+			want: `<?xml version="1.0"?>` + "\n" + `<TrustFrameworkPolicy PolicyId="B2C_1A_TEST"><!-- managed_by: ws-prod --><BasePolicy/></TrustFrameworkPolicy>`,
+		},
+		{
+			name: "empty root element",
+			xml:  `<TrustFrameworkPolicy PolicyId="B2C_1A_TEST"/>`,
+			want: `<!-- managed_by: ws-prod --><TrustFrameworkPolicy PolicyId="B2C_1A_TEST"/>`,
+		},
+		{
+			name: "unparseable document",
+			xml:  `not xml`,
+			want: `not xml`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := withManagedBy(tt.xml, "ws-prod")
+			if got != tt.want {
+				t.Errorf("withManagedBy() = %s, want %s", got, tt.want)
+			}
+			if tt.xml != "not xml" && getPolicyId(got) != "B2C_1A_TEST" {
+				t.Errorf("PolicyId not found after adding the marker: %s", got)
+			}
+		})
+	}
+
+	for value, valid := range map[string]bool{"ws-prod": true, "team a/ws-1": true, "a--b": false, "trailing-": false} {
+		if managedByPattern.MatchString(value) != valid {
+			t.Errorf("managedByPattern.MatchString(%q) = %v, want %v", value, !valid, valid)
+		}
+	}
+}
+
+func TestWithTenantId(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+		want string
+	}{
+		{
+			name: "templated tenant",
+			xml:  `<?xml version="1.0"?>` + "\n" + `<TrustFrameworkPolicy TenantId="{settings:tenant}.onmicrosoft.com" PolicyId="B2C_1A_TEST"><BasePolicy><TenantId>other.onmicrosoft.com</TenantId></BasePolicy></TrustFrameworkPolicy>`,
+			want: `<?xml version="1.0"?>` + "\n" + `<TrustFrameworkPolicy TenantId="contoso.onmicrosoft.com" PolicyId="B2C_1A_TEST"><BasePolicy><TenantId>other.onmicrosoft.com</TenantId></BasePolicy></TrustFrameworkPolicy>`,
+		},
+		{
+			name: "single quotes and spacing",
+			xml:  "<TrustFrameworkPolicy\n  PolicyId=\"B2C_1A_TEST\"\n  TenantId = 'old.onmicrosoft.com'/>",
+			want: "<TrustFrameworkPolicy\n  PolicyId=\"B2C_1A_TEST\"\n  TenantId = \"contoso.onmicrosoft.com\"/>",
+		},
+		{
+			name: "no TenantId on the root element",
+			xml:  `<TrustFrameworkPolicy PolicyId="B2C_1A_TEST"><BasePolicy TenantId="old.onmicrosoft.com"/></TrustFrameworkPolicy>`,
+			want: `<TrustFrameworkPolicy PolicyId="B2C_1A_TEST"><BasePolicy TenantId="old.onmicrosoft.com"/></TrustFrameworkPolicy>`,
+		},
+		{
+			name: "unparseable document",
+			xml:  `not xml`,
+			want: `not xml`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withTenantId(tt.xml, "contoso.onmicrosoft.com"); got != tt.want {
+				t.Errorf("withTenantId() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	policyXml := `<TrustFrameworkPolicy TenantId="old.onmicrosoft.com" PolicyId="B2C_1A_TEST"/>`
+	c := &GraphClient{tenantId: "contoso.onmicrosoft.com"}
+	if got := c.withPolicyTenant(policyXml); got != policyXml {
+		t.Errorf("withPolicyTenant() rewrote TenantId without set_policy_tenant_id: %s", got)
+	}
+	c.setPolicyTenantId = true
+	if got := c.withPolicyTenant(policyXml); !strings.Contains(got, `TenantId="contoso.onmicrosoft.com"`) {
+		t.Errorf("withPolicyTenant() = %s, want the configured tenant", got)
+	}
+}
+
+func TestSetEffectiveSettings(t *testing.T) {
+	ctx := context.Background()
+	settings := map[string]types.String{
+		"tenant": types.StringValue("contoso"),
+		"secret": types.StringValue("hunter2"),
+	}
+	sensitive, _ := types.SetValueFrom(ctx, types.StringType, []string{"secret", "unused"})
+
+	data := IEFPolicyModel{SensitiveSettings: sensitive}
+	data.setEffectiveSettings(ctx, settings)
+	got := map[string]string{}
+	data.EffectiveSettings.ElementsAs(ctx, &got, false)
+	if len(got) != 2 || got["tenant"] != "contoso" || got["secret"] != redacted {
+		t.Errorf("effective_app_settings = %v, want tenant kept and secret redacted", got)
+	}
+
+	skipped := IEFPolicyModel{SkipInjection: types.BoolValue(true), SensitiveSettings: types.SetNull(types.StringType)}
+	skipped.setEffectiveSettings(ctx, settings)
+	if !skipped.EffectiveSettings.IsNull() {
+		t.Errorf("effective_app_settings = %s, want null with skip_injection", skipped.EffectiveSettings)
+	}
+}
+
+func TestWaitForPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		timeout   time.Duration
+		served    bool
+		wantCalls int
+		wantMore  bool
+	}{
+		{name: "disabled", timeout: 0, wantCalls: 0},
+		{name: "policy served", timeout: time.Second, served: true, wantCalls: 1},
+		// each attempt that misses reads v1.0 and then beta
+		{name: "policy never served", timeout: 30 * time.Millisecond, wantCalls: 4, wantMore: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGraph{responses: map[string]fakeResponse{}}
+			if tt.served {
+				fake.responses["GET /v1.0/trustFramework/policies/B2C_1A_Test/$value"] = fakeResponse{http.StatusOK, `<TrustFrameworkPolicy PolicyId="B2C_1A_Test"/>`}
+			}
+			client := newFakeGraphClient(fake)
+			client.publishPollTimeout = tt.timeout
+			client.publishPollInterval = 10 * time.Millisecond
+			r := &PolicyResource{client: client}
+
+			r.waitForPolicy(context.Background(), "B2C_1A_Test")
+			if tt.wantMore && len(fake.calls) < tt.wantCalls || !tt.wantMore && len(fake.calls) != tt.wantCalls {
+				t.Errorf("got %d policy reads, want %d (or more: %v): %v", len(fake.calls), tt.wantCalls, tt.wantMore, fake.calls)
+			}
+		})
+	}
+}
+
+func TestPolicyDisabled(t *testing.T) {
+	policy := `<TrustFrameworkPolicy PolicyId="B2C_1A_TEST"/>`
+	file := filepath.Join(t.TempDir(), "policy.xml")
+	if err := os.WriteFile(file, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeGraph{}
+	client := newFakeGraphClient(fake)
+	client.readOnly = true
+	r := &PolicyResource{client: client}
+	state := testResourceState(t, r, map[string]tftypes.Value{
+		"id":      tftypes.NewValue(tftypes.String, "B2C_1A_TEST"),
+		"xml":     tftypes.NewValue(tftypes.String, policy),
+		"file":    tftypes.NewValue(tftypes.String, file),
+		"publish": tftypes.NewValue(tftypes.Bool, true),
+		"enabled": tftypes.NewValue(tftypes.Bool, false),
+	})
+
+	readResp := &fwresource.ReadResponse{State: state}
+	r.Read(context.Background(), fwresource.ReadRequest{State: state}, readResp)
+	if readResp.Diagnostics.HasError() {
+		t.Fatalf("Read() unexpected error: %v", readResp.Diagnostics)
+	}
+	if readResp.State.Raw.IsNull() {
+		t.Errorf("Read() removed a disabled policy")
+	}
+
+	deleteResp := &fwresource.DeleteResponse{State: state}
+	r.Delete(context.Background(), fwresource.DeleteRequest{State: state}, deleteResp)
+	if deleteResp.Diagnostics.HasError() {
+		t.Fatalf("Delete() unexpected error: %v", deleteResp.Diagnostics)
+	}
+
+	if len(fake.calls) != 0 {
+		t.Errorf("expected no Graph calls, got %v", fake.calls)
+	}
+}
+
+func TestReferencedSettings(t *testing.T) {
+	content := `<TrustFrameworkPolicy PolicyId="B2C_1A_TEST"><Item>{Settings:Tenant}</Item></TrustFrameworkPolicy>`
+	referenced, unused := referencedSettings(content, map[string]types.String{
+		"tenant":  types.StringValue("contoso"),
+		"unused":  types.StringUnknown(),
+		"another": types.StringValue("x"),
+	})
+	if len(referenced) != 1 || referenced["tenant"].ValueString() != "contoso" {
+		t.Errorf("referenced = %v, want only tenant", referenced)
+	}
+	if strings.Join(unused, ",") != "another,unused" {
+		t.Errorf("unused = %v, want [another unused]", unused)
+	}
+}
+
+func TestPolicyValidateConfigUnusedSettings(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.xml")
+	policy := `<TrustFrameworkPolicy PolicyId="B2C_1A_UnusedSettings"><Item>{settings:tenant}</Item></TrustFrameworkPolicy>`
+	if err := os.WriteFile(file, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &PolicyResource{}
+	state := testResourceState(t, r, map[string]tftypes.Value{
+		"file":    tftypes.NewValue(tftypes.String, file),
+		"publish": tftypes.NewValue(tftypes.Bool, false),
+		"app_settings": tftypes.NewValue(tftypes.Map{ElementType: tftypes.String}, map[string]tftypes.Value{
+			"tenant": tftypes.NewValue(tftypes.String, "contoso"),
+			"tenat":  tftypes.NewValue(tftypes.String, "contoso"),
+		}),
+	})
+	resp := &fwresource.ValidateConfigResponse{}
+	r.ValidateConfig(context.Background(), fwresource.ValidateConfigRequest{
+		Config: tfsdk.Config{Schema: state.Schema, Raw: state.Raw},
+	}, resp)
+	if resp.Diagnostics.WarningsCount() != 1 || !strings.Contains(resp.Diagnostics[0].Detail(), "tenat") {
+		t.Errorf("expected one warning naming tenat, got %v", resp.Diagnostics)
+	}
+}
+
+func TestPolicyUnreferencedSettingChange(t *testing.T) {
+	policy := `<TrustFrameworkPolicy PolicyId="B2C_1A_TEST"><Item>{settings:tenant}</Item></TrustFrameworkPolicy>`
+	rendered := `<TrustFrameworkPolicy PolicyId="B2C_1A_TEST"><Item>contoso</Item></TrustFrameworkPolicy>`
+	file := filepath.Join(t.TempDir(), "policy.xml")
+	if err := os.WriteFile(file, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	settings := func(tenant, unused tftypes.Value) tftypes.Value {
+		return tftypes.NewValue(tftypes.Map{ElementType: tftypes.String}, map[string]tftypes.Value{
+			"tenant": tenant,
+			"unused": unused,
+		})
+	}
+
+	tests := []struct {
+		name       string
+		settings   tftypes.Value
+		wantUpload bool
+	}{
+		{name: "unreferenced setting changed", settings: settings(tftypes.NewValue(tftypes.String, "contoso"), tftypes.NewValue(tftypes.String, "new"))},
+		{name: "referenced setting changed", settings: settings(tftypes.NewValue(tftypes.String, "fabrikam"), tftypes.NewValue(tftypes.String, "old")), wantUpload: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGraph{responses: map[string]fakeResponse{
+				"PUT /trustFramework/policies/B2C_1A_TEST/$value": {http.StatusOK, ""},
+			}}
+			r := &PolicyResource{client: newFakeGraphClient(fake)}
+			state := testResourceState(t, r, map[string]tftypes.Value{
+				"id":               tftypes.NewValue(tftypes.String, "B2C_1A_TEST"),
+				"xml":              tftypes.NewValue(tftypes.String, rendered),
+				"xml_sha256":       tftypes.NewValue(tftypes.String, xmlChecksum(rendered)),
+				"file":             tftypes.NewValue(tftypes.String, file),
+				"publish":          tftypes.NewValue(tftypes.Bool, true),
+				"is_published":     tftypes.NewValue(tftypes.Bool, true),
+				"last_http_status": tftypes.NewValue(tftypes.Number, 201),
+				"app_settings":     settings(tftypes.NewValue(tftypes.String, "contoso"), tftypes.NewValue(tftypes.String, "old")),
+			})
+			config := testResourceState(t, r, map[string]tftypes.Value{
+				"id":           tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+				"xml":          tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+				"xml_sha256":   tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+				"file":         tftypes.NewValue(tftypes.String, file),
+				"publish":      tftypes.NewValue(tftypes.Bool, true),
+				"app_settings": tt.settings,
+			})
+			plan := tfsdk.Plan{Schema: config.Schema, Raw: config.Raw}
+
+			planResp := &fwresource.ModifyPlanResponse{Plan: plan}
+			r.ModifyPlan(context.Background(), fwresource.ModifyPlanRequest{State: state, Plan: plan}, planResp)
+			if planResp.Diagnostics.HasError() {
+				t.Fatalf("ModifyPlan() unexpected error: %v", planResp.Diagnostics)
+			}
+			var plannedSha types.String
+			planResp.Plan.GetAttribute(context.Background(), path.Root("xml_sha256"), &plannedSha)
+			if plannedSha.IsUnknown() != tt.wantUpload {
+				t.Errorf("planned xml_sha256 = %s, want unknown %v", plannedSha, tt.wantUpload)
+			}
+
+			updateResp := &fwresource.UpdateResponse{State: state}
+			r.Update(context.Background(), fwresource.UpdateRequest{
+				Config: tfsdk.Config{Schema: config.Schema, Raw: config.Raw},
+				Plan:   planResp.Plan,
+				State:  state,
+			}, updateResp)
+			if updateResp.Diagnostics.HasError() {
+				t.Fatalf("Update() unexpected error: %v", updateResp.Diagnostics)
+			}
+			if uploaded := len(fake.calls) > 0; uploaded != tt.wantUpload {
+				t.Errorf("uploaded = %v, want %v: %v", uploaded, tt.wantUpload, fake.calls)
+			}
+			var status types.Int64
+			updateResp.State.GetAttribute(context.Background(), path.Root("last_http_status"), &status)
+			if !tt.wantUpload && status.ValueInt64() != 201 {
+				t.Errorf("last_http_status = %s, want 201 kept from state", status)
+			}
+		})
+	}
+}
+
+// TestPolicyKeyRotationRepublishes rotates a generated key and checks a
+// policy whose triggers reference the key's active_kid is uploaded again,
+// though its rendered XML does not change
+func TestPolicyKeyRotationRepublishes(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeGraph{responses: map[string]fakeResponse{
+		"POST /trustFramework/keySets/B2C_1A_Signing/generateKey": {http.StatusOK, `{"kid":"signing-2026","use":"sig","kty":"RSA"}`},
+		"GET /trustFramework/keySets/B2C_1A_Signing/getActiveKey": {http.StatusOK, `{"kid":"signing-2026","use":"sig","kty":"RSA"}`},
+		"PUT /trustFramework/policies/B2C_1A_TEST/$value":         {http.StatusOK, ""},
+	}}
+	client := newFakeGraphClient(fake)
+
+	// Rotate the key by changing its key_id
+	key := &PolicyKeyResource{client: client}
+	priorKey := PolicyKeyModel{
+		ID:        types.StringValue("B2C_1A_Signing"),
+		Name:      types.StringValue("B2C_1A_Signing"),
+		Usage:     types.StringValue("sig"),
+		Generate:  &PolicyKeyGenerate{Type: types.StringValue("RSA"), KeyId: types.StringValue("signing-2025")},
+		Kid:       types.StringValue("signing-2025"),
+		ActiveKid: types.StringValue("signing-2025"),
+	}
+	keyState := testResourceState(t, key, nil)
+	if diags := keyState.Set(ctx, &priorKey); diags.HasError() {
+		t.Fatalf("setting key state: %v", diags)
+	}
+	keyConfig := priorKey
+	keyConfig.Generate = &PolicyKeyGenerate{Type: types.StringValue("RSA"), KeyId: types.StringValue("signing-2026")}
+	keyConfig.Kid = types.StringUnknown()
+	keyConfig.ActiveKid = types.StringUnknown()
+	keyPlan := testResourceState(t, key, nil)
+	if diags := keyPlan.Set(ctx, &keyConfig); diags.HasError() {
+		t.Fatalf("setting key config: %v", diags)
+	}
+	keyResp := &fwresource.UpdateResponse{State: keyState}
+	key.Update(ctx, fwresource.UpdateRequest{
+		Config: tfsdk.Config{Schema: keyPlan.Schema, Raw: keyPlan.Raw},
+		Plan:   tfsdk.Plan{Schema: keyPlan.Schema, Raw: keyPlan.Raw},
+		State:  keyState,
+	}, keyResp)
+	if keyResp.Diagnostics.HasError() {
+		t.Fatalf("key Update() unexpected error: %v", keyResp.Diagnostics)
+	}
+	var activeKid types.String
+	keyResp.State.GetAttribute(ctx, path.Root("active_kid"), &activeKid)
+	if activeKid.ValueString() != "signing-2026" {
+		t.Fatalf("active_kid = %s, want signing-2026", activeKid)
+	}
+
+	// The policy references active_kid in its triggers
+	rendered := `<TrustFrameworkPolicy PolicyId="B2C_1A_TEST"></TrustFrameworkPolicy>`
+	file := filepath.Join(t.TempDir(), "policy.xml")
+	if err := os.WriteFile(file, []byte(rendered), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	triggers := func(kid tftypes.Value) tftypes.Value {
+		return tftypes.NewValue(tftypes.Map{ElementType: tftypes.String}, map[string]tftypes.Value{"signing_kid": kid})
+	}
+	policy := &PolicyResource{client: client}
+	state := testResourceState(t, policy, map[string]tftypes.Value{
+		"id":               tftypes.NewValue(tftypes.String, "B2C_1A_TEST"),
+		"xml":              tftypes.NewValue(tftypes.String, rendered),
+		"xml_sha256":       tftypes.NewValue(tftypes.String, xmlChecksum(rendered)),
+		"file":             tftypes.NewValue(tftypes.String, file),
+		"publish":          tftypes.NewValue(tftypes.Bool, true),
+		"is_published":     tftypes.NewValue(tftypes.Bool, true),
+		"last_http_status": tftypes.NewValue(tftypes.Number, 201),
+		"triggers":         triggers(tftypes.NewValue(tftypes.String, "signing-2025")),
+	})
+	policyConfig := func(kid tftypes.Value) tfsdk.State {
+		return testResourceState(t, policy, map[string]tftypes.Value{
+			"id":         tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+			"xml":        tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+			"xml_sha256": tftypes.NewValue(tftypes.String, tftypes.UnknownValue),
+			"file":       tftypes.NewValue(tftypes.String, file),
+			"publish":    tftypes.NewValue(tftypes.Bool, true),
+			"triggers":   triggers(kid),
+		})
+	}
+
+	// At plan time the new kid is not known yet
+	planned := policyConfig(tftypes.NewValue(tftypes.String, tftypes.UnknownValue))
+	plan := tfsdk.Plan{Schema: planned.Schema, Raw: planned.Raw}
+	planResp := &fwresource.ModifyPlanResponse{Plan: plan}
+	policy.ModifyPlan(ctx, fwresource.ModifyPlanRequest{State: state, Plan: plan}, planResp)
+	if planResp.Diagnostics.HasError() {
+		t.Fatalf("ModifyPlan() unexpected error: %v", planResp.Diagnostics)
+	}
+	var plannedSha types.String
+	planResp.Plan.GetAttribute(ctx, path.Root("xml_sha256"), &plannedSha)
+	if !plannedSha.IsUnknown() {
+		t.Errorf("planned xml_sha256 = %s, want unknown until the policy is uploaded again", plannedSha)
+	}
+
+	config := policyConfig(tftypes.NewValue(tftypes.String, activeKid.ValueString()))
+	updateResp := &fwresource.UpdateResponse{State: state}
+	policy.Update(ctx, fwresource.UpdateRequest{
+		Config: tfsdk.Config{Schema: config.Schema, Raw: config.Raw},
+		Plan:   tfsdk.Plan{Schema: config.Schema, Raw: config.Raw},
+		State:  state,
+	}, updateResp)
+	if updateResp.Diagnostics.HasError() {
+		t.Fatalf("policy Update() unexpected error: %v", updateResp.Diagnostics)
+	}
+	var uploaded bool
+	for _, call := range fake.calls {
+		uploaded = uploaded || call == "PUT /trustFramework/policies/B2C_1A_TEST/$value"
+	}
+	if !uploaded {
+		t.Errorf("policy was not uploaded again after the key rotated: %v", fake.calls)
+	}
+}
+
+// TestPolicyBaseAndExtension creates a base and an extension policy the way
+// Terraform orders them when the extension references the base's id, and
+// checks the extension reports the base it builds on
+func TestPolicyBaseAndExtension(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	fake := &fakeGraph{responses: map[string]fakeResponse{
+		"PUT /trustFramework/policies/B2C_1A_Base/$value":       {http.StatusCreated, ""},
+		"PUT /trustFramework/policies/B2C_1A_Extensions/$value": {http.StatusCreated, ""},
+	}}
+	r := &PolicyResource{client: newFakeGraphClient(fake)}
+
+	create := func(name, policyXml string, triggers tftypes.Value) IEFPolicyModel {
+		t.Helper()
+		file := filepath.Join(dir, name+".xml")
+		if err := os.WriteFile(file, []byte(policyXml), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		config := testResourceState(t, r, map[string]tftypes.Value{
+			"file":     tftypes.NewValue(tftypes.String, file),
+			"publish":  tftypes.NewValue(tftypes.Bool, true),
+			"triggers": triggers,
+		})
+		resp := &fwresource.CreateResponse{State: testResourceState(t, r, nil)}
+		r.Create(ctx, fwresource.CreateRequest{
+			Config: tfsdk.Config{Schema: config.Schema, Raw: config.Raw},
+			Plan:   tfsdk.Plan{Schema: config.Schema, Raw: config.Raw},
+		}, resp)
+		if resp.Diagnostics.HasError() {
+			t.Fatalf("Create(%s) unexpected error: %v", name, resp.Diagnostics)
+		}
+		var data IEFPolicyModel
+		resp.State.Get(ctx, &data)
+		return data
+	}
+
+	triggersType := tftypes.Map{ElementType: tftypes.String}
+	base := create("base", testPolicyXml("B2C_1A_Base", ""), tftypes.NewValue(triggersType, nil))
+	if !base.BasePolicyId.IsNull() {
+		t.Errorf("base policy base_policy_id = %s, want null", base.BasePolicyId)
+	}
+	extension := create("extensions", testPolicyXml("B2C_1A_Extensions", "B2C_1A_Base"), tftypes.NewValue(triggersType, map[string]tftypes.Value{
+		"base": tftypes.NewValue(tftypes.String, base.ID.ValueString()),
+	}))
+	if extension.BasePolicyId.ValueString() != base.ID.ValueString() {
+		t.Errorf("extension base_policy_id = %s, want the base id %s", extension.BasePolicyId, base.ID)
+	}
+
+	want := []string{
+		"PUT /trustFramework/policies/B2C_1A_Base/$value",
+		"PUT /trustFramework/policies/B2C_1A_Extensions/$value",
+	}
+	if !slices.Equal(fake.calls, want) {
+		t.Errorf("Graph calls = %v, want %v", fake.calls, want)
+	}
+}
+
+func TestPolicyCreateWithoutPolicyId(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.xml")
+	if err := os.WriteFile(file, []byte(`<TrustFrameworkPolicy TenantId="yourtenant.onmicrosoft.com"/>`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeGraph{}
+	r := &PolicyResource{client: newFakeGraphClient(fake)}
+	config := testResourceState(t, r, map[string]tftypes.Value{
+		"file":    tftypes.NewValue(tftypes.String, file),
+		"publish": tftypes.NewValue(tftypes.Bool, true),
+	})
+
+	resp := &fwresource.CreateResponse{State: testResourceState(t, r, nil)}
+	r.Create(context.Background(), fwresource.CreateRequest{
+		Config: tfsdk.Config{Schema: config.Schema, Raw: config.Raw},
+		Plan:   tfsdk.Plan{Schema: config.Schema, Raw: config.Raw},
+	}, resp)
+	if !resp.Diagnostics.HasError() || resp.Diagnostics.Errors()[0].Summary() != "Missing PolicyId" {
+		t.Fatalf("Create() diagnostics = %v, want a Missing PolicyId error", resp.Diagnostics)
+	}
+	if !strings.Contains(resp.Diagnostics.Errors()[0].Detail(), file) {
+		t.Errorf("error does not name the policy file: %s", resp.Diagnostics.Errors()[0].Detail())
+	}
+	if len(fake.calls) != 0 {
+		t.Errorf("expected no Graph calls, got %v", fake.calls)
+	}
+}
+
+func TestPolicyCachedFileContent(t *testing.T) {
+	policy := `<TrustFrameworkPolicy PolicyId="B2C_1A_TEST"><Item>{settings:tenant}</Item></TrustFrameworkPolicy>`
+	tenant := func(v string) tftypes.Value {
+		return tftypes.NewValue(tftypes.Map{ElementType: tftypes.String}, map[string]tftypes.Value{
+			"tenant": tftypes.NewValue(tftypes.String, v),
+		})
+	}
+
+	tests := []struct {
+		name        string
+		onDisk      string
+		wantWarning string
+		wantItem    string
+	}{
+		{name: "file missing", wantWarning: "Using cached policy file", wantItem: "<Item>fabrikam</Item>"},
+		{name: "file changed", onDisk: strings.Replace(policy, "Item", "Other", 2), wantWarning: "Policy file changed", wantItem: "<Other>fabrikam</Other>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "policy.xml")
+			if tt.onDisk != "" {
+				if err := os.WriteFile(file, []byte(tt.onDisk), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			fake := &fakeGraph{responses: map[string]fakeResponse{
+				"PUT /trustFramework/policies/B2C_1A_TEST/$value": {http.StatusOK, ""},
+			}}
+			r := &PolicyResource{client: newFakeGraphClient(fake)}
+			rendered := strings.Replace(policy, "{settings:tenant}", "contoso", 1)
+			state := testResourceState(t, r, map[string]tftypes.Value{
+				"id":               tftypes.NewValue(tftypes.String, "B2C_1A_TEST"),
+				"xml":              tftypes.NewValue(tftypes.String, rendered),
+				"xml_sha256":       tftypes.NewValue(tftypes.String, xmlChecksum(rendered)),
+				"file_content":     tftypes.NewValue(tftypes.String, policy),
+				"file_sha256":      tftypes.NewValue(tftypes.String, xmlChecksum(policy)),
+				"file":             tftypes.NewValue(tftypes.String, file),
+				"publish":          tftypes.NewValue(tftypes.Bool, true),
+				"is_published":     tftypes.NewValue(tftypes.Bool, true),
+				"last_http_status": tftypes.NewValue(tftypes.Number, 201),
+				"app_settings":     tenant("contoso"),
+			})
+			config := testResourceState(t, r, map[string]tftypes.Value{
+				"file":         tftypes.NewValue(tftypes.String, file),
+				"publish":      tftypes.NewValue(tftypes.Bool, true),
+				"app_settings": tenant("fabrikam"),
+			})
+
+			resp := &fwresource.UpdateResponse{State: state}
+			r.Update(context.Background(), fwresource.UpdateRequest{
+				Config: tfsdk.Config{Schema: config.Schema, Raw: config.Raw},
+				Plan:   tfsdk.Plan{Schema: config.Schema, Raw: config.Raw},
+				State:  state,
+			}, resp)
+			if resp.Diagnostics.HasError() {
+				t.Fatalf("Update() unexpected error: %v", resp.Diagnostics)
+			}
+			if len(resp.Diagnostics) != 1 || resp.Diagnostics[0].Summary() != tt.wantWarning {
+				t.Errorf("diagnostics = %v, want a %q warning", resp.Diagnostics, tt.wantWarning)
+			}
+			if len(fake.calls) != 1 {
+				t.Errorf("Expected the policy to be uploaded, got %v", fake.calls)
+			}
+			var xml types.String
+			resp.State.GetAttribute(context.Background(), path.Root("xml"), &xml)
+			if !strings.Contains(xml.ValueString(), tt.wantItem) {
+				t.Errorf("xml = %s, want it to contain %s", xml, tt.wantItem)
+			}
+		})
+	}
+
+	t.Run("no cache", func(t *testing.T) {
+		r := &PolicyResource{client: newFakeGraphClient(&fakeGraph{})}
+		file := filepath.Join(t.TempDir(), "policy.xml")
+		state := testResourceState(t, r, map[string]tftypes.Value{
+			"file":    tftypes.NewValue(tftypes.String, file),
+			"publish": tftypes.NewValue(tftypes.Bool, true),
+		})
+		resp := &fwresource.ReadResponse{State: state}
+		r.Read(context.Background(), fwresource.ReadRequest{State: state}, resp)
+		if !resp.Diagnostics.HasError() {
+			t.Errorf("Read() expected an error for a missing file without cached content")
+		}
+	})
+}
+
+func TestPolicyDeleteWithoutId(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "policy.xml")
+	if err := os.WriteFile(file, []byte(`<TrustFrameworkPolicy PolicyId="B2C_1A_{settings:suffix}"/>`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		file      string
+		wantCalls []string
+		wantWarn  bool
+	}{
+		{name: "resolved from file", file: file, wantCalls: []string{"DELETE /trustFramework/policies/B2C_1A_TEST"}},
+		{name: "file missing", file: filepath.Join(dir, "missing.xml"), wantWarn: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGraph{responses: map[string]fakeResponse{
+				"DELETE /trustFramework/policies/B2C_1A_TEST": {http.StatusNoContent, ``},
+			}}
+			r := &PolicyResource{client: newFakeGraphClient(fake)}
+			state := testResourceState(t, r, map[string]tftypes.Value{
+				"file":    tftypes.NewValue(tftypes.String, tt.file),
+				"publish": tftypes.NewValue(tftypes.Bool, true),
+				"app_settings": tftypes.NewValue(tftypes.Map{ElementType: tftypes.String}, map[string]tftypes.Value{
+					"suffix": tftypes.NewValue(tftypes.String, "TEST"),
+				}),
+			})
+			resp := &fwresource.DeleteResponse{State: state}
+			r.Delete(context.Background(), fwresource.DeleteRequest{State: state}, resp)
+
+			if resp.Diagnostics.HasError() {
+				t.Fatalf("Delete() unexpected error: %v", resp.Diagnostics)
+			}
+			if got := resp.Diagnostics.WarningsCount() > 0; got != tt.wantWarn {
+				t.Errorf("warned = %v, want %v: %v", got, tt.wantWarn, resp.Diagnostics)
+			}
+			if strings.Join(fake.calls, ",") != strings.Join(tt.wantCalls, ",") {
+				t.Errorf("calls = %v, want %v", fake.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestPutPolicyReturnedPolicy(t *testing.T) {
+	policy := `<TrustFrameworkPolicy PolicyId="B2C_1A_TEST"/>`
+	tests := []struct {
+		name         string
+		prefer       string
+		response     fakeResponse
+		wantReturned bool
+	}{
+		{name: "no prefer header", response: fakeResponse{http.StatusCreated, policy}},
+		{name: "representation returned", prefer: "return=representation", response: fakeResponse{http.StatusCreated, policy}, wantReturned: true},
+		{name: "representation not returned", prefer: "return=representation", response: fakeResponse{http.StatusNoContent, ``}},
+		{name: "other policy returned", prefer: "return=representation", response: fakeResponse{http.StatusCreated, `<TrustFrameworkPolicy PolicyId="B2C_1A_OTHER"/>`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGraph{responses: map[string]fakeResponse{
+				"PUT /trustFramework/policies/B2C_1A_TEST/$value": tt.response,
+			}}
+			client := newFakeGraphClient(fake)
+			client.uploadPrefer = tt.prefer
+			r := &PolicyResource{client: client}
+			_, returned, err := r.putPolicy(context.Background(), policy)
+			if err != nil {
+				t.Fatalf("putPolicy() unexpected error: %v", err)
+			}
+			if returned != tt.wantReturned {
+				t.Errorf("returned = %v, want %v", returned, tt.wantReturned)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package provider
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// maxSchemaViolations caps how many violations validateAgainstSchema reports
+const maxSchemaViolations = 20
+
+// xsdNode is a generic element of an XML schema document
+type xsdNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Children []xsdNode  `xml:",any"`
+}
+
+func (n xsdNode) attr(name string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// xsdSchema holds the named top-level declarations of a schema
+type xsdSchema struct {
+	elements        map[string]xsdNode
+	types           map[string]xsdNode
+	groups          map[string]xsdNode
+	attributeGroups map[string]xsdNode
+}
+
+// xsdContent is what an element of a given type may contain
+type xsdContent struct {
+	children     map[string]xsdNode
+	attributes   map[string]bool // true when required
+	anyElement   bool
+	anyAttribute bool
+}
+
+// localName strips the namespace prefix from a QName such as xs:string
+func localName(qname string) string {
+	if i := strings.LastIndex(qname, ":"); i >= 0 {
+		return qname[i+1:]
+	}
+	return qname
+}
+
+func loadSchema(p string) (*xsdSchema, error) {
+	raw, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read schema %s: %s", p, err)
+	}
+	var root xsdNode
+	if err := xml.Unmarshal(raw, &root); err != nil {
+		return nil, fmt.Errorf("Unable to parse schema %s: %s", p, err)
+	}
+	if root.XMLName.Local != "schema" {
+		return nil, fmt.Errorf("%s is not an XML schema, its root element is %s", p, root.XMLName.Local)
+	}
+
+	s := &xsdSchema{
+		elements:        map[string]xsdNode{},
+		types:           map[string]xsdNode{},
+		groups:          map[string]xsdNode{},
+		attributeGroups: map[string]xsdNode{},
+	}
+	for _, n := range root.Children {
+		name := n.attr("name")
+		switch n.XMLName.Local {
+		case "element":
+			s.elements[name] = n
+		case "complexType", "simpleType":
+			s.types[name] = n
+		case "group":
+			s.groups[name] = n
+		case "attributeGroup":
+			s.attributeGroups[name] = n
+		}
+	}
+	return s, nil
+}
+
+// elementContent resolves what the declared element may contain. Types the
+// schema does not declare, such as xs:string, allow no child elements.
+func (s *xsdSchema) elementContent(decl xsdNode) xsdContent {
+	if ref := decl.attr("ref"); ref != "" {
+		if global, ok := s.elements[localName(ref)]; ok {
+			decl = global
+		}
+	}
+	content := xsdContent{children: map[string]xsdNode{}, attributes: map[string]bool{}}
+	if typeName := decl.attr("type"); typeName != "" {
+		if t, ok := s.types[localName(typeName)]; ok {
+			s.collect(t, &content, map[string]bool{})
+		} else if localName(typeName) == "anyType" {
+			content.anyElement, content.anyAttribute = true, true
+		}
+		return content
+	}
+	for _, c := range decl.Children {
+		switch c.XMLName.Local {
+		case "complexType", "simpleType":
+			s.collect(c, &content, map[string]bool{})
+			return content
+		}
+	}
+	// No type at all is xs:anyType
+	content.anyElement, content.anyAttribute = true, true
+	return content
+}
+
+// collect adds the element and attribute declarations under n to content,
+// following extension bases and group references
+func (s *xsdSchema) collect(n xsdNode, content *xsdContent, seen map[string]bool) {
+	for _, c := range n.Children {
+		switch c.XMLName.Local {
+		case "element":
+			name := c.attr("name")
+			if name == "" {
+				name = localName(c.attr("ref"))
+			}
+			content.children[name] = c
+		case "any":
+			content.anyElement = true
+		case "anyAttribute":
+			content.anyAttribute = true
+		case "attribute":
+			name := c.attr("name")
+			if name == "" {
+				name = localName(c.attr("ref"))
+			}
+			content.attributes[name] = c.attr("use") == "required"
+		case "group", "attributeGroup":
+			ref := localName(c.attr("ref"))
+			key := c.XMLName.Local + ":" + ref
+			if ref == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			defs := s.groups
+			if c.XMLName.Local == "attributeGroup" {
+				defs = s.attributeGroups
+			}
+			if def, ok := defs[ref]; ok {
+				s.collect(def, content, seen)
+			}
+		case "extension", "restriction":
+			base := localName(c.attr("base"))
+			if t, ok := s.types[base]; ok && !seen["type:"+base] {
+				seen["type:"+base] = true
+				s.collect(t, content, seen)
+			}
+			s.collect(c, content, seen)
+		case "sequence", "choice", "all", "complexContent", "simpleContent":
+			s.collect(c, content, seen)
+		}
+	}
+}
+
+// validateAgainstSchema checks policyXml against the XML schema at xsdPath.
+// Only element names, nesting and attributes are checked; element order,
+// occurrence counts and value types are not.
+func validateAgainstSchema(policyXml string, xsdPath string) error {
+	s, err := loadSchema(xsdPath)
+	if err != nil {
+		return err
+	}
+
+	var violations []string
+	report := func(line, column int, format string, args ...any) {
+		violations = append(violations, fmt.Sprintf("line %d, column %d: %s", line, column, fmt.Sprintf(format, args...)))
+	}
+
+	decoder := xml.NewDecoder(strings.NewReader(policyXml))
+	// nil entries are elements whose content is not checked
+	var stack []*xsdContent
+	for len(violations) < maxSchemaViolations {
+		line, column := decoder.InputPos()
+		tok, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Unable to parse policy XML: %s", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name := t.Name.Local
+			var decl xsdNode
+			var declared bool
+			if len(stack) == 0 {
+				decl, declared = s.elements[name]
+				if !declared {
+					report(line, column, "root element %s is not declared in the schema", name)
+				}
+			} else if parent := stack[len(stack)-1]; parent != nil {
+				decl, declared = parent.children[name]
+				if !declared && !parent.anyElement {
+					report(line, column, "element %s is not allowed here", name)
+				}
+			}
+			if !declared {
+				stack = append(stack, nil)
+				continue
+			}
+
+			content := s.elementContent(decl)
+			present := make(map[string]bool, len(t.Attr))
+			for _, a := range t.Attr {
+				// Namespace declarations and attributes such as xsi:type
+				// belong to other schemas
+				if a.Name.Space != "" || a.Name.Local == "xmlns" {
+					continue
+				}
+				present[a.Name.Local] = true
+				if _, ok := content.attributes[a.Name.Local]; !ok && !content.anyAttribute {
+					report(line, column, "attribute %s is not allowed on element %s", a.Name.Local, name)
+				}
+			}
+			var missing []string
+			for attrName, required := range content.attributes {
+				if required && !present[attrName] {
+					missing = append(missing, attrName)
+				}
+			}
+			sort.Strings(missing)
+			for _, attrName := range missing {
+				report(line, column, "element %s is missing required attribute %s", name, attrName)
+			}
+			stack = append(stack, &content)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	if len(violations) > 0 {
+		return fmt.Errorf("Policy does not match schema %s:\n%s", xsdPath, strings.Join(violations, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testPolicySchema = `<?xml version="1.0" encoding="utf-8"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+  <xs:element name="TrustFrameworkPolicy" type="TrustFrameworkPolicyType"/>
+  <xs:complexType name="TrustFrameworkPolicyType">
+    <xs:sequence>
+      <xs:element name="BasePolicy" type="BasePolicyType" minOccurs="0"/>
+      <xs:element name="ClaimsProviders" minOccurs="0">
+        <xs:complexType>
+          <xs:sequence>
+            <xs:element name="ClaimsProvider" type="ClaimsProviderType" maxOccurs="unbounded"/>
+          </xs:sequence>
+        </xs:complexType>
+      </xs:element>
+    </xs:sequence>
+    <xs:attributeGroup ref="PolicyAttributes"/>
+  </xs:complexType>
+  <xs:attributeGroup name="PolicyAttributes">
+    <xs:attribute name="PolicyId" type="xs:string" use="required"/>
+    <xs:attribute name="TenantId" type="xs:string"/>
+  </xs:attributeGroup>
+  <xs:complexType name="BasePolicyType">
+    <xs:sequence>
+      <xs:element name="TenantId" type="xs:string"/>
+      <xs:element name="PolicyId" type="xs:string"/>
+    </xs:sequence>
+  </xs:complexType>
+  <xs:complexType name="ProviderType">
+    <xs:sequence>
+      <xs:element name="DisplayName" type="xs:string"/>
+    </xs:sequence>
+  </xs:complexType>
+  <xs:complexType name="ClaimsProviderType">
+    <xs:complexContent>
+      <xs:extension base="ProviderType">
+        <xs:sequence>
+          <xs:element name="Metadata">
+            <xs:complexType>
+              <xs:sequence><xs:any processContents="skip"/></xs:sequence>
+            </xs:complexType>
+          </xs:element>
+        </xs:sequence>
+      </xs:extension>
+    </xs:complexContent>
+  </xs:complexType>
+</xs:schema>`
+
+func TestValidateAgainstSchema(t *testing.T) {
+	xsdPath := filepath.Join(t.TempDir(), "policy.xsd")
+	if err := os.WriteFile(xsdPath, []byte(testPolicySchema), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		xml     string
+		wantErr []string
+	}{
+		{
+			name: "valid",
+			xml: `<TrustFrameworkPolicy xmlns="http://schemas.microsoft.com/online/cpim/schemas/2013/06" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" PolicyId="B2C_1A_Test">
+  <BasePolicy><TenantId>contoso</TenantId><PolicyId>B2C_1A_Base</PolicyId></BasePolicy>
+  <ClaimsProviders>
+    <ClaimsProvider><DisplayName>Local</DisplayName><Metadata><Item Key="k">v</Item></Metadata></ClaimsProvider>
+  </ClaimsProviders>
+</TrustFrameworkPolicy>`,
+		},
+		{
+			name: "unknown element",
+			xml: `<TrustFrameworkPolicy PolicyId="B2C_1A_Test">
+  <ClaimsProviders>
+    <ClaimProvider/>
+  </ClaimsProviders>
+</TrustFrameworkPolicy>`,
+			wantErr: []string{"line 3, column 5: element ClaimProvider is not allowed here"},
+		},
+		{
+			name:    "missing required attribute",
+			xml:     `<TrustFrameworkPolicy TenantId="contoso"/>`,
+			wantErr: []string{"line 1, column 1: element TrustFrameworkPolicy is missing required attribute PolicyId"},
+		},
+		{
+			name:    "unknown attribute",
+			xml:     `<TrustFrameworkPolicy PolicyId="B2C_1A_Test" Tenant="contoso"/>`,
+			wantErr: []string{"attribute Tenant is not allowed on element TrustFrameworkPolicy"},
+		},
+		{
+			name:    "wrong root",
+			xml:     `<Policy PolicyId="B2C_1A_Test"/>`,
+			wantErr: []string{"root element Policy is not declared in the schema"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAgainstSchema(tt.xml, xsdPath)
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("validateAgainstSchema() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("validateAgainstSchema() expected an error")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("validateAgainstSchema() = %v, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+
+	if err := validateAgainstSchema(`<TrustFrameworkPolicy PolicyId="B2C_1A_Test"/>`, filepath.Join(t.TempDir(), "missing.xsd")); err == nil {
+		t.Errorf("validateAgainstSchema() expected an error for a missing schema")
+	}
+}